@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// activityKind — вид активности с таймером: ID хранится в activity_sessions.kind, Label показывается в отчетах,
+// Title — на кнопках. DefaultGoalMinutes — дневная цель, пока семья не задала свою через /goal.
+type activityKind struct {
+	ID                 string
+	Label              string
+	Title              string
+	DefaultGoalMinutes int
+}
+
+var activityKinds = []activityKind{
+	{ID: "tummy", Label: "животик", Title: "Животик", DefaultGoalMinutes: 30},
+	{ID: "walk", Label: "прогулка", Title: "Прогулка"},
+	{ID: "play", Label: "игра", Title: "Игра"},
+}
+
+// Максимальная дневная цель, минут.
+const activityGoalMaxMinutes = 600
+
+func lookupActivityKind(id string) (activityKind, bool) {
+	for _, kind := range activityKinds {
+		if kind.ID == id {
+			return kind, true
+		}
+	}
+	return activityKind{}, false
+}
+
+// resolveActivityKind находит вид по ID или подписи: `tummy`, `животик`, `Прогулка`.
+func resolveActivityKind(raw string) (activityKind, bool) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	for _, kind := range activityKinds {
+		if raw == kind.ID || raw == kind.Label {
+			return kind, true
+		}
+	}
+	return activityKind{}, false
+}
+
+func activityKindLabels() string {
+	labels := make([]string, 0, len(activityKinds))
+	for _, kind := range activityKinds {
+		labels = append(labels, kind.Label)
+	}
+	return strings.Join(labels, ", ")
+}
+
+// activityGoal — дневная цель в минутах (0 — без цели) с учетом настроек семьи.
+func activityGoal(goals map[string]int, kind activityKind) int {
+	if minutes, ok := goals[kind.ID]; ok {
+		return minutes
+	}
+	return kind.DefaultGoalMinutes
+}
+
+// activityTimeBetween — суммарное время активностей вида kind внутри [from, to); идущая считается до now.
+func activityTimeBetween(activities []ActivitySession, kind string, from time.Time, to time.Time, now time.Time) time.Duration {
+	var total time.Duration
+	for _, activity := range activities {
+		if activity.Kind != kind {
+			continue
+		}
+		end := now
+		if activity.EndAt != nil {
+			end = *activity.EndAt
+		}
+		start := maxTime(activity.StartAt, from)
+		end = minTime(end, to)
+		if end.After(start) {
+			total += end.Sub(start)
+		}
+	}
+	return total
+}
+
+func formatActivityProgress(done time.Duration, goalMinutes int) string {
+	if goalMinutes <= 0 {
+		return formatDurationRU(done)
+	}
+	goal := time.Duration(goalMinutes) * time.Minute
+	if done >= goal {
+		return fmt.Sprintf("%s, цель %s выполнена ✓", formatDurationRU(done), formatDurationRU(goal))
+	}
+	return fmt.Sprintf("%s из %s (%d%%)", formatDurationRU(done), formatDurationRU(goal), int(done*100/goal))
+}
+
+// activeActivity возвращает идущую активность вида kind или nil.
+func activeActivity(activities []ActivitySession, kind string) *ActivitySession {
+	for i := range activities {
+		if activities[i].Kind == kind && activities[i].EndAt == nil {
+			return &activities[i]
+		}
+	}
+	return nil
+}
+
+// BuildActivitiesPanel — текст сообщения с кнопками старта/остановки: что идет сейчас и прогресс за сегодня.
+func BuildActivitiesPanel(activities []ActivitySession, goals map[string]int, now time.Time, loc *time.Location) string {
+	dayStart := startOfDay(now, loc)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+	lines := []string{"Активности за сегодня:"}
+	for _, kind := range activityKinds {
+		line := fmt.Sprintf("%s — %s", kind.Title, formatActivityProgress(activityTimeBetween(activities, kind.ID, dayStart, dayEnd, now), activityGoal(goals, kind)))
+		if running := activeActivity(activities, kind.ID); running != nil {
+			line += fmt.Sprintf("; идет с %s", running.StartAt.In(loc).Format("15:04"))
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", "Кнопки запускают и останавливают таймер. Задним числом: `/tummy 15` (минут); цели: `/goal животик 30`.")
+	return strings.Join(lines, "\n")
+}
+
+// BuildActivityDaySection — время активностей за день с прогрессом по целям (пусто, если активностей не было).
+func BuildActivityDaySection(activities []ActivitySession, goals map[string]int, day time.Time, now time.Time, loc *time.Location) string {
+	dayStart := startOfDay(day, loc)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+	if !hasActivitiesBetween(activities, dayStart, dayEnd) {
+		return ""
+	}
+	lines := []string{"*Активности:*"}
+	for _, kind := range activityKinds {
+		done := activityTimeBetween(activities, kind.ID, dayStart, dayEnd, now)
+		goal := activityGoal(goals, kind)
+		if done == 0 && goal == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s — %s", kind.Label, formatActivityProgress(done, goal)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func hasActivitiesBetween(activities []ActivitySession, from time.Time, to time.Time) bool {
+	for _, activity := range activities {
+		if activity.StartAt.Before(to) && (activity.EndAt == nil || activity.EndAt.After(from)) {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildActivityRangeSection — итоги активностей за локальные дни [start, end]: всего, в среднем за день
+// и в сколько дней выполнена цель (пусто, если активностей не было).
+func BuildActivityRangeSection(activities []ActivitySession, goals map[string]int, start time.Time, end time.Time, now time.Time, loc *time.Location) string {
+	first := startOfDay(start, loc)
+	last := startOfDay(end, loc)
+	if !hasActivitiesBetween(activities, first, last.AddDate(0, 0, 1)) {
+		return ""
+	}
+	days := daysInRange(start, end, loc)
+	lines := []string{"*Активности:*"}
+	for _, kind := range activityKinds {
+		total := activityTimeBetween(activities, kind.ID, first, last.AddDate(0, 0, 1), now)
+		if total == 0 {
+			continue
+		}
+		line := fmt.Sprintf("%s — всего %s, в среднем %s в день", kind.Label, formatDurationRU(total), formatDurationRU(total/time.Duration(days)))
+		if goal := activityGoal(goals, kind); goal > 0 {
+			reached := 0
+			for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+				if activityTimeBetween(activities, kind.ID, day, day.AddDate(0, 0, 1), now) >= time.Duration(goal)*time.Minute {
+					reached++
+				}
+			}
+			line += fmt.Sprintf("; цель %s — %d из %d %s", formatDurationRU(time.Duration(goal)*time.Minute), reached, days, ruPlural(days, "дня", "дней", "дней"))
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActivityTimeBetweenClipsToDay(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, loc).UTC()
+	}
+	end := at(16, 0, 20)
+	activities := []ActivitySession{
+		{Kind: "walk", StartAt: at(15, 23, 40), EndAt: &end},
+		{Kind: "tummy", StartAt: at(16, 10, 0)},
+	}
+	dayStart := startOfDay(at(16, 12, 0), loc)
+	now := at(16, 10, 25)
+
+	if got := activityTimeBetween(activities, "walk", dayStart, dayStart.AddDate(0, 0, 1), now); got != 20*time.Minute {
+		t.Fatalf("walk across midnight must be clipped, got %s", got)
+	}
+	if got := activityTimeBetween(activities, "tummy", dayStart, dayStart.AddDate(0, 0, 1), now); got != 25*time.Minute {
+		t.Fatalf("running activity must count until now, got %s", got)
+	}
+	if activeActivity(activities, "walk") != nil || activeActivity(activities, "tummy") == nil {
+		t.Fatal("only tummy time is running")
+	}
+}
+
+func TestBuildActivitySectionsShowGoals(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	add := func(day int, hour int, minutes int, kind string) ActivitySession {
+		start := time.Date(2026, 3, day, hour, 0, 0, 0, loc).UTC()
+		end := start.Add(time.Duration(minutes) * time.Minute)
+		return ActivitySession{Kind: kind, StartAt: start, EndAt: &end}
+	}
+	activities := []ActivitySession{
+		add(15, 10, 20, "tummy"),
+		add(15, 16, 15, "tummy"),
+		add(16, 10, 10, "tummy"),
+		add(16, 12, 90, "walk"),
+	}
+	now := time.Date(2026, 3, 16, 20, 0, 0, 0, loc)
+
+	day := BuildActivityDaySection(activities, map[string]int{}, now, now, loc)
+	for _, want := range []string{"животик — 10 мин из 30 мин (33%)", "прогулка — 1 ч 30 мин"} {
+		if !strings.Contains(day, want) {
+			t.Fatalf("expected %q in day section:\n%s", want, day)
+		}
+	}
+	if strings.Contains(day, "игра") {
+		t.Fatalf("activity without time and goal must be skipped:\n%s", day)
+	}
+
+	start := time.Date(2026, 3, 15, 0, 0, 0, 0, loc)
+	week := BuildActivityRangeSection(activities, map[string]int{"walk": 60}, start, now, now, loc)
+	for _, want := range []string{
+		"животик — всего 45 мин, в среднем 23 мин в день; цель 30 мин — 1 из 2 дней",
+		"прогулка — всего 1 ч 30 мин, в среднем 45 мин в день; цель 1 ч — 1 из 2 дней",
+	} {
+		if !strings.Contains(week, want) {
+			t.Fatalf("expected %q in range section:\n%s", want, week)
+		}
+	}
+	if BuildActivityDaySection(activities, nil, now.AddDate(0, 0, -3), now, loc) != "" {
+		t.Fatal("day without activities must produce no section")
+	}
+}
+
+func TestActivityIntervalsDoNotOverlapWithinKind(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(1)
+	userCtx, err := h.store.GetUserContext(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("user context: %v", err)
+	}
+	ctx, childID, memberID := context.Background(), userCtx.Child.ID, userCtx.Member.ID
+	now := h.clock.Now()
+
+	if _, err := h.store.AddActivity(ctx, childID, memberID, "walk", now.Add(-2*time.Hour), now.Add(-time.Hour)); err != nil {
+		t.Fatalf("add walk: %v", err)
+	}
+	if _, err := h.store.AddActivity(ctx, childID, memberID, "walk", now.Add(-90*time.Minute), now.Add(-30*time.Minute)); err == nil {
+		t.Fatal("overlapping walk must be rejected")
+	}
+	if _, err := h.store.StartActivity(ctx, childID, memberID, "walk", now.Add(-90*time.Minute)); err == nil {
+		t.Fatal("walk cannot start inside a saved walk")
+	}
+	if _, err := h.store.AddActivity(ctx, childID, memberID, "tummy", now.Add(-90*time.Minute), now.Add(-80*time.Minute)); err != nil {
+		t.Fatalf("other kinds may overlap: %v", err)
+	}
+
+	if _, err := h.store.StartActivity(ctx, childID, memberID, "walk", now.Add(-30*time.Minute)); err != nil {
+		t.Fatalf("start walk: %v", err)
+	}
+	if _, err := h.store.AddActivity(ctx, childID, memberID, "walk", now.Add(-20*time.Minute), now.Add(-10*time.Minute)); err == nil {
+		t.Fatal("walk inside the running one must be rejected")
+	}
+	walk, err := h.store.EndActivity(ctx, childID, memberID, "walk", now)
+	if err != nil || walk.EndAt == nil || !walk.EndAt.Equal(now) || walk.Kind != "walk" {
+		t.Fatalf("unexpected finished walk %+v (%v)", walk, err)
+	}
+}
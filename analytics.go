@@ -9,6 +9,12 @@ import (
 
 const sleepTableSlot = 30 * time.Minute
 
+// Дневное окно сна: всё, что вне [dayWindowStartHour, dayWindowEndHour), считается ночью.
+const (
+	dayWindowStartHour = 7
+	dayWindowEndHour   = 19
+)
+
 type NapInsight struct {
 	NapIndex         int
 	Duration         time.Duration
@@ -120,13 +126,13 @@ func SummarizeDay(sessions []SleepSession, day time.Time, loc *time.Location) Da
 	return summary
 }
 
-func SummarizeRange(sessions []SleepSession, end time.Time, days int, loc *time.Location) (int, time.Duration, time.Duration) {
+// SummarizeRange считает завершенные сны, начавшиеся в локальные календарные дни от start до end включительно.
+func SummarizeRange(sessions []SleepSession, start time.Time, end time.Time, loc *time.Location) (int, time.Duration, time.Duration) {
 	var count int
 	var total time.Duration
-	endLocal := end.In(loc)
-	startDate := time.Date(endLocal.Year(), endLocal.Month(), endLocal.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -(days - 1))
+	startDate := startOfDay(start, loc)
 	// Эксклюзивная граница: следующий локальный полуночный "тик".
-	endExclusive := time.Date(endLocal.Year(), endLocal.Month(), endLocal.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	endExclusive := startOfDay(end, loc).AddDate(0, 0, 1)
 	for _, session := range sessions {
 		if session.EndAt == nil {
 			continue
@@ -146,6 +152,38 @@ func SummarizeRange(sessions []SleepSession, end time.Time, days int, loc *time.
 	return count, total, average
 }
 
+// lastDaysStart возвращает начало периода из days локальных календарных дней, заканчивающегося днём end.
+func lastDaysStart(end time.Time, days int, loc *time.Location) time.Time {
+	if days < 1 {
+		days = 1
+	}
+	return startOfDay(end, loc).AddDate(0, 0, -(days - 1))
+}
+
+// daysInRange — число локальных календарных дней от start до end включительно.
+func daysInRange(start time.Time, end time.Time, loc *time.Location) int {
+	days := 0
+	for day := startOfDay(start, loc); !day.After(startOfDay(end, loc)); day = day.AddDate(0, 0, 1) {
+		days++
+	}
+	return days
+}
+
+// rangeLongerThan сообщает, что период от start до end включительно длиннее maxDays календарных дней;
+// проверка без перебора дней, поэтому годится и для дат из запроса до проверки длины.
+func rangeLongerThan(start time.Time, end time.Time, maxDays int, loc *time.Location) bool {
+	return !startOfDay(start, loc).AddDate(0, 0, maxDays).After(startOfDay(end, loc))
+}
+
+// formatRangeLabel: «За 7 дней» для периода, заканчивающегося сегодня, иначе явные даты.
+func formatRangeLabel(start time.Time, end time.Time, now time.Time, loc *time.Location) string {
+	days := daysInRange(start, end, loc)
+	if startOfDay(end, loc).Equal(startOfDay(now, loc)) {
+		return fmt.Sprintf("За %d дней", days)
+	}
+	return fmt.Sprintf("%s–%s (%d дн.)", start.In(loc).Format("02.01.2006"), end.In(loc).Format("02.01.2006"), days)
+}
+
 func BuildLatestSleepReport(childName string, sessions []SleepSession, latest SleepSession, loc *time.Location) string {
 	insight := AnalyzeLatestNap(sessions, latest, loc)
 	var lines []string
@@ -190,35 +228,53 @@ func BuildDashboardReport(childName string, sessions []SleepSession, active *Sle
 	today := SummarizeDay(sessions, now.In(loc), loc)
 	blocks = append(blocks, formatDaySummary("Сегодня", today))
 
-	weekCount, weekTotal, weekAverage := SummarizeRange(sessions, now, 7, loc)
+	weekCount, weekTotal, weekAverage := SummarizeRange(sessions, lastDaysStart(now, 7, loc), now, loc)
 	blocks = append(blocks, fmt.Sprintf("За 7 дней: %d снов, всего %s, средняя длительность %s.", weekCount, formatDurationRU(weekTotal), formatDurationRU(weekAverage)))
 
-	monthCount, monthTotal, monthAverage := SummarizeRange(sessions, now, 30, loc)
+	monthCount, monthTotal, monthAverage := SummarizeRange(sessions, lastDaysStart(now, 30, loc), now, loc)
 	blocks = append(blocks, fmt.Sprintf("За 30 дней: %d снов, всего %s, средняя длительность %s.", monthCount, formatDurationRU(monthTotal), formatDurationRU(monthAverage)))
 	blocks = append(blocks, BuildSleepTableSection(sessionsWithActive(sessions, active, now), now, 7, loc))
 
 	return strings.Join(blocks, "\n\n")
 }
 
-func BuildDayReport(sessions []SleepSession, active *SleepSession, day time.Time, loc *time.Location) string {
+// BuildDayReport — отчёт за локальный день day; активный сон учитывается до момента now.
+func BuildDayReport(sessions []SleepSession, active *SleepSession, day time.Time, now time.Time, loc *time.Location) string {
 	summary := SummarizeDay(sessions, day, loc)
-	table := BuildSleepTableSection(sessionsWithActive(sessions, active, day), day, 7, loc)
+	merged := sessionsWithActive(sessions, active, now)
+	night := SummarizeNight(merged, day, loc)
+	table := BuildSleepTableSection(merged, day, 7, loc)
+	label := "Сегодня"
+	if !startOfDay(day, loc).Equal(startOfDay(now, loc)) {
+		label = startOfDay(day, loc).Format("02.01.2006")
+	}
 	return strings.Join([]string{
-		formatDaySummary("Сегодня", summary),
+		formatDaySummary(label, summary),
+		formatNightSummary(night),
 		table,
 	}, "\n\n")
 }
 
-func BuildRangeReport(sessions []SleepSession, active *SleepSession, end time.Time, days int, loc *time.Location) string {
-	count, total, average := SummarizeRange(sessions, end, days, loc)
-	summary := fmt.Sprintf("За %d дней: %d снов, всего %s, средняя длительность %s.", days, count, formatDurationRU(total), formatDurationRU(average))
-	table := BuildSleepTableSection(sessionsWithActive(sessions, active, end), end, days, loc)
+// BuildRangeReport — отчёт за локальные дни от start до end включительно; активный сон учитывается до момента now.
+func BuildRangeReport(sessions []SleepSession, active *SleepSession, start time.Time, end time.Time, now time.Time, loc *time.Location) string {
+	table := BuildSleepTableSection(sessionsWithActive(sessions, active, now), end, daysInRange(start, end, loc), loc)
 	return strings.Join([]string{
-		summary,
+		BuildRangeSummary(sessions, active, start, end, now, loc),
 		table,
 	}, "\n\n")
 }
 
+// BuildRangeSummary — текстовая часть отчёта за период без таблицы сна (таблицу заменяют графики).
+func BuildRangeSummary(sessions []SleepSession, active *SleepSession, start time.Time, end time.Time, now time.Time, loc *time.Location) string {
+	count, total, average := SummarizeRange(sessions, start, end, loc)
+	summary := fmt.Sprintf("%s: %d снов, всего %s, средняя длительность %s.", formatRangeLabel(start, end, now, loc), count, formatDurationRU(total), formatDurationRU(average))
+	nights := BuildNightTrendSection(SummarizeNights(sessionsWithActive(sessions, active, now), end, daysInRange(start, end, loc), loc))
+	return strings.Join([]string{
+		summary,
+		nights,
+	}, "\n\n")
+}
+
 func formatDaySummary(label string, summary DaySummary) string {
 	if summary.SleepCount == 0 {
 		return fmt.Sprintf("%s: записей о сне пока нет.", label)
@@ -394,23 +450,16 @@ func startOfDay(value time.Time, loc *time.Location) time.Time {
 	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
 }
 
-type SleepNorm struct {
-	TotalMin  float64
-	TotalMax  float64
-	DayMin    float64
-	DayMax    float64
-	NightMin  float64
-	NightMax  float64
-}
-
 type NormSystemResult struct {
 	SystemID string
+	Title    string
 	Band     string
 	Norm     SleepNorm
 	Actual   struct {
 		Total float64
 		Day   float64
 		Night float64
+		Naps  int
 	}
 	Delta struct {
 		TotalPercent float64
@@ -421,53 +470,6 @@ type NormSystemResult struct {
 	Category string
 }
 
-var sleepNormsA = map[string]SleepNorm{
-	"0-1": {TotalMin: 16, TotalMax: 20, DayMin: 7, DayMax: 9, NightMin: 9, NightMax: 11},
-	"1-2": {TotalMin: 15, TotalMax: 18, DayMin: 6, DayMax: 8, NightMin: 9, NightMax: 11},
-	"2-3": {TotalMin: 15, TotalMax: 17, DayMin: 5, DayMax: 7, NightMin: 9, NightMax: 10},
-	"3-4": {TotalMin: 14, TotalMax: 16, DayMin: 4, DayMax: 5.5, NightMin: 9, NightMax: 10.5},
-	"4-6": {TotalMin: 13, TotalMax: 15, DayMin: 3, DayMax: 4.5, NightMin: 9, NightMax: 11},
-}
-
-var sleepNormsB = map[string]SleepNorm{
-	"0-1": {TotalMin: 14, TotalMax: 17, DayMin: 7, DayMax: 9, NightMin: 7, NightMax: 9},
-	"1-2": {TotalMin: 14, TotalMax: 17, DayMin: 6, DayMax: 8, NightMin: 8, NightMax: 9},
-	"2-3": {TotalMin: 14, TotalMax: 17, DayMin: 5, DayMax: 7, NightMin: 9, NightMax: 10},
-	"3-4": {TotalMin: 12, TotalMax: 16, DayMin: 4, DayMax: 5, NightMin: 8, NightMax: 10},
-	"4-6": {TotalMin: 12, TotalMax: 15, DayMin: 3, DayMax: 4.5, NightMin: 9, NightMax: 10.5},
-}
-
-var sleepNormsC = map[string]SleepNorm{
-	"0-3": {TotalMin: 14, TotalMax: 17, DayMin: 6, DayMax: 9, NightMin: 8, NightMax: 11},
-	"3-6": {TotalMin: 12, TotalMax: 16, DayMin: 3, DayMax: 5, NightMin: 9, NightMax: 11},
-}
-
-func ageBandA(ageMonths float64) string {
-	switch {
-	case ageMonths < 1:
-		return "0-1"
-	case ageMonths < 2:
-		return "1-2"
-	case ageMonths < 3:
-		return "2-3"
-	case ageMonths < 4:
-		return "3-4"
-	default:
-		return "4-6"
-	}
-}
-
-func ageBandB(ageMonths float64) string {
-	return ageBandA(ageMonths)
-}
-
-func ageBandC(ageMonths float64) string {
-	if ageMonths < 3 {
-		return "0-3"
-	}
-	return "3-6"
-}
-
 func deviationPercent(value float64, min float64, max float64) float64 {
 	if value >= min && value <= max {
 		return 0
@@ -497,8 +499,8 @@ func categoryByScore(score float64) string {
 	}
 }
 
-func evaluateSystem(systemID string, norms map[string]SleepNorm, band string, dayHours float64, nightHours float64) NormSystemResult {
-	norm := norms[band]
+// evaluateSystem сравнивает сон с нормой группы; число дневных снов показывается отдельно и в балл не входит.
+func evaluateSystem(system NormSystem, norm SleepNorm, dayHours float64, nightHours float64, naps int) NormSystemResult {
 	total := dayHours + nightHours
 
 	deltaTotal := deviationPercent(total, norm.TotalMin, norm.TotalMax)
@@ -508,12 +510,14 @@ func evaluateSystem(systemID string, norms map[string]SleepNorm, band string, da
 	score := 0.5*absFloat(deltaTotal) + 0.25*absFloat(deltaDay) + 0.25*absFloat(deltaNight)
 
 	var res NormSystemResult
-	res.SystemID = systemID
-	res.Band = band
+	res.SystemID = system.ID
+	res.Title = system.Title
+	res.Band = norm.Label
 	res.Norm = norm
 	res.Actual.Total = total
 	res.Actual.Day = dayHours
 	res.Actual.Night = nightHours
+	res.Actual.Naps = naps
 	res.Delta.TotalPercent = deltaTotal
 	res.Delta.DayPercent = deltaDay
 	res.Delta.NightPercent = deltaNight
@@ -563,15 +567,28 @@ func splitDayNightLast24h(sessions []SleepSession, now time.Time, loc *time.Loca
 	return dayTotal, nightTotal
 }
 
-func overlapWithDayWindow(start time.Time, end time.Time, loc *time.Location) time.Duration {
-	const dayStartHour = 7
-	const dayEndHour = 19
+// countNapsLast24h считает сны, начавшиеся за последние 24 часа внутри дневного окна.
+func countNapsLast24h(sessions []SleepSession, now time.Time, loc *time.Location) int {
+	since := now.Add(-24 * time.Hour)
+	naps := 0
+	for _, session := range sessions {
+		if session.EndAt == nil || session.StartAt.Before(since) || session.StartAt.After(now) {
+			continue
+		}
+		hour := session.StartAt.In(loc).Hour()
+		if hour >= dayWindowStartHour && hour < dayWindowEndHour {
+			naps++
+		}
+	}
+	return naps
+}
 
+func overlapWithDayWindow(start time.Time, end time.Time, loc *time.Location) time.Duration {
 	var total time.Duration
 	current := start
 	for current.Before(end) {
-		dayStart := time.Date(current.Year(), current.Month(), current.Day(), dayStartHour, 0, 0, 0, loc)
-		dayEnd := time.Date(current.Year(), current.Month(), current.Day(), dayEndHour, 0, 0, 0, loc)
+		dayStart := time.Date(current.Year(), current.Month(), current.Day(), dayWindowStartHour, 0, 0, 0, loc)
+		dayEnd := time.Date(current.Year(), current.Month(), current.Day(), dayWindowEndHour, 0, 0, 0, loc)
 		if dayEnd.Before(dayStart) {
 			dayEnd = dayStart
 		}
@@ -588,6 +605,48 @@ func overlapWithDayWindow(start time.Time, end time.Time, loc *time.Location) ti
 	return total
 }
 
+// DayNightSummary — «сутки сна» дня Date: ночь, закончившаяся утром, и дневное окно того же дня.
+type DayNightSummary struct {
+	Date     time.Time
+	DaySleep time.Duration
+	NapCount int
+	NapSleep time.Duration
+	Night    NightSummary
+}
+
+// Total — сон за ночь перед днём и за дневное окно этого дня.
+func (s DayNightSummary) Total() time.Duration {
+	return s.DaySleep + s.Night.TotalSleep
+}
+
+// SummarizeDayNight считает сон в дневном окне, число дневных снов (начавшихся в окне) и ночь, закончившуюся утром дня day.
+// NapSleep — полная длительность дневных снов, без обрезки по окну.
+func SummarizeDayNight(sessions []SleepSession, day time.Time, loc *time.Location) DayNightSummary {
+	summary := DayNightSummary{
+		Date:  startOfDay(day, loc),
+		Night: SummarizeNight(sessions, day, loc),
+	}
+	windowStart := time.Date(summary.Date.Year(), summary.Date.Month(), summary.Date.Day(), dayWindowStartHour, 0, 0, 0, loc)
+	windowEnd := time.Date(summary.Date.Year(), summary.Date.Month(), summary.Date.Day(), dayWindowEndHour, 0, 0, 0, loc)
+	for _, session := range sessions {
+		if session.EndAt == nil {
+			continue
+		}
+		start := maxTime(session.StartAt, windowStart)
+		end := minTime(*session.EndAt, windowEnd)
+		if !end.After(start) {
+			continue
+		}
+		summary.DaySleep += end.Sub(start)
+		// Утренний «хвост» ночного сна днём считается, но отдельным дневным сном не является.
+		if !session.StartAt.Before(windowStart) {
+			summary.NapCount++
+			summary.NapSleep += session.EndAt.Sub(session.StartAt)
+		}
+	}
+	return summary
+}
+
 func minTime(a, b time.Time) time.Time {
 	if a.Before(b) {
 		return a
@@ -616,12 +675,9 @@ func childAgeMonths(child Child, now time.Time) (float64, bool) {
 }
 
 func BuildNormsReport(child Child, sessions []SleepSession, loc *time.Location, now time.Time) string {
-	ageMonths, ok := childAgeMonths(child, now.In(loc))
-	if !ok {
-		return "Возраст ребенка неизвестен или некорректен. Укажите дату рождения через `/setbirthdate`, чтобы оценивать сон относительно норм для возраста до 6 месяцев."
-	}
-	if ageMonths > 6 {
-		return "Эта оценка рассчитана для детей до 6 месяцев. Сейчас возраст ребенка больше 6 месяцев, поэтому используйте обычные отчеты или проконсультируйтесь с педиатром."
+	ageMonths, problem := normsChildAge(child, now, loc)
+	if problem != "" {
+		return problem
 	}
 
 	dayDur, nightDur := splitDayNightLast24h(sessions, now, loc)
@@ -629,51 +685,101 @@ func BuildNormsReport(child Child, sessions []SleepSession, loc *time.Location,
 		return "За последние 24 часа нет сохраненных снов, поэтому оценка относительно норм пока недоступна."
 	}
 
-	dayHours := dayDur.Hours()
-	nightHours := nightDur.Hours()
-
-	bandA := ageBandA(ageMonths)
-	bandB := ageBandB(ageMonths)
-	bandC := ageBandC(ageMonths)
-
-	resA := evaluateSystem("A", sleepNormsA, bandA, dayHours, nightHours)
-	resB := evaluateSystem("B", sleepNormsB, bandB, dayHours, nightHours)
-	resC := evaluateSystem("C", sleepNormsC, bandC, dayHours, nightHours)
-
-	avgScore := (resA.Delta.Score + resB.Delta.Score + resC.Delta.Score) / 3
-	overallCategory := categoryByScore(avgScore)
+	results := evaluateAllSystems(ageMonths, dayDur.Hours(), nightDur.Hours(), countNapsLast24h(sessions, now, loc))
+	if len(results) == 0 {
+		return "Для этого возраста нет подходящих норм сна."
+	}
+	avgScore := averageScore(results)
 
 	safeName := escapeTelegramMarkdown(child.Name)
 	lines := []string{
 		fmt.Sprintf("Оценка сна %s за последние 24 часа:", safeName),
-		fmt.Sprintf("*Сводка:* в среднем по 3 системам — _%s_ (среднее отклонение %.1f%%).", overallCategory, avgScore),
-		"",
-		formatSystemBlock(resA, "Система A (русская таблица)"),
-		"",
-		formatSystemBlock(resB, "Система B (Sleep Foundation)"),
-		"",
-		formatSystemBlock(resC, "Система C (международные рекомендации)"),
-		"",
-		"Это ориентировочная оценка по открытым педиатрическим источникам и не является медицинским диагнозом. При заметных отклонениях или беспокойстве по поводу сна ребенка обсудите режим с педиатром или детским сомнологом.",
+		fmt.Sprintf("*Сводка:* в среднем по %d системам — _%s_ (среднее отклонение %.1f%%).", len(results), categoryByScore(avgScore), avgScore),
+	}
+	for _, res := range results {
+		lines = append(lines, "", formatSystemBlock(res))
 	}
+	lines = append(lines, "", normsDisclaimer)
 
 	return strings.Join(lines, "\n")
 }
 
-func formatSystemBlock(res NormSystemResult, title string) string {
+const normsDisclaimer = "Это ориентировочная оценка по открытым педиатрическим источникам и не является медицинским диагнозом. При заметных отклонениях или беспокойстве по поводу сна ребенка обсудите режим с педиатром или детским сомнологом."
+
+// normsChildAge возвращает возраст в месяцах или текст, почему оценка по нормам невозможна.
+func normsChildAge(child Child, now time.Time, loc *time.Location) (float64, string) {
+	ageMonths, ok := childAgeMonths(child, now.In(loc))
+	if !ok {
+		return 0, fmt.Sprintf("Возраст ребенка неизвестен или некорректен. Укажите дату рождения через `/setbirthdate`, чтобы оценивать сон относительно норм для возраста до %s.", formatNormsMaxAge())
+	}
+	if ageMonths > sleepNorms.MaxAgeMonths {
+		return 0, fmt.Sprintf("Эта оценка рассчитана для детей до %s. Сейчас ребенок старше, поэтому используйте обычные отчеты или проконсультируйтесь с педиатром.", formatNormsMaxAge())
+	}
+	return ageMonths, ""
+}
+
+// evaluateAllSystems оценивает сон по всем системам, у которых есть группа для этого возраста.
+func evaluateAllSystems(ageMonths float64, dayHours float64, nightHours float64, naps int) []NormSystemResult {
+	var results []NormSystemResult
+	for _, system := range sleepNorms.Systems {
+		norm, ok := system.BandFor(ageMonths)
+		if !ok {
+			continue
+		}
+		results = append(results, evaluateSystem(system, norm, dayHours, nightHours, naps))
+	}
+	return results
+}
+
+func averageScore(results []NormSystemResult) float64 {
+	if len(results) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, res := range results {
+		sum += res.Delta.Score
+	}
+	return sum / float64(len(results))
+}
+
+func formatNormsMaxAge() string {
+	months := int(sleepNorms.MaxAgeMonths)
+	if months%12 == 0 {
+		years := months / 12
+		return fmt.Sprintf("%d %s", years, ruPlural(years, "года", "лет", "лет"))
+	}
+	return fmt.Sprintf("%d мес.", months)
+}
+
+func formatSystemBlock(res NormSystemResult) string {
+	naps := fmt.Sprintf("дневных снов %d.", res.Actual.Naps)
+	switch {
+	case res.Actual.Naps < res.Norm.NapsMin:
+		naps = fmt.Sprintf("дневных снов %d (меньше обычного для возраста).", res.Actual.Naps)
+	case res.Actual.Naps > res.Norm.NapsMax:
+		naps = fmt.Sprintf("дневных снов %d (больше обычного для возраста).", res.Actual.Naps)
+	}
 	return strings.Join([]string{
-		fmt.Sprintf("*%s* (возрастная группа %s)", title, res.Band),
-		fmt.Sprintf("Норма: всего %.1f–%.1f ч, день %.1f–%.1f ч, ночь %.1f–%.1f ч.",
+		fmt.Sprintf("*%s* (возрастная группа %s мес.)", res.Title, res.Band),
+		fmt.Sprintf("Норма: всего %.1f–%.1f ч, день %.1f–%.1f ч, ночь %.1f–%.1f ч, дневных снов %s.",
 			res.Norm.TotalMin, res.Norm.TotalMax,
 			res.Norm.DayMin, res.Norm.DayMax,
 			res.Norm.NightMin, res.Norm.NightMax,
+			formatNapsRange(res.Norm),
 		),
-		fmt.Sprintf("У вас: всего %.1f ч (%.1f%%), день %.1f ч (%.1f%%), ночь %.1f ч (%.1f%%).",
+		fmt.Sprintf("У вас: всего %.1f ч (%.1f%%), день %.1f ч (%.1f%%), ночь %.1f ч (%.1f%%), %s",
 			res.Actual.Total, res.Delta.TotalPercent,
 			res.Actual.Day, res.Delta.DayPercent,
 			res.Actual.Night, res.Delta.NightPercent,
+			naps,
 		),
 		fmt.Sprintf("Итог по системе: _%s_.", res.Category),
 	}, "\n")
 }
 
+func formatNapsRange(norm SleepNorm) string {
+	if norm.NapsMin == norm.NapsMax {
+		return fmt.Sprintf("%d", norm.NapsMin)
+	}
+	return fmt.Sprintf("%d–%d", norm.NapsMin, norm.NapsMax)
+}
@@ -117,7 +117,7 @@ func TestBuildRangeReportIncludesSleepTable(t *testing.T) {
 	finish := time.Date(2026, 3, 16, 2, 0, 0, 0, loc).UTC()
 	sessions := []SleepSession{{ID: 1, StartAt: start, EndAt: &finish}}
 
-	report := BuildRangeReport(sessions, nil, end, 1, loc)
+	report := BuildRangeReport(sessions, nil, end, end, end, loc)
 
 	if !strings.Contains(report, "Таблица сна за 1 дн.") {
 		t.Fatalf("expected sleep table heading, got %s", report)
@@ -172,3 +172,65 @@ func TestBuildNormsReportUsesTelegramLegacyMarkdown(t *testing.T) {
 		t.Fatalf("expected *Сводка:* bold label: %s", s)
 	}
 }
+
+func TestParseReportDateRange(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 16, 20, 0, 0, 0, loc)
+
+	cases := []struct {
+		input     string
+		wantStart string
+		wantEnd   string
+		wantErr   bool
+	}{
+		{input: "01.03-15.03", wantStart: "2026-03-01", wantEnd: "2026-03-15"},
+		{input: "01.03 – 15.03", wantStart: "2026-03-01", wantEnd: "2026-03-15"},
+		{input: "25.12-05.01", wantStart: "2025-12-25", wantEnd: "2026-01-05"},
+		{input: "10.03.2026-12.03.2026", wantStart: "2026-03-10", wantEnd: "2026-03-12"},
+		// Дата без года из будущего относится к прошлому году.
+		{input: "20.03-25.03", wantStart: "2025-03-20", wantEnd: "2025-03-25"},
+		{input: "15.03-01.03.2026", wantErr: true},
+		{input: "01.01.2025-15.03.2026", wantErr: true},
+		{input: "01.01.2025-02.04.2025", wantStart: "2025-01-01", wantEnd: "2025-04-02"},
+		{input: "01.01.2025-03.04.2025", wantErr: true},
+		{input: "01.01.0001-15.03", wantErr: true},
+		{input: "01.03", wantErr: true},
+	}
+	for _, tc := range cases {
+		start, end, err := parseReportDateRange(tc.input, now, loc)
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("%q: expected error, got %s..%s", tc.input, start, end)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.input, err)
+		}
+		if got := start.Format("2006-01-02"); got != tc.wantStart {
+			t.Fatalf("%q: start %s, want %s", tc.input, got, tc.wantStart)
+		}
+		if got := end.Format("2006-01-02"); got != tc.wantEnd {
+			t.Fatalf("%q: end %s, want %s", tc.input, got, tc.wantEnd)
+		}
+	}
+}
+
+func TestBuildRangeReportWithExplicitBounds(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 16, 20, 0, 0, 0, loc)
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, loc)
+	end := time.Date(2026, 3, 3, 0, 0, 0, 0, loc)
+
+	makeSession := func(day int) SleepSession {
+		s := time.Date(2026, 3, day, 13, 0, 0, 0, loc).UTC()
+		e := s.Add(time.Hour)
+		return SleepSession{StartAt: s, EndAt: &e}
+	}
+	sessions := []SleepSession{makeSession(1), makeSession(2), makeSession(3), makeSession(4)}
+
+	report := BuildRangeSummary(sessions, nil, start, end, now, loc)
+	if !strings.Contains(report, "01.03.2026–03.03.2026 (3 дн.): 3 снов, всего 3 ч") {
+		t.Fatalf("unexpected summary: %s", report)
+	}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Период /api/v1/sleeps и /api/v1/summary/range без параметров, дней.
+const apiDefaultRangeDays = 7
+
+// apiError — ошибка запроса с HTTP-статусом; остальные ошибки отдаются как 500.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func badRequest(format string, args ...any) error {
+	return &apiError{Status: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+type apiHandlerFunc func(w http.ResponseWriter, r *http.Request, userCtx UserContext) error
+
+// familyNotifier сообщает участникам семьи об изменении, сделанном через API от имени userCtx.Member.
+type familyNotifier func(ctx context.Context, userCtx UserContext, text string)
+
+// apiServer — HTTP API семьи поверх Store. Запросы авторизуются токеном из /apitoken:
+// `Authorization: Bearer <токен>`.
+type apiServer struct {
+	store  *Store
+	notify familyNotifier
+	now    func() time.Time
+}
+
+func newAPIServer(store *Store, notify familyNotifier) *apiServer {
+	return &apiServer{store: store, notify: notify, now: time.Now}
+}
+
+func (a *apiServer) register(mux *http.ServeMux) {
+	mux.Handle("GET /api/v1/family", a.auth(a.getFamily))
+	mux.Handle("GET /api/v1/settings", a.auth(a.getSettings))
+	mux.Handle("GET /api/v1/sleep/active", a.auth(a.getActiveSleep))
+	mux.Handle("GET /api/v1/sleeps", a.auth(a.listSleeps))
+	mux.Handle("GET /api/v1/summary/day", a.auth(a.getDaySummary))
+	mux.Handle("GET /api/v1/summary/range", a.auth(a.getRangeSummary))
+	mux.Handle("POST /api/v1/sleep/start", a.auth(a.startSleep))
+	mux.Handle("POST /api/v1/sleep/end", a.auth(a.endSleep))
+	mux.Handle("POST /api/v1/sleeps", a.auth(a.addSleep))
+	mux.Handle("POST /api/v1/activity/start", a.auth(a.startActivity))
+	mux.Handle("POST /api/v1/activity/end", a.auth(a.endActivity))
+	mux.Handle("POST /api/v1/temperature", a.auth(a.addTemperature))
+	mux.Handle("POST /api/v1/symptom", a.auth(a.addSymptom))
+	// Календарь авторизуется секретом в ссылке: календарные приложения не умеют передавать заголовки.
+	mux.HandleFunc("GET /calendar/{file}", a.serveCalendar)
+}
+
+func (a *apiServer) auth(next apiHandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || strings.TrimSpace(token) == "" {
+			writeAPIError(w, http.StatusUnauthorized, "нужен заголовок Authorization: Bearer <токен из /apitoken>")
+			return
+		}
+		userCtx, err := a.store.GetUserContextByAPIToken(r.Context(), hashAPIToken(strings.TrimSpace(token)))
+		if errors.Is(err, sql.ErrNoRows) {
+			writeAPIError(w, http.StatusUnauthorized, "неизвестный или отозванный токен")
+			return
+		}
+		if err == nil {
+			err = next(w, r, userCtx)
+		}
+		if err == nil {
+			return
+		}
+		var reqErr *apiError
+		if errors.As(err, &reqErr) {
+			writeAPIError(w, reqErr.Status, reqErr.Message)
+			return
+		}
+		slog.Error("api request failed", "method", r.Method, "path", r.URL.Path, "family_id", userCtx.Family.ID, "error", err)
+		writeAPIError(w, http.StatusInternalServerError, "внутренняя ошибка")
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		slog.Warn("api write response failed", "error", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// generateAPIToken возвращает новый токен и его хеш: в базе хранится только хеш.
+func generateAPIToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(buf)
+	return token, hashAPIToken(token), nil
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type apiFamily struct {
+	Family apiFamilyInfo `json:"family"`
+	Child  apiChild      `json:"child"`
+	Member apiMember     `json:"member"`
+}
+
+type apiFamilyInfo struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Timezone string `json:"timezone"`
+}
+
+type apiChild struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	BirthDate *time.Time `json:"birth_date"`
+	Sex       string     `json:"sex,omitempty"`
+}
+
+type apiMember struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type apiSettings struct {
+	RemindersEnabled     bool    `json:"reminders_enabled"`
+	WakeWindowEnabled    bool    `json:"wake_window_enabled"`
+	WakeWindowMinutes    int     `json:"wake_window_minutes"`
+	MaxSleepEnabled      bool    `json:"max_sleep_enabled"`
+	MaxSleepMinutes      int     `json:"max_sleep_minutes"`
+	InactivityEnabled    bool    `json:"inactivity_enabled"`
+	InactivityMinutes    int     `json:"inactivity_minutes"`
+	MilestoneNotifyEach  bool    `json:"milestone_notify_each"`
+	MilestoneReportToday bool    `json:"milestone_report_today"`
+	TemperatureAlert     float64 `json:"temperature_alert"`
+}
+
+type apiSleep struct {
+	ID              int64      `json:"id"`
+	StartAt         time.Time  `json:"start_at"`
+	EndAt           *time.Time `json:"end_at"`
+	DurationMinutes int        `json:"duration_minutes"`
+	Note            string     `json:"note,omitempty"`
+	Tags            []string   `json:"tags,omitempty"`
+}
+
+type apiNight struct {
+	SleepCount            int `json:"sleep_count"`
+	TotalMinutes          int `json:"total_minutes"`
+	Wakings               int `json:"wakings"`
+	AwakeMinutes          int `json:"awake_minutes"`
+	LongestStretchMinutes int `json:"longest_stretch_minutes"`
+}
+
+type apiDaySummary struct {
+	Date            string   `json:"date"`
+	TotalMinutes    int      `json:"total_minutes"`
+	DaySleepMinutes int      `json:"day_sleep_minutes"`
+	NapCount        int      `json:"nap_count"`
+	NapMinutes      int      `json:"nap_minutes"`
+	Night           apiNight `json:"night"`
+}
+
+type apiRangeSummary struct {
+	From                  string          `json:"from"`
+	To                    string          `json:"to"`
+	SleepCount            int             `json:"sleep_count"`
+	TotalMinutes          int             `json:"total_minutes"`
+	AverageMinutes        int             `json:"average_minutes"`
+	AverageNightWakings   float64         `json:"average_night_wakings"`
+	AverageLongestMinutes int             `json:"average_longest_minutes"`
+	Days                  []apiDaySummary `json:"days"`
+}
+
+func minutes(d time.Duration) int {
+	return int(d.Round(time.Minute) / time.Minute)
+}
+
+func toAPISleep(session SleepSession, now time.Time) apiSleep {
+	end := now
+	if session.EndAt != nil {
+		end = *session.EndAt
+	}
+	return apiSleep{
+		ID:              session.ID,
+		StartAt:         session.StartAt,
+		EndAt:           session.EndAt,
+		DurationMinutes: minutes(end.Sub(session.StartAt)),
+		Note:            session.Note,
+		Tags:            session.Tags,
+	}
+}
+
+func toAPIDaySummary(summary DayNightSummary) apiDaySummary {
+	return apiDaySummary{
+		Date:            summary.Date.Format("2006-01-02"),
+		TotalMinutes:    minutes(summary.Total()),
+		DaySleepMinutes: minutes(summary.DaySleep),
+		NapCount:        summary.NapCount,
+		NapMinutes:      minutes(summary.NapSleep),
+		Night: apiNight{
+			SleepCount:            summary.Night.SleepCount,
+			TotalMinutes:          minutes(summary.Night.TotalSleep),
+			Wakings:               summary.Night.Wakings,
+			AwakeMinutes:          minutes(summary.Night.AwakeTime),
+			LongestStretchMinutes: minutes(summary.Night.LongestStretch),
+		},
+	}
+}
+
+func (a *apiServer) getFamily(w http.ResponseWriter, r *http.Request, userCtx UserContext) error {
+	writeJSON(w, http.StatusOK, apiFamily{
+		Family: apiFamilyInfo{ID: userCtx.Family.ID, Name: userCtx.Family.Name, Timezone: userCtx.Family.Timezone},
+		Child:  apiChild{ID: userCtx.Child.ID, Name: userCtx.Child.Name, BirthDate: userCtx.Child.BirthDate, Sex: userCtx.Child.Sex},
+		Member: apiMember{ID: userCtx.Member.ID, Name: userCtx.Member.DisplayName},
+	})
+	return nil
+}
+
+func (a *apiServer) getSettings(w http.ResponseWriter, r *http.Request, userCtx UserContext) error {
+	settings := userCtx.Settings
+	writeJSON(w, http.StatusOK, apiSettings{
+		RemindersEnabled:     settings.RemindersEnabled,
+		WakeWindowEnabled:    settings.WakeWindowEnabled,
+		WakeWindowMinutes:    settings.WakeWindowMinutes,
+		MaxSleepEnabled:      settings.MaxSleepEnabled,
+		MaxSleepMinutes:      settings.MaxSleepMinutes,
+		InactivityEnabled:    settings.InactivityEnabled,
+		InactivityMinutes:    settings.InactivityMinutes,
+		MilestoneNotifyEach:  settings.MilestoneNotifyEach,
+		MilestoneReportToday: settings.MilestoneReportToday,
+		TemperatureAlert:     settings.TemperatureAlert,
+	})
+	return nil
+}
+
+// getActiveSleep отдает идущий сон ({"active": null}, если ребенок не спит).
+func (a *apiServer) getActiveSleep(w http.ResponseWriter, r *http.Request, userCtx UserContext) error {
+	active, err := a.store.GetActiveSleep(r.Context(), userCtx.Child.ID)
+	if err != nil {
+		return err
+	}
+	var payload *apiSleep
+	if active != nil {
+		sleep := toAPISleep(*active, a.now())
+		payload = &sleep
+	}
+	writeJSON(w, http.StatusOK, map[string]*apiSleep{"active": payload})
+	return nil
+}
+
+// listSleeps отдает завершенные сны, начавшиеся в локальные дни ?from=…&to=… (`2006-01-02`, включительно).
+func (a *apiServer) listSleeps(w http.ResponseWriter, r *http.Request, userCtx UserContext) error {
+	loc := apiLocation(userCtx)
+	start, end, err := parseAPIRange(r, a.now(), loc)
+	if err != nil {
+		return err
+	}
+	sessions, err := a.store.ListCompletedSleepsBetween(r.Context(), userCtx.Child.ID, start, end.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+	result := make([]apiSleep, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, toAPISleep(session, a.now()))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"from":   start.Format("2006-01-02"),
+		"to":     end.Format("2006-01-02"),
+		"sleeps": result,
+	})
+	return nil
+}
+
+// getDaySummary — сон за локальный день ?date=… (по умолчанию сегодня): день, дневные сны и ночь перед ним.
+func (a *apiServer) getDaySummary(w http.ResponseWriter, r *http.Request, userCtx UserContext) error {
+	loc := apiLocation(userCtx)
+	now := a.now()
+	day := startOfDay(now, loc)
+	if raw := r.URL.Query().Get("date"); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", raw, loc)
+		if err != nil {
+			return badRequest("date должна быть в формате YYYY-MM-DD")
+		}
+		day = parsed
+	}
+	sessions, err := a.loadSessions(r.Context(), userCtx, day, day, now)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, toAPIDaySummary(SummarizeDayNight(sessions, day, loc)))
+	return nil
+}
+
+// getRangeSummary — итоги за локальные дни ?from=…&to=… и разбивка по дням.
+func (a *apiServer) getRangeSummary(w http.ResponseWriter, r *http.Request, userCtx UserContext) error {
+	loc := apiLocation(userCtx)
+	now := a.now()
+	start, end, err := parseAPIRange(r, now, loc)
+	if err != nil {
+		return err
+	}
+	sessions, err := a.loadSessions(r.Context(), userCtx, start, end, now)
+	if err != nil {
+		return err
+	}
+	count, total, average := SummarizeRange(sessions, start, end, loc)
+	days := daysInRange(start, end, loc)
+	trend := AverageNights(SummarizeNights(sessions, end, days, loc))
+	summary := apiRangeSummary{
+		From:                  start.Format("2006-01-02"),
+		To:                    end.Format("2006-01-02"),
+		SleepCount:            count,
+		TotalMinutes:          minutes(total),
+		AverageMinutes:        minutes(average),
+		AverageNightWakings:   trend.AverageWakings,
+		AverageLongestMinutes: minutes(trend.AverageLongest),
+		Days:                  make([]apiDaySummary, 0, days),
+	}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		summary.Days = append(summary.Days, toAPIDaySummary(SummarizeDayNight(sessions, day, loc)))
+	}
+	writeJSON(w, http.StatusOK, summary)
+	return nil
+}
+
+// loadSessions загружает сны за локальные дни [start, end] вместе с ночью перед первым днем;
+// идущий сон учитывается до now.
+func (a *apiServer) loadSessions(ctx context.Context, userCtx UserContext, start time.Time, end time.Time, now time.Time) ([]SleepSession, error) {
+	sessions, err := a.store.ListCompletedSleepsBetween(ctx, userCtx.Child.ID, start.AddDate(0, 0, -2), end.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	active, err := a.store.GetActiveSleep(ctx, userCtx.Child.ID)
+	if err != nil {
+		return nil, err
+	}
+	return sessionsWithActive(sessions, active, now), nil
+}
+
+func apiLocation(userCtx UserContext) *time.Location {
+	loc, err := time.LoadLocation(userCtx.Family.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// parseAPIRange разбирает ?from=…&to=… (`2006-01-02`); по умолчанию — последние apiDefaultRangeDays дней.
+func parseAPIRange(r *http.Request, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	end := startOfDay(now, loc)
+	if raw := r.URL.Query().Get("to"); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", raw, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, badRequest("to должна быть в формате YYYY-MM-DD")
+		}
+		end = parsed
+	}
+	start := end.AddDate(0, 0, -(apiDefaultRangeDays - 1))
+	if raw := r.URL.Query().Get("from"); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", raw, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, badRequest("from должна быть в формате YYYY-MM-DD")
+		}
+		start = parsed
+	}
+	if start.After(end) {
+		return time.Time{}, time.Time{}, badRequest("from позже to")
+	}
+	if rangeLongerThan(start, end, reportMaxRangeDays, loc) {
+		return time.Time{}, time.Time{}, badRequest("период длиннее %d дней", reportMaxRangeDays)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAPIRange(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 17, 1, 30, 0, 0, time.UTC)
+
+	start, end, err := parseAPIRange(httptest.NewRequest(http.MethodGet, "/api/v1/sleeps", nil), now, loc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if start.Format("2006-01-02") != "2026-03-11" || end.Format("2006-01-02") != "2026-03-17" {
+		t.Fatalf("expected last 7 local days, got %s..%s", start, end)
+	}
+
+	start, end, err = parseAPIRange(httptest.NewRequest(http.MethodGet, "/api/v1/sleeps?from=2026-03-01&to=2026-03-05", nil), now, loc)
+	if err != nil || start.Format("02.01") != "01.03" || end.Format("02.01") != "05.03" {
+		t.Fatalf("unexpected range %s..%s (%v)", start, end, err)
+	}
+
+	if _, _, err := parseAPIRange(httptest.NewRequest(http.MethodGet, "/api/v1/sleeps?from=2026-01-01&to=2026-04-02", nil), now, loc); err != nil {
+		t.Fatalf("92 days should be allowed: %v", err)
+	}
+
+	for _, query := range []string{"from=2026-03-10&to=2026-03-01", "from=01.03.2026", "from=2025-01-01&to=2026-03-01",
+		"from=2026-01-01&to=2026-04-03", "from=0001-01-01&to=9999-12-31"} {
+		if _, _, err := parseAPIRange(httptest.NewRequest(http.MethodGet, "/api/v1/sleeps?"+query, nil), now, loc); err == nil {
+			t.Fatalf("expected error for %q", query)
+		}
+	}
+}
+
+func TestGenerateAPITokenHashesToken(t *testing.T) {
+	token, hash, err := generateAPIToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(token) != 64 || hash != hashAPIToken(token) || hash == token {
+		t.Fatalf("unexpected token %q / hash %q", token, hash)
+	}
+	other, _, _ := generateAPIToken()
+	if other == token {
+		t.Fatalf("tokens should differ")
+	}
+}
+
+func TestAPIRequiresBearerToken(t *testing.T) {
+	mux := http.NewServeMux()
+	newAPIServer(nil, nil).register(mux)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/sleeps", nil))
+	if recorder.Code != http.StatusUnauthorized || !strings.Contains(recorder.Body.String(), `"error"`) {
+		t.Fatalf("expected 401 with JSON error, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/api/v1/sleeps", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for DELETE, got %d", recorder.Code)
+	}
+}
+
+func TestToAPISleepCountsActiveUntilNow(t *testing.T) {
+	start := time.Date(2026, 3, 16, 10, 0, 0, 0, time.UTC)
+	sleep := toAPISleep(SleepSession{ID: 7, StartAt: start}, start.Add(95*time.Minute))
+	if sleep.EndAt != nil || sleep.DurationMinutes != 95 {
+		t.Fatalf("unexpected active sleep %+v", sleep)
+	}
+}
+
+func TestDecodeEventDefaults(t *testing.T) {
+	api := newAPIServer(nil, nil)
+	userCtx := UserContext{Member: Member{ID: 3, DisplayName: "Мама"}}
+	now := time.Date(2026, 3, 16, 10, 0, 0, 0, time.UTC)
+
+	req, memberCtx, err := api.decodeEvent(httptest.NewRequest(http.MethodPost, "/api/v1/sleep/start", nil), userCtx)
+	if err != nil || memberCtx.Member.ID != 3 || !req.at(now).Equal(now) {
+		t.Fatalf("empty body should use token member and now: %+v %v", req, err)
+	}
+
+	body := strings.NewReader(`{"member": "мама", "at": "2026-03-16T12:30:00+03:00"}`)
+	req, memberCtx, err = api.decodeEvent(httptest.NewRequest(http.MethodPost, "/api/v1/sleep/start", body), userCtx)
+	if err != nil || memberCtx.Member.ID != 3 || !req.at(now).Equal(now.Add(-30*time.Minute)) {
+		t.Fatalf("unexpected event %+v (%v)", req, err)
+	}
+
+	body = strings.NewReader(`{"minutes": 5}`)
+	if _, _, err := api.decodeEvent(httptest.NewRequest(http.MethodPost, "/api/v1/sleep/start", body), userCtx); err == nil {
+		t.Fatalf("unknown fields should be rejected")
+	}
+}
+
+// apiHarness гоняет запросы через настоящий mux HTTP API поверх Store из botHarness
+// и запоминает оповещения семьи.
+type apiHarness struct {
+	*botHarness
+	mux      *http.ServeMux
+	notified []string
+}
+
+func newAPIHarness(t *testing.T) *apiHarness {
+	t.Helper()
+	a := &apiHarness{botHarness: newBotHarness(t), mux: http.NewServeMux()}
+	api := newAPIServer(a.store, func(_ context.Context, userCtx UserContext, text string) {
+		a.notified = append(a.notified, text)
+	})
+	api.now = a.clock.Now
+	api.register(a.mux)
+	return a
+}
+
+// userContext возвращает семью, ребенка и участника пользователя userID.
+func (a *apiHarness) userContext(userID int64) UserContext {
+	a.t.Helper()
+	userCtx, err := a.store.GetUserContext(context.Background(), userID)
+	if err != nil {
+		a.t.Fatalf("user context %d: %v", userID, err)
+	}
+	return userCtx
+}
+
+// issueToken выпускает токен API семьи пользователя userID, как /apitoken.
+func (a *apiHarness) issueToken(userID int64) string {
+	a.t.Helper()
+	userCtx := a.userContext(userID)
+	token, hash, err := generateAPIToken()
+	if err != nil {
+		a.t.Fatalf("generate token: %v", err)
+	}
+	if err := a.store.SetAPIToken(context.Background(), userCtx.Family.ID, userCtx.Member.ID, hash); err != nil {
+		a.t.Fatalf("set token: %v", err)
+	}
+	return token
+}
+
+// call выполняет запрос с токеном и возвращает код ответа и тело.
+func (a *apiHarness) call(token string, method string, path string, body string) (int, string) {
+	a.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	a.mux.ServeHTTP(recorder, req)
+	return recorder.Code, recorder.Body.String()
+}
+
+// listSleepIDs читает /api/v1/sleeps и возвращает id снов из ответа.
+func (a *apiHarness) listSleepIDs(token string) []int64 {
+	a.t.Helper()
+	code, body := a.call(token, http.MethodGet, "/api/v1/sleeps", "")
+	if code != http.StatusOK {
+		a.t.Fatalf("expected 200 for /api/v1/sleeps, got %d %s", code, body)
+	}
+	var payload struct {
+		Sleeps []apiSleep `json:"sleeps"`
+	}
+	if err := json.Unmarshal([]byte(body), &payload); err != nil {
+		a.t.Fatalf("decode sleeps: %v", err)
+	}
+	ids := make([]int64, 0, len(payload.Sleeps))
+	for _, sleep := range payload.Sleeps {
+		ids = append(ids, sleep.ID)
+	}
+	return ids
+}
+
+func TestAPIReadsOnlyOwnFamily(t *testing.T) {
+	a := newAPIHarness(t)
+	a.onboard(100)
+	a.onboard(200)
+	ctx := context.Background()
+	now := a.clock.Now()
+	first, second := a.userContext(100), a.userContext(200)
+	firstSleep, err := a.store.AddManualSleep(ctx, first.Child.ID, first.Member.ID, now.Add(-3*time.Hour), now.Add(-2*time.Hour), "")
+	if err != nil {
+		t.Fatalf("add sleep: %v", err)
+	}
+	secondSleep, err := a.store.AddManualSleep(ctx, second.Child.ID, second.Member.ID, now.Add(-4*time.Hour), now.Add(-3*time.Hour), "")
+	if err != nil {
+		t.Fatalf("add sleep: %v", err)
+	}
+
+	firstToken, secondToken := a.issueToken(100), a.issueToken(200)
+	if ids := a.listSleepIDs(firstToken); len(ids) != 1 || ids[0] != firstSleep.ID {
+		t.Fatalf("first family should see only sleep %d, got %v", firstSleep.ID, ids)
+	}
+	if ids := a.listSleepIDs(secondToken); len(ids) != 1 || ids[0] != secondSleep.ID {
+		t.Fatalf("second family should see only sleep %d, got %v", secondSleep.ID, ids)
+	}
+
+	code, body := a.call(firstToken, http.MethodGet, "/api/v1/family", "")
+	var family apiFamily
+	if code != http.StatusOK || json.Unmarshal([]byte(body), &family) != nil || family.Family.ID != first.Family.ID || family.Member.ID != first.Member.ID {
+		t.Fatalf("unexpected family response %d %s", code, body)
+	}
+	if _, lastUsed, err := a.store.GetAPITokenInfo(ctx, first.Family.ID); err != nil || lastUsed == nil {
+		t.Fatalf("token use should be recorded, got %v (%v)", lastUsed, err)
+	}
+}
+
+func TestAPIRotatedAndRevokedTokens(t *testing.T) {
+	a := newAPIHarness(t)
+	a.onboard(100)
+	family := a.userContext(100).Family
+
+	old := a.issueToken(100)
+	if code, _ := a.call(old, http.MethodGet, "/api/v1/sleeps", ""); code != http.StatusOK {
+		t.Fatalf("fresh token should work, got %d", code)
+	}
+	rotated := a.issueToken(100)
+	if code, _ := a.call(old, http.MethodGet, "/api/v1/sleeps", ""); code != http.StatusUnauthorized {
+		t.Fatalf("rotated out token should be rejected, got %d", code)
+	}
+	if code, _ := a.call(rotated, http.MethodGet, "/api/v1/sleeps", ""); code != http.StatusOK {
+		t.Fatalf("new token should work, got %d", code)
+	}
+
+	if revoked, err := a.store.RevokeAPIToken(context.Background(), family.ID); err != nil || !revoked {
+		t.Fatalf("revoke: %v %v", revoked, err)
+	}
+	if code, body := a.call(rotated, http.MethodGet, "/api/v1/sleeps", ""); code != http.StatusUnauthorized || !strings.Contains(body, "отозванный") {
+		t.Fatalf("revoked token should be rejected, got %d %s", code, body)
+	}
+}
+
+func TestAPITokenUseRecordedAtMostOncePerMinute(t *testing.T) {
+	a := newAPIHarness(t)
+	a.onboard(100)
+	token := a.issueToken(100)
+	family := a.userContext(100).Family
+	ctx := context.Background()
+
+	lastUsed := func() time.Time {
+		t.Helper()
+		_, used, err := a.store.GetAPITokenInfo(ctx, family.ID)
+		if err != nil || used == nil {
+			t.Fatalf("token use should be recorded, got %v (%v)", used, err)
+		}
+		return *used
+	}
+	a.call(token, http.MethodGet, "/api/v1/sleeps", "")
+	first := lastUsed()
+	if !first.Equal(a.clock.Now()) {
+		t.Fatalf("expected last use at %s, got %s", a.clock.Now(), first)
+	}
+	a.clock.Advance(30 * time.Second)
+	a.call(token, http.MethodGet, "/api/v1/sleeps", "")
+	if got := lastUsed(); !got.Equal(first) {
+		t.Fatalf("reads within a minute should not rewrite last use, got %s", got)
+	}
+	a.clock.Advance(apiTokenTouchInterval)
+	a.call(token, http.MethodGet, "/api/v1/sleeps", "")
+	if got := lastUsed(); !got.Equal(a.clock.Now()) {
+		t.Fatalf("last use should move after a minute, got %s", got)
+	}
+}
+
+// postJSON отправляет POST и проверяет код ответа.
+func (a *apiHarness) postJSON(token string, path string, body string, want int) string {
+	a.t.Helper()
+	code, response := a.call(token, http.MethodPost, path, body)
+	if code != want {
+		a.t.Fatalf("POST %s %s: expected %d, got %d %s", path, body, want, code, response)
+	}
+	return response
+}
+
+func TestAPIWriteSleep(t *testing.T) {
+	a := newAPIHarness(t)
+	a.onboard(100)
+	token := a.issueToken(100)
+	userCtx := a.userContext(100)
+	ctx := context.Background()
+
+	a.postJSON(token, "/api/v1/sleep/start", "", http.StatusCreated)
+	active, err := a.store.GetActiveSleep(ctx, userCtx.Child.ID)
+	if err != nil || active == nil || !active.StartAt.Equal(a.clock.Now()) || active.StartSource != sourceAPI || active.CreatedBy != userCtx.Member.ID {
+		t.Fatalf("unexpected active sleep %+v (%v)", active, err)
+	}
+	if len(a.notified) != 1 || !strings.Contains(a.notified[0], "(через API): сон начался в") {
+		t.Fatalf("family should be notified about the start, got %q", a.notified)
+	}
+	a.postJSON(token, "/api/v1/sleep/start", "", http.StatusUnprocessableEntity)
+
+	a.clock.Advance(90 * time.Minute)
+	response := a.postJSON(token, "/api/v1/sleep/end", "", http.StatusOK)
+	var ended apiSleep
+	if err := json.Unmarshal([]byte(response), &ended); err != nil || ended.ID != active.ID || ended.DurationMinutes != 90 {
+		t.Fatalf("unexpected end response %s (%v)", response, err)
+	}
+	stored, err := a.store.GetSleepByID(ctx, active.ID)
+	if err != nil || stored.EndAt == nil || !stored.EndAt.Equal(a.clock.Now()) {
+		t.Fatalf("sleep end should be stored, got %+v (%v)", stored, err)
+	}
+	if len(a.notified) != 2 || !strings.Contains(a.notified[1], "длительность 1 ч 30 мин") {
+		t.Fatalf("family should be notified about the end, got %q", a.notified)
+	}
+	a.postJSON(token, "/api/v1/sleep/end", "", http.StatusUnprocessableEntity)
+
+	now := a.clock.Now()
+	interval := func(start time.Time, end time.Time) string {
+		return `{"start_at": "` + start.Format(time.RFC3339) + `", "end_at": "` + end.Format(time.RFC3339) + `", "note": "в коляске"}`
+	}
+	// Пересекается с только что записанным сном.
+	a.postJSON(token, "/api/v1/sleeps", interval(now.Add(-2*time.Hour), now.Add(-time.Hour)), http.StatusUnprocessableEntity)
+	a.postJSON(token, "/api/v1/sleeps", interval(now.Add(time.Hour), now.Add(2*time.Hour)), http.StatusUnprocessableEntity)
+	a.postJSON(token, "/api/v1/sleep/start", `{"at": "`+now.Add(time.Hour).Format(time.RFC3339)+`"}`, http.StatusUnprocessableEntity)
+	a.postJSON(token, "/api/v1/sleeps", `{"note": "без времени"}`, http.StatusBadRequest)
+	a.postJSON(token, "/api/v1/sleeps", `{"minutes": 5}`, http.StatusBadRequest)
+
+	a.postJSON(token, "/api/v1/sleeps", interval(now.Add(-5*time.Hour), now.Add(-4*time.Hour)), http.StatusCreated)
+	sessions, err := a.store.ListCompletedSleepsSince(ctx, userCtx.Child.ID, now.Add(-24*time.Hour))
+	if err != nil || len(sessions) != 2 || sessions[0].Note != "в коляске" || sessions[0].StartSource != sourceManual {
+		t.Fatalf("expected the added sleep to be stored first, got %+v (%v)", sessions, err)
+	}
+	if len(a.notified) != 3 || !strings.Contains(a.notified[2], "записан сон") {
+		t.Fatalf("family should be notified about the added sleep, got %q", a.notified)
+	}
+}
+
+func TestAPIWriteOnBehalfOfMember(t *testing.T) {
+	a := newAPIHarness(t)
+	a.names[100], a.names[200], a.names[300] = "Мама", "Папа", "Бабушка"
+	a.onboard(100)
+	a.join(100, 200)
+	a.onboard(300)
+	token := a.issueToken(100)
+	family := a.userContext(100)
+	dad := a.userContext(200)
+	ctx := context.Background()
+
+	// Участник из другой семьи не найдется, даже если имя существует.
+	a.postJSON(token, "/api/v1/sleep/start", `{"member": "Бабушка"}`, http.StatusBadRequest)
+	a.postJSON(token, "/api/v1/sleep/start", `{"member": "Дедушка"}`, http.StatusBadRequest)
+	if active, err := a.store.GetActiveSleep(ctx, family.Child.ID); err != nil || active != nil {
+		t.Fatalf("rejected requests must not store a sleep, got %+v (%v)", active, err)
+	}
+	if len(a.notified) != 0 {
+		t.Fatalf("rejected requests must not notify, got %q", a.notified)
+	}
+
+	a.postJSON(token, "/api/v1/sleep/start", `{"member": "папа"}`, http.StatusCreated)
+	active, err := a.store.GetActiveSleep(ctx, family.Child.ID)
+	if err != nil || active == nil || active.CreatedBy != dad.Member.ID {
+		t.Fatalf("sleep should be recorded by the dad (member %d), got %+v (%v)", dad.Member.ID, active, err)
+	}
+	if len(a.notified) != 1 || !strings.HasPrefix(a.notified[0], "Папа (через API)") {
+		t.Fatalf("notice should name the dad, got %q", a.notified)
+	}
+}
+
+func TestAPIWriteActivityAndHealth(t *testing.T) {
+	a := newAPIHarness(t)
+	a.onboard(100)
+	token := a.issueToken(100)
+	userCtx := a.userContext(100)
+	ctx := context.Background()
+
+	a.postJSON(token, "/api/v1/activity/start", `{"kind": "прогулка"}`, http.StatusCreated)
+	a.postJSON(token, "/api/v1/activity/start", `{"kind": "walk"}`, http.StatusUnprocessableEntity)
+	a.postJSON(token, "/api/v1/activity/start", `{"kind": "плавание"}`, http.StatusBadRequest)
+	if running, err := a.store.ListActiveActivities(ctx, userCtx.Child.ID); err != nil || len(running) != 1 || running[0].Kind != "walk" {
+		t.Fatalf("expected a running walk, got %+v (%v)", running, err)
+	}
+	a.clock.Advance(40 * time.Minute)
+	response := a.postJSON(token, "/api/v1/activity/end", `{"kind": "walk"}`, http.StatusOK)
+	var walk apiActivity
+	if err := json.Unmarshal([]byte(response), &walk); err != nil || walk.EndAt == nil || walk.DurationMinutes != 40 {
+		t.Fatalf("unexpected activity response %s (%v)", response, err)
+	}
+	a.postJSON(token, "/api/v1/activity/end", `{"kind": "walk"}`, http.StatusUnprocessableEntity)
+
+	response = a.postJSON(token, "/api/v1/temperature", `{"temperature": 38.6}`, http.StatusCreated)
+	var temperature apiHealthEntry
+	if err := json.Unmarshal([]byte(response), &temperature); err != nil || temperature.Temperature != 38.6 {
+		t.Fatalf("unexpected temperature response %s (%v)", response, err)
+	}
+	a.postJSON(token, "/api/v1/temperature", `{"temperature": 50}`, http.StatusUnprocessableEntity)
+	a.postJSON(token, "/api/v1/symptom", `{"symptoms": [" Кашель ", ""], "note": "ночью хуже"}`, http.StatusCreated)
+
+	entries, err := a.store.ListHealthEntriesBetween(ctx, userCtx.Child.ID, a.clock.Now().Add(-time.Hour), a.clock.Now().Add(time.Minute))
+	if err != nil || len(entries) != 2 || entries[0].Temperature != 38.6 || len(entries[1].Tags) != 1 || entries[1].Tags[0] != "кашель" {
+		t.Fatalf("unexpected health entries %+v (%v)", entries, err)
+	}
+	if len(a.notified) != 4 {
+		t.Fatalf("expected 4 notices (walk start and end, temperature, symptom), got %q", a.notified)
+	}
+}
+
+func TestAPIWriteStoreFailureIsInternal(t *testing.T) {
+	a := newAPIHarness(t)
+	a.onboard(100)
+	token := a.issueToken(100)
+	// Ошибка базы, а не проверки: клиент не должен увидеть текст SQLite.
+	if _, err := a.store.db.Exec(`DROP TABLE sleep_sessions`); err != nil {
+		t.Fatalf("drop table: %v", err)
+	}
+	response := a.postJSON(token, "/api/v1/sleep/start", "", http.StatusInternalServerError)
+	if strings.Contains(response, "sleep_sessions") || !strings.Contains(response, "внутренняя ошибка") {
+		t.Fatalf("internal error text leaked: %s", response)
+	}
+	if err := unprocessable(context.Canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("context errors must not become 422, got %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Максимальный размер тела POST-запроса к API, байт.
+const apiMaxBodyBytes = 16 << 10
+
+// apiEventRequest — тело POST-запросов записи событий. Все поля необязательны, кроме нужных
+// конкретному запросу. Member — имя участника семьи, от которого записывается событие
+// (по умолчанию — выпустивший токен); At — время события (по умолчанию сейчас).
+type apiEventRequest struct {
+	Member      string     `json:"member"`
+	At          *time.Time `json:"at"`
+	StartAt     *time.Time `json:"start_at"`
+	EndAt       *time.Time `json:"end_at"`
+	Note        string     `json:"note"`
+	Kind        string     `json:"kind"`
+	Temperature float64    `json:"temperature"`
+	Symptoms    []string   `json:"symptoms"`
+}
+
+type apiActivity struct {
+	ID              int64      `json:"id"`
+	Kind            string     `json:"kind"`
+	StartAt         time.Time  `json:"start_at"`
+	EndAt           *time.Time `json:"end_at"`
+	DurationMinutes int        `json:"duration_minutes"`
+}
+
+type apiHealthEntry struct {
+	ID          int64     `json:"id"`
+	Kind        string    `json:"kind"`
+	Temperature float64   `json:"temperature,omitempty"`
+	Symptoms    []string  `json:"symptoms,omitempty"`
+	Note        string    `json:"note,omitempty"`
+	RecordedAt  time.Time `json:"recorded_at"`
+	Alert       bool      `json:"alert"`
+}
+
+// unprocessable оборачивает ошибку проверки Store (пересечение снов, время в будущем…) в ответ 422;
+// остальные ошибки (база, отмена запроса) уходят как есть и становятся 500.
+func unprocessable(err error) error {
+	var invalid *validationError
+	if !errors.As(err, &invalid) {
+		return err
+	}
+	return &apiError{Status: http.StatusUnprocessableEntity, Message: invalid.Error()}
+}
+
+// decodeEvent разбирает тело запроса и подменяет userCtx участником из поля member.
+func (a *apiServer) decodeEvent(r *http.Request, userCtx UserContext) (apiEventRequest, UserContext, error) {
+	var req apiEventRequest
+	decoder := json.NewDecoder(io.LimitReader(r.Body, apiMaxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return req, userCtx, badRequest("не понял JSON: %v", err)
+	}
+	name := strings.TrimSpace(req.Member)
+	if name == "" || strings.EqualFold(name, userCtx.Member.DisplayName) {
+		return req, userCtx, nil
+	}
+	members, err := a.store.GetFamilyMembers(r.Context(), userCtx.Family.ID)
+	if err != nil {
+		return req, userCtx, err
+	}
+	for _, member := range members {
+		if strings.EqualFold(member.DisplayName, name) {
+			memberCtx, err := a.store.GetUserContext(r.Context(), member.TelegramUserID)
+			return req, memberCtx, err
+		}
+	}
+	return req, userCtx, badRequest("в семье нет участника %q", name)
+}
+
+func (req apiEventRequest) at(now time.Time) time.Time {
+	if req.At == nil {
+		return now
+	}
+	return req.At.UTC()
+}
+
+// notifyFamily сообщает семье об изменении от имени участника с пометкой, что оно пришло через API.
+func (a *apiServer) notifyFamily(r *http.Request, userCtx UserContext, text string) {
+	if a.notify == nil {
+		return
+	}
+	a.notify(r.Context(), userCtx, fmt.Sprintf("%s (через API): %s", escapeTelegramMarkdown(userCtx.Member.DisplayName), text))
+}
+
+func (a *apiServer) startSleep(w http.ResponseWriter, r *http.Request, userCtx UserContext) error {
+	req, userCtx, err := a.decodeEvent(r, userCtx)
+	if err != nil {
+		return err
+	}
+	session, err := a.store.StartSleep(r.Context(), userCtx.Child.ID, userCtx.Member.ID, req.at(a.now()), sourceAPI)
+	if err != nil {
+		return unprocessable(err)
+	}
+	emitWebhookEvent(r.Context(), a.store, userCtx.Family, userCtx.Child, &userCtx.Member, webhookEventSleepStarted, toAPISleep(*session, a.now()))
+	a.notifyFamily(r, userCtx, fmt.Sprintf("сон начался в %s.", formatLocalDateTime(session.StartAt, apiLocation(userCtx))))
+	writeJSON(w, http.StatusCreated, toAPISleep(*session, a.now()))
+	return nil
+}
+
+func (a *apiServer) endSleep(w http.ResponseWriter, r *http.Request, userCtx UserContext) error {
+	req, userCtx, err := a.decodeEvent(r, userCtx)
+	if err != nil {
+		return err
+	}
+	session, err := a.store.EndSleep(r.Context(), userCtx.Child.ID, userCtx.Member.ID, req.at(a.now()), sourceAPI)
+	if err != nil {
+		return unprocessable(err)
+	}
+	emitWebhookEvent(r.Context(), a.store, userCtx.Family, userCtx.Child, &userCtx.Member, webhookEventSleepEnded, toAPISleep(*session, a.now()))
+	a.notifyFamily(r, userCtx, fmt.Sprintf("сон завершен в %s, длительность %s.",
+		formatLocalDateTime(*session.EndAt, apiLocation(userCtx)), formatDurationRU(session.EndAt.Sub(session.StartAt)),
+	))
+	writeJSON(w, http.StatusOK, toAPISleep(*session, a.now()))
+	return nil
+}
+
+// addSleep записывает завершенный сон задним числом: `{"start_at": "...", "end_at": "...", "note": "..."}`.
+func (a *apiServer) addSleep(w http.ResponseWriter, r *http.Request, userCtx UserContext) error {
+	req, userCtx, err := a.decodeEvent(r, userCtx)
+	if err != nil {
+		return err
+	}
+	if req.StartAt == nil || req.EndAt == nil {
+		return badRequest("нужны start_at и end_at")
+	}
+	session, err := a.store.AddManualSleep(r.Context(), userCtx.Child.ID, userCtx.Member.ID, req.StartAt.UTC(), req.EndAt.UTC(), req.Note)
+	if err != nil {
+		return unprocessable(err)
+	}
+	emitWebhookEvent(r.Context(), a.store, userCtx.Family, userCtx.Child, &userCtx.Member, webhookEventSleepAdded, toAPISleep(*session, a.now()))
+	loc := apiLocation(userCtx)
+	a.notifyFamily(r, userCtx, fmt.Sprintf("записан сон %s – %s (%s).",
+		formatLocalDateTime(session.StartAt, loc), formatLocalDateTime(*session.EndAt, loc), formatDurationRU(session.EndAt.Sub(session.StartAt)),
+	))
+	writeJSON(w, http.StatusCreated, toAPISleep(*session, a.now()))
+	return nil
+}
+
+func (a *apiServer) startActivity(w http.ResponseWriter, r *http.Request, userCtx UserContext) error {
+	req, userCtx, err := a.decodeEvent(r, userCtx)
+	if err != nil {
+		return err
+	}
+	kind, ok := resolveActivityKind(req.Kind)
+	if !ok {
+		return badRequest("kind — одна из активностей: %s", activityKindLabels())
+	}
+	activity, err := a.store.StartActivity(r.Context(), userCtx.Child.ID, userCtx.Member.ID, kind.ID, req.at(a.now()))
+	if err != nil {
+		return unprocessable(err)
+	}
+	a.notifyFamily(r, userCtx, fmt.Sprintf("%s — начато в %s.", kind.Label, formatLocalDateTime(activity.StartAt, apiLocation(userCtx))))
+	writeJSON(w, http.StatusCreated, toAPIActivity(*activity, a.now()))
+	return nil
+}
+
+func (a *apiServer) endActivity(w http.ResponseWriter, r *http.Request, userCtx UserContext) error {
+	req, userCtx, err := a.decodeEvent(r, userCtx)
+	if err != nil {
+		return err
+	}
+	kind, ok := resolveActivityKind(req.Kind)
+	if !ok {
+		return badRequest("kind — одна из активностей: %s", activityKindLabels())
+	}
+	activity, err := a.store.EndActivity(r.Context(), userCtx.Child.ID, userCtx.Member.ID, kind.ID, req.at(a.now()))
+	if err != nil {
+		return unprocessable(err)
+	}
+	a.notifyFamily(r, userCtx, fmt.Sprintf("%s — завершено, %s.", kind.Label, formatDurationRU(activity.EndAt.Sub(activity.StartAt))))
+	writeJSON(w, http.StatusOK, toAPIActivity(*activity, a.now()))
+	return nil
+}
+
+// addTemperature записывает температуру: `{"temperature": 38.2}`; при превышении порога /tempalert
+// оповещение семьи помечается как тревожное.
+func (a *apiServer) addTemperature(w http.ResponseWriter, r *http.Request, userCtx UserContext) error {
+	req, userCtx, err := a.decodeEvent(r, userCtx)
+	if err != nil {
+		return err
+	}
+	entry, err := a.store.AddHealthEntry(r.Context(), userCtx.Child.ID, userCtx.Member.ID, HealthEntry{
+		Kind:        healthTemperature,
+		Temperature: req.Temperature,
+		RecordedAt:  req.at(a.now()),
+	})
+	if err != nil {
+		return unprocessable(err)
+	}
+	alert := TemperatureAlertTriggered(*entry, userCtx.Settings.TemperatureAlert)
+	text := fmt.Sprintf("температура %s (%s).", formatTemperature(entry.Temperature), formatLocalDateTime(entry.RecordedAt, apiLocation(userCtx)))
+	if alert {
+		text = fmt.Sprintf("внимание, у %s %s Порог оповещения — %s.", escapeTelegramMarkdown(userCtx.Child.Name), text, formatTemperature(userCtx.Settings.TemperatureAlert))
+	}
+	a.notifyFamily(r, userCtx, text)
+	writeJSON(w, http.StatusCreated, toAPIHealthEntry(*entry, alert))
+	return nil
+}
+
+// addSymptom записывает симптомы: `{"symptoms": ["кашель", "насморк"], "note": "ночью хуже"}`.
+func (a *apiServer) addSymptom(w http.ResponseWriter, r *http.Request, userCtx UserContext) error {
+	req, userCtx, err := a.decodeEvent(r, userCtx)
+	if err != nil {
+		return err
+	}
+	var symptoms []string
+	for _, symptom := range req.Symptoms {
+		if symptom = strings.ToLower(strings.TrimSpace(symptom)); symptom != "" {
+			symptoms = append(symptoms, symptom)
+		}
+	}
+	entry, err := a.store.AddHealthEntry(r.Context(), userCtx.Child.ID, userCtx.Member.ID, HealthEntry{
+		Kind:       healthSymptom,
+		Tags:       symptoms,
+		Note:       strings.TrimSpace(req.Note),
+		RecordedAt: req.at(a.now()),
+	})
+	if err != nil {
+		return unprocessable(err)
+	}
+	a.notifyFamily(r, userCtx, fmt.Sprintf("симптомы (%s): %s.", formatLocalDateTime(entry.RecordedAt, apiLocation(userCtx)), escapeTelegramMarkdown(strings.Join(entry.Tags, ", "))))
+	writeJSON(w, http.StatusCreated, toAPIHealthEntry(*entry, false))
+	return nil
+}
+
+func toAPIActivity(activity ActivitySession, now time.Time) apiActivity {
+	end := now
+	if activity.EndAt != nil {
+		end = *activity.EndAt
+	}
+	return apiActivity{
+		ID:              activity.ID,
+		Kind:            activity.Kind,
+		StartAt:         activity.StartAt,
+		EndAt:           activity.EndAt,
+		DurationMinutes: minutes(end.Sub(activity.StartAt)),
+	}
+}
+
+func toAPIHealthEntry(entry HealthEntry, alert bool) apiHealthEntry {
+	return apiHealthEntry{
+		ID:          entry.ID,
+		Kind:        entry.Kind,
+		Temperature: entry.Temperature,
+		Symptoms:    entry.Tags,
+		Note:        entry.Note,
+		RecordedAt:  entry.RecordedAt,
+		Alert:       alert,
+	}
+}
@@ -66,3 +66,32 @@ func formatChildBirthForSettings(t time.Time, familyLoc *time.Location) string {
 	}
 	return t.In(familyLoc).Format("02.01.2006 15:04")
 }
+
+// formatChildAgeRU возвращает возраст на момент now в виде «3 мес. 12 дн.» (календарные месяцы в таймзоне семьи).
+func formatChildAgeRU(birth time.Time, now time.Time, loc *time.Location) string {
+	anchor, ok := BirthAnchorLocal(&birth, loc)
+	if !ok || now.Before(anchor) {
+		return "неизвестен"
+	}
+	nowLocal := now.In(loc)
+	months := (nowLocal.Year()-anchor.Year())*12 + int(nowLocal.Month()-anchor.Month())
+	if anchor.AddDate(0, months, 0).After(nowLocal) {
+		months--
+	}
+	days := 0
+	for anchor.AddDate(0, months, days+1).Before(nowLocal) || anchor.AddDate(0, months, days+1).Equal(nowLocal) {
+		days++
+	}
+
+	var parts []string
+	if years := months / 12; years > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", years, ruPlural(years, "год", "года", "лет")))
+	}
+	if rest := months % 12; rest > 0 {
+		parts = append(parts, fmt.Sprintf("%d мес.", rest))
+	}
+	if days > 0 || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%d дн.", days))
+	}
+	return strings.Join(parts, " ")
+}
@@ -56,3 +56,23 @@ func TestFormatChildBirthForSettings(t *testing.T) {
 		t.Fatalf("with time: %q", g)
 	}
 }
+
+func TestFormatChildAgeRU(t *testing.T) {
+	t.Parallel()
+	loc := time.FixedZone("MSK", 3*3600)
+	birth := time.Date(2026, 1, 31, 14, 0, 0, 0, loc)
+	cases := []struct {
+		now  time.Time
+		want string
+	}{
+		{time.Date(2026, 1, 31, 20, 0, 0, 0, loc), "0 дн."},
+		{time.Date(2026, 2, 10, 15, 0, 0, 0, loc), "10 дн."},
+		{time.Date(2026, 3, 31, 15, 0, 0, 0, loc), "2 мес."},
+		{time.Date(2027, 4, 5, 15, 0, 0, 0, loc), "1 год 2 мес. 5 дн."},
+	}
+	for _, tc := range cases {
+		if got := formatChildAgeRU(birth, tc.now, loc); got != tc.want {
+			t.Fatalf("age at %s: got %q want %q", tc.now, got, tc.want)
+		}
+	}
+}
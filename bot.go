@@ -9,7 +9,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -25,6 +26,7 @@ const (
 	stateAwaitingTimezone    = "awaiting_timezone"
 	stateAwaitingBirthDate   = "awaiting_birth_date"
 	stateAwaitingReminder    = "awaiting_custom_reminder"
+	stateAwaitingSleepNote   = "awaiting_sleep_note"
 
 	// Онбординг нового пользователя/семьи (профиль): имя -> таймзона -> дата рождения.
 	stateOnboardingChildName = "onboarding_child_name"
@@ -52,60 +54,114 @@ func isOnboardingState(state string) bool {
 	}
 }
 
+// telegramAPI — вызовы Telegram Bot API, которые использует бот; *tgbotapi.BotAPI ему
+// соответствует, а тесты подставляют запись исходящих сообщений.
+type telegramAPI interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel
+}
+
 type SleepBot struct {
-	api   *tgbotapi.BotAPI
-	store *Store
-	cfg   Config
+	api     telegramAPI
+	store   *Store
+	cfg     Config
+	metrics *botMetrics
+	limiter *sendLimiter
+	// Сроки напоминаний по семьям для RunReminders.
+	reminders *reminderScheduler
+	// outboxWake будит RunOutbox, когда в очередь попали новые уведомления.
+	outboxWake chan struct{}
 }
 
 type pendingActionPayload struct {
-	Note string `json:"note,omitempty"`
+	Note      string `json:"note,omitempty"`
+	SessionID int64  `json:"session_id,omitempty"`
 }
 
-func NewSleepBot(api *tgbotapi.BotAPI, store *Store, cfg Config) *SleepBot {
+func NewSleepBot(api telegramAPI, store *Store, cfg Config) *SleepBot {
 	return &SleepBot{
-		api:   api,
-		store: store,
-		cfg:   cfg,
+		api:        api,
+		store:      store,
+		cfg:        cfg,
+		metrics:    newBotMetrics(),
+		limiter:    newSendLimiter(store.clock),
+		reminders:  newReminderScheduler(),
+		outboxWake: make(chan struct{}, 1),
 	}
 }
 
+// now — текущее время по часам Store; в тестах часы подменяются.
+func (b *SleepBot) now() time.Time {
+	return b.store.clock()
+}
+
 func (b *SleepBot) Run(ctx context.Context) error {
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = b.cfg.PollTimeout
-	u.AllowedUpdates = []string{"message"}
+	u.AllowedUpdates = []string{"message", "callback_query"}
 
 	updates := b.api.GetUpdatesChan(u)
+	// Обработка не отменяется вместе с ctx: при остановке принятые обновления дорабатываются,
+	// пока не выйдет ShutdownTimeout.
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	dispatcher := newUpdateDispatcher(workCtx, b.cfg.UpdateWorkers, b.cfg.UpdateQueueSize, b.updateFamily(workCtx), b.processUpdate)
 	for {
 		select {
 		case <-ctx.Done():
+			if !dispatcher.drain(b.cfg.ShutdownTimeout) {
+				slog.Warn("shutdown timeout, updates still in progress", "timeout", b.cfg.ShutdownTimeout)
+			}
 			return ctx.Err()
 		case update := <-updates:
-			if update.Message == nil {
+			if update.CallbackQuery == nil && update.Message == nil {
 				continue
 			}
-			if err := b.handleMessage(ctx, update.Message); err != nil {
-				log.Printf("handle message error: %v", err)
-				_ = b.sendText(update.Message.Chat.ID, "Не получилось обработать сообщение. Попробуйте еще раз.")
+			if !dispatcher.dispatch(ctx, update) {
+				slog.Warn("update dropped on shutdown", "update_id", update.UpdateID)
 			}
 		}
 	}
 }
 
-func (b *SleepBot) RunReminders(ctx context.Context) {
-	ticker := time.NewTicker(b.cfg.ReminderTick)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			if err := b.processReminders(ctx); err != nil {
-				log.Printf("reminders error: %v", err)
-			}
+// updateFamily — семья отправителя для порядка обработки обновлений; при ошибке базы 0,
+// и обновление упорядочивается только по пользователю.
+func (b *SleepBot) updateFamily(ctx context.Context) func(userID int64) int64 {
+	return func(userID int64) int64 {
+		familyID, err := b.store.GetFamilyIDByTelegramUser(ctx, userID)
+		if err != nil {
+			slog.Warn("family lookup for update order failed", "error", err)
+			return 0
 		}
+		return familyID
+	}
+}
+
+// processUpdate обрабатывает одно обновление с логом и метриками; вызывается воркерами updateDispatcher.
+func (b *SleepBot) processUpdate(ctx context.Context, update tgbotapi.Update) {
+	command := updateMetricLabel(update)
+	updateCtx, scope := withUpdateLog(ctx, slog.Default().With("update_id", update.UpdateID, "command", command))
+	started := time.Now()
+	err := b.handleUpdate(updateCtx, update)
+	elapsed := time.Since(started)
+	b.metrics.observeUpdate(command, elapsed, err)
+	if err != nil {
+		scope.Logger().Error("handle update failed", "error", err, "duration", elapsed)
+	} else {
+		scope.Logger().Debug("update handled", "duration", elapsed)
+	}
+}
+
+func (b *SleepBot) handleUpdate(ctx context.Context, update tgbotapi.Update) error {
+	if update.CallbackQuery != nil {
+		return b.handleCallback(ctx, update.CallbackQuery)
 	}
+	err := b.handleMessage(ctx, update.Message)
+	if err != nil {
+		_ = b.sendText(update.Message.Chat.ID, "Не получилось обработать сообщение. Попробуйте еще раз.")
+	}
+	return err
 }
 
 func (b *SleepBot) handleMessage(ctx context.Context, msg *tgbotapi.Message) error {
@@ -140,6 +196,9 @@ func (b *SleepBot) handleMessage(ctx context.Context, msg *tgbotapi.Message) err
 	default:
 		return err
 	}
+	setLogFamily(ctx, userCtx.Family.ID)
+	// Любое действие участника может сдвинуть сроки напоминаний семьи: пересчитываем их после обработки.
+	defer b.reminders.touch(userCtx.Family.ID)
 
 	if created && ((msg.IsCommand() && strings.EqualFold(msg.Command(), "start")) || !msg.IsCommand()) {
 		// Для новой семьи сразу запускаем онбординг профиля, чтобы отчёты/таймзона/вехи работали корректно.
@@ -193,6 +252,101 @@ func (b *SleepBot) startOnboarding(ctx context.Context, userCtx UserContext, cha
 	return b.sendTextWithKeyboard(chatID, intro, b.mainKeyboard(false))
 }
 
+// handleCallback обрабатывает нажатия inline-кнопок; data имеет вид `med:<id>`, `tag:<id сна>:<тег>`,
+// `note:<id сна>`, `rt:<id ритуала>:<шаг>`, `act:<вид активности>` или `bag:<id сцеживания>:<хранение>`.
+func (b *SleepBot) handleCallback(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+	if _, err := b.request(tgbotapi.NewCallback(query.ID, "")); err != nil {
+		loggerFrom(ctx).Warn("answer callback failed", "error", err)
+	}
+	if query.From == nil || query.Message == nil || query.Message.Chat == nil {
+		return nil
+	}
+	chatID := query.Message.Chat.ID
+	userCtx, err := b.store.GetUserContext(ctx, query.From.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return b.sendText(chatID, "Сначала отправьте /start.")
+	}
+	if err != nil {
+		return err
+	}
+	setLogFamily(ctx, userCtx.Family.ID)
+	defer b.reminders.touch(userCtx.Family.ID)
+
+	parts := strings.Split(query.Data, ":")
+	if len(parts) < 2 {
+		return nil
+	}
+	if parts[0] == "act" {
+		return b.toggleActivityFromPanel(ctx, userCtx, query.Message, parts[1])
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil
+	}
+	switch {
+	case parts[0] == "med":
+		return b.giveMedication(ctx, userCtx, chatID, id)
+	case parts[0] == "tag" && len(parts) == 3:
+		return b.toggleSessionTag(ctx, userCtx, query.Message, id, parts[2])
+	case parts[0] == "note":
+		if err := b.store.SetUserState(ctx, query.From.ID, userCtx.Family.ID, stateAwaitingSleepNote, pendingActionPayload{SessionID: id}); err != nil {
+			return err
+		}
+		return b.sendText(chatID, "Отправьте заметку ко сну одним сообщением (или /cancel).")
+	case parts[0] == "rt" && len(parts) == 3:
+		step, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil
+		}
+		return b.toggleRoutineStep(ctx, userCtx, query.Message, id, step)
+	case parts[0] == "bag" && len(parts) == 3:
+		return b.stashPumping(ctx, userCtx, chatID, id, parts[2])
+	}
+	return nil
+}
+
+func (b *SleepBot) toggleSessionTag(ctx context.Context, userCtx UserContext, message *tgbotapi.Message, sessionID int64, tag string) error {
+	session, err := b.store.GetChildSleep(ctx, userCtx.Child.ID, sessionID)
+	if err != nil {
+		return b.sendText(message.Chat.ID, escapeTelegramMarkdown(err.Error()))
+	}
+	if _, ok := sleepTagLabel(tag); !ok {
+		return nil
+	}
+	session.Tags = toggleSleepTag(session.Tags, tag)
+	if err := b.store.SetSleepTags(ctx, userCtx.Child.ID, session.ID, userCtx.Member.ID, session.Tags); err != nil {
+		return err
+	}
+	edit := tgbotapi.NewEditMessageReplyMarkup(message.Chat.ID, message.MessageID, sleepTagsKeyboard(*session))
+	_, err = b.request(edit)
+	return err
+}
+
+// sendSleepTagsPrompt предлагает отметить условия сна кнопками.
+func (b *SleepBot) sendSleepTagsPrompt(chatID int64, session SleepSession, loc *time.Location) error {
+	return b.sendTextWithInlineKeyboard(chatID, BuildSleepTagsPrompt(session, loc), sleepTagsKeyboard(session))
+}
+
+// sleepTagsKeyboard — строка кнопок на группу тегов (отмеченные с ✓) и кнопка заметки.
+func sleepTagsKeyboard(session SleepSession) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, group := range sleepTagGroups {
+		var row []tgbotapi.InlineKeyboardButton
+		for _, option := range group {
+			label := option.Label
+			if hasSleepTag(session, option.ID) {
+				label = "✓ " + label
+			}
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("tag:%d:%s", session.ID, option.ID)))
+		}
+		rows = append(rows, row)
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Заметка", fmt.Sprintf("note:%d", session.ID)),
+	))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
 func (b *SleepBot) handleJoinOnly(ctx context.Context, msg *tgbotapi.Message) error {
 	code := strings.TrimSpace(msg.CommandArguments())
 	if code == "" {
@@ -202,6 +356,8 @@ func (b *SleepBot) handleJoinOnly(ctx context.Context, msg *tgbotapi.Message) er
 	if err != nil {
 		return b.sendText(msg.Chat.ID, escapeTelegramMarkdown(err.Error()))
 	}
+	// У семьи появился участник: его сводки и сцеживания входят в ее сроки.
+	b.reminders.touch(joined.Family.ID)
 	return b.sendTextWithKeyboard(msg.Chat.ID, fmt.Sprintf("Готово. Теперь вы привязаны к семье `%s`.", escapeTelegramMarkdown(joined.Family.Name)), b.mainKeyboard(false))
 }
 
@@ -246,21 +402,205 @@ func (b *SleepBot) handleCommand(ctx context.Context, userCtx UserContext, msg *
 		if err != nil {
 			return b.sendText(msg.Chat.ID, escapeTelegramMarkdown(err.Error()))
 		}
+		b.reminders.touch(joined.Family.ID)
 		return b.sendTextWithKeyboard(msg.Chat.ID, fmt.Sprintf("Готово. Теперь вы привязаны к семье `%s`.", escapeTelegramMarkdown(joined.Family.Name)), b.mainKeyboard(false))
 	case "status":
 		return b.sendStatus(ctx, userCtx, msg.Chat.ID)
 	case "server_status":
 		return b.sendServerStatus(ctx, msg.Chat.ID)
 	case "report":
+		if args != "" {
+			start, end, err := parseReportDateRange(args, b.now(), b.mustLocation(userCtx.Family.Timezone))
+			if err != nil {
+				return b.sendText(msg.Chat.ID, fmt.Sprintf("Не понял период (%s). Пример: `/report 01.03-15.03` или `/report 01.03.2026-15.03.2026`.", escapeTelegramMarkdown(err.Error())))
+			}
+			return b.sendRangeReport(ctx, userCtx, msg.Chat.ID, start, end, "")
+		}
 		return b.sendDashboard(ctx, userCtx, msg.Chat.ID)
 	case "export_csv":
 		return b.sendExportCSV(ctx, userCtx, msg.Chat.ID)
+	case "pdf_report":
+		days := pdfReportDefaultDays
+		if args != "" {
+			parsed, err := strconv.Atoi(args)
+			if err != nil || parsed < 1 || parsed > pdfReportMaxDays {
+				return b.sendText(msg.Chat.ID, fmt.Sprintf("Использование: `/pdf_report 30` (от 1 до %d дней).", pdfReportMaxDays))
+			}
+			days = parsed
+		}
+		return b.sendPDFReport(ctx, userCtx, msg.Chat.ID, days)
 	case "day":
-		return b.sendDayReport(ctx, userCtx, msg.Chat.ID)
-	case "week":
-		return b.sendRangeReport(ctx, userCtx, msg.Chat.ID, 7)
-	case "month":
-		return b.sendRangeReport(ctx, userCtx, msg.Chat.ID, 30)
+		day := b.now()
+		if args != "" {
+			parsed, err := parseReportDate(args, b.now(), b.mustLocation(userCtx.Family.Timezone))
+			if err != nil {
+				return b.sendText(msg.Chat.ID, "Использование: `/day` или `/day 12.03` (можно `/day 12.03.2026`).")
+			}
+			day = parsed
+		}
+		return b.sendDayReport(ctx, userCtx, msg.Chat.ID, day)
+	case "week", "month":
+		return b.sendPeriodReport(ctx, userCtx, msg.Chat.ID, command, args)
+	case "evaluate":
+		days := normsDefaultWindowDays
+		if args != "" {
+			parsed, err := strconv.Atoi(args)
+			if err != nil || !isNormsWindow(parsed) {
+				return b.sendText(msg.Chat.ID, "Использование: `/evaluate 3` (окно 1, 3, 7 или 14 дней).")
+			}
+			days = parsed
+		}
+		return b.sendEvaluation(ctx, userCtx, msg.Chat.ID, days)
+	case "digest":
+		return b.updateDigest(ctx, userCtx, msg.Chat.ID, args)
+	case "compare":
+		loc := b.mustLocation(userCtx.Family.Timezone)
+		previousStart, previousEnd, currentStart, currentEnd, err := parseCompareRanges(args, b.now(), loc)
+		if err != nil {
+			return b.sendText(msg.Chat.ID, fmt.Sprintf("Не понял периоды (%s). Примеры: `/compare`, `/compare month`, `/compare 14` или `/compare 01.03-07.03 08.03-14.03`.", escapeTelegramMarkdown(err.Error())))
+		}
+		return b.sendCompareReport(ctx, userCtx, msg.Chat.ID, previousStart, previousEnd, currentStart, currentEnd)
+	case "weight", "height", "head":
+		return b.recordMeasurement(ctx, userCtx, msg.Chat.ID, command, args)
+	case "growth":
+		return b.sendGrowthReport(ctx, userCtx, msg.Chat.ID)
+	case "setsex":
+		sex, ok := parseChildSex(args)
+		if !ok {
+			return b.sendText(msg.Chat.ID, "Использование: `/setsex мальчик` или `/setsex девочка`.")
+		}
+		if err := b.store.SetChildSex(ctx, userCtx.Family.ID, sex); err != nil {
+			return err
+		}
+		return b.sendText(msg.Chat.ID, "Пол ребенка обновлен.")
+	case "tags":
+		return b.sendSessionTags(ctx, userCtx, msg.Chat.ID, args)
+	case "bytag":
+		return b.sendSleepTagReport(ctx, userCtx, msg.Chat.ID, args)
+	case "tummy", "walk", "play":
+		return b.handleActivityCommand(ctx, userCtx, msg.Chat.ID, command, args)
+	case "activities":
+		return b.sendActivitiesPanel(ctx, userCtx, msg.Chat.ID)
+	case "goal":
+		return b.setActivityGoal(ctx, userCtx, msg.Chat.ID, args)
+	case "pump":
+		return b.handlePumpCommand(ctx, userCtx, msg.Chat.ID, args)
+	case "pumplog":
+		days := pumpingReportDays
+		if args != "" {
+			parsed, err := strconv.Atoi(args)
+			if err != nil || parsed < 1 || parsed > reportMaxRangeDays {
+				return b.sendText(msg.Chat.ID, fmt.Sprintf("Использование: `/pumplog 14` (от 1 до %d дней).", reportMaxRangeDays))
+			}
+			days = parsed
+		}
+		return b.sendPumpingReport(ctx, userCtx, msg.Chat.ID, days)
+	case "pumpevery":
+		minutes := 0
+		if on, ok := parseOnOffArg(args); !ok || on {
+			parsed, err := strconv.Atoi(args)
+			if err != nil || parsed < 1 {
+				return b.sendText(msg.Chat.ID, "Использование: `/pumpevery 180` (минут с конца последнего сцеживания) или `/pumpevery off`.")
+			}
+			minutes = parsed
+		}
+		if err := b.store.SetPumpInterval(ctx, userCtx.Member.ID, minutes); err != nil {
+			return b.sendText(msg.Chat.ID, escapeTelegramMarkdown(err.Error()))
+		}
+		return b.sendText(msg.Chat.ID, fmt.Sprintf("Напоминание о сцеживании (только вам): %s.", pumpIntervalLabel(minutes)))
+	case "stash":
+		return b.handleStashCommand(ctx, userCtx, msg.Chat.ID, args)
+	case "bottle":
+		return b.recordBottleFeed(ctx, userCtx, msg.Chat.ID, args)
+	case "apitoken":
+		return b.handleAPITokenCommand(ctx, userCtx, msg.Chat.ID, args)
+	case "calendar":
+		return b.handleCalendarCommand(ctx, userCtx, msg.Chat.ID, args)
+	case "webhooks":
+		return b.handleWebhooksCommand(ctx, userCtx, msg.Chat.ID, args)
+	case "routine":
+		return b.startRoutine(ctx, userCtx, msg.Chat.ID)
+	case "routine_steps":
+		return b.setRoutineSteps(ctx, userCtx, msg.Chat.ID, args)
+	case "routine_report":
+		days := routineReportDays
+		if args != "" {
+			parsed, err := strconv.Atoi(args)
+			if err != nil || parsed < 1 || parsed > reportMaxRangeDays {
+				return b.sendText(msg.Chat.ID, fmt.Sprintf("Использование: `/routine_report 30` (от 1 до %d дней).", reportMaxRangeDays))
+			}
+			days = parsed
+		}
+		return b.sendRoutineReport(ctx, userCtx, msg.Chat.ID, days)
+	case "temp":
+		loc := b.mustLocation(userCtx.Family.Timezone)
+		value, at, err := parseTemperatureArgs(args, b.now(), loc)
+		if err != nil {
+			return b.sendText(msg.Chat.ID, fmt.Sprintf("Не понял (%s). Использование: `/temp 38.2` или `/temp 38.2 14:30`.", escapeTelegramMarkdown(err.Error())))
+		}
+		return b.recordHealthEntry(ctx, userCtx, msg.Chat.ID, HealthEntry{Kind: healthTemperature, Temperature: value, RecordedAt: at})
+	case "symptom":
+		tags, note, at, err := parseSymptomArgs(args, b.now(), b.mustLocation(userCtx.Family.Timezone))
+		if err != nil {
+			return b.sendText(msg.Chat.ID, "Использование: `/symptom кашель, насморк; ночью хуже` (можно начать со времени: `/symptom 14:30 сыпь`).")
+		}
+		return b.recordHealthEntry(ctx, userCtx, msg.Chat.ID, HealthEntry{Kind: healthSymptom, Tags: tags, Note: note, RecordedAt: at})
+	case "sick":
+		days := sickDefaultDays
+		if args != "" {
+			parsed, err := strconv.Atoi(args)
+			if err != nil || parsed < 1 || parsed > sickMaxDays {
+				return b.sendText(msg.Chat.ID, fmt.Sprintf("Использование: `/sick 7` (от 1 до %d дней).", sickMaxDays))
+			}
+			days = parsed
+		}
+		return b.sendSickReport(ctx, userCtx, msg.Chat.ID, days)
+	case "tempalert":
+		threshold := 0.0
+		if on, ok := parseOnOffArg(args); ok && on {
+			threshold = temperatureAlertDefault
+		} else if !ok {
+			parsed, err := strconv.ParseFloat(strings.ReplaceAll(args, ",", "."), 64)
+			if err != nil {
+				return b.sendText(msg.Chat.ID, "Использование: `/tempalert 38.5`, `/tempalert on` (38 °C) или `/tempalert off`.")
+			}
+			threshold = parsed
+		}
+		if err := b.store.SetTemperatureAlert(ctx, userCtx.Family.ID, threshold); err != nil {
+			return b.sendText(msg.Chat.ID, escapeTelegramMarkdown(err.Error()))
+		}
+		return b.sendText(msg.Chat.ID, fmt.Sprintf("Оповещение о температуре: %s.", formatTemperatureAlert(threshold)))
+	case "addmed":
+		medication, err := parseMedicationArgs(args)
+		if err != nil {
+			return b.sendText(msg.Chat.ID, fmt.Sprintf("Не понял (%s). Примеры: `/addmed Витамин D; 1 капля; 09:00`, `/addmed Нурофен; 2.5 мл; каждые 6 ч`.", escapeTelegramMarkdown(err.Error())))
+		}
+		added, err := b.store.AddMedication(ctx, userCtx.Child.ID, userCtx.Member.ID, medication)
+		if err != nil {
+			return b.sendText(msg.Chat.ID, escapeTelegramMarkdown(err.Error()))
+		}
+		text := fmt.Sprintf("Добавлено: *%d. %s* — %s.", added.ID, formatMedicationTitle(*added), formatMedicationSchedule(*added))
+		if added.AtTimes != "" && !userCtx.Settings.RemindersEnabled {
+			text += "\nНапоминания о приёме придут после `/reminders_on`."
+		}
+		return b.sendText(msg.Chat.ID, text)
+	case "meds":
+		return b.sendMedications(ctx, userCtx, msg.Chat.ID)
+	case "give":
+		id, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			return b.sendText(msg.Chat.ID, "Использование: `/give 1` (номер из `/meds`).")
+		}
+		return b.giveMedication(ctx, userCtx, msg.Chat.ID, id)
+	case "delmed":
+		id, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			return b.sendText(msg.Chat.ID, "Использование: `/delmed 1` (номер из `/meds`).")
+		}
+		if err := b.store.DeactivateMedication(ctx, userCtx.Child.ID, id); err != nil {
+			return b.sendText(msg.Chat.ID, escapeTelegramMarkdown(err.Error()))
+		}
+		return b.sendText(msg.Chat.ID, "Лекарство удалено, журнал доз сохранён.")
 	case "settings":
 		return b.sendSettings(ctx, userCtx, msg.Chat.ID)
 	case "reminders":
@@ -355,25 +695,25 @@ func (b *SleepBot) handleText(ctx context.Context, userCtx UserContext, msg *tgb
 	text := strings.TrimSpace(msg.Text)
 	switch text {
 	case "Сон начался":
-		return b.startSleep(ctx, userCtx, msg.Chat.ID, time.Now(), sourceRealTime)
+		return b.startSleep(ctx, userCtx, msg.Chat.ID, b.now(), sourceRealTime)
 	case "Начался 5 минут назад":
-		return b.startSleep(ctx, userCtx, msg.Chat.ID, time.Now().Add(-5*time.Minute), sourceQuickBackdate)
+		return b.startSleep(ctx, userCtx, msg.Chat.ID, b.now().Add(-5*time.Minute), sourceQuickBackdate)
 	case "Начался 10 минут назад":
-		return b.startSleep(ctx, userCtx, msg.Chat.ID, time.Now().Add(-10*time.Minute), sourceQuickBackdate)
+		return b.startSleep(ctx, userCtx, msg.Chat.ID, b.now().Add(-10*time.Minute), sourceQuickBackdate)
 	case "Начался 15 минут назад":
-		return b.startSleep(ctx, userCtx, msg.Chat.ID, time.Now().Add(-15*time.Minute), sourceQuickBackdate)
+		return b.startSleep(ctx, userCtx, msg.Chat.ID, b.now().Add(-15*time.Minute), sourceQuickBackdate)
 	case "Начался 30 минут назад":
-		return b.startSleep(ctx, userCtx, msg.Chat.ID, time.Now().Add(-30*time.Minute), sourceQuickBackdate)
+		return b.startSleep(ctx, userCtx, msg.Chat.ID, b.now().Add(-30*time.Minute), sourceQuickBackdate)
 	case "Сон закончился":
-		return b.endSleep(ctx, userCtx, msg.Chat.ID, time.Now(), sourceRealTime)
+		return b.endSleep(ctx, userCtx, msg.Chat.ID, b.now(), sourceRealTime)
 	case "Закончился 5 минут назад":
-		return b.endSleep(ctx, userCtx, msg.Chat.ID, time.Now().Add(-5*time.Minute), sourceQuickBackdate)
+		return b.endSleep(ctx, userCtx, msg.Chat.ID, b.now().Add(-5*time.Minute), sourceQuickBackdate)
 	case "Закончился 10 минут назад":
-		return b.endSleep(ctx, userCtx, msg.Chat.ID, time.Now().Add(-10*time.Minute), sourceQuickBackdate)
+		return b.endSleep(ctx, userCtx, msg.Chat.ID, b.now().Add(-10*time.Minute), sourceQuickBackdate)
 	case "Закончился 15 минут назад":
-		return b.endSleep(ctx, userCtx, msg.Chat.ID, time.Now().Add(-15*time.Minute), sourceQuickBackdate)
+		return b.endSleep(ctx, userCtx, msg.Chat.ID, b.now().Add(-15*time.Minute), sourceQuickBackdate)
 	case "Закончился 30 минут назад":
-		return b.endSleep(ctx, userCtx, msg.Chat.ID, time.Now().Add(-30*time.Minute), sourceQuickBackdate)
+		return b.endSleep(ctx, userCtx, msg.Chat.ID, b.now().Add(-30*time.Minute), sourceQuickBackdate)
 	case "Добавить сон":
 		if err := b.store.SetUserState(ctx, msg.From.ID, userCtx.Family.ID, stateAwaitingManualSleep, pendingActionPayload{}); err != nil {
 			return err
@@ -391,9 +731,11 @@ func (b *SleepBot) handleText(ctx context.Context, userCtx UserContext, msg *tgb
 	case "Отчеты":
 		return b.sendDashboard(ctx, userCtx, msg.Chat.ID)
 	case "Оценить":
-		return b.sendEvaluation(ctx, userCtx, msg.Chat.ID)
+		return b.sendEvaluation(ctx, userCtx, msg.Chat.ID, normsDefaultWindowDays)
 	case "Напоминания":
 		return b.sendReminders(ctx, userCtx, msg.Chat.ID)
+	case "Активности":
+		return b.sendActivitiesPanel(ctx, userCtx, msg.Chat.ID)
 	case "Настройки":
 		return b.sendSettings(ctx, userCtx, msg.Chat.ID)
 	default:
@@ -464,19 +806,25 @@ func (b *SleepBot) handleState(ctx context.Context, userCtx UserContext, msg *tg
 		return true, b.sendTextWithKeyboard(msg.Chat.ID, finish, b.mainKeyboard(active != nil))
 
 	case stateAwaitingManualSleep:
-		startAt, endAt, err := parseSleepRange(text, time.Now(), b.mustLocation(userCtx.Family.Timezone))
+		startAt, endAt, err := parseSleepRange(text, b.now(), b.mustLocation(userCtx.Family.Timezone))
 		if err != nil {
 			return true, b.sendText(msg.Chat.ID, "Не понял интервал. Пример: `11:10 - 12:35`.")
 		}
-		if _, err := b.store.AddManualSleep(ctx, userCtx.Child.ID, userCtx.Member.ID, startAt, endAt, "manual"); err != nil {
+		session, err := b.store.AddManualSleep(ctx, userCtx.Child.ID, userCtx.Member.ID, startAt, endAt, "")
+		if err != nil {
 			return true, b.sendText(msg.Chat.ID, escapeTelegramMarkdown(err.Error()))
 		}
+		emitWebhookEvent(ctx, b.store, userCtx.Family, userCtx.Child, &userCtx.Member, webhookEventSleepAdded, toAPISleep(*session, b.now()))
 		if err := b.store.ClearUserState(ctx, msg.From.ID); err != nil {
 			return true, err
 		}
-		return true, b.sendTextWithKeyboard(msg.Chat.ID, fmt.Sprintf("Сон сохранен: %s - %s.", formatLocalDateTime(startAt, b.mustLocation(userCtx.Family.Timezone)), formatLocalDateTime(endAt, b.mustLocation(userCtx.Family.Timezone))), b.mainKeyboard(false))
+		loc := b.mustLocation(userCtx.Family.Timezone)
+		if err := b.sendTextWithKeyboard(msg.Chat.ID, fmt.Sprintf("Сон сохранен: %s - %s.", formatLocalDateTime(startAt, loc), formatLocalDateTime(endAt, loc)), b.mainKeyboard(false)); err != nil {
+			return true, err
+		}
+		return true, b.sendSleepTagsPrompt(msg.Chat.ID, *session, loc)
 	case stateAwaitingEditLast:
-		startAt, endAt, err := parseSleepRange(text, time.Now(), b.mustLocation(userCtx.Family.Timezone))
+		startAt, endAt, err := parseSleepRange(text, b.now(), b.mustLocation(userCtx.Family.Timezone))
 		if err != nil {
 			return true, b.sendText(msg.Chat.ID, "Не понял интервал. Пример: `11:10 - 12:35`.")
 		}
@@ -487,6 +835,19 @@ func (b *SleepBot) handleState(ctx context.Context, userCtx UserContext, msg *tg
 			return true, err
 		}
 		return true, b.sendText(msg.Chat.ID, "Последний сон обновлен.")
+	case stateAwaitingSleepNote:
+		var payload pendingActionPayload
+		if err := json.Unmarshal(state.Payload, &payload); err != nil || payload.SessionID == 0 {
+			_ = b.store.ClearUserState(ctx, msg.From.ID)
+			return true, b.sendText(msg.Chat.ID, "Не понял, к какому сну заметка. Выберите сон заново: `/tags`.")
+		}
+		if err := b.store.SetSleepNote(ctx, userCtx.Child.ID, payload.SessionID, userCtx.Member.ID, text); err != nil {
+			return true, b.sendText(msg.Chat.ID, escapeTelegramMarkdown(err.Error()))
+		}
+		if err := b.store.ClearUserState(ctx, msg.From.ID); err != nil {
+			return true, err
+		}
+		return true, b.sendText(msg.Chat.ID, "Заметка сохранена.")
 	case stateAwaitingChildName:
 		if err := b.store.SetChildName(ctx, userCtx.Family.ID, text); err != nil {
 			return true, b.sendText(msg.Chat.ID, escapeTelegramMarkdown(err.Error()))
@@ -524,97 +885,209 @@ func (b *SleepBot) handleState(ctx context.Context, userCtx UserContext, msg *tg
 	}
 }
 
-func (b *SleepBot) processReminders(ctx context.Context) error {
-	targets, err := b.store.GetReminderTargets(ctx)
+// processFamilyReminders отправляет наступившие напоминания семьи; повторы отсекаются через
+// notification_log, поэтому лишний проход ничего не дублирует. Шаги независимы: ошибка одного
+// пишется в лог и не мешает остальным, а вызывающему возвращаются все ошибки вместе.
+func (b *SleepBot) processFamilyReminders(ctx context.Context, target ReminderTarget, now time.Time) error {
+	var errs []error
+	step := func(name string, err error) {
+		if err == nil {
+			return
+		}
+		loggerFrom(ctx).Warn("reminder step failed", "family_id", target.Family.ID, "step", name, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+	// Сводки включаются каждым участником отдельно и не зависят от общего /reminders_on.
+	step("digests", b.processDigests(ctx, target, now))
+	// Напоминания о сцеживании тоже личные и включаются через /pumpevery.
+	step("pumping", b.processPumpingReminders(ctx, target, now))
+	// Вехи уходят на вебхуки семьи независимо от уведомлений в чате.
+	step("milestone webhooks", b.processMilestoneWebhooks(ctx, target, now))
+	if !target.Settings.RemindersEnabled || len(target.Members) == 0 {
+		return errors.Join(errs...)
+	}
+	loc := b.mustLocation(target.Family.Timezone)
+	step("sleep", b.processSleepReminders(ctx, target, now, loc))
+	step("custom", b.processCustomReminders(ctx, target, now, loc))
+	step("medications", b.processMedicationReminders(ctx, target, now, loc))
+	b.processMilestoneReminders(ctx, target, now, loc)
+	return errors.Join(errs...)
+}
+
+// processSleepReminders отправляет напоминания об окне бодрствования, долгом сне и паузе в записях.
+func (b *SleepBot) processSleepReminders(ctx context.Context, target ReminderTarget, now time.Time, loc *time.Location) error {
+	active, err := b.store.GetActiveSleep(ctx, target.Child.ID)
+	if err != nil {
+		return err
+	}
+	lastCompleted, err := b.store.GetLastCompletedSleep(ctx, target.Child.ID)
+	if err != nil {
+		return err
+	}
+	lastEvent, err := b.store.GetLatestEventTime(ctx, target.Child.ID)
 	if err != nil {
 		return err
 	}
 
-	now := time.Now().UTC()
-	for _, target := range targets {
-		if !target.Settings.RemindersEnabled || len(target.Members) == 0 {
-			continue
+	if active == nil && lastCompleted != nil && target.Settings.WakeWindowEnabled {
+		due := lastCompleted.EndAt.Add(time.Duration(target.Settings.WakeWindowMinutes) * time.Minute)
+		if !now.Before(due) {
+			key := fmt.Sprintf("wake-window:%d:%d", lastCompleted.ID, target.Settings.WakeWindowMinutes)
+			if ok, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err == nil && ok {
+				message := fmt.Sprintf("Пора готовить %s ко сну: окно бодрствования %d мин уже прошло.", escapeTelegramMarkdown(target.Child.Name), target.Settings.WakeWindowMinutes)
+				b.broadcast(ctx, notificationWakeWindow, target.Members, message)
+				emitWebhookEvent(ctx, b.store, target.Family, target.Child, nil, webhookEventReminder, webhookReminder{Kind: notificationWakeWindow, Text: message})
+			}
 		}
-		loc := b.mustLocation(target.Family.Timezone)
-		active, err := b.store.GetActiveSleep(ctx, target.Child.ID)
-		if err != nil {
-			return err
+	}
+
+	if active != nil && target.Settings.MaxSleepEnabled {
+		due := active.StartAt.Add(time.Duration(target.Settings.MaxSleepMinutes) * time.Minute)
+		if !now.Before(due) {
+			key := fmt.Sprintf("max-sleep:%d:%d", active.ID, target.Settings.MaxSleepMinutes)
+			if ok, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err == nil && ok {
+				message := fmt.Sprintf("%s спит уже %s. Это больше порога %d мин.", escapeTelegramMarkdown(target.Child.Name), formatDurationRU(now.Sub(active.StartAt)), target.Settings.MaxSleepMinutes)
+				b.broadcast(ctx, notificationMaxSleep, target.Members, message)
+				emitWebhookEvent(ctx, b.store, target.Family, target.Child, nil, webhookEventReminder, webhookReminder{Kind: notificationMaxSleep, Text: message})
+			}
 		}
-		lastCompleted, err := b.store.GetLastCompletedSleep(ctx, target.Child.ID)
-		if err != nil {
-			return err
+	}
+
+	if lastEvent != nil && target.Settings.InactivityEnabled {
+		due := lastEvent.Add(time.Duration(target.Settings.InactivityMinutes) * time.Minute)
+		if !now.Before(due) {
+			key := fmt.Sprintf("inactivity:%d:%d", lastEvent.Unix()/60, target.Settings.InactivityMinutes)
+			if ok, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err == nil && ok {
+				message := fmt.Sprintf("Давно нет записей о сне %s. Последнее событие было %s.", escapeTelegramMarkdown(target.Child.Name), formatLocalDateTime(*lastEvent, loc))
+				b.broadcast(ctx, notificationInactivity, target.Members, message)
+				emitWebhookEvent(ctx, b.store, target.Family, target.Child, nil, webhookEventReminder, webhookReminder{Kind: notificationInactivity, Text: message})
+			}
 		}
-		lastEvent, err := b.store.GetLatestEventTime(ctx, target.Child.ID)
-		if err != nil {
-			return err
+	}
+	return nil
+}
+
+// processCustomReminders отправляет пользовательские напоминания, время которых наступило сегодня.
+func (b *SleepBot) processCustomReminders(ctx context.Context, target ReminderTarget, now time.Time, loc *time.Location) error {
+	reminders, err := b.store.ListCustomReminders(ctx, target.Family.ID)
+	if err != nil {
+		return err
+	}
+	currentLocal := now.In(loc)
+	currentDate := currentLocal.Format("2006-01-02")
+	currentWeekday := strconv.Itoa(int(currentLocal.Weekday()))
+	for _, reminder := range reminders {
+		if !reminder.Enabled || !timeOfDayDue(now, reminder.AtTime, loc, customReminderCatchUp) || !weekdayIncluded(reminder.Weekdays, currentWeekday) || reminder.LastFiredOn == currentDate {
+			continue
+		}
+		key := fmt.Sprintf("custom:%d:%s", reminder.ID, currentDate)
+		if ok, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err == nil && ok {
+			b.broadcast(ctx, notificationCustom, target.Members, fmt.Sprintf("Напоминание: %s", escapeTelegramMarkdown(reminder.Title)))
+			emitWebhookEvent(ctx, b.store, target.Family, target.Child, nil, webhookEventReminder, webhookReminder{Kind: notificationCustom, Text: reminder.Title})
+			_ = b.store.MarkCustomReminderFired(ctx, reminder.ID, currentDate)
 		}
+	}
+	return nil
+}
 
-		if active == nil && lastCompleted != nil && target.Settings.WakeWindowEnabled {
-			due := lastCompleted.EndAt.Add(time.Duration(target.Settings.WakeWindowMinutes) * time.Minute)
-			if now.After(due) {
-				key := fmt.Sprintf("wake-window:%d:%d", lastCompleted.ID, target.Settings.WakeWindowMinutes)
-				if ok, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err == nil && ok {
-					message := fmt.Sprintf("Пора готовить %s ко сну: окно бодрствования %d мин уже прошло.", escapeTelegramMarkdown(target.Child.Name), target.Settings.WakeWindowMinutes)
-					b.broadcast(target.Members, message)
-				}
-			}
+// processMilestoneReminders сообщает семье о наступивших вехах, если включено /milestone_notify.
+func (b *SleepBot) processMilestoneReminders(ctx context.Context, target ReminderTarget, now time.Time, loc *time.Location) {
+	if !target.Settings.MilestoneNotifyEach || target.Child.BirthDate == nil {
+		return
+	}
+	anchor, ok := BirthAnchorLocal(target.Child.BirthDate, loc)
+	if !ok || anchor.After(now) {
+		return
+	}
+	ForEachMilestoneDueForNotify(anchor, now, loc, func(m Milestone) {
+		key := fmt.Sprintf("milestone:%s", m.ID)
+		if okSent, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err == nil && okSent {
+			b.broadcast(ctx, notificationMilestone, target.Members, FormatMilestonePushMessage(escapeTelegramMarkdown(target.Child.Name), m.Title))
 		}
+	})
+}
 
-		if active != nil && target.Settings.MaxSleepEnabled {
-			due := active.StartAt.Add(time.Duration(target.Settings.MaxSleepMinutes) * time.Minute)
-			if now.After(due) {
-				key := fmt.Sprintf("max-sleep:%d:%d", active.ID, target.Settings.MaxSleepMinutes)
-				if ok, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err == nil && ok {
-					message := fmt.Sprintf("%s спит уже %s. Это больше порога %d мин.", escapeTelegramMarkdown(target.Child.Name), formatDurationRU(now.Sub(active.StartAt)), target.Settings.MaxSleepMinutes)
-					b.broadcast(target.Members, message)
-				}
-			}
+// processMilestoneWebhooks отправляет наступившие вехи на вебхуки семьи; повторы отсекаются
+// через notification_log, как и уведомления в чате, но по своему ключу.
+func (b *SleepBot) processMilestoneWebhooks(ctx context.Context, target ReminderTarget, now time.Time) error {
+	if target.Child.BirthDate == nil {
+		return nil
+	}
+	webhooks, err := b.store.ListWebhooks(ctx, target.Family.ID)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+	loc := b.mustLocation(target.Family.Timezone)
+	anchor, ok := BirthAnchorLocal(target.Child.BirthDate, loc)
+	if !ok || anchor.After(now) {
+		return nil
+	}
+	ForEachMilestoneDueForNotify(anchor, now, loc, func(m Milestone) {
+		key := fmt.Sprintf("webhook-milestone:%s", m.ID)
+		if sent, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err == nil && sent {
+			emitWebhookEvent(ctx, b.store, target.Family, target.Child, nil, webhookEventMilestone, webhookMilestone{ID: m.ID, Title: m.Title, At: anchor.Add(m.Offset).UTC()})
 		}
+	})
+	return nil
+}
 
-		if lastEvent != nil && target.Settings.InactivityEnabled {
-			due := lastEvent.Add(time.Duration(target.Settings.InactivityMinutes) * time.Minute)
-			if now.After(due) {
-				key := fmt.Sprintf("inactivity:%d:%d", lastEvent.Unix()/60, target.Settings.InactivityMinutes)
-				if ok, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err == nil && ok {
-					message := fmt.Sprintf("Давно нет записей о сне %s. Последнее событие было %s.", escapeTelegramMarkdown(target.Child.Name), formatLocalDateTime(*lastEvent, loc))
-					b.broadcast(target.Members, message)
-				}
-			}
+// processDigests отправляет участникам семьи утренние и воскресные сводки; повторы отсекаются
+// через notification_log по ключу с локальной датой.
+func (b *SleepBot) processDigests(ctx context.Context, target ReminderTarget, now time.Time) error {
+	loc := b.mustLocation(target.Family.Timezone)
+	localDate := now.In(loc).Format("2006-01-02")
+	sunday := now.In(loc).Weekday() == time.Sunday
+
+	var (
+		loaded   bool
+		sessions []SleepSession
+		active   *SleepSession
+	)
+	load := func() error {
+		if loaded {
+			return nil
 		}
+		var err error
+		if active, err = b.store.GetActiveSleep(ctx, target.Child.ID); err != nil {
+			return err
+		}
+		// Воскресной сводке нужны две недели и ночь перед первой из них.
+		sessions, err = b.store.ListCompletedSleepsSince(ctx, target.Child.ID, now.AddDate(0, 0, -16))
+		loaded = err == nil
+		return err
+	}
 
-		reminders, err := b.store.ListCustomReminders(ctx, target.Family.ID)
-		if err != nil {
+	childName := escapeTelegramMarkdown(target.Child.Name)
+	// Сводка собирается до отметки в журнале: если загрузка упала, она повторится на следующем проходе.
+	send := func(member Member, kind string, keyPrefix string, build func() string) error {
+		if err := load(); err != nil {
 			return err
 		}
-		currentLocal := now.In(loc)
-		currentDate := currentLocal.Format("2006-01-02")
-		currentTime := currentLocal.Format("15:04")
-		currentWeekday := strconv.Itoa(int(currentLocal.Weekday()))
-		for _, reminder := range reminders {
-			if !reminder.Enabled || reminder.AtTime != currentTime || !weekdayIncluded(reminder.Weekdays, currentWeekday) || reminder.LastFiredOn == currentDate {
-				continue
-			}
-			key := fmt.Sprintf("custom:%d:%s", reminder.ID, currentDate)
-			if ok, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err == nil && ok {
-				b.broadcast(target.Members, fmt.Sprintf("Напоминание: %s", escapeTelegramMarkdown(reminder.Title)))
-				_ = b.store.MarkCustomReminderFired(ctx, reminder.ID, currentDate)
+		text := build()
+		key := fmt.Sprintf("%s:%d:%s", keyPrefix, member.ID, localDate)
+		ok, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key)
+		if err != nil || !ok {
+			return err
+		}
+		b.broadcast(ctx, kind, []Member{member}, text)
+		return nil
+	}
+	for _, member := range target.Members {
+		if digestDue(now, member.DailyDigestAt, loc) {
+			if err := send(member, notificationDigestDaily, "digest-daily", func() string {
+				return BuildMorningDigest(childName, sessions, active, now, loc)
+			}); err != nil {
+				return err
 			}
 		}
-
-		if target.Settings.RemindersEnabled && target.Settings.MilestoneNotifyEach && len(target.Members) > 0 && target.Child.BirthDate != nil {
-			loc := b.mustLocation(target.Family.Timezone)
-			anchor, ok := BirthAnchorLocal(target.Child.BirthDate, loc)
-			if ok && !anchor.After(now) {
-				ForEachMilestoneDueForNotify(anchor, now, loc, func(m Milestone) {
-					key := fmt.Sprintf("milestone:%s", m.ID)
-					if okSent, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err == nil && okSent {
-						b.broadcast(target.Members, FormatMilestonePushMessage(escapeTelegramMarkdown(target.Child.Name), m.Title))
-					}
-				})
+		if sunday && digestDue(now, member.WeeklyDigestAt, loc) {
+			if err := send(member, notificationDigestWeekly, "digest-weekly", func() string {
+				return BuildWeeklyDigest(childName, sessions, active, now, loc)
+			}); err != nil {
+				return err
 			}
 		}
 	}
-
 	return nil
 }
 
@@ -626,7 +1099,7 @@ func (b *SleepBot) sendWelcome(userCtx UserContext, chatID int64) error {
 		"`Сон начался`, `Сон закончился`",
 		"`Начался 5/10/15/30 минут назад`",
 		"`Закончился 5/10/15/30 минут назад`",
-		"`Добавить сон`, `Исправить последний сон`, `Отчеты`, `Напоминания`, `Настройки`",
+		"`Добавить сон`, `Исправить последний сон`, `Активности`, `Отчеты`, `Напоминания`, `Настройки`",
 		"",
 		"Настройка напоминаний:",
 		"автоматические напоминания по умолчанию выключены.",
@@ -635,8 +1108,37 @@ func (b *SleepBot) sendWelcome(userCtx UserContext, chatID int64) error {
 		"Вехи (красивые даты) по умолчанию выключены:",
 		"`/milestone_notify on|off`, `/milestone_report on|off`",
 		"",
+		"Сводки по расписанию (у каждого родителя свои):",
+		"`/digest 08:00` — утром о ночи, `/digest weekly 20:00` — итоги недели по воскресеньям",
+		"",
+		"После сна бот предложит отметить, где и как ребёнок уснул (кроватка, коляска, с кормлением, сам…) и добавить заметку:",
+		"`/tags` — для последнего сна, `/bytag` — какие условия дают более длинный дневной сон, `/bytag коляска` — сны с тегом",
+		"",
+		"Животик, прогулки и игры (кнопка «Активности»):",
+		"`/tummy`, `/walk`, `/play` — запустить или остановить таймер, `/tummy 15` — записать задним числом, `/goal животик 30` — дневная цель",
+		"",
+		"Сцеживание и запас молока:",
+		"`/pump` — таймер, `/pump 120 л` — объем и сторона, `/pumplog` — сводка, `/pumpevery 180` — напоминание, `/stash` — запас, `/bottle 90` — кормление из запаса",
+		"",
+		"HTTP API для своих интеграций: сны и сводки в JSON, запись сна и событий с умной кнопки или часов:",
+		"`/apitoken` — выпустить токен, `/apitoken status`, `/apitoken off` — отозвать",
+		"`/calendar` — ссылка на календарь (.ics) со снами, напоминаниями и красивыми датами",
+		"`/webhooks` — JSON о сне, напоминаниях и красивых датах на ваш адрес",
+		"",
+		"Вечерний ритуал (купание, массаж, кормление, книжка, свет):",
+		"`/routine` — чек-лист на сегодня, `/routine_steps` — свои шаги, `/routine_report` — как ритуал влияет на засыпание и ночь",
+		"",
+		"Рост и вес (перцентили ВОЗ до 3 лет):",
+		"`/weight 5.2`, `/height 58`, `/head 38`, можно с датой: `/weight 5.2 12.03`; `/growth` — сводка",
+		"",
+		"Температура и симптомы (оповещение семье при температуре от порога, `/tempalert 38.5`):",
+		"`/temp 38.2`, `/temp 38.2 14:30`, `/symptom кашель, насморк; ночью хуже`, `/sick` — период болезни вместе со сном",
+		"",
+		"Лекарства и витамины (напоминания о приёме — при `/reminders_on`):",
+		"`/addmed Витамин D; 1 капля; 09:00`, `/addmed Нурофен; 2.5 мл; каждые 6 ч`, `/meds` — список и кнопки «Дать», `/give 1`, `/delmed 1`",
+		"",
 		"Полезные команды:",
-		"`/report`, `/day`, `/week`, `/month`, `/export_csv`, `/invite`, `/join CODE`, `/settings`, `/cancel`, `/server_status`",
+		"`/report`, `/report 01.03-15.03`, `/evaluate 7`, `/day`, `/day 12.03`, `/week`, `/week prev`, `/month`, `/month prev`, `/compare`, `/export_csv`, `/pdf_report 30`, `/invite`, `/join CODE`, `/settings`, `/cancel`, `/server_status`",
 		"`/silent_mode` — выключить все уведомления",
 		"`/reset_service confirm` — полная очистка данных",
 	}, "\n")
@@ -650,6 +1152,7 @@ func (b *SleepBot) startSleep(ctx context.Context, userCtx UserContext, chatID i
 	if err != nil {
 		return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
 	}
+	emitWebhookEvent(ctx, b.store, userCtx.Family, userCtx.Child, &userCtx.Member, webhookEventSleepStarted, toAPISleep(*session, b.now()))
 	loc := b.mustLocation(userCtx.Family.Timezone)
 	return b.sendTextWithKeyboard(chatID, fmt.Sprintf("Сон начался в %s.", formatLocalDateTime(session.StartAt, loc)), b.mainKeyboard(true))
 }
@@ -659,9 +1162,13 @@ func (b *SleepBot) endSleep(ctx context.Context, userCtx UserContext, chatID int
 	if err != nil {
 		return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
 	}
+	emitWebhookEvent(ctx, b.store, userCtx.Family, userCtx.Child, &userCtx.Member, webhookEventSleepEnded, toAPISleep(*session, b.now()))
 	loc := b.mustLocation(userCtx.Family.Timezone)
 	text := fmt.Sprintf("Сон завершен в %s.\nДлительность: %s.", formatLocalDateTime(*session.EndAt, loc), formatDurationRU(session.EndAt.Sub(session.StartAt)))
-	return b.sendTextWithKeyboard(chatID, text, b.mainKeyboard(false))
+	if err := b.sendTextWithKeyboard(chatID, text, b.mainKeyboard(false)); err != nil {
+		return err
+	}
+	return b.sendSleepTagsPrompt(chatID, *session, loc)
 }
 
 func (b *SleepBot) sendStatus(ctx context.Context, userCtx UserContext, chatID int64) error {
@@ -685,6 +1192,15 @@ func (b *SleepBot) sendStatus(ctx context.Context, userCtx UserContext, chatID i
 	} else {
 		lines = append(lines, "Сейчас активного сна нет.")
 	}
+	activities, err := b.store.ListActiveActivities(ctx, userCtx.Child.ID)
+	if err != nil {
+		return err
+	}
+	for _, activity := range activities {
+		if kind, ok := lookupActivityKind(activity.Kind); ok {
+			lines = append(lines, fmt.Sprintf("%s: идет с %s.", kind.Title, formatLocalDateTime(activity.StartAt, loc)))
+		}
+	}
 	return b.sendText(chatID, strings.Join(lines, "\n"))
 }
 
@@ -700,7 +1216,7 @@ func (b *SleepBot) sendServerStatus(ctx context.Context, chatID int64) error {
 	httpCtx, httpCancel := context.WithTimeout(ctx, 2*time.Second)
 	defer httpCancel()
 
-	healthURL := "http://127.0.0.1:8080/health"
+	healthURL := localHTTPURL(b.cfg.HTTPAddr) + "/health"
 	healthStatus := "недоступен ❌"
 	req, reqErr := http.NewRequestWithContext(httpCtx, http.MethodGet, healthURL, nil)
 	if reqErr != nil {
@@ -740,59 +1256,1080 @@ func (b *SleepBot) sendDashboard(ctx context.Context, userCtx UserContext, chatI
 	if err != nil {
 		return err
 	}
-	sessions, err := b.store.ListCompletedSleepsSince(ctx, userCtx.Child.ID, time.Now().UTC().AddDate(0, 0, -40))
+	sessions, err := b.store.ListCompletedSleepsSince(ctx, userCtx.Child.ID, b.now().UTC().AddDate(0, 0, -40))
 	if err != nil {
 		return err
 	}
 	loc := b.mustLocation(userCtx.Family.Timezone)
-	report := BuildDashboardReport(escapeTelegramMarkdown(userCtx.Child.Name), sessions, active, loc, time.Now())
-	report = b.appendMilestoneReportBlock(userCtx, report, time.Now().In(loc))
+	report := BuildDashboardReport(escapeTelegramMarkdown(userCtx.Child.Name), sessions, active, loc, b.now())
+	report = b.appendMilestoneReportBlock(userCtx, report, b.now().In(loc))
 	return b.sendText(chatID, report)
 }
 
-func (b *SleepBot) sendDayReport(ctx context.Context, userCtx UserContext, chatID int64) error {
+func (b *SleepBot) sendDayReport(ctx context.Context, userCtx UserContext, chatID int64, day time.Time) error {
 	loc := b.mustLocation(userCtx.Family.Timezone)
 	active, err := b.store.GetActiveSleep(ctx, userCtx.Child.ID)
 	if err != nil {
 		return err
 	}
-	sessions, err := b.store.ListCompletedSleepsSince(ctx, userCtx.Child.ID, time.Now().UTC().AddDate(0, 0, -9))
+	// Таблица в отчёте за день показывает 7 дней, плюс ночь перед первым из них.
+	from := startOfDay(day, loc).AddDate(0, 0, -8)
+	to := startOfDay(day, loc).AddDate(0, 0, 1)
+	sessions, err := b.store.ListCompletedSleepsBetween(ctx, userCtx.Child.ID, from, to)
+	if err != nil {
+		return err
+	}
+	entries, err := b.store.ListHealthEntriesBetween(ctx, userCtx.Child.ID, startOfDay(day, loc), to)
+	if err != nil {
+		return err
+	}
+	activities, err := b.store.ListActivitiesBetween(ctx, userCtx.Child.ID, startOfDay(day, loc), to)
 	if err != nil {
 		return err
 	}
-	day := time.Now().In(loc)
-	report := BuildDayReport(sessions, active, day, loc)
+	goals, err := b.store.GetActivityGoals(ctx, userCtx.Child.ID)
+	if err != nil {
+		return err
+	}
+	day = day.In(loc)
+	now := b.now()
+	report := BuildDayReport(sessions, active, day, now, loc)
+	if section := BuildActivityDaySection(activities, goals, day, now, loc); section != "" {
+		report += "\n\n" + section
+	}
+	if health := BuildHealthDaySection(entries, sessionsWithActive(sessions, active, now), day, loc); health != "" {
+		report += "\n\n" + health
+	}
 	report = b.appendMilestoneReportBlock(userCtx, report, day)
 	return b.sendText(chatID, report)
 }
 
-func (b *SleepBot) sendRangeReport(ctx context.Context, userCtx UserContext, chatID int64, days int) error {
+// sendPeriodReport обрабатывает /week и /month: без аргумента — последние 7/30 дней,
+// с числом N (или prev) — период на N шагов назад.
+func (b *SleepBot) sendPeriodReport(ctx context.Context, userCtx UserContext, chatID int64, command string, args string) error {
+	days := 7
+	if command == "month" {
+		days = 30
+	}
+	offset, ok := parsePeriodOffset(args)
+	if !ok {
+		return b.sendText(chatID, fmt.Sprintf("Использование: `/%s`, `/%s prev` или `/%s 2` (на сколько периодов назад).", command, command, command))
+	}
+
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	end := startOfDay(b.now(), loc).AddDate(0, 0, -offset*days)
+	start := lastDaysStart(end, days, loc)
+	if offset == 0 {
+		end = b.now()
+	}
+
+	nav := fmt.Sprintf("Предыдущие %d дней: `/%s %d`", days, command, offset+1)
+	if offset > 0 {
+		nav += fmt.Sprintf(", следующие: `/%s %d`", command, offset-1)
+	}
+	return b.sendRangeReport(ctx, userCtx, chatID, start, end, nav)
+}
+
+// sendRangeReport отправляет текст отчёта за локальные дни [start, end] и графики к нему.
+func (b *SleepBot) sendRangeReport(ctx context.Context, userCtx UserContext, chatID int64, start time.Time, end time.Time, footer string) error {
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	now := b.now()
 	active, err := b.store.GetActiveSleep(ctx, userCtx.Child.ID)
 	if err != nil {
 		return err
 	}
-	sessions, err := b.store.ListCompletedSleepsSince(ctx, userCtx.Child.ID, time.Now().UTC().AddDate(0, 0, -(days+2)))
+	// Ночь первого дня начинается накануне вечером.
+	from := startOfDay(start, loc).AddDate(0, 0, -2)
+	to := startOfDay(end, loc).AddDate(0, 0, 1)
+	sessions, err := b.store.ListCompletedSleepsBetween(ctx, userCtx.Child.ID, from, to)
 	if err != nil {
 		return err
 	}
-	report := BuildRangeReport(sessions, active, time.Now(), days, b.mustLocation(userCtx.Family.Timezone))
-	return b.sendText(chatID, report)
-}
+	activities, err := b.store.ListActivitiesBetween(ctx, userCtx.Child.ID, startOfDay(start, loc), to)
+	if err != nil {
+		return err
+	}
+	goals, err := b.store.GetActivityGoals(ctx, userCtx.Child.ID)
+	if err != nil {
+		return err
+	}
+	days := daysInRange(start, end, loc)
+	merged := sessionsWithActive(sessions, active, now)
+	activitySection := BuildActivityRangeSection(activities, goals, start, end, now, loc)
 
-func (b *SleepBot) sendExportCSV(ctx context.Context, userCtx UserContext, chatID int64) error {
-	sessions, err := b.store.ListAllCompletedSleeps(ctx, userCtx.Child.ID)
+	withFooter := func(text string) string {
+		if activitySection != "" {
+			text += "\n\n" + activitySection
+		}
+		if footer == "" {
+			return text
+		}
+		return text + "\n\n" + footer
+	}
+
+	timeline, err := RenderSleepTimelinePNG(merged, end, days, loc)
+	if err != nil {
+		loggerFrom(ctx).Warn("sleep timeline chart failed", "error", err)
+		return b.sendText(chatID, withFooter(BuildRangeReport(sessions, active, start, end, now, loc)))
+	}
+	totals, err := RenderDailyTotalsPNG(merged, end, days, loc)
 	if err != nil {
+		loggerFrom(ctx).Warn("daily totals chart failed", "error", err)
+		return b.sendText(chatID, withFooter(BuildRangeReport(sessions, active, start, end, now, loc)))
+	}
+
+	if err := b.sendText(chatID, withFooter(BuildRangeSummary(sessions, active, start, end, now, loc))); err != nil {
 		return err
 	}
-	if len(sessions) == 0 {
-		return b.sendText(chatID, "Пока нет завершенных записей сна для экспорта.")
+	stamp := fmt.Sprintf("%s_%s", startOfDay(start, loc).Format("20060102"), startOfDay(end, loc).Format("20060102"))
+	if err := b.sendPhoto(chatID, fmt.Sprintf("sleep_timeline_%s.png", stamp), timeline, fmt.Sprintf("Сон по часам за %d дн. (синий — сон, серый фон — ночь)", days)); err != nil {
+		return err
 	}
+	return b.sendPhoto(chatID, fmt.Sprintf("sleep_totals_%s.png", stamp), totals, fmt.Sprintf("Сон за сутки, ч (%d дн.)", days))
+}
 
+// sendCompareReport сравнивает периоды [previousStart, previousEnd] и [currentStart, currentEnd] (локальные дни).
+func (b *SleepBot) sendCompareReport(ctx context.Context, userCtx UserContext, chatID int64, previousStart, previousEnd, currentStart, currentEnd time.Time) error {
 	loc := b.mustLocation(userCtx.Family.Timezone)
-	var csvBuf bytes.Buffer
-	writer := csv.NewWriter(&csvBuf)
-
-	if err := writer.Write([]string{
+	now := b.now()
+	active, err := b.store.GetActiveSleep(ctx, userCtx.Child.ID)
+	if err != nil {
+		return err
+	}
+	from := startOfDay(minTime(previousStart, currentStart), loc).AddDate(0, 0, -2)
+	to := startOfDay(maxTime(previousEnd, currentEnd), loc).AddDate(0, 0, 1)
+	sessions, err := b.store.ListCompletedSleepsBetween(ctx, userCtx.Child.ID, from, to)
+	if err != nil {
+		return err
+	}
+	merged := sessionsWithActive(sessions, active, now)
+	report := BuildCompareReport(
+		SummarizePeriod(merged, previousStart, previousEnd, loc),
+		SummarizePeriod(merged, currentStart, currentEnd, loc),
+	)
+	return b.sendText(chatID, report)
+}
+
+func (b *SleepBot) recordMeasurement(ctx context.Context, userCtx UserContext, chatID int64, kind string, args string) error {
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	now := b.now()
+	value, measuredAt, err := parseMeasurementArgs(kind, args, now, loc)
+	if err != nil {
+		example := map[string]string{measurementWeight: "5.2", measurementHeight: "58", measurementHead: "38"}[kind]
+		return b.sendText(chatID, fmt.Sprintf("Не понял (%s). Использование: `/%s %s` или `/%s %s 12.03`.", escapeTelegramMarkdown(err.Error()), kind, example, kind, example))
+	}
+	measurement, err := b.store.AddMeasurement(ctx, userCtx.Child.ID, userCtx.Member.ID, kind, value, measuredAt)
+	if err != nil {
+		return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+	}
+	text := fmt.Sprintf("Записано: %s — %s (%s).", strings.ToLower(measurementTitles[kind]), formatMeasurementValue(kind, measurement.Value), measurement.MeasuredAt.In(loc).Format("02.01.2006"))
+	if ageMonths, ok := childAgeMonths(userCtx.Child, measurement.MeasuredAt); ok {
+		if _, percentile, ok := GrowthPercentile(kind, userCtx.Child.Sex, ageMonths, measurement.Value); ok {
+			text += " Это " + formatPercentile(percentile) + "."
+		}
+	}
+	return b.sendText(chatID, text+"\nСводка: /growth")
+}
+
+func (b *SleepBot) sendGrowthReport(ctx context.Context, userCtx UserContext, chatID int64) error {
+	measurements, err := b.store.ListMeasurements(ctx, userCtx.Child.ID)
+	if err != nil {
+		return err
+	}
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	return b.sendText(chatID, BuildGrowthReport(userCtx.Child, measurements, b.now(), loc))
+}
+
+// sendSessionTags показывает кнопки тегов для последнего завершенного сна или сна с указанным id.
+func (b *SleepBot) sendSessionTags(ctx context.Context, userCtx UserContext, chatID int64, args string) error {
+	var (
+		session *SleepSession
+		err     error
+	)
+	if args == "" {
+		session, err = b.store.GetLastCompletedSleep(ctx, userCtx.Child.ID)
+		if err != nil {
+			return err
+		}
+		if session == nil {
+			return b.sendText(chatID, "Пока нет завершенных снов.")
+		}
+	} else {
+		id, parseErr := strconv.ParseInt(strings.TrimPrefix(args, "#"), 10, 64)
+		if parseErr != nil {
+			return b.sendText(chatID, "Использование: `/tags` (последний сон) или `/tags 42` (id сна из CSV).")
+		}
+		session, err = b.store.GetChildSleep(ctx, userCtx.Child.ID, id)
+		if err != nil {
+			return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+		}
+		if session.EndAt == nil {
+			return b.sendText(chatID, "Этот сон еще идет: отметить условия можно после его окончания.")
+		}
+	}
+	return b.sendSleepTagsPrompt(chatID, *session, b.mustLocation(userCtx.Family.Timezone))
+}
+
+// sendSleepTagReport обрабатывает `/bytag [тег] [дни]`.
+func (b *SleepBot) sendSleepTagReport(ctx context.Context, userCtx UserContext, chatID int64, args string) error {
+	days := sleepTagReportDays
+	tag := ""
+	for _, field := range strings.Fields(args) {
+		if parsed, err := strconv.Atoi(field); err == nil && parsed >= 1 && parsed <= reportMaxRangeDays {
+			days = parsed
+			continue
+		}
+		resolved, ok := resolveSleepTag(field)
+		if !ok {
+			return b.sendText(chatID, fmt.Sprintf("Не знаю тег %q. Теги: %s.", escapeTelegramMarkdown(field), escapeTelegramMarkdown(formatSleepTags(allSleepTagIDs()))))
+		}
+		tag = resolved
+	}
+
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	now := b.now()
+	end := startOfDay(now, loc).AddDate(0, 0, 1)
+	start := end.AddDate(0, 0, -days)
+	sessions, err := b.store.ListCompletedSleepsBetween(ctx, userCtx.Child.ID, start, end)
+	if err != nil {
+		return err
+	}
+	return b.sendText(chatID, BuildSleepTagReport(sessions, tag, start, end, loc))
+}
+
+// handleActivityCommand обрабатывает `/tummy`, `/walk`, `/play`: без аргумента запускает или останавливает
+// таймер, с числом минут записывает завершенную активность, закончившуюся сейчас.
+func (b *SleepBot) handleActivityCommand(ctx context.Context, userCtx UserContext, chatID int64, command string, args string) error {
+	kind, _ := lookupActivityKind(command)
+	if args == "" {
+		text, err := b.toggleActivity(ctx, userCtx, kind)
+		if err != nil {
+			return err
+		}
+		return b.sendText(chatID, text)
+	}
+	minutes, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(args, "мин")))
+	if err != nil || minutes < 1 || minutes > activityGoalMaxMinutes {
+		return b.sendText(chatID, fmt.Sprintf("Использование: `/%s` — запустить или остановить таймер, `/%s 15` — записать 15 минут, закончившиеся сейчас.", command, command))
+	}
+	now := b.now()
+	activity, err := b.store.AddActivity(ctx, userCtx.Child.ID, userCtx.Member.ID, kind.ID, now.Add(-time.Duration(minutes)*time.Minute), now)
+	if err != nil {
+		return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+	}
+	return b.sendText(chatID, fmt.Sprintf("Записано: %s — %s. Сегодня: /activities", kind.Label, formatDurationRU(activity.EndAt.Sub(activity.StartAt))))
+}
+
+// toggleActivity останавливает идущую активность вида kind или запускает новую и возвращает текст ответа.
+func (b *SleepBot) toggleActivity(ctx context.Context, userCtx UserContext, kind activityKind) (string, error) {
+	active, err := b.store.ListActiveActivities(ctx, userCtx.Child.ID)
+	if err != nil {
+		return "", err
+	}
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	now := b.now()
+	if activeActivity(active, kind.ID) == nil {
+		activity, err := b.store.StartActivity(ctx, userCtx.Child.ID, userCtx.Member.ID, kind.ID, now)
+		if err != nil {
+			return escapeTelegramMarkdown(err.Error()), nil
+		}
+		return fmt.Sprintf("%s: начато в %s. Остановить — той же кнопкой или `/%s`.", kind.Title, formatLocalDateTime(activity.StartAt, loc), kind.ID), nil
+	}
+	activity, err := b.store.EndActivity(ctx, userCtx.Child.ID, userCtx.Member.ID, kind.ID, now)
+	if err != nil {
+		return escapeTelegramMarkdown(err.Error()), nil
+	}
+	text := fmt.Sprintf("%s: завершено, %s.", kind.Title, formatDurationRU(activity.EndAt.Sub(activity.StartAt)))
+	goals, err := b.store.GetActivityGoals(ctx, userCtx.Child.ID)
+	if err != nil {
+		return "", err
+	}
+	if goal := activityGoal(goals, kind); goal > 0 {
+		today, err := b.store.ListActivitiesBetween(ctx, userCtx.Child.ID, startOfDay(now, loc), now)
+		if err != nil {
+			return "", err
+		}
+		text += " Сегодня: " + formatActivityProgress(activityTimeBetween(today, kind.ID, startOfDay(now, loc), now, now), goal) + "."
+	}
+	return text, nil
+}
+
+func (b *SleepBot) sendActivitiesPanel(ctx context.Context, userCtx UserContext, chatID int64) error {
+	text, keyboard, err := b.activitiesPanel(ctx, userCtx)
+	if err != nil {
+		return err
+	}
+	return b.sendTextWithInlineKeyboard(chatID, text, keyboard)
+}
+
+// toggleActivityFromPanel обрабатывает кнопку панели активностей и обновляет саму панель.
+func (b *SleepBot) toggleActivityFromPanel(ctx context.Context, userCtx UserContext, message *tgbotapi.Message, kindID string) error {
+	kind, ok := lookupActivityKind(kindID)
+	if !ok {
+		return nil
+	}
+	reply, err := b.toggleActivity(ctx, userCtx, kind)
+	if err != nil {
+		return err
+	}
+	text, keyboard, err := b.activitiesPanel(ctx, userCtx)
+	if err != nil {
+		return err
+	}
+	edit := tgbotapi.NewEditMessageTextAndMarkup(message.Chat.ID, message.MessageID, text, keyboard)
+	edit.ParseMode = "Markdown"
+	if _, err := b.request(edit); err != nil {
+		loggerFrom(ctx).Warn("edit activities panel failed", "error", err)
+	}
+	return b.sendText(message.Chat.ID, reply)
+}
+
+func (b *SleepBot) activitiesPanel(ctx context.Context, userCtx UserContext) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	now := b.now()
+	// Идущие активности попадают в выборку, даже если начались вчера.
+	activities, err := b.store.ListActivitiesBetween(ctx, userCtx.Child.ID, startOfDay(now, loc), now.Add(time.Minute))
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	goals, err := b.store.GetActivityGoals(ctx, userCtx.Child.ID)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, kind := range activityKinds {
+		label := "▶ " + kind.Title
+		if activeActivity(activities, kind.ID) != nil {
+			label = "■ Остановить: " + kind.Title
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, "act:"+kind.ID)))
+	}
+	return BuildActivitiesPanel(activities, goals, now, loc), tgbotapi.NewInlineKeyboardMarkup(rows...), nil
+}
+
+// setActivityGoal обрабатывает `/goal [активность] [минуты|off]`.
+func (b *SleepBot) setActivityGoal(ctx context.Context, userCtx UserContext, chatID int64, args string) error {
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		goals, err := b.store.GetActivityGoals(ctx, userCtx.Child.ID)
+		if err != nil {
+			return err
+		}
+		lines := []string{"Дневные цели:"}
+		for _, kind := range activityKinds {
+			goal := "нет"
+			if minutes := activityGoal(goals, kind); minutes > 0 {
+				goal = formatDurationRU(time.Duration(minutes) * time.Minute)
+			}
+			lines = append(lines, fmt.Sprintf("%s — %s", kind.Label, goal))
+		}
+		lines = append(lines, "", "Изменить: `/goal животик 30`, `/goal прогулка 120`, выключить: `/goal игра off`.")
+		return b.sendText(chatID, strings.Join(lines, "\n"))
+	}
+	kind, ok := resolveActivityKind(fields[0])
+	if !ok {
+		return b.sendText(chatID, fmt.Sprintf("Не знаю активность %q. Есть: %s.", escapeTelegramMarkdown(fields[0]), activityKindLabels()))
+	}
+	minutes := 0
+	if on, ok := parseOnOffArg(fields[1]); !ok || on {
+		// `1` разбирается и как «вкл», и как число минут — считаем его числом.
+		parsed, err := strconv.Atoi(fields[1])
+		if err != nil || parsed < 1 {
+			return b.sendText(chatID, "Использование: `/goal животик 30` (минут в день) или `/goal животик off`.")
+		}
+		minutes = parsed
+	}
+	if err := b.store.SetActivityGoal(ctx, userCtx.Child.ID, kind.ID, minutes); err != nil {
+		return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+	}
+	if minutes == 0 {
+		return b.sendText(chatID, fmt.Sprintf("Цель для «%s» выключена.", kind.Label))
+	}
+	return b.sendText(chatID, fmt.Sprintf("Цель для «%s»: %s в день.", kind.Label, formatDurationRU(time.Duration(minutes)*time.Minute)))
+}
+
+// handlePumpCommand обрабатывает `/pump`: без аргументов запускает таймер (или показывает идущий),
+// с объемом завершает таймер либо, если таймера нет, записывает сцеживание, закончившееся сейчас.
+func (b *SleepBot) handlePumpCommand(ctx context.Context, userCtx UserContext, chatID int64, args string) error {
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	now := b.now()
+	active, err := b.store.GetActivePumping(ctx, userCtx.Member.ID)
+	if err != nil {
+		return err
+	}
+	if args == "" {
+		if active != nil {
+			return b.sendText(chatID, fmt.Sprintf("Сцеживание идет с %s (%s). Завершить: `/pump 120 л` — объем и сторона.", active.StartAt.In(loc).Format("15:04"), formatDurationRU(now.Sub(active.StartAt))))
+		}
+		session, err := b.store.StartPumping(ctx, userCtx.Child.ID, userCtx.Member.ID, now)
+		if err != nil {
+			return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+		}
+		return b.sendText(chatID, fmt.Sprintf("Сцеживание началось в %s. Завершить: `/pump 120 л` (объем в мл; сторона `л`, `п` или `обе`).", session.StartAt.In(loc).Format("15:04")))
+	}
+
+	volume, side, minutes, err := parsePumpArgs(args)
+	if err != nil {
+		return b.sendText(chatID, fmt.Sprintf("Не понял (%s). Примеры: `/pump 120 л`, `/pump 70+50 обе 20` (объем, сторона, минуты).", escapeTelegramMarkdown(err.Error())))
+	}
+	var session *PumpingSession
+	if active != nil {
+		if minutes != 0 {
+			return b.sendText(chatID, "Идет таймер: длительность посчитается сама, укажите только объем и сторону — `/pump 120 л`.")
+		}
+		session, err = b.store.FinishPumping(ctx, userCtx.Member.ID, side, volume, now)
+	} else {
+		session, err = b.store.AddPumping(ctx, userCtx.Child.ID, userCtx.Member.ID, side, volume, now.Add(-time.Duration(minutes)*time.Minute), now)
+	}
+	if err != nil {
+		return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+	}
+
+	text := "Записано: " + formatPumping(*session, loc) + ". Сводка: /pumplog"
+	if session.VolumeML == 0 {
+		return b.sendText(chatID, text)
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("В холодильник", fmt.Sprintf("bag:%d:%s", session.ID, milkStorageFridge)),
+		tgbotapi.NewInlineKeyboardButtonData("В морозилку", fmt.Sprintf("bag:%d:%s", session.ID, milkStorageFreezer)),
+	))
+	return b.sendTextWithInlineKeyboard(chatID, text+"\nУбрать молоко в запас?", keyboard)
+}
+
+// stashPumping кладет молоко из сцеживания в запас по кнопке.
+func (b *SleepBot) stashPumping(ctx context.Context, userCtx UserContext, chatID int64, pumpingID int64, storage string) error {
+	if _, ok := milkShelfLife[storage]; !ok {
+		return nil
+	}
+	session, err := b.store.GetPumping(ctx, userCtx.Child.ID, pumpingID)
+	if err != nil {
+		return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+	}
+	if session.EndAt == nil {
+		return nil
+	}
+	bag, err := b.store.AddMilkBag(ctx, userCtx.Child.ID, userCtx.Member.ID, MilkBag{PumpingID: session.ID, VolumeML: session.VolumeML, Storage: storage, PumpedAt: *session.EndAt})
+	if err != nil {
+		return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+	}
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	return b.sendText(chatID, fmt.Sprintf("Пакет №%d: %d мл, %s, годно до %s. Запас: /stash", bag.ID, bag.VolumeML, milkStorageLabels[bag.Storage], formatLocalDateTime(bag.ExpiresAt, loc)))
+}
+
+func (b *SleepBot) sendPumpingReport(ctx context.Context, userCtx UserContext, chatID int64, days int) error {
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	now := b.now()
+	sessions, err := b.store.ListPumpingsSince(ctx, userCtx.Child.ID, startOfDay(now, loc).AddDate(0, 0, -(days-1)))
+	if err != nil {
+		return err
+	}
+	return b.sendText(chatID, BuildPumpingReport(sessions, now, days, loc))
+}
+
+// handleStashCommand обрабатывает `/stash`, `/stash add 120 морозилка [дата]` и `/stash del N`.
+func (b *SleepBot) handleStashCommand(ctx context.Context, userCtx UserContext, chatID int64, args string) error {
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	now := b.now()
+	action, rest, _ := strings.Cut(args, " ")
+	rest = strings.TrimSpace(rest)
+	switch strings.ToLower(action) {
+	case "":
+		bags, err := b.store.ListMilkBags(ctx, userCtx.Child.ID)
+		if err != nil {
+			return err
+		}
+		return b.sendText(chatID, BuildStashReport(bags, now, loc))
+	case "add":
+		bag, err := parseStashAddArgs(rest, now, loc)
+		if err != nil {
+			return b.sendText(chatID, fmt.Sprintf("Не понял (%s). Пример: `/stash add 120 морозилка 12.03`.", escapeTelegramMarkdown(err.Error())))
+		}
+		added, err := b.store.AddMilkBag(ctx, userCtx.Child.ID, userCtx.Member.ID, bag)
+		if err != nil {
+			return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+		}
+		return b.sendText(chatID, fmt.Sprintf("Пакет №%d: %d мл, %s, годно до %s.", added.ID, added.VolumeML, milkStorageLabels[added.Storage], formatLocalDateTime(added.ExpiresAt, loc)))
+	case "del":
+		id, err := strconv.ParseInt(strings.TrimPrefix(rest, "№"), 10, 64)
+		if err != nil {
+			return b.sendText(chatID, "Использование: `/stash del 3` (номер пакета из `/stash`).")
+		}
+		if err := b.store.DiscardMilkBag(ctx, userCtx.Child.ID, id); err != nil {
+			return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+		}
+		return b.sendText(chatID, fmt.Sprintf("Пакет №%d убран из запаса.", id))
+	default:
+		return b.sendText(chatID, "Использование: `/stash`, `/stash add 120 морозилка [дата]`, `/stash del 3`.")
+	}
+}
+
+// handleAPITokenCommand выпускает токен HTTP API семьи (`/apitoken`), показывает его статус (`/apitoken status`)
+// или отзывает его (`/apitoken off`). Токен показывается один раз, в базе хранится только его хеш.
+func (b *SleepBot) handleAPITokenCommand(ctx context.Context, userCtx UserContext, chatID int64, args string) error {
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	switch strings.ToLower(strings.TrimSpace(args)) {
+	case "":
+		token, hash, err := generateAPIToken()
+		if err != nil {
+			return err
+		}
+		if err := b.store.SetAPIToken(ctx, userCtx.Family.ID, userCtx.Member.ID, hash); err != nil {
+			return err
+		}
+		return b.sendText(chatID, fmt.Sprintf(
+			"Токен API семьи (показывается один раз, прежний токен больше не действует):\n`%s`\n\nПример:\n`curl -H \"Authorization: Bearer %s\" %s/api/v1/summary/day`\n\nОтозвать: `/apitoken off`.",
+			token, token, publicBaseURL(b.cfg),
+		))
+	case "status":
+		createdAt, lastUsedAt, err := b.store.GetAPITokenInfo(ctx, userCtx.Family.ID)
+		if err != nil {
+			return err
+		}
+		if createdAt == nil {
+			return b.sendText(chatID, "Токена API нет. Выпустить: `/apitoken`.")
+		}
+		lastUsed := "ни разу"
+		if lastUsedAt != nil {
+			lastUsed = formatLocalDateTime(*lastUsedAt, loc)
+		}
+		return b.sendText(chatID, fmt.Sprintf("Токен API выпущен %s, последний запрос: %s.", formatLocalDateTime(*createdAt, loc), lastUsed))
+	case "off":
+		revoked, err := b.store.RevokeAPIToken(ctx, userCtx.Family.ID)
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			return b.sendText(chatID, "Токена API и так нет.")
+		}
+		return b.sendText(chatID, "Токен API отозван.")
+	}
+	return b.sendText(chatID, "Использование: `/apitoken` — новый токен, `/apitoken status`, `/apitoken off`.")
+}
+
+// handleCalendarCommand показывает секретную ссылку на календарь семьи (`/calendar`), заменяет ее
+// (`/calendar reset`) или выключает календарь (`/calendar off`).
+func (b *SleepBot) handleCalendarCommand(ctx context.Context, userCtx UserContext, chatID int64, args string) error {
+	arg := strings.ToLower(strings.TrimSpace(args))
+	if arg == "off" {
+		deleted, err := b.store.DeleteCalendarToken(ctx, userCtx.Family.ID)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return b.sendText(chatID, "Календарь и так выключен.")
+		}
+		return b.sendText(chatID, "Календарь выключен, ссылка больше не работает.")
+	}
+	if arg != "" && arg != "reset" {
+		return b.sendText(chatID, "Использование: `/calendar` — ссылка, `/calendar reset` — новая ссылка, `/calendar off` — выключить.")
+	}
+	token, err := b.store.GetCalendarToken(ctx, userCtx.Family.ID)
+	if err != nil {
+		return err
+	}
+	if token == "" || arg == "reset" {
+		if token, err = generateCalendarToken(); err != nil {
+			return err
+		}
+		if err := b.store.SetCalendarToken(ctx, userCtx.Family.ID, token); err != nil {
+			return err
+		}
+	}
+	return b.sendText(chatID, fmt.Sprintf(
+		"Календарь семьи: сны за %d дней, пользовательские напоминания и ближайшие красивые даты.\n`%s/calendar/%s.ics`\n\nДобавьте ссылку в календарь как подписку (Google: «Добавить по URL», Apple: «Новая подписка»). Ссылка секретная — по ней календарь виден без входа. Заменить: `/calendar reset`, выключить: `/calendar off`.",
+		calendarSleepDays, publicBaseURL(b.cfg), token,
+	))
+}
+
+const webhooksUsage = "`/webhooks add https://example.com/hook` — добавить, `/webhooks test 1` — проверить, `/webhooks del 1` — удалить, `/webhooks log` — журнал отправок."
+
+// handleWebhooksCommand управляет вебхуками семьи: список, add, test, del и log.
+func (b *SleepBot) handleWebhooksCommand(ctx context.Context, userCtx UserContext, chatID int64, args string) error {
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	action, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	rest = strings.TrimSpace(rest)
+	switch strings.ToLower(action) {
+	case "":
+		webhooks, err := b.store.ListWebhooks(ctx, userCtx.Family.ID)
+		if err != nil {
+			return err
+		}
+		if len(webhooks) == 0 {
+			return b.sendText(chatID, "Вебхуков нет. Бот может отправлять JSON о начале и конце сна, напоминаниях и красивых датах на ваш адрес.\n"+webhooksUsage)
+		}
+		lines := []string{"Вебхуки семьи:"}
+		for _, webhook := range webhooks {
+			lines = append(lines, fmt.Sprintf("`%d` %s (с %s)", webhook.ID, escapeTelegramMarkdown(webhook.URL), formatLocalDateTime(webhook.CreatedAt, loc)))
+		}
+		lines = append(lines, "", webhooksUsage)
+		return b.sendText(chatID, strings.Join(lines, "\n"))
+	case "add":
+		target, err := validateWebhookURL(ctx, net.DefaultResolver, rest, b.cfg.WebhookAllowHTTP)
+		if err != nil {
+			return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+		}
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return err
+		}
+		webhook, err := b.store.AddWebhook(ctx, userCtx.Family.ID, target, secret)
+		if err != nil {
+			return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+		}
+		return b.sendText(chatID, fmt.Sprintf(
+			"Вебхук `%d` добавлен. Секрет для проверки подписи (показывается один раз):\n`%s`\n\nЗаголовок `X-Sleepbot-Signature` — `sha256=` и HMAC-SHA256 тела запроса с этим секретом. Проверить: `/webhooks test %d`.",
+			webhook.ID, secret, webhook.ID,
+		))
+	case "test":
+		webhookID, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return b.sendText(chatID, "Использование: `/webhooks test 1`.")
+		}
+		payload, err := marshalWebhookPayload(userCtx.Family, userCtx.Child, &userCtx.Member, webhookEventTest, map[string]string{"text": "Проверка вебхука"}, b.now())
+		if err != nil {
+			return err
+		}
+		delivery, err := b.store.EnqueueWebhookDelivery(ctx, userCtx.Family.ID, webhookID, webhookEventTest, payload)
+		if err != nil {
+			return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+		}
+		result, err := newWebhookSender(b.store).attempt(ctx, *delivery)
+		if err != nil {
+			return err
+		}
+		if result.Status == webhookStatusDelivered {
+			return b.sendText(chatID, fmt.Sprintf("Тестовое событие доставлено, ответ %d.", result.ResponseCode))
+		}
+		return b.sendText(chatID, fmt.Sprintf("Не доставлено: %s. Бот повторит попытку через %s, журнал — `/webhooks log`.",
+			escapeTelegramMarkdown(result.LastError), formatDurationRU(webhookRetryDelay(result.Attempts)),
+		))
+	case "del":
+		webhookID, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return b.sendText(chatID, "Использование: `/webhooks del 1`.")
+		}
+		deleted, err := b.store.DeleteWebhook(ctx, userCtx.Family.ID, webhookID)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return b.sendText(chatID, "Такого вебхука нет.")
+		}
+		return b.sendText(chatID, "Вебхук удален.")
+	case "log":
+		deliveries, err := b.store.ListWebhookDeliveries(ctx, userCtx.Family.ID, webhookLogLimit)
+		if err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return b.sendText(chatID, "Отправок пока не было.")
+		}
+		lines := []string{"Последние отправки:"}
+		now := b.now()
+		for _, delivery := range deliveries {
+			lines = append(lines, formatWebhookDelivery(delivery, now, loc))
+		}
+		return b.sendText(chatID, strings.Join(lines, "\n"))
+	}
+	return b.sendText(chatID, "Использование: "+webhooksUsage)
+}
+
+// recordBottleFeed обрабатывает `/bottle 90`: кормление сцеженным молоком из запаса.
+// С пометкой `смесь` или `свежее` кормление записывается без списания из запаса.
+func (b *SleepBot) recordBottleFeed(ctx context.Context, userCtx UserContext, chatID int64, args string) error {
+	fields := strings.Fields(strings.ToLower(args))
+	usage := "Использование: `/bottle 90` — из запаса (берется молоко с ближайшим сроком), `/bottle 90 смесь` или `/bottle 90 свежее` — без списания."
+	if len(fields) == 0 || len(fields) > 2 {
+		return b.sendText(chatID, usage)
+	}
+	volume, err := strconv.Atoi(strings.TrimSuffix(fields[0], "мл"))
+	if err != nil {
+		return b.sendText(chatID, usage)
+	}
+	fromStash := true
+	if len(fields) == 2 {
+		if fields[1] != "смесь" && fields[1] != "свежее" {
+			return b.sendText(chatID, usage)
+		}
+		fromStash = false
+	}
+	uses, err := b.store.AddBottleFeed(ctx, userCtx.Child.ID, userCtx.Member.ID, volume, fromStash, b.now())
+	if err != nil {
+		return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+	}
+	if !fromStash {
+		return b.sendText(chatID, fmt.Sprintf("Записано кормление: %d мл.", volume))
+	}
+	parts := make([]string, 0, len(uses))
+	for _, use := range uses {
+		parts = append(parts, fmt.Sprintf("№%d — %d мл", use.BagID, use.VolumeML))
+	}
+	bags, err := b.store.ListMilkBags(ctx, userCtx.Child.ID)
+	if err != nil {
+		return err
+	}
+	left := 0
+	now := b.now()
+	for _, bag := range bags {
+		if bag.ExpiresAt.After(now) {
+			left += bag.RemainingML
+		}
+	}
+	return b.sendText(chatID, fmt.Sprintf("Записано кормление: %d мл из запаса (%s). Осталось годного молока: %d мл.", volume, strings.Join(parts, ", "), left))
+}
+
+// processPumpingReminders напоминает участникам с /pumpevery о сцеживании — один раз после каждого сцеживания.
+func (b *SleepBot) processPumpingReminders(ctx context.Context, target ReminderTarget, now time.Time) error {
+	states, err := b.familyPumpingStates(ctx, target)
+	if err != nil {
+		return err
+	}
+	for _, member := range target.Members {
+		state := states[member.ID]
+		if !PumpReminderDue(member.PumpIntervalMinutes, state.LastEnd, state.Active, now) {
+			continue
+		}
+		lastEnd := state.LastEnd
+		key := fmt.Sprintf("pump:%d:%d", member.ID, lastEnd.Unix())
+		if ok, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err != nil || !ok {
+			continue
+		}
+		b.broadcast(ctx, notificationPumping, []Member{member}, fmt.Sprintf("Пора сцеживаться: с прошлого раза прошло %s. Таймер: `/pump`.", formatDurationRU(now.Sub(*lastEnd))))
+	}
+	return nil
+}
+
+// familyPumpingStates загружает сцеживания участников семьи, если кто-то из них включил /pumpevery;
+// иначе nil без запроса к базе.
+func (b *SleepBot) familyPumpingStates(ctx context.Context, target ReminderTarget) (map[int64]PumpingState, error) {
+	for _, member := range target.Members {
+		if member.PumpIntervalMinutes > 0 {
+			return b.store.GetFamilyPumpingStates(ctx, target.Family.ID)
+		}
+	}
+	return nil, nil
+}
+
+func pumpIntervalLabel(minutes int) string {
+	if minutes <= 0 {
+		return "выкл."
+	}
+	return "через " + formatDurationRU(time.Duration(minutes)*time.Minute) + " после последнего"
+}
+
+// startRoutine начинает ритуал сегодняшнего вечера (или продолжает уже начатый) и присылает чек-лист.
+func (b *SleepBot) startRoutine(ctx context.Context, userCtx UserContext, chatID int64) error {
+	steps, err := b.store.GetRoutineSteps(ctx, userCtx.Child.ID)
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		steps = defaultRoutineSteps
+	}
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	now := b.now()
+	run, err := b.store.StartRoutine(ctx, userCtx.Child.ID, userCtx.Member.ID, routineEvening(now, loc), steps, now)
+	if err != nil {
+		return err
+	}
+	return b.sendTextWithInlineKeyboard(chatID, BuildRoutineChecklist(*run, loc), routineKeyboard(*run, loc))
+}
+
+func (b *SleepBot) toggleRoutineStep(ctx context.Context, userCtx UserContext, message *tgbotapi.Message, runID int64, step int) error {
+	run, err := b.store.GetRoutineRun(ctx, userCtx.Child.ID, runID)
+	if err != nil {
+		return b.sendText(message.Chat.ID, escapeTelegramMarkdown(err.Error()))
+	}
+	if step < 0 || step >= len(run.Steps) {
+		return nil
+	}
+	if err := b.store.ToggleRoutineMark(ctx, run.ID, step, userCtx.Member.ID, b.now()); err != nil {
+		return err
+	}
+	run, err = b.store.GetRoutineRun(ctx, userCtx.Child.ID, runID)
+	if err != nil {
+		return err
+	}
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	edit := tgbotapi.NewEditMessageTextAndMarkup(message.Chat.ID, message.MessageID, BuildRoutineChecklist(*run, loc), routineKeyboard(*run, loc))
+	edit.ParseMode = "Markdown"
+	_, err = b.request(edit)
+	return err
+}
+
+// routineKeyboard — кнопка на каждый шаг ритуала; выполненные отмечены ✓ и временем.
+func routineKeyboard(run RoutineRun, loc *time.Location) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, step := range run.Steps {
+		label := step
+		if doneAt, ok := run.Marks[i]; ok {
+			label = fmt.Sprintf("✓ %s — %s", step, doneAt.In(loc).Format("15:04"))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("rt:%d:%d", run.ID, i)),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// setRoutineSteps обрабатывает `/routine_steps [шаги через запятую|default]`.
+func (b *SleepBot) setRoutineSteps(ctx context.Context, userCtx UserContext, chatID int64, args string) error {
+	if args == "" {
+		steps, err := b.store.GetRoutineSteps(ctx, userCtx.Child.ID)
+		if err != nil {
+			return err
+		}
+		if len(steps) == 0 {
+			steps = defaultRoutineSteps
+		}
+		return b.sendText(chatID, fmt.Sprintf("Шаги ритуала: %s.\nИзменить: `/routine_steps купание, массаж, книжка`; вернуть стандартные: `/routine_steps default`.", escapeTelegramMarkdown(strings.Join(steps, ", "))))
+	}
+	var steps []string
+	if !strings.EqualFold(args, "default") {
+		parsed, err := parseRoutineSteps(args)
+		if err != nil {
+			return b.sendText(chatID, fmt.Sprintf("Не понял (%s). Пример: `/routine_steps купание, массаж, книжка`.", escapeTelegramMarkdown(err.Error())))
+		}
+		steps = parsed
+	}
+	if err := b.store.SetRoutineSteps(ctx, userCtx.Child.ID, steps); err != nil {
+		return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+	}
+	if len(steps) == 0 {
+		steps = defaultRoutineSteps
+	}
+	return b.sendText(chatID, fmt.Sprintf("Шаги ритуала обновлены: %s. Уже начатый сегодня ритуал сохранит прежние шаги.", escapeTelegramMarkdown(strings.Join(steps, ", "))))
+}
+
+func (b *SleepBot) sendRoutineReport(ctx context.Context, userCtx UserContext, chatID int64, days int) error {
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	now := b.now()
+	since := startOfDay(now, loc).AddDate(0, 0, -(days - 1))
+	runs, err := b.store.ListRoutineRunsSince(ctx, userCtx.Child.ID, since.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+	// Сны до утра после последнего вечера, чтобы учесть засыпание и ночь.
+	sessions, err := b.store.ListCompletedSleepsBetween(ctx, userCtx.Child.ID, since, startOfDay(now, loc).AddDate(0, 0, 2))
+	if err != nil {
+		return err
+	}
+	return b.sendText(chatID, BuildRoutineReport(runs, sessions, days, loc))
+}
+
+// recordHealthEntry сохраняет температуру или симптомы; температура от порога оповещения
+// рассылается остальным участникам семьи.
+func (b *SleepBot) recordHealthEntry(ctx context.Context, userCtx UserContext, chatID int64, entry HealthEntry) error {
+	saved, err := b.store.AddHealthEntry(ctx, userCtx.Child.ID, userCtx.Member.ID, entry)
+	if err != nil {
+		return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+	}
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	recordedAt := formatLocalDateTime(saved.RecordedAt, loc)
+	if saved.Kind == healthSymptom {
+		return b.sendText(chatID, fmt.Sprintf("Записано (%s): %s. Период болезни: /sick", recordedAt, escapeTelegramMarkdown(strings.Join(saved.Tags, ", "))))
+	}
+
+	text := fmt.Sprintf("Записано (%s): температура %s.", recordedAt, formatTemperature(saved.Temperature))
+	if !TemperatureAlertTriggered(*saved, userCtx.Settings.TemperatureAlert) {
+		return b.sendText(chatID, text+" Период болезни: /sick")
+	}
+	alert := fmt.Sprintf("Внимание: у %s температура %s (%s), порог оповещения — %s.",
+		escapeTelegramMarkdown(userCtx.Child.Name), formatTemperature(saved.Temperature), recordedAt, formatTemperature(userCtx.Settings.TemperatureAlert),
+	)
+	if err := b.sendText(chatID, text+"\n"+alert+"\nОстальные участники семьи получили оповещение."); err != nil {
+		return err
+	}
+	members, err := b.store.GetFamilyMembers(ctx, userCtx.Family.ID)
+	if err != nil {
+		return err
+	}
+	var others []Member
+	for _, member := range members {
+		if member.ID != userCtx.Member.ID {
+			others = append(others, member)
+		}
+	}
+	b.broadcast(ctx, notificationFamily, others, fmt.Sprintf("%s Записал(а): %s.", alert, escapeTelegramMarkdown(userCtx.Member.DisplayName)))
+	return nil
+}
+
+func (b *SleepBot) sendSickReport(ctx context.Context, userCtx UserContext, chatID int64, days int) error {
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	now := b.now()
+	from := startOfDay(now, loc).AddDate(0, 0, -(days - 1))
+	entries, err := b.store.ListHealthEntriesBetween(ctx, userCtx.Child.ID, from, now.Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	active, err := b.store.GetActiveSleep(ctx, userCtx.Child.ID)
+	if err != nil {
+		return err
+	}
+	// Ночь первого дня начинается накануне.
+	sessions, err := b.store.ListCompletedSleepsBetween(ctx, userCtx.Child.ID, from.AddDate(0, 0, -1), now)
+	if err != nil {
+		return err
+	}
+	report := BuildSickReport(escapeTelegramMarkdown(userCtx.Child.Name), entries, sessionsWithActive(sessions, active, now), now, days, loc)
+	return b.sendText(chatID, report)
+}
+
+// medicationDosesLookback — сколько истории доз достаточно для проверки интервала и приёмов за сегодня.
+const medicationDosesLookback = 48 * time.Hour
+
+func (b *SleepBot) sendMedications(ctx context.Context, userCtx UserContext, chatID int64) error {
+	medications, err := b.store.ListMedications(ctx, userCtx.Child.ID)
+	if err != nil {
+		return err
+	}
+	now := b.now()
+	doses, err := b.store.ListMedicationDosesSince(ctx, userCtx.Child.ID, now.Add(-medicationDosesLookback))
+	if err != nil {
+		return err
+	}
+	report := BuildMedicationsReport(medications, doses, now, b.mustLocation(userCtx.Family.Timezone))
+	if len(medications) == 0 {
+		return b.sendText(chatID, report)
+	}
+	return b.sendTextWithInlineKeyboard(chatID, report, medicationsKeyboard(medications))
+}
+
+// giveMedication отмечает дозу, предупреждает о нарушении интервала и сообщает остальным участникам семьи.
+func (b *SleepBot) giveMedication(ctx context.Context, userCtx UserContext, chatID int64, medicationID int64) error {
+	medication, err := b.store.GetMedication(ctx, userCtx.Child.ID, medicationID)
+	if err != nil {
+		return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+	}
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	now := b.now()
+	doses, err := b.store.ListMedicationDosesSince(ctx, userCtx.Child.ID, now.Add(-medicationDosesLookback))
+	if err != nil {
+		return err
+	}
+	warning := CheckMedicationDose(*medication, medicationDoses(doses, medication.ID), now, loc)
+	dose, err := b.store.AddMedicationDose(ctx, medication.ID, userCtx.Member.ID, now)
+	if err != nil {
+		return b.sendText(chatID, escapeTelegramMarkdown(err.Error()))
+	}
+
+	givenAt := dose.GivenAt.In(loc).Format("15:04")
+	text := fmt.Sprintf("Отмечено: %s в %s.", formatMedicationTitle(*medication), givenAt)
+	if warning != "" {
+		text += "\n" + warning
+	}
+	if err := b.sendText(chatID, text); err != nil {
+		return err
+	}
+
+	members, err := b.store.GetFamilyMembers(ctx, userCtx.Family.ID)
+	if err != nil {
+		return err
+	}
+	var others []Member
+	for _, member := range members {
+		if member.ID != userCtx.Member.ID {
+			others = append(others, member)
+		}
+	}
+	notice := fmt.Sprintf("%s дал(а) %s в %s.", escapeTelegramMarkdown(userCtx.Member.DisplayName), formatMedicationTitle(*medication), givenAt)
+	if warning != "" {
+		notice += "\n" + warning
+	}
+	b.broadcast(ctx, notificationFamily, others, notice)
+	return nil
+}
+
+// processMedicationReminders напоминает о приёмах по расписанию, которые ещё не отмечены.
+func (b *SleepBot) processMedicationReminders(ctx context.Context, target ReminderTarget, now time.Time, loc *time.Location) error {
+	medications, err := b.store.ListMedications(ctx, target.Child.ID)
+	if err != nil || len(medications) == 0 {
+		return err
+	}
+	doses, err := b.store.ListMedicationDosesSince(ctx, target.Child.ID, now.Add(-medicationDosesLookback))
+	if err != nil {
+		return err
+	}
+	localDate := now.In(loc).Format("2006-01-02")
+	for _, medication := range medications {
+		for _, atTime := range DueMedicationSlots(medication, medicationDoses(doses, medication.ID), now, loc) {
+			key := fmt.Sprintf("medication:%d:%s:%s", medication.ID, localDate, atTime)
+			if ok, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err != nil || !ok {
+				continue
+			}
+			message := fmt.Sprintf("%s: пора дать %s — приём в %s. Отметить — кнопкой или `/give %d`.",
+				escapeTelegramMarkdown(target.Child.Name), formatMedicationTitle(medication), atTime, medication.ID,
+			)
+			keyboard := medicationsKeyboard([]Medication{medication})
+			b.enqueueNotification(ctx, notificationMedication, target.Members, message, &keyboard)
+		}
+		// Лекарство «не чаще раза в N» не напоминает дать дозу, а сообщает, что интервал прошел.
+		own := medicationDoses(doses, medication.ID)
+		allowedAt, ok := NextDoseAllowedAt(medication, own)
+		if !ok || now.Before(allowedAt) || now.Sub(allowedAt) >= digestCatchUp {
+			continue
+		}
+		last := own[len(own)-1]
+		key := fmt.Sprintf("medication-interval:%d:%d", medication.ID, last.ID)
+		if ok, err := b.store.TryMarkNotificationSent(ctx, target.Family.ID, key); err != nil || !ok {
+			continue
+		}
+		message := fmt.Sprintf("%s: с последней дозы %s (%s%s) прошло %s — следующую можно дать, если она нужна. Отметить — кнопкой или `/give %d`.",
+			escapeTelegramMarkdown(target.Child.Name), formatMedicationTitle(medication), formatLocalDateTime(last.GivenAt, loc), formatDoseGiver(last),
+			formatDurationRU(time.Duration(medication.MinIntervalMinutes)*time.Minute), medication.ID,
+		)
+		keyboard := medicationsKeyboard([]Medication{medication})
+		b.enqueueNotification(ctx, notificationMedication, target.Members, message, &keyboard)
+	}
+	return nil
+}
+
+func medicationsKeyboard(medications []Medication) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(medications))
+	for _, medication := range medications {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Дать: "+medication.Name, fmt.Sprintf("med:%d", medication.ID)),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func (b *SleepBot) sendExportCSV(ctx context.Context, userCtx UserContext, chatID int64) error {
+	sessions, err := b.store.ListAllCompletedSleeps(ctx, userCtx.Child.ID)
+	if err != nil {
+		return err
+	}
+	measurements, err := b.store.ListMeasurements(ctx, userCtx.Child.ID)
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 && len(measurements) == 0 {
+		return b.sendText(chatID, "Пока нет завершенных записей сна и измерений для экспорта.")
+	}
+
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	if len(sessions) > 0 {
+		if err := b.sendSleepsCSV(chatID, sessions, loc); err != nil {
+			return err
+		}
+	}
+	if len(measurements) == 0 {
+		return nil
+	}
+	payload, err := BuildMeasurementsCSV(userCtx.Child, measurements, loc)
+	if err != nil {
+		return err
+	}
+	filename := fmt.Sprintf("measurements_export_%s.csv", b.now().In(loc).Format("20060102"))
+	return b.sendDocument(chatID, filename, payload)
+}
+
+func (b *SleepBot) sendSleepsCSV(chatID int64, sessions []SleepSession, loc *time.Location) error {
+	var csvBuf bytes.Buffer
+	writer := csv.NewWriter(&csvBuf)
+
+	if err := writer.Write([]string{
 		"id",
 		"start_at_local",
 		"end_at_local",
@@ -800,6 +2337,7 @@ func (b *SleepBot) sendExportCSV(ctx context.Context, userCtx UserContext, chatI
 		"start_source",
 		"end_source",
 		"note",
+		"tags",
 		"created_by",
 		"updated_by",
 	}); err != nil {
@@ -819,6 +2357,7 @@ func (b *SleepBot) sendExportCSV(ctx context.Context, userCtx UserContext, chatI
 			session.StartSource,
 			session.EndSource,
 			session.Note,
+			strings.Join(session.Tags, ";"),
 			strconv.FormatInt(session.CreatedBy, 10),
 			strconv.FormatInt(session.UpdatedBy, 10),
 		}); err != nil {
@@ -830,10 +2369,29 @@ func (b *SleepBot) sendExportCSV(ctx context.Context, userCtx UserContext, chatI
 		return err
 	}
 
-	filename := fmt.Sprintf("sleep_export_%s.csv", time.Now().In(loc).Format("20060102"))
+	filename := fmt.Sprintf("sleep_export_%s.csv", b.now().In(loc).Format("20060102"))
 	return b.sendDocument(chatID, filename, csvBuf.Bytes())
 }
 
+func (b *SleepBot) sendPDFReport(ctx context.Context, userCtx UserContext, chatID int64, days int) error {
+	active, err := b.store.GetActiveSleep(ctx, userCtx.Child.ID)
+	if err != nil {
+		return err
+	}
+	sessions, err := b.store.ListCompletedSleepsSince(ctx, userCtx.Child.ID, b.now().UTC().AddDate(0, 0, -(days+2)))
+	if err != nil {
+		return err
+	}
+	loc := b.mustLocation(userCtx.Family.Timezone)
+	now := b.now()
+	payload, err := BuildPDFReport(userCtx.Child, sessions, active, now, days, loc)
+	if err != nil {
+		return err
+	}
+	filename := fmt.Sprintf("sleep_report_%dd_%s.pdf", days, now.In(loc).Format("20060102"))
+	return b.sendDocument(chatID, filename, payload)
+}
+
 func (b *SleepBot) sendSettings(ctx context.Context, userCtx UserContext, chatID int64) error {
 	var lines []string
 	lines = append(lines, "Настройки:")
@@ -843,12 +2401,14 @@ func (b *SleepBot) sendSettings(ctx context.Context, userCtx UserContext, chatID
 		loc := b.mustLocation(userCtx.Family.Timezone)
 		lines = append(lines, fmt.Sprintf("Дата и время рождения: %s", formatChildBirthForSettings(*userCtx.Child.BirthDate, loc)))
 	}
+	lines = append(lines, fmt.Sprintf("Пол: %s", childSexLabel(userCtx.Child.Sex)))
 	lines = append(lines, "")
 	lines = append(lines, "Команды:")
 	lines = append(lines, "`/invite`")
 	lines = append(lines, "`/setchild Имя`")
 	lines = append(lines, "`/settimezone Europe/Moscow`")
 	lines = append(lines, "`/setbirthdate 16.03.2026 14:30` или `/setbirthdate 16.03.2026`")
+	lines = append(lines, "`/setsex мальчик` или `/setsex девочка` (нужно для перцентилей роста и веса)")
 	lines = append(lines, "`/editlast`")
 	lines = append(lines, "")
 	lines = append(lines, "Красивые даты (от полуночи дня рождения в вашей таймзоне):")
@@ -870,12 +2430,19 @@ func (b *SleepBot) sendReminders(ctx context.Context, userCtx UserContext, chatI
 	lines = append(lines, fmt.Sprintf("Окно бодрствования: %d мин", userCtx.Settings.WakeWindowMinutes))
 	lines = append(lines, fmt.Sprintf("Слишком долгий сон: %d мин", userCtx.Settings.MaxSleepMinutes))
 	lines = append(lines, fmt.Sprintf("Нет записей: %d мин", userCtx.Settings.InactivityMinutes))
+	lines = append(lines, fmt.Sprintf("Оповещение о температуре (всей семье): %s", formatTemperatureAlert(userCtx.Settings.TemperatureAlert)))
+	lines = append(lines, fmt.Sprintf("Утренняя сводка (только вам): %s", digestAtLabel(userCtx.Member.DailyDigestAt)))
+	lines = append(lines, fmt.Sprintf("Итоги недели по воскресеньям (только вам): %s", digestAtLabel(userCtx.Member.WeeklyDigestAt)))
+	lines = append(lines, fmt.Sprintf("Сцеживание (только вам): %s", pumpIntervalLabel(userCtx.Member.PumpIntervalMinutes)))
 	lines = append(lines, "")
 	lines = append(lines, "Команды:")
 	lines = append(lines, "`/reminders_on`, `/reminders_off`")
 	lines = append(lines, "`/milestone_notify on|off`, `/milestone_report on|off`")
 	lines = append(lines, "`/setwake 90`, `/setmaxsleep 120`, `/setinactive 240`")
 	lines = append(lines, "`/addreminder 19:30 Купание`")
+	lines = append(lines, "`/digest 08:00`, `/digest weekly 20:00`, `/digest off`")
+	lines = append(lines, "`/tempalert 38.5`, `/tempalert off`")
+	lines = append(lines, "`/pumpevery 180`, `/pumpevery off`")
 	if len(custom) > 0 {
 		lines = append(lines, "")
 		lines = append(lines, "Пользовательские напоминания:")
@@ -887,6 +2454,47 @@ func (b *SleepBot) sendReminders(ctx context.Context, userCtx UserContext, chatI
 	return b.sendText(chatID, strings.Join(lines, "\n"))
 }
 
+// updateDigest обрабатывает /digest: `08:00` или `off` — утренняя сводка, `weekly 20:00` или `weekly off` — воскресная.
+func (b *SleepBot) updateDigest(ctx context.Context, userCtx UserContext, chatID int64, args string) error {
+	usage := "Использование: `/digest 08:00`, `/digest off`, `/digest weekly 20:00`, `/digest weekly off`."
+	fields := strings.Fields(strings.ToLower(args))
+	if len(fields) == 0 {
+		return b.sendText(chatID, strings.Join([]string{
+			fmt.Sprintf("Утренняя сводка о ночи: %s", digestAtLabel(userCtx.Member.DailyDigestAt)),
+			fmt.Sprintf("Итоги недели (по воскресеньям): %s", digestAtLabel(userCtx.Member.WeeklyDigestAt)),
+			"Сводки приходят только вам, у второго родителя — свои настройки.",
+			usage,
+		}, "\n"))
+	}
+
+	field, label, schedule := "digest_daily_at", "Утренняя сводка о ночи", "каждый день"
+	if fields[0] == "weekly" {
+		field, label, schedule = "digest_weekly_at", "Итоги недели", "по воскресеньям"
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return b.sendText(chatID, usage)
+	}
+	atTime := fields[0]
+	if atTime == "off" {
+		atTime = ""
+	}
+	if err := b.store.SetMemberDigest(ctx, userCtx.Member.ID, field, atTime); err != nil {
+		return b.sendText(chatID, escapeTelegramMarkdown(err.Error())+"\n"+usage)
+	}
+	if atTime == "" {
+		return b.sendText(chatID, fmt.Sprintf("%s: выкл.", label))
+	}
+	return b.sendText(chatID, fmt.Sprintf("%s: %s в %s (%s).", label, schedule, atTime, escapeTelegramMarkdown(userCtx.Family.Timezone)))
+}
+
+func digestAtLabel(atTime string) string {
+	if atTime == "" {
+		return "выкл"
+	}
+	return atTime
+}
+
 func milestoneOnOff(on bool) string {
 	if on {
 		return "вкл"
@@ -985,25 +2593,49 @@ func (b *SleepBot) applyCustomReminder(ctx context.Context, userCtx UserContext,
 	return b.sendText(chatID, "Пользовательское напоминание добавлено.")
 }
 
-func (b *SleepBot) broadcast(members []Member, text string) {
-	for _, member := range members {
-		if member.TelegramChatID == 0 {
-			continue
-		}
-		if err := b.sendText(member.TelegramChatID, text); err != nil {
-			log.Printf("broadcast failed to %d: %v", member.TelegramChatID, err)
-		}
+// notifyFamily рассылает всем участникам семьи userCtx изменение, пришедшее не из чата (например, через API).
+func (b *SleepBot) notifyFamily(ctx context.Context, userCtx UserContext, text string) {
+	b.reminders.touch(userCtx.Family.ID)
+	members, err := b.store.GetFamilyMembers(ctx, userCtx.Family.ID)
+	if err != nil {
+		loggerFrom(ctx).Error("notify family failed", "family_id", userCtx.Family.ID, "error", err)
+		return
 	}
+	b.broadcast(ctx, notificationFamily, members, text)
+}
+
+// broadcast ставит уведомление типа kind в очередь outbox для участников; доставляет RunOutbox.
+func (b *SleepBot) broadcast(ctx context.Context, kind string, members []Member, text string) {
+	b.enqueueNotification(ctx, kind, members, text, nil)
+}
+
+// send и request — вызовы Telegram Bot API с лимитами отправки и учетом ошибок в метриках.
+func (b *SleepBot) send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var msg tgbotapi.Message
+	err := b.callTelegram("send", chattableChatID(c), func() (err error) {
+		msg, err = b.api.Send(c)
+		return err
+	})
+	return msg, err
+}
+
+func (b *SleepBot) request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	err := b.callTelegram("request", chattableChatID(c), func() (err error) {
+		resp, err = b.api.Request(c)
+		return err
+	})
+	return resp, err
 }
 
 func (b *SleepBot) sendText(chatID int64, text string) error {
 	for _, part := range splitTelegramMessage(text, telegramMaxMessageRunes) {
 		msg := tgbotapi.NewMessage(chatID, part)
 		msg.ParseMode = "Markdown"
-		_, err := b.api.Send(msg)
+		_, err := b.send(msg)
 		if err != nil && telegramSendPlainFallback(err) {
 			msg.ParseMode = ""
-			_, err = b.api.Send(msg)
+			_, err = b.send(msg)
 		}
 		if err != nil {
 			return err
@@ -1016,13 +2648,28 @@ func (b *SleepBot) sendTextWithKeyboard(chatID int64, text string, keyboard tgbo
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
-	_, err := b.api.Send(msg)
+	_, err := b.send(msg)
+	return err
+}
+
+func (b *SleepBot) sendTextWithInlineKeyboard(chatID int64, text string, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = keyboard
+	_, err := b.send(msg)
 	return err
 }
 
 func (b *SleepBot) sendDocument(chatID int64, filename string, payload []byte) error {
 	msg := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: filename, Bytes: payload})
-	_, err := b.api.Send(msg)
+	_, err := b.send(msg)
+	return err
+}
+
+func (b *SleepBot) sendPhoto(chatID int64, filename string, payload []byte, caption string) error {
+	msg := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: filename, Bytes: payload})
+	msg.Caption = caption
+	_, err := b.send(msg)
 	return err
 }
 
@@ -1041,6 +2688,9 @@ func (b *SleepBot) mainKeyboard(active bool) tgbotapi.ReplyKeyboardMarkup {
 				tgbotapi.NewKeyboardButton("Закончился 30 минут назад"),
 				tgbotapi.NewKeyboardButton("Исправить последний сон"),
 			),
+			tgbotapi.NewKeyboardButtonRow(
+				tgbotapi.NewKeyboardButton("Активности"),
+			),
 			tgbotapi.NewKeyboardButtonRow(
 				tgbotapi.NewKeyboardButton("Оценить"),
 				tgbotapi.NewKeyboardButton("Отчеты"),
@@ -1065,6 +2715,7 @@ func (b *SleepBot) mainKeyboard(active bool) tgbotapi.ReplyKeyboardMarkup {
 		),
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("Исправить последний сон"),
+			tgbotapi.NewKeyboardButton("Активности"),
 			tgbotapi.NewKeyboardButton("Оценить"),
 		),
 		tgbotapi.NewKeyboardButtonRow(
@@ -1087,19 +2738,22 @@ func (b *SleepBot) localTimeHint(userCtx UserContext) string {
 	return "Время в вашей таймзоне: `" + escapeTelegramMarkdown(userCtx.Family.Timezone) + "`"
 }
 
-func (b *SleepBot) sendEvaluation(ctx context.Context, userCtx UserContext, chatID int64) error {
+// sendEvaluation отправляет оценку по нормам за окно days (1 — последние 24 часа).
+func (b *SleepBot) sendEvaluation(ctx context.Context, userCtx UserContext, chatID int64, days int) error {
 	loc := b.mustLocation(userCtx.Family.Timezone)
 	active, err := b.store.GetActiveSleep(ctx, userCtx.Child.ID)
 	if err != nil {
 		return err
 	}
-	since := time.Now().UTC().Add(-48 * time.Hour)
+	// Плюс ночь перед первым днём окна и запас на сдвиг таймзоны.
+	since := b.now().UTC().AddDate(0, 0, -(days + 2))
 	sessions, err := b.store.ListCompletedSleepsSince(ctx, userCtx.Child.ID, since)
 	if err != nil {
 		return err
 	}
-	merged := sessionsWithActive(sessions, active, time.Now())
-	report := BuildNormsReport(userCtx.Child, merged, loc, time.Now())
+	merged := sessionsWithActive(sessions, active, b.now())
+	report := BuildNormsWindowReport(userCtx.Child, merged, loc, b.now(), days)
+	report += "\n\nДругие окна: `/evaluate 1` (24 часа), `/evaluate 3`, `/evaluate 7`, `/evaluate 14`."
 	return b.sendText(chatID, report)
 }
 
@@ -1178,6 +2832,120 @@ func parseFlexibleDateTime(raw string, now time.Time, loc *time.Location) (time.
 	return time.Time{}, false, fmt.Errorf("unsupported datetime")
 }
 
+// Максимальная длина произвольного периода в /report.
+const reportMaxRangeDays = 92
+
+// parseReportDate разбирает дату отчёта `12.03` или `12.03.2026` в таймзоне семьи.
+// Дата без года, которая ещё не наступила в этом году, относится к прошлому году.
+func parseReportDate(raw string, now time.Time, loc *time.Location) (time.Time, error) {
+	parsed, _, err := parseReportDateWithYear(raw, now, loc)
+	return parsed, err
+}
+
+func parseReportDateWithYear(raw string, now time.Time, loc *time.Location) (time.Time, bool, error) {
+	raw = strings.TrimSpace(raw)
+	current := now.In(loc)
+	if parsed, err := time.ParseInLocation("02.01.2006", raw, loc); err == nil {
+		if parsed.After(current) {
+			return time.Time{}, true, fmt.Errorf("дата в будущем")
+		}
+		return parsed, true, nil
+	}
+	parsed, err := time.ParseInLocation("02.01", raw, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("неизвестный формат даты")
+	}
+	parsed = time.Date(current.Year(), parsed.Month(), parsed.Day(), 0, 0, 0, 0, loc)
+	if parsed.After(current) {
+		parsed = parsed.AddDate(-1, 0, 0)
+	}
+	return parsed, false, nil
+}
+
+// parseReportDateRange разбирает период `01.03-15.03` (даты включительно, в таймзоне семьи).
+func parseReportDateRange(raw string, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	raw = strings.ReplaceAll(raw, "–", "-")
+	chunks := strings.Split(raw, "-")
+	if len(chunks) != 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("нужно две даты через дефис")
+	}
+	start, startHasYear, err := parseReportDateWithYear(chunks[0], now, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := parseReportDate(chunks[1], now, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if start.After(end) && !startHasYear {
+		// `25.12-05.01`: начало без года относится к предыдущему году.
+		start = start.AddDate(-1, 0, 0)
+	}
+	if start.After(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("начало позже конца")
+	}
+	if rangeLongerThan(start, end, reportMaxRangeDays, loc) {
+		return time.Time{}, time.Time{}, fmt.Errorf("период длиннее %d дней", reportMaxRangeDays)
+	}
+	return start, end, nil
+}
+
+// parsePeriodOffset разбирает аргумент /week и /month: пусто — текущий период, `prev` — предыдущий, N — на N назад.
+func parsePeriodOffset(raw string) (int, bool) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "":
+		return 0, true
+	case "prev", "пред", "назад":
+		return 1, true
+	}
+	offset, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || offset < 0 || offset > 52 {
+		return 0, false
+	}
+	return offset, true
+}
+
+// parseCompareRanges разбирает аргумент /compare и возвращает сначала прошлый, затем текущий период.
+// Без аргумента — последние 7 полных дней против 7 дней до них; `month` — 30 дней; N — N дней;
+// два периода `01.03-07.03 08.03-14.03` сравниваются в указанном порядке.
+func parseCompareRanges(raw string, now time.Time, loc *time.Location) (time.Time, time.Time, time.Time, time.Time, error) {
+	var zero time.Time
+	fields := strings.Fields(raw)
+	if len(fields) == 2 {
+		previousStart, previousEnd, err := parseReportDateRange(fields[0], now, loc)
+		if err != nil {
+			return zero, zero, zero, zero, err
+		}
+		currentStart, currentEnd, err := parseReportDateRange(fields[1], now, loc)
+		if err != nil {
+			return zero, zero, zero, zero, err
+		}
+		return previousStart, previousEnd, currentStart, currentEnd, nil
+	}
+	if len(fields) > 2 {
+		return zero, zero, zero, zero, fmt.Errorf("нужно не больше двух периодов")
+	}
+
+	days := 7
+	switch arg := strings.ToLower(strings.TrimSpace(raw)); arg {
+	case "", "week", "неделя":
+	case "month", "месяц":
+		days = 30
+	default:
+		parsed, err := strconv.Atoi(arg)
+		if err != nil || parsed < 1 || parsed > reportMaxRangeDays {
+			return zero, zero, zero, zero, fmt.Errorf("число дней от 1 до %d", reportMaxRangeDays)
+		}
+		days = parsed
+	}
+	// Сегодняшний день ещё не закончился и занизил бы средние, поэтому сравниваем полные дни.
+	currentEnd := startOfDay(now, loc).AddDate(0, 0, -1)
+	currentStart := lastDaysStart(currentEnd, days, loc)
+	previousEnd := currentStart.AddDate(0, 0, -1)
+	previousStart := lastDaysStart(previousEnd, days, loc)
+	return previousStart, previousEnd, currentStart, currentEnd, nil
+}
+
 func formatLocalDateTime(ts time.Time, loc *time.Location) string {
 	return ts.In(loc).Format("02.01 15:04")
 }
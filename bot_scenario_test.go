@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// botHarness прогоняет сообщения через SleepBot с fakeTelegram, настоящим Store в SQLite
+// во временном каталоге и управляемыми часами.
+type botHarness struct {
+	t        *testing.T
+	bot      *SleepBot
+	store    *Store
+	tg       *fakeTelegram
+	clock    *testClock
+	updateID int
+	// names — имена пользователей в Telegram; по умолчанию «Родитель».
+	names map[int64]string
+}
+
+func newBotHarness(t *testing.T) *botHarness {
+	t.Helper()
+	db, err := openDatabase(filepath.Join(t.TempDir(), "sleepbot.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	cfg := Config{
+		DefaultTimezone: "Europe/Moscow", InviteTTL: 24 * time.Hour, MaxBackdate: 48 * time.Hour,
+		UpdateWorkers: 4, UpdateQueueSize: 64, ShutdownTimeout: 10 * time.Second,
+	}
+	store, err := NewStore(db, cfg)
+	if err != nil {
+		t.Fatalf("init store: %v", err)
+	}
+	// Понедельник, 12:00 по Москве.
+	clock := &testClock{now: time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC)}
+	store.clock = clock.Now
+	tg := newFakeTelegram()
+	bot := NewSleepBot(tg, store, cfg)
+	// Лимиты отправки считаются по управляемым часам; ждать по-настоящему в тестах незачем.
+	bot.limiter.sleep = func(time.Duration) {}
+	return &botHarness{t: t, bot: bot, store: store, tg: tg, clock: clock, names: map[int64]string{}}
+}
+
+// send обрабатывает сообщение пользователя userID в его личном чате и возвращает ответы в этот чат.
+func (h *botHarness) send(userID int64, text string) []fakeMessage {
+	h.t.Helper()
+	update := h.update(userID, text)
+	if err := h.bot.handleUpdate(context.Background(), update); err != nil {
+		h.t.Fatalf("handle %q from %d: %v", text, userID, err)
+	}
+	return messagesTo(h.tg.take(), userID)
+}
+
+// update собирает обновление с сообщением text от пользователя userID в его личном чате.
+func (h *botHarness) update(userID int64, text string) tgbotapi.Update {
+	h.updateID++
+	name := h.names[userID]
+	if name == "" {
+		name = "Родитель"
+	}
+	msg := &tgbotapi.Message{
+		MessageID: h.updateID,
+		From:      &tgbotapi.User{ID: userID, FirstName: name},
+		Chat:      &tgbotapi.Chat{ID: userID, Type: "private"},
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command, _, _ := strings.Cut(text, " ")
+		msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+	return tgbotapi.Update{UpdateID: h.updateID, Message: msg}
+}
+
+// expect отправляет сообщение и проверяет, что в ответах есть want.
+func (h *botHarness) expect(userID int64, text string, want string) {
+	h.t.Helper()
+	if got := joinTexts(h.send(userID, text)); !strings.Contains(got, want) {
+		h.t.Fatalf("after %q expected %q in reply, got:\n%s", text, want, got)
+	}
+}
+
+// onboard регистрирует новую семью пользователя userID с ребенком Маша.
+func (h *botHarness) onboard(userID int64) {
+	h.t.Helper()
+	h.expect(userID, "/start", "Шаг 1/3")
+	h.expect(userID, "Маша", "Шаг 2/3")
+	h.expect(userID, "Europe/Moscow", "Шаг 3/3")
+	h.expect(userID, "01.03.2026", "Профиль сохранён")
+}
+
+// join добавляет пользователя userID в семью ownerID по коду из /invite.
+func (h *botHarness) join(ownerID int64, userID int64) {
+	h.t.Helper()
+	reply := joinTexts(h.send(ownerID, "/invite"))
+	code := regexp.MustCompile("`([A-Z0-9]+)`").FindStringSubmatch(reply)
+	if code == nil {
+		h.t.Fatalf("no invite code in %q", reply)
+	}
+	h.expect(userID, "/join "+code[1], "Теперь вы привязаны к семье")
+}
+
+// processReminders обрабатывает семьи с наступившими по часам сроками и доставляет очередь outbox.
+func (h *botHarness) processReminders() []fakeMessage {
+	h.t.Helper()
+	h.bot.runDueReminders(context.Background())
+	return h.deliverOutbox()
+}
+
+func (h *botHarness) deliverOutbox() []fakeMessage {
+	h.t.Helper()
+	if err := h.bot.deliverOutbox(context.Background()); err != nil {
+		h.t.Fatalf("deliver outbox: %v", err)
+	}
+	return h.tg.take()
+}
+
+// member возвращает участника семьи ownerID с чатом chatID.
+func (h *botHarness) member(ownerID int64, chatID int64) Member {
+	h.t.Helper()
+	owner, err := h.store.GetUserContext(context.Background(), ownerID)
+	if err != nil {
+		h.t.Fatalf("owner context: %v", err)
+	}
+	members, err := h.store.GetFamilyMembers(context.Background(), owner.Family.ID)
+	if err != nil {
+		h.t.Fatalf("family members: %v", err)
+	}
+	for _, member := range members {
+		if member.TelegramChatID == chatID {
+			return member
+		}
+	}
+	h.t.Fatalf("no member with chat %d", chatID)
+	return Member{}
+}
+
+func TestScenarioOnboarding(t *testing.T) {
+	h := newBotHarness(t)
+	h.expect(100, "/start", "Шаг 1/3")
+	h.expect(100, "Маша", "Шаг 2/3")
+	h.expect(100, "Mars/Base", "не удалось загрузить таймзону")
+	h.expect(100, "Сон начался", "Сначала ответьте на вопрос анкеты")
+	h.expect(100, "Europe/Moscow", "Шаг 3/3")
+	h.expect(100, "вчера", "Не удалось разобрать дату рождения")
+	h.expect(100, "01.03.2026 14:30", "Профиль сохранён")
+
+	userCtx, err := h.store.GetUserContext(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("user context: %v", err)
+	}
+	if userCtx.Child.Name != "Маша" || userCtx.Family.Timezone != "Europe/Moscow" || userCtx.Child.BirthDate == nil {
+		t.Fatalf("unexpected profile %+v", userCtx)
+	}
+	if want := time.Date(2026, 3, 1, 11, 30, 0, 0, time.UTC); !userCtx.Child.BirthDate.Equal(want) {
+		t.Fatalf("expected birth %v, got %v", want, userCtx.Child.BirthDate)
+	}
+	if state, err := h.store.GetUserState(context.Background(), 100); err == nil && state != nil {
+		t.Fatalf("onboarding state should be cleared, got %+v", state)
+	}
+}
+
+func TestScenarioJoin(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(100)
+	h.join(100, 200)
+
+	owner, err := h.store.GetUserContext(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("owner context: %v", err)
+	}
+	members, err := h.store.GetFamilyMembers(context.Background(), owner.Family.ID)
+	if err != nil || len(members) != 2 {
+		t.Fatalf("expected 2 members, got %d (%v)", len(members), err)
+	}
+	if familyID, err := h.store.GetFamilyIDByTelegramUser(context.Background(), 200); err != nil || familyID != owner.Family.ID {
+		t.Fatalf("joined member should be in family %d, got %d (%v)", owner.Family.ID, familyID, err)
+	}
+
+	h.expect(300, "/join NOPE42", "код приглашения не найден")
+	if _, err := h.store.GetUserContext(context.Background(), 300); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("unknown code should not create a member, got %v", err)
+	}
+	if familyID, err := h.store.GetFamilyIDByTelegramUser(context.Background(), 300); err != nil || familyID != 0 {
+		t.Fatalf("user without a family should get 0, got %d (%v)", familyID, err)
+	}
+
+	// Код действует сутки.
+	reply := joinTexts(h.send(100, "/invite"))
+	code := regexp.MustCompile("`([A-Z0-9]+)`").FindStringSubmatch(reply)
+	h.clock.Advance(25 * time.Hour)
+	h.expect(300, "/join "+code[1], "код приглашения уже истек")
+	if _, err := h.store.GetUserContext(context.Background(), 300); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expired code should not create a member, got %v", err)
+	}
+}
+
+func TestScenarioSleepStartEnd(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(100)
+	h.join(100, 200)
+
+	h.expect(100, "Сон начался", "Сон начался в 16.03 12:00.")
+	h.expect(200, "Сон начался", "сон уже идет с")
+	h.clock.Advance(90 * time.Minute)
+	h.expect(200, "Закончился 10 минут назад", "Сон завершен в 16.03 13:20.\nДлительность: "+formatDurationRU(80*time.Minute)+".")
+
+	userCtx, _ := h.store.GetUserContext(context.Background(), 100)
+	last, err := h.store.GetLastCompletedSleep(context.Background(), userCtx.Child.ID)
+	if err != nil || last == nil {
+		t.Fatalf("expected completed sleep, got %v %v", last, err)
+	}
+	if last.StartSource != sourceRealTime || last.EndSource != sourceQuickBackdate {
+		t.Fatalf("unexpected sources %q/%q", last.StartSource, last.EndSource)
+	}
+	h.expect(100, "Сон закончился", "сейчас нет активного сна")
+	if active, _ := h.store.GetActiveSleep(context.Background(), userCtx.Child.ID); active != nil {
+		t.Fatalf("no sleep should be active, got %+v", active)
+	}
+}
+
+func TestScenarioEditLastSleep(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(100)
+	h.send(100, "Сон начался")
+	h.clock.Advance(90 * time.Minute)
+	h.send(100, "Сон закончился")
+
+	h.expect(100, "Исправить последний сон", "16.03 12:00 - 16.03 13:30")
+	h.expect(100, "после обеда", "Не понял интервал")
+	h.expect(100, "11:50 - 13:20", "Последний сон обновлен.")
+
+	userCtx, _ := h.store.GetUserContext(context.Background(), 100)
+	last, err := h.store.GetLastCompletedSleep(context.Background(), userCtx.Child.ID)
+	if err != nil || last == nil {
+		t.Fatalf("expected completed sleep, got %v %v", last, err)
+	}
+	wantStart := time.Date(2026, 3, 16, 8, 50, 0, 0, time.UTC)
+	if !last.StartAt.Equal(wantStart) || !last.EndAt.Equal(wantStart.Add(90*time.Minute)) {
+		t.Fatalf("unexpected edited sleep %v - %v", last.StartAt, last.EndAt)
+	}
+}
+
+func TestScenarioReminders(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(100)
+	h.join(100, 200)
+	h.expect(100, "/setwake 60", "Настройка обновлена.")
+	h.expect(100, "/reminders_on", "напоминания включены")
+
+	h.send(100, "Сон начался")
+	h.clock.Advance(30 * time.Minute)
+	h.send(100, "Сон закончился")
+	if sent := h.processReminders(); len(sent) != 0 {
+		t.Fatalf("no reminders expected yet, got:\n%s", joinTexts(sent))
+	}
+
+	h.clock.Advance(61 * time.Minute)
+	h.tg.fail(200, &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"})
+	sent := h.processReminders()
+	if got := joinTexts(messagesTo(sent, 100)); !strings.Contains(got, "Пора готовить Маша ко сну") {
+		t.Fatalf("expected wake window reminder, got:\n%s", joinTexts(sent))
+	}
+	if len(messagesTo(sent, 200)) != 0 {
+		t.Fatalf("failing chat should not record messages")
+	}
+	if h.member(100, 200).BlockedAt == nil {
+		t.Fatalf("member who blocked the bot should be marked")
+	}
+	if again := h.processReminders(); len(again) != 0 {
+		t.Fatalf("reminder should fire once, got:\n%s", joinTexts(again))
+	}
+
+	// Написав боту снова, участник опять получает уведомления.
+	h.tg.fail(200, nil)
+	h.send(200, "Сон начался")
+	if h.member(100, 200).BlockedAt != nil {
+		t.Fatalf("member should be reactivated after writing to the bot")
+	}
+	h.clock.Advance(121 * time.Minute)
+	sent = h.processReminders()
+	for _, chatID := range []int64{100, 200} {
+		if got := joinTexts(messagesTo(sent, chatID)); !strings.Contains(got, "Маша спит уже") {
+			t.Fatalf("expected max sleep reminder in chat %d, got:\n%s", chatID, joinTexts(sent))
+		}
+	}
+}
+
+func TestScenarioRateLimitedReminder(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(100)
+	h.expect(100, "/setmaxsleep 60", "Настройка обновлена.")
+	h.expect(100, "/reminders_on", "напоминания включены")
+	h.send(100, "Сон начался")
+	h.clock.Advance(61 * time.Minute)
+
+	h.tg.fail(100, &tgbotapi.Error{Code: 429, Message: "Too Many Requests", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 30}})
+	if sent := h.processReminders(); len(sent) != 0 {
+		t.Fatalf("rate limited reminder should wait, got:\n%s", joinTexts(sent))
+	}
+	h.tg.fail(100, nil)
+	h.clock.Advance(10 * time.Second)
+	if sent := h.deliverOutbox(); len(sent) != 0 {
+		t.Fatalf("reminder should wait for retry_after, got:\n%s", joinTexts(sent))
+	}
+	h.clock.Advance(25 * time.Second)
+	if got := joinTexts(messagesTo(h.deliverOutbox(), 100)); !strings.Contains(got, "Маша спит уже") {
+		t.Fatalf("expected max sleep reminder after retry_after, got:\n%s", got)
+	}
+	if again := h.deliverOutbox(); len(again) != 0 {
+		t.Fatalf("reminder should be delivered once, got:\n%s", joinTexts(again))
+	}
+}
+
+func TestScenarioConcurrentUpdates(t *testing.T) {
+	h := newBotHarness(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- h.bot.Run(ctx) }()
+
+	// Сообщения разных семей перемешаны; каждая анкета проходит, только если порядок внутри чата сохранен.
+	steps := []string{"/start", "Маша", "Europe/Moscow", "01.03.2026", "Сон начался"}
+	const families = 12
+	for _, text := range steps {
+		for userID := int64(1); userID <= families; userID++ {
+			h.tg.updates <- h.update(userID, text)
+		}
+	}
+	for len(h.tg.updates) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("run should stop with context.Canceled, got %v", err)
+	}
+
+	sent := h.tg.take()
+	for userID := int64(1); userID <= families; userID++ {
+		if got := joinTexts(messagesTo(sent, userID)); !strings.Contains(got, "Профиль сохранён") || !strings.Contains(got, "Сон начался в") {
+			t.Fatalf("user %d: expected onboarding and sleep start, got:\n%s", userID, got)
+		}
+		userCtx, err := h.store.GetUserContext(context.Background(), userID)
+		if err != nil {
+			t.Fatalf("user %d context: %v", userID, err)
+		}
+		if active, err := h.store.GetActiveSleep(context.Background(), userCtx.Child.ID); err != nil || active == nil {
+			t.Fatalf("user %d: expected active sleep, got %v (%v)", userID, active, err)
+		}
+	}
+}
+
+func TestScenarioScheduledReminders(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(100)
+	h.expect(100, "/setwake 60", "Настройка обновлена.")
+	h.expect(100, "/reminders_on", "напоминания включены")
+	h.send(100, "Сон начался")
+	h.clock.Advance(30 * time.Minute)
+	h.send(100, "Сон закончился")
+	sleepEnd := h.clock.Now()
+	if sent := h.processReminders(); len(sent) != 0 {
+		t.Fatalf("no reminders expected yet, got:\n%s", joinTexts(sent))
+	}
+
+	// Без новых сообщений семья ждет в очереди до конца окна бодрствования.
+	if due, ok := h.bot.reminders.next(); !ok || !due.Equal(sleepEnd.Add(60*time.Minute)) {
+		t.Fatalf("expected wake window due at %v, got %v %v", sleepEnd.Add(60*time.Minute), due, ok)
+	}
+	h.clock.Advance(59 * time.Minute)
+	if sent := h.processReminders(); len(sent) != 0 {
+		t.Fatalf("reminder fired too early:\n%s", joinTexts(sent))
+	}
+	h.clock.Advance(time.Minute)
+	if got := joinTexts(h.processReminders()); !strings.Contains(got, "Пора готовить Маша ко сну") {
+		t.Fatalf("expected wake window reminder at due time, got:\n%s", got)
+	}
+
+	// После перезапуска полный проход снова ставит семью в очередь: теперь ждем неактивности.
+	cfg := h.bot.cfg
+	h.bot = NewSleepBot(h.tg, h.store, cfg)
+	h.bot.limiter.sleep = func(time.Duration) {}
+	if err := h.bot.processReminders(context.Background()); err != nil {
+		t.Fatalf("process reminders: %v", err)
+	}
+	if sent := h.deliverOutbox(); len(sent) != 0 {
+		t.Fatalf("restart should not repeat reminders, got:\n%s", joinTexts(sent))
+	}
+	if due, ok := h.bot.reminders.next(); !ok || !due.Equal(sleepEnd.Add(240*time.Minute)) {
+		t.Fatalf("expected inactivity due at %v, got %v %v", sleepEnd.Add(240*time.Minute), due, ok)
+	}
+}
+
+func TestScenarioJoinRefreshesReminders(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(100)
+	reply := joinTexts(h.send(100, "/invite"))
+	code := regexp.MustCompile("`([A-Z0-9]+)`").FindStringSubmatch(reply)
+	if code == nil {
+		t.Fatalf("no invite code in %q", reply)
+	}
+	owner, err := h.store.GetUserContext(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("owner context: %v", err)
+	}
+	h.processReminders()
+
+	// Новый участник еще не в семье, когда приходит /join: пересчитать нужно семью, в которую он вошел.
+	h.expect(200, "/join "+code[1], "Теперь вы привязаны к семье")
+	if families := h.bot.reminders.takeDue(h.clock.Now()); len(families) != 1 || families[0] != owner.Family.ID {
+		t.Fatalf("expected family %d to be refreshed, got %v", owner.Family.ID, families)
+	}
+}
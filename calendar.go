@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Сколько дней завершенных снов попадает в календарь.
+	calendarSleepDays = 90
+	// Сколько ближайших красивых дат попадает в календарь.
+	calendarMilestoneCount = 10
+	// Длительность событий-напоминаний и вех в календаре.
+	calendarEventDuration = 15 * time.Minute
+	// Строки iCalendar длиннее этого числа байт переносятся (RFC 5545, 3.1).
+	icalMaxLineOctets = 75
+	// На сколько лет вперед VTIMEZONE перечисляет переходы таймзоны семьи.
+	calendarTimezoneYears = 10
+)
+
+// Дни недели custom_reminders.weekdays (0 — воскресенье, как time.Weekday) в нотации RRULE.
+var icalWeekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+func generateCalendarToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// serveCalendar отдает календарь семьи по секретной ссылке `/calendar/<секрет>.ics` из /calendar.
+func (a *apiServer) serveCalendar(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutSuffix(r.PathValue("file"), ".ics")
+	if !ok || token == "" {
+		http.NotFound(w, r)
+		return
+	}
+	userCtx, err := a.store.GetUserContextByCalendarToken(r.Context(), token)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("calendar feed failed", "error", err)
+		http.Error(w, "внутренняя ошибка", http.StatusInternalServerError)
+		return
+	}
+	body, err := a.buildCalendar(r, userCtx)
+	if err != nil {
+		slog.Error("calendar feed failed", "family_id", userCtx.Family.ID, "error", err)
+		http.Error(w, "внутренняя ошибка", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	_, _ = w.Write([]byte(body))
+}
+
+func (a *apiServer) buildCalendar(r *http.Request, userCtx UserContext) (string, error) {
+	now := a.now()
+	loc := apiLocation(userCtx)
+	sessions, err := a.store.ListCompletedSleepsSince(r.Context(), userCtx.Child.ID, startOfDay(now, loc).AddDate(0, 0, -calendarSleepDays))
+	if err != nil {
+		return "", err
+	}
+	reminders, err := a.store.ListCustomReminders(r.Context(), userCtx.Family.ID)
+	if err != nil {
+		return "", err
+	}
+	return BuildFamilyCalendar(userCtx, sessions, reminders, now, loc), nil
+}
+
+// icalWriter собирает календарь: экранирует значения и переносит длинные строки.
+type icalWriter struct {
+	b strings.Builder
+}
+
+func (w *icalWriter) raw(line string) {
+	for len(line) > icalMaxLineOctets {
+		cut := icalMaxLineOctets
+		// Не разрываем UTF-8 последовательность.
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.b.WriteString(line[:cut] + "\r\n")
+		line = " " + line[cut:]
+	}
+	w.b.WriteString(line + "\r\n")
+}
+
+func (w *icalWriter) text(name string, value string) {
+	w.raw(name + ":" + escapeICalText(value))
+}
+
+func escapeICalText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+func icalUTC(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+func icalOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// writeVTimezone описывает таймзону loc для событий с TZID: смещение, действующее в now, и все
+// переходы (летнее и зимнее время) на calendarTimezoneYears лет вперед. Правила берутся из базы
+// таймзон Go, поэтому у зоны без перехода на летнее время будет одна секция STANDARD.
+func writeVTimezone(w *icalWriter, loc *time.Location, now time.Time) {
+	observance := func(at time.Time, offsetFrom int) {
+		local := at.In(loc)
+		name, offsetTo := local.Zone()
+		component := "STANDARD"
+		if local.IsDST() {
+			component = "DAYLIGHT"
+		}
+		w.raw("BEGIN:" + component)
+		// DTSTART наблюдения — местное время момента перехода по смещению до него.
+		w.raw("DTSTART:" + at.In(time.FixedZone("", offsetFrom)).Format("20060102T150405"))
+		w.raw("TZOFFSETFROM:" + icalOffset(offsetFrom))
+		w.raw("TZOFFSETTO:" + icalOffset(offsetTo))
+		w.text("TZNAME", name)
+		w.raw("END:" + component)
+	}
+
+	w.raw("BEGIN:VTIMEZONE")
+	w.raw("TZID:" + loc.String())
+	current := now.In(loc)
+	start, end := current.ZoneBounds()
+	_, offset := current.Zone()
+	if start.IsZero() {
+		observance(time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC).Add(-time.Duration(offset)*time.Second), offset)
+	} else {
+		_, before := start.Add(-time.Second).In(loc).Zone()
+		observance(start, before)
+	}
+	limit := now.AddDate(calendarTimezoneYears, 0, 0)
+	for !end.IsZero() && end.Before(limit) {
+		observance(end, offset)
+		_, offset = end.In(loc).Zone()
+		_, end = end.In(loc).ZoneBounds()
+	}
+	w.raw("END:VTIMEZONE")
+}
+
+// BuildFamilyCalendar — календарь семьи в формате iCalendar: завершенные сны, пользовательские
+// напоминания как повторяющиеся события и ближайшие красивые даты (если задана дата рождения).
+func BuildFamilyCalendar(userCtx UserContext, sessions []SleepSession, reminders []CustomReminder, now time.Time, loc *time.Location) string {
+	w := &icalWriter{}
+	w.raw("BEGIN:VCALENDAR")
+	w.raw("VERSION:2.0")
+	w.raw("PRODID:-//sleepbot//calendar//RU")
+	w.raw("CALSCALE:GREGORIAN")
+	w.raw("METHOD:PUBLISH")
+	w.text("X-WR-CALNAME", "Сон: "+userCtx.Child.Name)
+	w.raw("X-WR-TIMEZONE:" + loc.String())
+	writeVTimezone(w, loc, now)
+	stamp := icalUTC(now)
+
+	for _, session := range sessions {
+		if session.EndAt == nil {
+			continue
+		}
+		w.raw("BEGIN:VEVENT")
+		w.raw(fmt.Sprintf("UID:sleep-%d-%d@sleepbot", userCtx.Child.ID, session.ID))
+		w.raw("DTSTAMP:" + stamp)
+		w.raw("DTSTART:" + icalUTC(session.StartAt))
+		w.raw("DTEND:" + icalUTC(*session.EndAt))
+		w.text("SUMMARY", fmt.Sprintf("Сон %s", formatDurationRU(session.EndAt.Sub(session.StartAt))))
+		var details []string
+		if tags := formatSleepTags(session.Tags); tags != "" {
+			details = append(details, tags)
+		}
+		if session.Note != "" {
+			details = append(details, session.Note)
+		}
+		if len(details) > 0 {
+			w.text("DESCRIPTION", strings.Join(details, "\n"))
+		}
+		w.raw("TRANSP:TRANSPARENT")
+		w.raw("END:VEVENT")
+	}
+
+	for _, reminder := range reminders {
+		start, rule, ok := customReminderRecurrence(reminder, now, loc)
+		if !ok {
+			continue
+		}
+		w.raw("BEGIN:VEVENT")
+		w.raw(fmt.Sprintf("UID:reminder-%d@sleepbot", reminder.ID))
+		w.raw("DTSTAMP:" + stamp)
+		w.raw(fmt.Sprintf("DTSTART;TZID=%s:%s", loc.String(), start.Format("20060102T150405")))
+		w.raw(fmt.Sprintf("DTEND;TZID=%s:%s", loc.String(), start.Add(calendarEventDuration).Format("20060102T150405")))
+		w.raw("RRULE:" + rule)
+		w.text("SUMMARY", reminder.Title)
+		w.raw("END:VEVENT")
+	}
+
+	if anchor, ok := BirthAnchorLocal(userCtx.Child.BirthDate, loc); ok {
+		for _, m := range NextMilestonesShownInDailyReportAtOrAfter(anchor, now, loc, calendarMilestoneCount) {
+			at := anchor.Add(m.Offset)
+			w.raw("BEGIN:VEVENT")
+			w.raw(fmt.Sprintf("UID:milestone-%d-%s@sleepbot", userCtx.Child.ID, m.ID))
+			w.raw("DTSTAMP:" + stamp)
+			w.raw("DTSTART:" + icalUTC(at))
+			w.raw("DTEND:" + icalUTC(at.Add(calendarEventDuration)))
+			w.text("SUMMARY", fmt.Sprintf("%s: %s", userCtx.Child.Name, m.Title))
+			w.raw("TRANSP:TRANSPARENT")
+			w.raw("END:VEVENT")
+		}
+	}
+
+	w.raw("END:VCALENDAR")
+	return w.b.String()
+}
+
+// customReminderRecurrence возвращает первое срабатывание напоминания не раньше сегодняшнего дня
+// (в таймзоне семьи) и правило повтора; выключенные и некорректные напоминания пропускаются.
+func customReminderRecurrence(reminder CustomReminder, now time.Time, loc *time.Location) (time.Time, string, bool) {
+	if !reminder.Enabled {
+		return time.Time{}, "", false
+	}
+	clock, err := time.ParseInLocation("15:04", reminder.AtTime, loc)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	var days []string
+	for i, day := range icalWeekdays {
+		if weekdayIncluded(reminder.Weekdays, strconv.Itoa(i)) {
+			days = append(days, day)
+		}
+	}
+	if len(days) == 0 {
+		return time.Time{}, "", false
+	}
+	today := startOfDay(now, loc)
+	start := time.Date(today.Year(), today.Month(), today.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+	for !weekdayIncluded(reminder.Weekdays, strconv.Itoa(int(start.Weekday()))) {
+		start = start.AddDate(0, 0, 1)
+	}
+	if len(days) == len(icalWeekdays) {
+		return start, "FREQ=DAILY", true
+	}
+	return start, "FREQ=WEEKLY;BYDAY=" + strings.Join(days, ","), true
+}
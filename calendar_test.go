@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildFamilyCalendar(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	now := time.Date(2026, 3, 18, 12, 0, 0, 0, time.UTC) // среда
+	birth := time.Date(2026, 3, 1, 8, 0, 0, 0, loc)
+	userCtx := UserContext{Child: Child{ID: 5, Name: "Маша", BirthDate: &birth}}
+	start := time.Date(2026, 3, 17, 10, 0, 0, 0, time.UTC)
+	end := start.Add(90 * time.Minute)
+	sessions := []SleepSession{
+		{ID: 7, StartAt: start, EndAt: &end, Tags: []string{"stroller"}, Note: "гуляли; долго"},
+		{ID: 8, StartAt: end.Add(time.Hour)},
+	}
+	reminders := []CustomReminder{
+		{ID: 1, Title: "Купание", AtTime: "19:30", Weekdays: "1,5", Enabled: true},
+		{ID: 2, Title: "Витамин", AtTime: "09:00", Weekdays: "0,1,2,3,4,5,6", Enabled: true},
+		{ID: 3, Title: "Выключено", AtTime: "10:00", Weekdays: "1", Enabled: false},
+	}
+
+	ics := BuildFamilyCalendar(userCtx, sessions, reminders, now, loc)
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Moscow\r\nBEGIN:STANDARD\r\nDTSTART:20141026T020000\r\nTZOFFSETFROM:+0400\r\nTZOFFSETTO:+0300\r\nTZNAME:MSK\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n",
+		"UID:sleep-5-7@sleepbot\r\nDTSTAMP:20260318T120000Z\r\nDTSTART:20260317T100000Z\r\nDTEND:20260317T113000Z\r\nSUMMARY:Сон 1 ч 30 мин\r\n",
+		"DESCRIPTION:коляска\\nгуляли\\; долго\r\n",
+		"DTSTART;TZID=Europe/Moscow:20260320T193000\r\n",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,FR\r\nSUMMARY:Купание\r\n",
+		"DTSTART;TZID=Europe/Moscow:20260318T090000\r\n",
+		"RRULE:FREQ=DAILY\r\n",
+		"UID:milestone-5-",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Fatalf("expected %q in calendar:\n%s", want, ics)
+		}
+	}
+	if strings.Contains(ics, "sleep-5-8") || strings.Contains(ics, "Выключено") {
+		t.Fatalf("active sleeps and disabled reminders should be skipped:\n%s", ics)
+	}
+	if count := strings.Count(ics, "UID:milestone-"); count != calendarMilestoneCount {
+		t.Fatalf("expected %d milestones, got %d", calendarMilestoneCount, count)
+	}
+}
+
+func TestWriteVTimezoneListsTransitions(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	w := &icalWriter{}
+	writeVTimezone(w, loc, time.Date(2026, 3, 18, 12, 0, 0, 0, time.UTC))
+	ics := w.b.String()
+	for _, want := range []string{
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Berlin\r\nBEGIN:STANDARD\r\nDTSTART:20251026T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\n",
+		"BEGIN:DAYLIGHT\r\nDTSTART:20260329T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nTZNAME:CEST\r\nEND:DAYLIGHT\r\n",
+		"BEGIN:STANDARD\r\nDTSTART:20261025T030000\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Fatalf("expected %q in timezone:\n%s", want, ics)
+		}
+	}
+	if count := strings.Count(ics, "BEGIN:DAYLIGHT"); count != calendarTimezoneYears {
+		t.Fatalf("expected %d summer time transitions, got %d", calendarTimezoneYears, count)
+	}
+	if !strings.HasSuffix(ics, "END:VTIMEZONE\r\n") {
+		t.Fatalf("timezone must be closed:\n%s", ics)
+	}
+}
+
+func TestICalWriterFoldsLongLines(t *testing.T) {
+	w := &icalWriter{}
+	w.text("SUMMARY", strings.Repeat("сон ", 30))
+	for _, line := range strings.Split(strings.TrimSuffix(w.b.String(), "\r\n"), "\r\n") {
+		if len(line) > icalMaxLineOctets {
+			t.Fatalf("line longer than %d octets: %q", icalMaxLineOctets, line)
+		}
+		if !strings.HasPrefix(line, "SUMMARY:") && !strings.HasPrefix(line, " ") {
+			t.Fatalf("continuation should start with a space: %q", line)
+		}
+	}
+	unfolded := strings.ReplaceAll(w.b.String(), "\r\n ", "")
+	if unfolded != "SUMMARY:"+strings.Repeat("сон ", 30)+"\r\n" {
+		t.Fatalf("unfolding should restore the value, got %q", unfolded)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"time"
+)
+
+// Графики отчётов рисуются стандартной библиотекой (image/png), без внешних сервисов и шрифтов:
+// подписи — встроенный пиксельный шрифт chartGlyphs (цифры и немного пунктуации).
+
+var (
+	chartBackground = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	chartNightShade = color.RGBA{R: 0xec, G: 0xee, B: 0xf4, A: 0xff}
+	chartGrid       = color.RGBA{R: 0xcf, G: 0xd3, B: 0xdc, A: 0xff}
+	chartText       = color.RGBA{R: 0x33, G: 0x36, B: 0x3d, A: 0xff}
+	chartSleep      = color.RGBA{R: 0x3b, G: 0x6e, B: 0xd8, A: 0xff}
+)
+
+const (
+	chartGlyphScale  = 2
+	chartGlyphWidth  = 3
+	chartGlyphHeight = 5
+	chartPadding     = 10
+)
+
+// chartGlyphs — пиксельный шрифт 3x5: '#' — закрашенный пиксель.
+var chartGlyphs = map[rune][chartGlyphHeight]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", ".#.", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'.': {"...", "...", "...", "...", ".#."},
+	':': {"...", ".#.", "...", ".#.", "..."},
+	'-': {"...", "...", "###", "...", "..."},
+	' ': {"...", "...", "...", "...", "..."},
+}
+
+// RenderSleepTimelinePNG рисует 24-часовую ленту сна по дням (строка = локальный календарный день).
+func RenderSleepTimelinePNG(sessions []SleepSession, end time.Time, days int, loc *time.Location) ([]byte, error) {
+	if days < 1 {
+		days = 1
+	}
+	const hourWidth = 24
+	rowHeight := 22
+	if days > 10 {
+		rowHeight = 14
+	}
+
+	labelWidth := chartTextWidth("00.00") + chartPadding
+	top := chartPadding + chartTextHeight() + 6
+	width := chartPadding + labelWidth + 24*hourWidth + chartTextWidth("00")/2 + chartPadding
+	height := top + days*rowHeight + chartPadding
+
+	img := newChartImage(width, height)
+	left := chartPadding + labelWidth
+
+	for hour := 0; hour <= 24; hour += 3 {
+		x := left + hour*hourWidth
+		label := fmt.Sprintf("%02d", hour%24)
+		drawChartText(img, x-chartTextWidth(label)/2, chartPadding, label, chartText)
+		fillRect(img, x, top, x+1, top+days*rowHeight, chartGrid)
+	}
+
+	endDay := startOfDay(end, loc)
+	startDay := endDay.AddDate(0, 0, -(days - 1))
+	row := 0
+	for day := startDay; !day.After(endDay); day = day.AddDate(0, 0, 1) {
+		y := top + row*rowHeight
+		barTop := y + 2
+		barBottom := y + rowHeight - 2
+
+		fillRect(img, left, barTop, left+dayWindowStartHour*hourWidth, barBottom, chartNightShade)
+		fillRect(img, left+dayWindowEndHour*hourWidth, barTop, left+24*hourWidth, barBottom, chartNightShade)
+
+		dayEnd := day.AddDate(0, 0, 1)
+		dayLength := dayEnd.Sub(day)
+		for _, session := range sessions {
+			if session.EndAt == nil {
+				continue
+			}
+			start := maxTime(session.StartAt, day)
+			finish := minTime(*session.EndAt, dayEnd)
+			if !finish.After(start) {
+				continue
+			}
+			x0 := left + int(float64(24*hourWidth)*float64(start.Sub(day))/float64(dayLength))
+			x1 := left + int(math.Ceil(float64(24*hourWidth)*float64(finish.Sub(day))/float64(dayLength)))
+			fillRect(img, x0, barTop, x1, barBottom, chartSleep)
+		}
+
+		labelY := y + (rowHeight-chartTextHeight())/2
+		drawChartText(img, chartPadding, labelY, day.Format("02.01"), chartText)
+		row++
+	}
+
+	return encodeChartPNG(img)
+}
+
+// RenderDailyTotalsPNG рисует столбчатую диаграмму суммарного сна за каждый локальный календарный день.
+// Сон, переходящий через полночь, делится между днями.
+func RenderDailyTotalsPNG(sessions []SleepSession, end time.Time, days int, loc *time.Location) ([]byte, error) {
+	if days < 1 {
+		days = 1
+	}
+	totals := dailySleepTotals(sessions, end, days, loc)
+
+	maxHours := 16.0
+	for _, total := range totals {
+		if h := total.Hours(); h > maxHours {
+			maxHours = h
+		}
+	}
+	maxHours = math.Ceil(maxHours/2) * 2
+
+	barWidth := 600 / days
+	if barWidth > 60 {
+		barWidth = 60
+	}
+	if barWidth < 12 {
+		barWidth = 12
+	}
+	const plotHeight = 240
+	axisWidth := chartTextWidth("00") + chartPadding
+	top := chartPadding + chartTextHeight() + 6
+	left := chartPadding + axisWidth
+	width := left + days*barWidth + chartPadding
+	height := top + plotHeight + 6 + chartTextHeight() + chartPadding
+
+	img := newChartImage(width, height)
+	scale := float64(plotHeight) / maxHours
+	baseline := top + plotHeight
+
+	for h := 0.0; h <= maxHours; h += 2 {
+		y := baseline - int(h*scale)
+		fillRect(img, left, y, left+days*barWidth, y+1, chartGrid)
+		label := fmt.Sprintf("%d", int(h))
+		drawChartText(img, left-chartTextWidth(label)-4, y-chartTextHeight()/2, label, chartText)
+	}
+
+	endDay := startOfDay(end, loc)
+	startDay := endDay.AddDate(0, 0, -(days - 1))
+	labelEvery := 1
+	if days > 10 {
+		labelEvery = 5
+	}
+	for i, total := range totals {
+		x0 := left + i*barWidth + barWidth/6
+		x1 := left + (i+1)*barWidth - barWidth/6
+		barTop := baseline - int(total.Hours()*scale)
+		fillRect(img, x0, barTop, x1, baseline, chartSleep)
+
+		day := startDay.AddDate(0, 0, i)
+		if (days-1-i)%labelEvery == 0 {
+			label := day.Format("02")
+			if days <= 10 {
+				label = day.Format("02.01")
+			}
+			drawChartText(img, left+i*barWidth+(barWidth-chartTextWidth(label))/2, baseline+6, label, chartText)
+		}
+		if days <= 10 && total > 0 {
+			value := fmt.Sprintf("%.1f", total.Hours())
+			drawChartText(img, left+i*barWidth+(barWidth-chartTextWidth(value))/2, barTop-chartTextHeight()-3, value, chartText)
+		}
+	}
+
+	return encodeChartPNG(img)
+}
+
+// dailySleepTotals возвращает сумму сна внутри каждого из days локальных календарных дней, заканчивающихся днём end.
+func dailySleepTotals(sessions []SleepSession, end time.Time, days int, loc *time.Location) []time.Duration {
+	endDay := startOfDay(end, loc)
+	startDay := endDay.AddDate(0, 0, -(days - 1))
+	totals := make([]time.Duration, 0, days)
+	for day := startDay; !day.After(endDay); day = day.AddDate(0, 0, 1) {
+		dayEnd := day.AddDate(0, 0, 1)
+		var total time.Duration
+		for _, session := range sessions {
+			if session.EndAt == nil {
+				continue
+			}
+			start := maxTime(session.StartAt, day)
+			finish := minTime(*session.EndAt, dayEnd)
+			if finish.After(start) {
+				total += finish.Sub(start)
+			}
+		}
+		totals = append(totals, total)
+	}
+	return totals
+}
+
+func newChartImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: chartBackground}, image.Point{}, draw.Src)
+	return img
+}
+
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	rect := image.Rect(x0, y0, x1, y1).Intersect(img.Bounds())
+	if rect.Empty() {
+		return
+	}
+	draw.Draw(img, rect, &image.Uniform{C: c}, image.Point{}, draw.Src)
+}
+
+func chartTextWidth(text string) int {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+	return (n*(chartGlyphWidth+1) - 1) * chartGlyphScale
+}
+
+func chartTextHeight() int {
+	return chartGlyphHeight * chartGlyphScale
+}
+
+// drawChartText выводит текст пиксельным шрифтом; неизвестные символы пропускаются с сохранением места.
+func drawChartText(img *image.RGBA, x, y int, text string, c color.Color) {
+	for _, r := range text {
+		if glyph, ok := chartGlyphs[r]; ok {
+			for row := 0; row < chartGlyphHeight; row++ {
+				for col := 0; col < chartGlyphWidth; col++ {
+					if glyph[row][col] != '#' {
+						continue
+					}
+					px := x + col*chartGlyphScale
+					py := y + row*chartGlyphScale
+					fillRect(img, px, py, px+chartGlyphScale, py+chartGlyphScale, c)
+				}
+			}
+		}
+		x += (chartGlyphWidth + 1) * chartGlyphScale
+	}
+}
+
+func encodeChartPNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode chart png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
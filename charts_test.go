@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestDailySleepTotalsSplitsAcrossMidnight(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	end := time.Date(2026, 3, 17, 12, 0, 0, 0, loc)
+	start := time.Date(2026, 3, 16, 22, 0, 0, 0, loc).UTC()
+	finish := time.Date(2026, 3, 17, 6, 0, 0, 0, loc).UTC()
+
+	totals := dailySleepTotals([]SleepSession{{StartAt: start, EndAt: &finish}}, end, 2, loc)
+	if len(totals) != 2 {
+		t.Fatalf("expected 2 days, got %d", len(totals))
+	}
+	if totals[0] != 2*time.Hour || totals[1] != 6*time.Hour {
+		t.Fatalf("unexpected totals: %v", totals)
+	}
+}
+
+func TestRenderSleepTimelinePNGMarksSleep(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	end := time.Date(2026, 3, 16, 20, 0, 0, 0, loc)
+	start := time.Date(2026, 3, 16, 12, 0, 0, 0, loc).UTC()
+	finish := time.Date(2026, 3, 16, 14, 0, 0, 0, loc).UTC()
+
+	payload, err := RenderSleepTimelinePNG([]SleepSession{{StartAt: start, EndAt: &finish}}, end, 7, loc)
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	// Последняя строка — день end; 13:00 лежит внутри сна.
+	bounds := img.Bounds()
+	left := chartPadding + chartTextWidth("00.00") + chartPadding
+	x := left + 13*24
+	y := bounds.Max.Y - chartPadding - 22/2
+	r, g, b, _ := img.At(x, y).RGBA()
+	sr, sg, sb, _ := chartSleep.RGBA()
+	if r != sr || g != sg || b != sb {
+		t.Fatalf("expected sleep color at 13:00, got %v", img.At(x, y))
+	}
+}
+
+func TestRenderDailyTotalsPNGProducesImage(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	end := time.Date(2026, 3, 30, 20, 0, 0, 0, loc)
+
+	payload, err := RenderDailyTotalsPNG(nil, end, 30, loc)
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if img.Bounds().Dx() < 30*12 {
+		t.Fatalf("expected room for 30 bars, got width %d", img.Bounds().Dx())
+	}
+}
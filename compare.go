@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PeriodStats — средние «сутки сна» за локальные дни [Start, End]; дни без записей в средние не входят.
+// Отбой считается от полуночи вечера (после полуночи — больше 24 ч), подъём — от полуночи утра.
+type PeriodStats struct {
+	Start           time.Time
+	End             time.Time
+	Days            int
+	DaysWithData    int
+	AverageTotal    time.Duration
+	AverageNight    time.Duration
+	AverageNapCount float64
+	AverageNap      time.Duration
+	AverageLongest  time.Duration
+	MedianBedtime   time.Duration
+	MedianWakeUp    time.Duration
+	HasBedtime      bool
+}
+
+// SummarizePeriod собирает PeriodStats по SummarizeDayNight для каждого дня периода.
+func SummarizePeriod(sessions []SleepSession, start time.Time, end time.Time, loc *time.Location) PeriodStats {
+	stats := PeriodStats{
+		Start: startOfDay(start, loc),
+		End:   startOfDay(end, loc),
+		Days:  daysInRange(start, end, loc),
+	}
+
+	var (
+		total    time.Duration
+		night    time.Duration
+		napSleep time.Duration
+		naps     int
+		nights   []NightSummary
+		bedtimes []time.Duration
+		wakeUps  []time.Duration
+	)
+	for day := stats.Start; !day.After(stats.End); day = day.AddDate(0, 0, 1) {
+		row := SummarizeDayNight(sessions, day, loc)
+		nights = append(nights, row.Night)
+		if row.Total() == 0 {
+			continue
+		}
+		stats.DaysWithData++
+		total += row.Total()
+		night += row.Night.TotalSleep
+		naps += row.NapCount
+		napSleep += row.NapSleep
+		if row.Night.SleepCount > 0 {
+			evening := row.Date.AddDate(0, 0, -1)
+			bedtimes = append(bedtimes, row.Night.FirstSleepAt.Sub(evening))
+			wakeUps = append(wakeUps, row.Night.LastWakeAt.Sub(row.Date))
+		}
+	}
+	if stats.DaysWithData == 0 {
+		return stats
+	}
+
+	stats.AverageTotal = total / time.Duration(stats.DaysWithData)
+	stats.AverageNight = night / time.Duration(stats.DaysWithData)
+	stats.AverageNapCount = float64(naps) / float64(stats.DaysWithData)
+	if naps > 0 {
+		stats.AverageNap = napSleep / time.Duration(naps)
+	}
+	stats.AverageLongest = AverageNights(nights).AverageLongest
+	if len(bedtimes) > 0 {
+		stats.HasBedtime = true
+		stats.MedianBedtime = medianDuration(bedtimes)
+		stats.MedianWakeUp = medianDuration(wakeUps)
+	}
+	return stats
+}
+
+func medianDuration(values []time.Duration) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[middle]
+	}
+	return (sorted[middle-1] + sorted[middle]) / 2
+}
+
+// BuildCompareReport выводит два периода рядом: «было → стало» и изменение со стрелкой тренда.
+func BuildCompareReport(previous PeriodStats, current PeriodStats) string {
+	lines := []string{
+		"Сравнение периодов:",
+		fmt.Sprintf("Было: %s", formatPeriodStatsLabel(previous)),
+		fmt.Sprintf("Стало: %s", formatPeriodStatsLabel(current)),
+	}
+	if previous.DaysWithData == 0 || current.DaysWithData == 0 {
+		lines = append(lines, "", "Для сравнения нужны записи о сне в обоих периодах.")
+		return strings.Join(lines, "\n")
+	}
+
+	lines = append(lines, "",
+		formatCompareDurationLine("Сон за сутки", previous.AverageTotal, current.AverageTotal),
+		formatCompareDurationLine("Ночной сон", previous.AverageNight, current.AverageNight),
+		formatCompareCountLine("Дневных снов в день", previous.AverageNapCount, current.AverageNapCount),
+		formatCompareDurationLine("Средний дневной сон", previous.AverageNap, current.AverageNap),
+		formatCompareDurationLine("Самый длинный ночной сон", previous.AverageLongest, current.AverageLongest),
+	)
+	if previous.HasBedtime && current.HasBedtime {
+		lines = append(lines,
+			formatCompareClockLine("Отбой (медиана)", previous.MedianBedtime, current.MedianBedtime),
+			formatCompareClockLine("Подъём (медиана)", previous.MedianWakeUp, current.MedianWakeUp),
+		)
+	} else {
+		lines = append(lines, "Отбой и подъём: нет ночных записей в одном из периодов.")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatPeriodStatsLabel(stats PeriodStats) string {
+	return fmt.Sprintf("%s–%s (%d дн., с записями %d)",
+		stats.Start.Format("02.01"), stats.End.Format("02.01"), stats.Days, stats.DaysWithData,
+	)
+}
+
+func trendArrow(delta float64) string {
+	switch {
+	case delta > 0:
+		return "↑"
+	case delta < 0:
+		return "↓"
+	default:
+		return "="
+	}
+}
+
+func formatCompareDurationLine(label string, previous time.Duration, current time.Duration) string {
+	delta := (current - previous).Round(time.Minute)
+	change := "без изменений"
+	if delta > 0 {
+		change = "+" + formatDurationRU(delta)
+	} else if delta < 0 {
+		change = "−" + formatDurationRU(delta)
+	}
+	return fmt.Sprintf("%s: %s → %s, %s %s",
+		label, formatDurationRU(previous), formatDurationRU(current), trendArrow(float64(delta)), change,
+	)
+}
+
+func formatCompareCountLine(label string, previous float64, current float64) string {
+	delta := math.Round((current-previous)*10) / 10
+	change := "без изменений"
+	if delta > 0 {
+		change = fmt.Sprintf("+%.1f", delta)
+	} else if delta < 0 {
+		change = fmt.Sprintf("−%.1f", -delta)
+	}
+	return fmt.Sprintf("%s: %.1f → %.1f, %s %s", label, previous, current, trendArrow(delta), change)
+}
+
+// formatCompareClockLine сравнивает время суток: ↑ — позже, ↓ — раньше.
+func formatCompareClockLine(label string, previous time.Duration, current time.Duration) string {
+	delta := (current - previous).Round(time.Minute)
+	change := "без изменений"
+	if delta > 0 {
+		change = fmt.Sprintf("на %s позже", formatDurationRU(delta))
+	} else if delta < 0 {
+		change = fmt.Sprintf("на %s раньше", formatDurationRU(delta))
+	}
+	return fmt.Sprintf("%s: %s → %s, %s %s",
+		label, formatClockOffset(previous), formatClockOffset(current), trendArrow(float64(delta)), change,
+	)
+}
+
+// formatClockOffset переводит смещение от полуночи во время суток `15:04`.
+func formatClockOffset(offset time.Duration) string {
+	minutes := int(offset.Round(time.Minute)/time.Minute) % (24 * 60)
+	if minutes < 0 {
+		minutes += 24 * 60
+	}
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizePeriodAveragesAndMedians(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+
+	var sessions []SleepSession
+	add := func(start time.Time, duration time.Duration) {
+		end := start.Add(duration)
+		sessions = append(sessions, SleepSession{StartAt: start.UTC(), EndAt: &end})
+	}
+	// Три ночи: отбой 20:00, 20:30 и 00:10; подъём в 06:00, 06:30 и 07:30.
+	add(time.Date(2026, 3, 9, 20, 0, 0, 0, loc), 10*time.Hour)
+	add(time.Date(2026, 3, 10, 20, 30, 0, 0, loc), 10*time.Hour)
+	add(time.Date(2026, 3, 12, 0, 10, 0, 0, loc), 7*time.Hour+20*time.Minute)
+	// Дневные сны: два по часу 10-го и один на 30 минут 11-го.
+	add(time.Date(2026, 3, 10, 10, 0, 0, 0, loc), time.Hour)
+	add(time.Date(2026, 3, 10, 14, 0, 0, 0, loc), time.Hour)
+	add(time.Date(2026, 3, 11, 13, 0, 0, 0, loc), 30*time.Minute)
+
+	stats := SummarizePeriod(sessions, time.Date(2026, 3, 10, 0, 0, 0, 0, loc), time.Date(2026, 3, 13, 0, 0, 0, 0, loc), loc)
+	if stats.Days != 4 || stats.DaysWithData != 3 {
+		t.Fatalf("unexpected day counts: %+v", stats)
+	}
+	if stats.AverageNapCount != 1 {
+		t.Fatalf("expected 1 nap per day, got %.2f", stats.AverageNapCount)
+	}
+	if stats.AverageNap != 50*time.Minute {
+		t.Fatalf("expected average nap 50m, got %s", stats.AverageNap)
+	}
+	if !stats.HasBedtime || formatClockOffset(stats.MedianBedtime) != "20:30" {
+		t.Fatalf("expected median bedtime 20:30, got %s", formatClockOffset(stats.MedianBedtime))
+	}
+	if formatClockOffset(stats.MedianWakeUp) != "06:30" {
+		t.Fatalf("expected median wake-up 06:30, got %s", formatClockOffset(stats.MedianWakeUp))
+	}
+}
+
+func TestBuildCompareReportShowsDeltasAndArrows(t *testing.T) {
+	previous := PeriodStats{
+		Days: 7, DaysWithData: 7,
+		AverageTotal: 13 * time.Hour, AverageNight: 10 * time.Hour,
+		AverageNapCount: 3, AverageNap: time.Hour, AverageLongest: 4 * time.Hour,
+		HasBedtime: true, MedianBedtime: 20 * time.Hour, MedianWakeUp: 7 * time.Hour,
+	}
+	current := previous
+	current.AverageTotal = 13*time.Hour + 30*time.Minute
+	current.AverageNapCount = 2.5
+	current.MedianBedtime = 24*time.Hour + 15*time.Minute
+
+	report := BuildCompareReport(previous, current)
+	for _, want := range []string{
+		"Сон за сутки: 13 ч → 13 ч 30 мин, ↑ +30 мин",
+		"Ночной сон: 10 ч → 10 ч, = без изменений",
+		"Дневных снов в день: 3.0 → 2.5, ↓ −0.5",
+		"Отбой (медиана): 20:00 → 00:15, ↑ на 4 ч 15 мин позже",
+	} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("expected %q in report:\n%s", want, report)
+		}
+	}
+}
+
+func TestParseCompareRanges(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 18, 15, 0, 0, 0, loc)
+
+	previousStart, previousEnd, currentStart, currentEnd, err := parseCompareRanges("", now, loc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := strings.Join([]string{
+		previousStart.Format("02.01"), previousEnd.Format("02.01"),
+		currentStart.Format("02.01"), currentEnd.Format("02.01"),
+	}, " ")
+	if got != "04.03 10.03 11.03 17.03" {
+		t.Fatalf("unexpected default ranges: %s", got)
+	}
+
+	previousStart, _, currentStart, currentEnd, err = parseCompareRanges("01.02-07.02 01.03-10.03", now, loc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if previousStart.Format("02.01") != "01.02" || currentStart.Format("02.01") != "01.03" || currentEnd.Format("02.01") != "10.03" {
+		t.Fatalf("unexpected explicit ranges: %s %s %s", previousStart, currentStart, currentEnd)
+	}
+
+	if _, _, _, _, err := parseCompareRanges("week 2 3", now, loc); err == nil {
+		t.Fatal("expected error for three arguments")
+	}
+	if _, _, _, _, err := parseCompareRanges("abc", now, loc); err == nil {
+		t.Fatal("expected error for unknown argument")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
@@ -16,8 +17,22 @@ type Config struct {
 	DefaultTimezone  string
 	PollTimeout      int
 	InviteTTL        time.Duration
-	ReminderTick     time.Duration
 	MaxBackdate      time.Duration
+	HTTPAddr         string
+	// Внешний адрес HTTP-сервера для ссылок в чате (календарь, API); пусто — локальный адрес.
+	PublicURL string
+	// Адрес отдельного сервера /metrics; по умолчанию только локальный, чтобы метрики не попали наружу вместе с API.
+	MetricsAddr string
+	LogLevel    slog.Level
+	// Формат логов: text или json.
+	LogFormat string
+	// Сколько обновлений Telegram обрабатывается параллельно и сколько ждет в очереди каждого воркера.
+	UpdateWorkers   int
+	UpdateQueueSize int
+	// Сколько при остановке ждать обработки уже принятых обновлений.
+	ShutdownTimeout time.Duration
+	// Разрешить вебхуки на http://; по умолчанию принимаются только https-адреса.
+	WebhookAllowHTTP bool
 }
 
 func LoadConfig() (Config, error) {
@@ -29,8 +44,31 @@ func LoadConfig() (Config, error) {
 		DefaultTimezone:  defaultString(os.Getenv("SLEEPBOT_DEFAULT_TIMEZONE"), "Europe/Moscow"),
 		PollTimeout:      defaultInt(os.Getenv("SLEEPBOT_POLL_TIMEOUT"), 60),
 		InviteTTL:        defaultDurationMinutes(os.Getenv("SLEEPBOT_INVITE_TTL_MINUTES"), 1440),
-		ReminderTick:     defaultDurationSeconds(os.Getenv("SLEEPBOT_REMINDER_TICK_SECONDS"), 60),
 		MaxBackdate:      defaultDurationMinutes(os.Getenv("SLEEPBOT_MAX_BACKDATE_MINUTES"), 2880),
+		HTTPAddr:         defaultString(os.Getenv("SLEEPBOT_HTTP_ADDR"), ":8080"),
+		PublicURL:        strings.TrimRight(strings.TrimSpace(os.Getenv("SLEEPBOT_PUBLIC_URL")), "/"),
+		MetricsAddr:      defaultString(os.Getenv("SLEEPBOT_METRICS_ADDR"), "127.0.0.1:9090"),
+		LogFormat:        strings.ToLower(defaultString(os.Getenv("SLEEPBOT_LOG_FORMAT"), "text")),
+		UpdateWorkers:    defaultInt(os.Getenv("SLEEPBOT_UPDATE_WORKERS"), 8),
+		UpdateQueueSize:  defaultInt(os.Getenv("SLEEPBOT_UPDATE_QUEUE_SIZE"), 32),
+		ShutdownTimeout:  defaultDurationSeconds(os.Getenv("SLEEPBOT_SHUTDOWN_TIMEOUT_SECONDS"), 30),
+		WebhookAllowHTTP: defaultBool(os.Getenv("SLEEPBOT_WEBHOOK_ALLOW_HTTP"), false),
+	}
+
+	level, err := parseLogLevel(os.Getenv("SLEEPBOT_LOG_LEVEL"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid SLEEPBOT_LOG_LEVEL: %w", err)
+	}
+	cfg.LogLevel = level
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return Config{}, fmt.Errorf("invalid SLEEPBOT_LOG_FORMAT: %q (text, json)", cfg.LogFormat)
+	}
+
+	if cfg.UpdateWorkers < 1 {
+		return Config{}, fmt.Errorf("invalid SLEEPBOT_UPDATE_WORKERS: %d (must be at least 1)", cfg.UpdateWorkers)
+	}
+	if cfg.UpdateQueueSize < 1 {
+		return Config{}, fmt.Errorf("invalid SLEEPBOT_UPDATE_QUEUE_SIZE: %d (must be at least 1)", cfg.UpdateQueueSize)
 	}
 
 	if cfg.TelegramBotToken == "" {
@@ -64,6 +102,14 @@ func defaultInt(value string, fallback int) int {
 	return parsed
 }
 
+func defaultBool(value string, fallback bool) bool {
+	parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
 func defaultDurationMinutes(value string, fallback int) time.Duration {
 	return time.Duration(defaultInt(value, fallback)) * time.Minute
 }
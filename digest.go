@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Сводка отправляется, если с назначенного времени прошло меньше digestCatchUp:
+// так пропущенный тик или короткий перезапуск не теряют сводку, а включение днём не шлёт утреннюю задним числом.
+const digestCatchUp = time.Hour
+
+// digestDue сообщает, пора ли отправлять сводку со временем atTime (`15:04`) в локальный день now.
+func digestDue(now time.Time, atTime string, loc *time.Location) bool {
+	return timeOfDayDue(now, atTime, loc, digestCatchUp)
+}
+
+// timeOfDayDue сообщает, что время atTime (`15:04`) в локальный день now наступило меньше catchUp назад.
+func timeOfDayDue(now time.Time, atTime string, loc *time.Location, catchUp time.Duration) bool {
+	if atTime == "" {
+		return false
+	}
+	parsed, err := time.Parse("15:04", atTime)
+	if err != nil {
+		return false
+	}
+	local := now.In(loc)
+	due := time.Date(local.Year(), local.Month(), local.Day(), parsed.Hour(), parsed.Minute(), 0, 0, loc)
+	return !local.Before(due) && local.Sub(due) < catchUp
+}
+
+// BuildMorningDigest — утренняя сводка о ночи, закончившейся сегодня; незавершённый сон учитывается до now.
+func BuildMorningDigest(childName string, sessions []SleepSession, active *SleepSession, now time.Time, loc *time.Location) string {
+	merged := sessionsWithActive(sessions, active, now)
+	night := SummarizeNight(merged, now, loc)
+
+	lines := []string{fmt.Sprintf("Доброе утро! Ночь %s на %s:", childName, night.Date.Format("02.01"))}
+	if night.SleepCount == 0 {
+		lines = append(lines, "Записей о ночном сне нет.")
+		return strings.Join(lines, "\n")
+	}
+
+	wake := night.LastWakeAt.Format("15:04")
+	if active != nil && !night.LastWakeAt.Before(now.In(loc)) {
+		wake = "ещё спит"
+	}
+	lines = append(lines,
+		fmt.Sprintf("Отбой: %s, подъём: %s.", night.FirstSleepAt.Format("15:04"), wake),
+		fmt.Sprintf("Ночной сон: %s.", formatDurationRU(night.TotalSleep)),
+	)
+	if night.Wakings == 0 {
+		lines = append(lines, "Без пробуждений.")
+	} else {
+		lines = append(lines, fmt.Sprintf("Пробуждений: %d, бодрствование %s (самое долгое %s).",
+			night.Wakings, formatDurationRU(night.AwakeTime), formatDurationRU(night.LongestWaking),
+		))
+	}
+	lines = append(lines, fmt.Sprintf("Самый длинный сон: %s.", formatDurationRU(night.LongestStretch)))
+	return strings.Join(lines, "\n")
+}
+
+// BuildWeeklyDigest — воскресные итоги: последние 7 дней (включая сегодня) и сравнение с 7 днями до них.
+func BuildWeeklyDigest(childName string, sessions []SleepSession, active *SleepSession, now time.Time, loc *time.Location) string {
+	start := lastDaysStart(now, 7, loc)
+	previousEnd := start.AddDate(0, 0, -1)
+	previousStart := lastDaysStart(previousEnd, 7, loc)
+	merged := sessionsWithActive(sessions, active, now)
+
+	blocks := []string{
+		fmt.Sprintf("Итоги недели: %s", childName),
+		BuildRangeSummary(sessions, active, start, now, now, loc),
+		BuildCompareReport(
+			SummarizePeriod(merged, previousStart, previousEnd, loc),
+			SummarizePeriod(merged, start, now, loc),
+		),
+	}
+	return strings.Join(blocks, "\n\n")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigestDueWithinCatchUpWindow(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 3, 16, hour, minute, 0, 0, loc).UTC()
+	}
+
+	cases := []struct {
+		now  time.Time
+		want bool
+	}{
+		{at(7, 59), false},
+		{at(8, 0), true},
+		{at(8, 59), true},
+		{at(9, 0), false},
+	}
+	for _, tc := range cases {
+		if got := digestDue(tc.now, "08:00", loc); got != tc.want {
+			t.Fatalf("digestDue at %s: expected %v, got %v", tc.now.In(loc).Format("15:04"), tc.want, got)
+		}
+	}
+	if digestDue(at(8, 0), "", loc) {
+		t.Fatal("disabled digest must never be due")
+	}
+}
+
+func TestBuildMorningDigestSummarizesNight(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 16, 8, 0, 0, 0, loc)
+
+	makeSession := func(startDay, startHour, startMinute, endDay, endHour, endMinute int) SleepSession {
+		start := time.Date(2026, 3, startDay, startHour, startMinute, 0, 0, loc).UTC()
+		end := time.Date(2026, 3, endDay, endHour, endMinute, 0, 0, loc).UTC()
+		return SleepSession{StartAt: start, EndAt: &end}
+	}
+	sessions := []SleepSession{
+		makeSession(15, 20, 15, 16, 1, 0),
+		makeSession(16, 1, 20, 16, 6, 40),
+	}
+
+	digest := BuildMorningDigest("Маша", sessions, nil, now, loc)
+	for _, want := range []string{
+		"Ночь Маша на 16.03",
+		"Отбой: 20:15, подъём: 06:40.",
+		"Пробуждений: 1, бодрствование 20 мин",
+		"Самый длинный сон: 5 ч 20 мин.",
+	} {
+		if !strings.Contains(digest, want) {
+			t.Fatalf("expected %q in digest:\n%s", want, digest)
+		}
+	}
+
+	active := SleepSession{StartAt: time.Date(2026, 3, 16, 6, 0, 0, 0, loc).UTC()}
+	digest = BuildMorningDigest("Маша", sessions[:1], &active, now, loc)
+	if !strings.Contains(digest, "подъём: ещё спит") {
+		t.Fatalf("expected ongoing sleep to be reported, got:\n%s", digest)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// updateDispatcher раздает обновления Telegram воркерам. Обновления одной семьи (пока семья
+// пользователя неизвестна — одного пользователя) всегда попадают к одному воркеру и обрабатываются
+// по порядку, разные семьи — параллельно, так что долгий отчет или выгрузка не задерживают остальные
+// семьи. Очередь воркера ограничена: когда она заполнена, dispatch ждет, и бот перестает забирать
+// новые обновления.
+type updateDispatcher struct {
+	queues   []chan routedUpdate
+	handle   func(context.Context, tgbotapi.Update)
+	familyOf func(userID int64) int64
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	routes map[int64]*userRoute
+}
+
+// routedUpdate — обновление в очереди воркера и пользователь, которому оно засчитано в userRoute.
+type routedUpdate struct {
+	update tgbotapi.Update
+	userID int64
+}
+
+// userRoute — воркер, к которому уходят обновления пользователя, и сколько их еще не обработано.
+// Пока есть необработанные, воркер не меняется, даже если пользователь перешел в другую семью (/join):
+// иначе его следующее сообщение могло бы обогнать предыдущее.
+type userRoute struct {
+	worker  int
+	pending int
+}
+
+// newUpdateDispatcher запускает workers воркеров с очередями по queueSize обновлений;
+// обработчик получает ctx, который не отменяется при остановке, чтобы очередь дослушалась.
+// familyOf возвращает семью пользователя (0 — неизвестна); nil — порядок только по пользователю.
+func newUpdateDispatcher(ctx context.Context, workers int, queueSize int, familyOf func(userID int64) int64, handle func(context.Context, tgbotapi.Update)) *updateDispatcher {
+	d := &updateDispatcher{
+		queues:   make([]chan routedUpdate, max(workers, 1)),
+		handle:   handle,
+		familyOf: familyOf,
+		routes:   map[int64]*userRoute{},
+	}
+	for i := range d.queues {
+		queue := make(chan routedUpdate, max(queueSize, 1))
+		d.queues[i] = queue
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for item := range queue {
+				d.handle(ctx, item.update)
+				d.release(item.userID)
+			}
+		}()
+	}
+	return d
+}
+
+// updateUserKey — пользователь, от которого пришло обновление (для сообщений без отправителя — чат).
+func updateUserKey(update tgbotapi.Update) int64 {
+	switch {
+	case update.CallbackQuery != nil && update.CallbackQuery.From != nil:
+		return update.CallbackQuery.From.ID
+	case update.Message != nil && update.Message.From != nil:
+		return update.Message.From.ID
+	case update.Message != nil && update.Message.Chat != nil:
+		return update.Message.Chat.ID
+	default:
+		return 0
+	}
+}
+
+// route выбирает воркер обновления пользователя userID: по семье, если она известна, иначе по
+// пользователю; пока у пользователя есть необработанные обновления — прежний воркер.
+func (d *updateDispatcher) route(userID int64) int {
+	key := userID
+	if d.familyOf != nil {
+		if familyID := d.familyOf(userID); familyID != 0 {
+			key = familyID
+		}
+	}
+	worker := int(uint64(key) % uint64(len(d.queues)))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	route := d.routes[userID]
+	if route == nil {
+		route = &userRoute{worker: worker}
+		d.routes[userID] = route
+	}
+	if route.pending == 0 {
+		route.worker = worker
+	}
+	route.pending++
+	return route.worker
+}
+
+// release отмечает, что обновление пользователя обработано (или не попало в очередь).
+func (d *updateDispatcher) release(userID int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if route := d.routes[userID]; route != nil {
+		route.pending--
+		if route.pending <= 0 {
+			delete(d.routes, userID)
+		}
+	}
+}
+
+// dispatch ставит обновление в очередь его воркера; false — ctx отменен раньше, чем нашлось место.
+func (d *updateDispatcher) dispatch(ctx context.Context, update tgbotapi.Update) bool {
+	item := routedUpdate{update: update, userID: updateUserKey(update)}
+	queue := d.queues[d.route(item.userID)]
+	select {
+	case queue <- item:
+		return true
+	default:
+	}
+	slog.Warn("update queue is full, waiting", "update_id", update.UpdateID)
+	select {
+	case queue <- item:
+		return true
+	case <-ctx.Done():
+		d.release(item.userID)
+		return false
+	}
+}
+
+// drain закрывает очереди и ждет, пока воркеры обработают уже принятые обновления;
+// false — не успели за timeout.
+func (d *updateDispatcher) drain(timeout time.Duration) bool {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
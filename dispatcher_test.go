@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func testUpdate(id int, userID int64) tgbotapi.Update {
+	return tgbotapi.Update{UpdateID: id, Message: &tgbotapi.Message{
+		From: &tgbotapi.User{ID: userID},
+		Chat: &tgbotapi.Chat{ID: userID, Type: "private"},
+	}}
+}
+
+func TestUpdateDispatcherKeepsOrderPerUser(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen = map[int64][]int{}
+	)
+	d := newUpdateDispatcher(context.Background(), 3, 4, nil, func(_ context.Context, update tgbotapi.Update) {
+		mu.Lock()
+		defer mu.Unlock()
+		userID := update.Message.From.ID
+		seen[userID] = append(seen[userID], update.UpdateID)
+	})
+	id := 0
+	for round := 0; round < 20; round++ {
+		for userID := int64(1); userID <= 5; userID++ {
+			id++
+			if !d.dispatch(context.Background(), testUpdate(id, userID)) {
+				t.Fatalf("dispatch %d failed", id)
+			}
+		}
+	}
+	if !d.drain(time.Second) {
+		t.Fatalf("drain timed out")
+	}
+	for userID, ids := range seen {
+		if len(ids) != 20 {
+			t.Fatalf("user %d: expected 20 updates, got %d", userID, len(ids))
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] <= ids[i-1] {
+				t.Fatalf("user %d: updates out of order %v", userID, ids)
+			}
+		}
+	}
+}
+
+func TestUpdateDispatcherSlowUserDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	handled := make(chan int64, 10)
+	d := newUpdateDispatcher(context.Background(), 2, 4, nil, func(_ context.Context, update tgbotapi.Update) {
+		if update.Message.From.ID == 2 {
+			<-release
+		}
+		handled <- update.Message.From.ID
+	})
+	// Пользователи 2 и 3 попадают к разным воркерам из двух.
+	d.dispatch(context.Background(), testUpdate(1, 2))
+	d.dispatch(context.Background(), testUpdate(2, 3))
+	select {
+	case userID := <-handled:
+		if userID != 3 {
+			t.Fatalf("expected user 3 first, got %d", userID)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("fast user is blocked by a slow one")
+	}
+
+	if d.drain(10 * time.Millisecond) {
+		t.Fatalf("drain should time out while an update is in progress")
+	}
+	close(release)
+	if userID := <-handled; userID != 2 {
+		t.Fatalf("expected user 2 after release, got %d", userID)
+	}
+}
+
+func TestUpdateDispatcherFullQueue(t *testing.T) {
+	release := make(chan struct{})
+	d := newUpdateDispatcher(context.Background(), 1, 1, nil, func(context.Context, tgbotapi.Update) { <-release })
+	d.dispatch(context.Background(), testUpdate(1, 1))
+	// Первое обновление может еще не дойти до воркера, поэтому очередь заполняется одним-двумя.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	for id := 2; ; id++ {
+		if !d.dispatch(ctx, testUpdate(id, 1)) {
+			break
+		}
+		if id > 3 {
+			t.Fatalf("dispatch should wait when the queue is full")
+		}
+	}
+	close(release)
+	if !d.drain(time.Second) {
+		t.Fatalf("drain timed out")
+	}
+}
+
+func TestUpdateUserKey(t *testing.T) {
+	callback := tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{From: &tgbotapi.User{ID: 7}}}
+	if got := updateUserKey(callback); got != 7 {
+		t.Fatalf("expected callback sender 7, got %d", got)
+	}
+	if got := updateUserKey(testUpdate(1, 42)); got != 42 {
+		t.Fatalf("expected message sender 42, got %d", got)
+	}
+}
+
+func TestUpdateDispatcherOrdersFamilyMembers(t *testing.T) {
+	families := map[int64]int64{1: 10, 2: 10, 3: 10, 4: 11, 5: 11}
+	var (
+		mu       sync.Mutex
+		seen     = map[int64][]int{}
+		inFlight = map[int64]int{}
+		overlap  bool
+	)
+	d := newUpdateDispatcher(context.Background(), 4, 8, func(userID int64) int64 { return families[userID] }, func(_ context.Context, update tgbotapi.Update) {
+		family := families[update.Message.From.ID]
+		mu.Lock()
+		inFlight[family]++
+		overlap = overlap || inFlight[family] > 1
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		inFlight[family]--
+		seen[family] = append(seen[family], update.UpdateID)
+		mu.Unlock()
+	})
+	id := 0
+	for round := 0; round < 10; round++ {
+		for userID := int64(1); userID <= 5; userID++ {
+			id++
+			d.dispatch(context.Background(), testUpdate(id, userID))
+		}
+	}
+	if !d.drain(5 * time.Second) {
+		t.Fatalf("drain timed out")
+	}
+	if overlap {
+		t.Fatalf("updates of one family were handled in parallel")
+	}
+	for family, ids := range seen {
+		for i := 1; i < len(ids); i++ {
+			if ids[i] <= ids[i-1] {
+				t.Fatalf("family %d: updates out of order %v", family, ids)
+			}
+		}
+	}
+	if len(seen[10]) != 30 || len(seen[11]) != 20 {
+		t.Fatalf("unexpected counts %d and %d", len(seen[10]), len(seen[11]))
+	}
+}
+
+func TestUpdateDispatcherKeepsUserOrderAcrossJoin(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		family int64
+		order  []int
+	)
+	release := make(chan struct{})
+	familyOf := func(int64) int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return family
+	}
+	// Пользователь 3 без семьи попадает к воркеру 1 из двух, его семья 4 — к воркеру 0.
+	d := newUpdateDispatcher(context.Background(), 2, 4, familyOf, func(_ context.Context, update tgbotapi.Update) {
+		if update.UpdateID == 1 {
+			<-release
+		}
+		mu.Lock()
+		order = append(order, update.UpdateID)
+		mu.Unlock()
+	})
+	d.dispatch(context.Background(), testUpdate(1, 3))
+	// /join сохранен, но его обновление еще обрабатывается.
+	mu.Lock()
+	family = 4
+	mu.Unlock()
+	d.dispatch(context.Background(), testUpdate(2, 3))
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if !d.drain(time.Second) {
+		t.Fatalf("drain timed out")
+	}
+	if len(order) != 2 || order[0] != 1 || order[1] != 2 {
+		t.Fatalf("user updates should keep order across a family change, got %v", order)
+	}
+
+	// Когда очередь пользователя пуста, он переходит к воркеру семьи.
+	d = newUpdateDispatcher(context.Background(), 2, 4, familyOf, func(context.Context, tgbotapi.Update) {})
+	if worker := d.route(3); worker != 0 {
+		t.Fatalf("expected family worker 0, got %d", worker)
+	}
+	d.release(3)
+	if len(d.routes) != 0 {
+		t.Fatalf("released user should not keep a route, got %v", d.routes)
+	}
+	d.drain(time.Second)
+}
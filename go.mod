@@ -3,8 +3,10 @@ module drupal-reminder
 go 1.25.5
 
 require (
+	github.com/go-pdf/fpdf v0.9.0
 	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
 	github.com/joho/godotenv v1.5.1
+	golang.org/x/image v0.36.0
 	modernc.org/sqlite v1.46.1
 )
 
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Таблицы ВОЗ (LMS-параметры по опорным месяцам 0–36) встраиваются в бинарник из who_growth.json.
+//
+//go:embed who_growth.json
+var whoGrowthJSON []byte
+
+// whoLMS — строка таблицы: возраст в месяцах и параметры L, M, S.
+type whoLMS [4]float64
+
+type whoGrowthTables struct {
+	Weight map[string][]whoLMS `json:"weight"`
+	Height map[string][]whoLMS `json:"height"`
+	Head   map[string][]whoLMS `json:"head"`
+}
+
+var whoGrowth = mustParseWHOGrowth(whoGrowthJSON)
+
+func mustParseWHOGrowth(raw []byte) whoGrowthTables {
+	var tables whoGrowthTables
+	if err := json.Unmarshal(raw, &tables); err != nil {
+		panic(fmt.Errorf("parse who growth tables: %w", err))
+	}
+	return tables
+}
+
+var measurementUnits = map[string]string{
+	measurementWeight: "кг",
+	measurementHeight: "см",
+	measurementHead:   "см",
+}
+
+var measurementTitles = map[string]string{
+	measurementWeight: "Вес",
+	measurementHeight: "Рост",
+	measurementHead:   "Окружность головы",
+}
+
+// Допустимые значения для детей до 3 лет: отсекают опечатки вроде `/height 5.8`.
+var measurementRanges = map[string][2]float64{
+	measurementWeight: {1, 30},
+	measurementHeight: {35, 120},
+	measurementHead:   {25, 60},
+}
+
+var measurementOrder = []string{measurementWeight, measurementHeight, measurementHead}
+
+func (t whoGrowthTables) table(kind string, sex string) []whoLMS {
+	key := "boys"
+	if sex == childSexGirl {
+		key = "girls"
+	}
+	switch kind {
+	case measurementWeight:
+		return t.Weight[key]
+	case measurementHeight:
+		return t.Height[key]
+	case measurementHead:
+		return t.Head[key]
+	}
+	return nil
+}
+
+// lmsAt интерполирует L, M, S линейно между опорными месяцами таблицы.
+func lmsAt(rows []whoLMS, ageMonths float64) (float64, float64, float64, bool) {
+	if len(rows) == 0 || ageMonths < rows[0][0] || ageMonths > rows[len(rows)-1][0] {
+		return 0, 0, 0, false
+	}
+	for i := 1; i < len(rows); i++ {
+		if ageMonths > rows[i][0] {
+			continue
+		}
+		lo, hi := rows[i-1], rows[i]
+		k := (ageMonths - lo[0]) / (hi[0] - lo[0])
+		return lo[1] + k*(hi[1]-lo[1]), lo[2] + k*(hi[2]-lo[2]), lo[3] + k*(hi[3]-lo[3]), true
+	}
+	return rows[0][1], rows[0][2], rows[0][3], true
+}
+
+// GrowthPercentile возвращает z-оценку и перцентиль ВОЗ для измерения; false — нет пола или возраст вне таблиц.
+func GrowthPercentile(kind string, sex string, ageMonths float64, value float64) (float64, float64, bool) {
+	if sex != childSexBoy && sex != childSexGirl {
+		return 0, 0, false
+	}
+	l, m, s, ok := lmsAt(whoGrowth.table(kind, sex), ageMonths)
+	if !ok || value <= 0 {
+		return 0, 0, false
+	}
+	var z float64
+	if math.Abs(l) < 1e-9 {
+		z = math.Log(value/m) / s
+	} else {
+		z = (math.Pow(value/m, l) - 1) / (l * s)
+	}
+	return z, 50 * math.Erfc(-z/math.Sqrt2), true
+}
+
+// parseMeasurementArgs разбирает `5.2`, `5,2 12.03` или `5200` (вес в граммах).
+// Без даты измерение записывается на now, с датой — на полдень этого дня.
+func parseMeasurementArgs(kind string, args string, now time.Time, loc *time.Location) (float64, time.Time, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, time.Time{}, fmt.Errorf("нужно значение и, при желании, дата")
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(fields[0], ",", "."), 64)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("не понял число")
+	}
+	if kind == measurementWeight && value >= 500 {
+		value /= 1000
+	}
+	limits := measurementRanges[kind]
+	if value < limits[0] || value > limits[1] {
+		return 0, time.Time{}, fmt.Errorf("значение вне диапазона %g–%g %s", limits[0], limits[1], measurementUnits[kind])
+	}
+
+	measuredAt := now
+	if len(fields) == 2 {
+		day, err := parseReportDate(fields[1], now, loc)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		if !day.Equal(startOfDay(now, loc)) {
+			measuredAt = day.Add(12 * time.Hour)
+		}
+	}
+	return value, measuredAt, nil
+}
+
+func formatMeasurementValue(kind string, value float64) string {
+	if kind == measurementWeight {
+		return fmt.Sprintf("%.2f %s", value, measurementUnits[kind])
+	}
+	return fmt.Sprintf("%.1f %s", value, measurementUnits[kind])
+}
+
+func formatPercentile(percentile float64) string {
+	switch {
+	case percentile < 3:
+		return "ниже 3-го перцентиля ВОЗ"
+	case percentile > 97:
+		return "выше 97-го перцентиля ВОЗ"
+	default:
+		return fmt.Sprintf("%d-й перцентиль ВОЗ", int(math.Round(percentile)))
+	}
+}
+
+// BuildGrowthReport — последние измерения каждого вида против перцентилей ВОЗ и изменение с предыдущего.
+// measurements ожидаются по возрастанию даты, как их возвращает ListMeasurements.
+func BuildGrowthReport(child Child, measurements []Measurement, now time.Time, loc *time.Location) string {
+	byKind := map[string][]Measurement{}
+	for _, measurement := range measurements {
+		byKind[measurement.Kind] = append(byKind[measurement.Kind], measurement)
+	}
+
+	header := fmt.Sprintf("Рост и вес %s:", escapeTelegramMarkdown(child.Name))
+	if child.BirthDate != nil {
+		header = fmt.Sprintf("Рост и вес %s (возраст %s):", escapeTelegramMarkdown(child.Name), formatChildAgeRU(*child.BirthDate, now, loc))
+	}
+	lines := []string{header}
+
+	for _, kind := range measurementOrder {
+		items := byKind[kind]
+		if len(items) == 0 {
+			lines = append(lines, fmt.Sprintf("%s: нет измерений (`/%s`).", measurementTitles[kind], kind))
+			continue
+		}
+		latest := items[len(items)-1]
+		line := fmt.Sprintf("%s: %s (%s)", measurementTitles[kind], formatMeasurementValue(kind, latest.Value), latest.MeasuredAt.In(loc).Format("02.01.2006"))
+		if ageMonths, ok := childAgeMonths(child, latest.MeasuredAt); ok {
+			if _, percentile, ok := GrowthPercentile(kind, child.Sex, ageMonths, latest.Value); ok {
+				line += " — " + formatPercentile(percentile)
+			}
+		}
+		if len(items) > 1 {
+			previous := items[len(items)-2]
+			days := int(latest.MeasuredAt.Sub(previous.MeasuredAt).Hours() / 24)
+			line += fmt.Sprintf("; %s за %d дн", formatMeasurementDelta(kind, latest.Value-previous.Value), days)
+		}
+		lines = append(lines, line+".")
+	}
+
+	lines = append(lines, "")
+	switch {
+	case child.BirthDate == nil:
+		lines = append(lines, "Для перцентилей укажите дату рождения: `/setbirthdate 16.03.2026`.")
+	case child.Sex == "":
+		lines = append(lines, "Для перцентилей укажите пол: `/setsex мальчик` или `/setsex девочка`.")
+	default:
+		lines = append(lines, "Перцентиль — доля детей того же пола и возраста с меньшим значением по стандартам ВОЗ (0–3 года); обычный диапазон — от 3-го до 97-го.")
+	}
+	lines = append(lines, "Записать: `/weight 5.2`, `/height 58`, `/head 38` (можно добавить дату: `/weight 5.2 12.03`).")
+	return strings.Join(lines, "\n")
+}
+
+func formatMeasurementDelta(kind string, delta float64) string {
+	sign := "+"
+	if delta < 0 {
+		sign = "−"
+		delta = -delta
+	}
+	if kind == measurementWeight {
+		return fmt.Sprintf("%s%d г", sign, int(math.Round(delta*1000)))
+	}
+	return fmt.Sprintf("%s%.1f см", sign, delta)
+}
+
+// BuildMeasurementsCSV выгружает измерения с возрастом и перцентилем ВОЗ (если их можно посчитать).
+func BuildMeasurementsCSV(child Child, measurements []Measurement, loc *time.Location) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write([]string{"id", "kind", "value", "unit", "measured_at_local", "age_days", "who_percentile", "created_by"}); err != nil {
+		return nil, err
+	}
+	for _, measurement := range measurements {
+		ageDays, percentile := "", ""
+		if child.BirthDate != nil && !measurement.MeasuredAt.Before(*child.BirthDate) {
+			ageDays = strconv.Itoa(int(measurement.MeasuredAt.Sub(*child.BirthDate).Hours() / 24))
+		}
+		if ageMonths, ok := childAgeMonths(child, measurement.MeasuredAt); ok {
+			if _, value, ok := GrowthPercentile(measurement.Kind, child.Sex, ageMonths, measurement.Value); ok {
+				percentile = strconv.FormatFloat(value, 'f', 1, 64)
+			}
+		}
+		if err := writer.Write([]string{
+			strconv.FormatInt(measurement.ID, 10),
+			measurement.Kind,
+			strconv.FormatFloat(measurement.Value, 'f', -1, 64),
+			measurementUnits[measurement.Kind],
+			measurement.MeasuredAt.In(loc).Format(time.RFC3339),
+			ageDays,
+			percentile,
+			strconv.FormatInt(measurement.CreatedBy, 10),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func parseChildSex(raw string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "мальчик", "м", "boy", "m":
+		return childSexBoy, true
+	case "девочка", "д", "girl", "f":
+		return childSexGirl, true
+	}
+	return "", false
+}
+
+func childSexLabel(sex string) string {
+	switch sex {
+	case childSexBoy:
+		return "мальчик"
+	case childSexGirl:
+		return "девочка"
+	}
+	return "не указан"
+}
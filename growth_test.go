@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGrowthPercentileMedianIsFiftieth(t *testing.T) {
+	for _, kind := range measurementOrder {
+		for _, sex := range []string{childSexBoy, childSexGirl} {
+			rows := whoGrowth.table(kind, sex)
+			if len(rows) == 0 || rows[len(rows)-1][0] != 36 {
+				t.Fatalf("%s/%s: expected table through 36 months", kind, sex)
+			}
+			median := rows[6][2]
+			_, percentile, ok := GrowthPercentile(kind, sex, rows[6][0], median)
+			if !ok || math.Abs(percentile-50) > 0.01 {
+				t.Fatalf("%s/%s: median should be 50th percentile, got %.2f (ok=%t)", kind, sex, percentile, ok)
+			}
+		}
+	}
+	if _, _, ok := GrowthPercentile(measurementWeight, "", 6, 7.9); ok {
+		t.Fatal("percentile without sex must not be computed")
+	}
+	if _, _, ok := GrowthPercentile(measurementWeight, childSexBoy, 40, 15); ok {
+		t.Fatal("percentile above 36 months must not be computed")
+	}
+}
+
+func TestLMSAtInterpolatesBetweenRows(t *testing.T) {
+	rows := []whoLMS{{0, 1, 10, 0.1}, {2, 0, 20, 0.3}}
+	l, m, s, ok := lmsAt(rows, 1)
+	if !ok || l != 0.5 || m != 15 || math.Abs(s-0.2) > 1e-9 {
+		t.Fatalf("unexpected interpolation: %v %v %v %t", l, m, s, ok)
+	}
+}
+
+func TestParseMeasurementArgs(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 16, 20, 0, 0, 0, loc)
+
+	value, at, err := parseMeasurementArgs(measurementWeight, "5200", now, loc)
+	if err != nil || value != 5.2 || !at.Equal(now) {
+		t.Fatalf("grams: got %v %v %v", value, at, err)
+	}
+	value, at, err = parseMeasurementArgs(measurementHeight, "58,5 12.03", now, loc)
+	if err != nil || value != 58.5 || !at.Equal(time.Date(2026, 3, 12, 12, 0, 0, 0, loc)) {
+		t.Fatalf("comma and date: got %v %v %v", value, at, err)
+	}
+	if _, _, err := parseMeasurementArgs(measurementHeight, "5.8", now, loc); err == nil {
+		t.Fatal("expected range error for 5.8 cm")
+	}
+	if _, _, err := parseMeasurementArgs(measurementHead, "", now, loc); err == nil {
+		t.Fatal("expected error for empty input")
+	}
+}
+
+func TestBuildGrowthReportAndCSV(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 9, 16, 12, 0, 0, 0, loc)
+	birth := now.AddDate(0, -6, 0)
+	child := Child{Name: "Малыш", BirthDate: &birth, Sex: childSexBoy}
+	measurements := []Measurement{
+		{ID: 1, Kind: measurementWeight, Value: 7.5, MeasuredAt: now.AddDate(0, 0, -14).UTC(), CreatedBy: 1},
+		{ID: 2, Kind: measurementWeight, Value: 7.934, MeasuredAt: now.UTC(), CreatedBy: 1},
+	}
+
+	report := BuildGrowthReport(child, measurements, now, loc)
+	for _, want := range []string{
+		"Вес: 7.93 кг (16.09.2026) — 49-й перцентиль ВОЗ; +434 г за 14 дн.\n",
+		"Рост: нет измерений",
+	} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("expected %q in report:\n%s", want, report)
+		}
+	}
+
+	payload, err := BuildMeasurementsCSV(child, measurements, loc)
+	if err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(payload)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "id,kind,value,unit,measured_at_local") {
+		t.Fatalf("unexpected csv:\n%s", payload)
+	}
+	if !strings.Contains(lines[2], "weight,7.934,кг,2026-09-16T12:00:00+03:00,") {
+		t.Fatalf("unexpected csv row: %s", lines[2])
+	}
+}
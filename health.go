@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Допустимая температура: отсекает опечатки вроде `/temp 382`.
+const (
+	temperatureMin = 34.0
+	temperatureMax = 43.0
+)
+
+// Порог оповещения о температуре для новых семей и `/tempalert on`, °C.
+const temperatureAlertDefault = 38.0
+
+// Окно /sick по умолчанию и максимум, дней (включая сегодня).
+const (
+	sickDefaultDays = 3
+	sickMaxDays     = 14
+)
+
+const healthUsageHint = "Записать: `/temp 38.2` (можно `/temp 38.2 14:30`), `/symptom кашель, насморк; ночью хуже`."
+
+// parseTemperatureArgs разбирает `38.2`, `38,2 14:30` или `38.2 16.03 14:30`; без времени — now.
+func parseTemperatureArgs(args string, now time.Time, loc *time.Location) (float64, time.Time, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 || len(fields) > 3 {
+		return 0, time.Time{}, fmt.Errorf("нужна температура и, при желании, время")
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(fields[0], ",", "."), 64)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("не понял число")
+	}
+	if value < temperatureMin || value > temperatureMax {
+		return 0, time.Time{}, fmt.Errorf("температура вне диапазона %g–%g °C", temperatureMin, temperatureMax)
+	}
+	if len(fields) == 1 {
+		return value, now, nil
+	}
+	at, _, err := parseFlexibleDateTime(strings.Join(fields[1:], " "), now, loc)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("не понял время")
+	}
+	return value, at, nil
+}
+
+// parseSymptomArgs разбирает `[время] кашель, насморк; заметка`: теги через запятую, заметка после `;`.
+func parseSymptomArgs(args string, now time.Time, loc *time.Location) ([]string, string, time.Time, error) {
+	at := now
+	fields := strings.Fields(args)
+	for _, take := range []int{2, 1} {
+		if len(fields) <= take {
+			continue
+		}
+		if parsed, _, err := parseFlexibleDateTime(strings.Join(fields[:take], " "), now, loc); err == nil {
+			at = parsed
+			fields = fields[take:]
+			break
+		}
+	}
+
+	rawTags, note, _ := strings.Cut(strings.Join(fields, " "), ";")
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(rawTags, ",") {
+		tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		return nil, "", time.Time{}, fmt.Errorf("нужен хотя бы один симптом")
+	}
+	return tags, strings.TrimSpace(note), at, nil
+}
+
+func formatTemperature(value float64) string {
+	return fmt.Sprintf("%.1f °C", value)
+}
+
+func formatTemperatureAlert(threshold float64) string {
+	if threshold <= 0 {
+		return "выкл."
+	}
+	return "от " + formatTemperature(threshold)
+}
+
+// TemperatureAlertTriggered сообщает, достигла ли запись порога оповещения.
+func TemperatureAlertTriggered(entry HealthEntry, threshold float64) bool {
+	return threshold > 0 && entry.Kind == healthTemperature && entry.Temperature >= threshold
+}
+
+// sleepStateAt описывает, спал ли ребёнок в момент at, для наложения записей на сон.
+func sleepStateAt(sessions []SleepSession, at time.Time, loc *time.Location) string {
+	for _, session := range sessions {
+		if session.EndAt == nil || at.Before(session.StartAt) || !at.Before(*session.EndAt) {
+			continue
+		}
+		return fmt.Sprintf("во сне %s–%s", session.StartAt.In(loc).Format("15:04"), session.EndAt.In(loc).Format("15:04"))
+	}
+	return "не спал"
+}
+
+func formatHealthEntry(entry HealthEntry, sessions []SleepSession, loc *time.Location) string {
+	var text string
+	if entry.Kind == healthTemperature {
+		text = "температура " + formatTemperature(entry.Temperature)
+	} else {
+		text = escapeTelegramMarkdown(strings.Join(entry.Tags, ", "))
+		if entry.Note != "" {
+			text += fmt.Sprintf(" (%s)", escapeTelegramMarkdown(entry.Note))
+		}
+	}
+	return fmt.Sprintf("%s — %s, %s", entry.RecordedAt.In(loc).Format("15:04"), text, sleepStateAt(sessions, entry.RecordedAt, loc))
+}
+
+func healthEntriesOfDay(entries []HealthEntry, day time.Time, loc *time.Location) []HealthEntry {
+	start := startOfDay(day, loc)
+	end := start.AddDate(0, 0, 1)
+	var result []HealthEntry
+	for _, entry := range entries {
+		if !entry.RecordedAt.Before(start) && entry.RecordedAt.Before(end) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// BuildHealthDaySection — записи о температуре и симптомах за день поверх сна (пусто, если записей нет).
+// sessions должны включать активный сон, чтобы запись во время него отмечалась как «во сне».
+func BuildHealthDaySection(entries []HealthEntry, sessions []SleepSession, day time.Time, loc *time.Location) string {
+	dayEntries := healthEntriesOfDay(entries, day, loc)
+	if len(dayEntries) == 0 {
+		return ""
+	}
+	lines := []string{"*Здоровье:*"}
+	for _, entry := range dayEntries {
+		lines = append(lines, formatHealthEntry(entry, sessions, loc))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// BuildSickReport — период болезни за days дней до сегодня: по каждому дню максимум температуры,
+// симптомы и сон (всего, ночью, пробуждения), затем записи с отметкой, спал ли ребёнок в этот момент.
+func BuildSickReport(childName string, entries []HealthEntry, sessions []SleepSession, now time.Time, days int, loc *time.Location) string {
+	today := startOfDay(now, loc)
+	first := today.AddDate(0, 0, -(days - 1))
+	lines := []string{fmt.Sprintf("Здоровье %s за %s–%s:", childName, first.Format("02.01"), today.Format("02.01"))}
+	if len(entries) == 0 {
+		lines = append(lines, "Записей о температуре и симптомах нет.", "", healthUsageHint)
+		return strings.Join(lines, "\n")
+	}
+
+	for day := first; !day.After(today); day = day.AddDate(0, 0, 1) {
+		dayEntries := healthEntriesOfDay(entries, day, loc)
+		summary := SummarizeDayNight(sessions, day, loc)
+
+		parts := []string{}
+		maxTemperature, readings := 0.0, 0
+		var symptoms []string
+		seen := map[string]bool{}
+		for _, entry := range dayEntries {
+			if entry.Kind == healthTemperature {
+				readings++
+				if entry.Temperature > maxTemperature {
+					maxTemperature = entry.Temperature
+				}
+				continue
+			}
+			for _, tag := range entry.Tags {
+				if !seen[tag] {
+					seen[tag] = true
+					symptoms = append(symptoms, tag)
+				}
+			}
+		}
+		if readings > 0 {
+			parts = append(parts, fmt.Sprintf("макс. %s (%d %s)", formatTemperature(maxTemperature), readings, ruPlural(readings, "измерение", "измерения", "измерений")))
+		}
+		if len(symptoms) > 0 {
+			parts = append(parts, escapeTelegramMarkdown(strings.Join(symptoms, ", ")))
+		}
+		if summary.Total() > 0 {
+			parts = append(parts, fmt.Sprintf("сон %s, ночью %s, пробуждений %d",
+				formatDurationRU(summary.Total()), formatDurationRU(summary.Night.TotalSleep), summary.Night.Wakings,
+			))
+		} else {
+			parts = append(parts, "сон не записан")
+		}
+
+		lines = append(lines, "", fmt.Sprintf("*%s:* %s", day.Format("02.01"), strings.Join(parts, "; ")))
+		for _, entry := range dayEntries {
+			lines = append(lines, formatHealthEntry(entry, sessions, loc))
+		}
+	}
+	lines = append(lines, "", healthUsageHint)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHealthArgs(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 16, 20, 0, 0, 0, loc)
+
+	value, at, err := parseTemperatureArgs("38,2 14:30", now, loc)
+	if err != nil || value != 38.2 || !at.Equal(time.Date(2026, 3, 16, 14, 30, 0, 0, loc)) {
+		t.Fatalf("temperature: got %v %v %v", value, at, err)
+	}
+	if _, _, err := parseTemperatureArgs("382", now, loc); err == nil {
+		t.Fatal("expected range error for 382")
+	}
+
+	tags, note, at, err := parseSymptomArgs("15.03 22:10 Кашель, #насморк, кашель; ночью хуже", now, loc)
+	if err != nil {
+		t.Fatalf("symptom: %v", err)
+	}
+	if strings.Join(tags, ",") != "кашель,насморк" || note != "ночью хуже" || !at.Equal(time.Date(2026, 3, 15, 22, 10, 0, 0, loc)) {
+		t.Fatalf("unexpected symptom: %v %q %v", tags, note, at)
+	}
+	if _, _, _, err := parseSymptomArgs("; только заметка", now, loc); err == nil {
+		t.Fatal("expected error without symptoms")
+	}
+}
+
+func TestTemperatureAlertTriggered(t *testing.T) {
+	entry := HealthEntry{Kind: healthTemperature, Temperature: 38.0}
+	if !TemperatureAlertTriggered(entry, 38) {
+		t.Fatal("reading equal to the threshold must alert")
+	}
+	if TemperatureAlertTriggered(entry, 38.5) || TemperatureAlertTriggered(entry, 0) {
+		t.Fatal("reading below the threshold or disabled alert must not alert")
+	}
+}
+
+func TestBuildSickReportOverlaysSleep(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 16, 20, 0, 0, 0, loc)
+	add := func(start time.Time, duration time.Duration) SleepSession {
+		end := start.Add(duration)
+		return SleepSession{StartAt: start.UTC(), EndAt: &end}
+	}
+	sessions := []SleepSession{
+		add(time.Date(2026, 3, 15, 21, 0, 0, 0, loc), 9*time.Hour),
+		add(time.Date(2026, 3, 16, 13, 0, 0, 0, loc), 2*time.Hour),
+	}
+	entries := []HealthEntry{
+		{Kind: healthTemperature, Temperature: 38.6, RecordedAt: time.Date(2026, 3, 16, 14, 0, 0, 0, loc).UTC()},
+		{Kind: healthTemperature, Temperature: 37.9, RecordedAt: time.Date(2026, 3, 16, 18, 0, 0, 0, loc).UTC()},
+		{Kind: healthSymptom, Tags: []string{"кашель"}, RecordedAt: time.Date(2026, 3, 16, 18, 5, 0, 0, loc).UTC()},
+	}
+
+	report := BuildSickReport("Малыш", entries, sessions, now, 2, loc)
+	for _, want := range []string{
+		"Здоровье Малыш за 15.03–16.03:",
+		"*15.03:* сон не записан",
+		"*16.03:* макс. 38.6 °C (2 измерения); кашель; сон 11 ч, ночью 9 ч, пробуждений 0",
+		"14:00 — температура 38.6 °C, во сне 13:00–15:00",
+		"18:05 — кашель, не спал",
+	} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("expected %q in report:\n%s", want, report)
+		}
+	}
+
+	section := BuildHealthDaySection(entries, sessions, now, loc)
+	if !strings.HasPrefix(section, "*Здоровье:*\n14:00") {
+		t.Fatalf("unexpected day section:\n%s", section)
+	}
+	if BuildHealthDaySection(entries, sessions, now.AddDate(0, 0, -1), loc) != "" {
+		t.Fatal("day without entries must produce no section")
+	}
+}
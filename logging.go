@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const logRedacted = "[redacted]"
+
+// Атрибуты с этими ключами никогда не попадают в лог: токены, секреты, имена и тексты сообщений.
+var sensitiveLogKeys = map[string]bool{
+	"token":  true,
+	"secret": true,
+	"name":   true,
+	"text":   true,
+	"url":    true,
+}
+
+// Токен бота Telegram (`123456:ABC...`) встречается в адресах запросов, которые tgbotapi кладет в ошибки.
+var telegramTokenPattern = regexp.MustCompile(`\d{5,}:[A-Za-z0-9_-]{30,}`)
+
+func parseLogLevel(value string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("неизвестный уровень %q (debug, info, warn, error)", value)
+	}
+}
+
+// newLogger создает логгер с уровнем level в формате text или json; чувствительные данные вычищаются.
+func newLogger(w io.Writer, level slog.Level, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactLogAttr}
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("неизвестный формат %q (text, json)", format)
+	}
+}
+
+func redactLogAttr(_ []string, attr slog.Attr) slog.Attr {
+	if sensitiveLogKeys[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, logRedacted)
+	}
+	switch value := attr.Value.Any().(type) {
+	case string:
+		return slog.String(attr.Key, redactLogText(value))
+	case error:
+		return slog.String(attr.Key, redactLogText(value.Error()))
+	}
+	return attr
+}
+
+func redactLogText(text string) string {
+	return telegramTokenPattern.ReplaceAllString(text, logRedacted)
+}
+
+// telegramLibLogger направляет собственные сообщения tgbotapi (ошибки long polling) в slog;
+// в них бывает адрес запроса с токеном бота, поэтому текст вычищается.
+type telegramLibLogger struct{}
+
+func (telegramLibLogger) Println(v ...any) {
+	slog.Warn("telegram", "message", redactLogText(strings.TrimSpace(fmt.Sprintln(v...))))
+}
+
+func (telegramLibLogger) Printf(format string, v ...any) {
+	slog.Warn("telegram", "message", redactLogText(strings.TrimSpace(fmt.Sprintf(format, v...))))
+}
+
+type updateLogKey struct{}
+
+// updateLog — логгер обработки одного обновления Telegram. Семью обработчик узнает по ходу
+// и записывает через setLogFamily, чтобы итоговая запись об обновлении ее содержала.
+type updateLog struct {
+	logger   *slog.Logger
+	familyID int64
+}
+
+func withUpdateLog(ctx context.Context, logger *slog.Logger) (context.Context, *updateLog) {
+	scope := &updateLog{logger: logger}
+	return context.WithValue(ctx, updateLogKey{}, scope), scope
+}
+
+func (l *updateLog) Logger() *slog.Logger {
+	if l.familyID == 0 {
+		return l.logger
+	}
+	return l.logger.With("family_id", l.familyID)
+}
+
+func setLogFamily(ctx context.Context, familyID int64) {
+	if scope, ok := ctx.Value(updateLogKey{}).(*updateLog); ok {
+		scope.familyID = familyID
+	}
+}
+
+// loggerFrom возвращает логгер обновления из ctx или общий логгер.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if scope, ok := ctx.Value(updateLogKey{}).(*updateLog); ok {
+		return scope.Logger()
+	}
+	return slog.Default()
+}
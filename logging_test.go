@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	for input, want := range map[string]slog.Level{"": slog.LevelInfo, "DEBUG": slog.LevelDebug, "warning": slog.LevelWarn, " error ": slog.LevelError} {
+		if got, err := parseLogLevel(input); err != nil || got != want {
+			t.Fatalf("parseLogLevel(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Fatalf("expected error for unknown level")
+	}
+}
+
+func TestNewLoggerRedactsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, slog.LevelInfo, "json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	token := "123456789:AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsaw"
+	logger.Debug("hidden")
+	logger.Error("send failed", "token", "abc", "name", "Маша", "family_id", int64(7),
+		"error", errors.New(`Post "https://api.telegram.org/bot`+token+`/sendMessage": timeout`))
+
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Fatalf("expected only the error record, got %s", buf.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected JSON record: %v", err)
+	}
+	if record["token"] != logRedacted || record["name"] != logRedacted || record["family_id"] != float64(7) {
+		t.Fatalf("unexpected record %v", record)
+	}
+	if msg, _ := record["error"].(string); strings.Contains(msg, token) || !strings.Contains(msg, "timeout") {
+		t.Fatalf("bot token should be redacted from errors, got %q", msg)
+	}
+	if _, err := newLogger(&buf, slog.LevelInfo, "xml"); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+}
+
+func TestUpdateLogCarriesFamily(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := newLogger(&buf, slog.LevelInfo, "text")
+	ctx, scope := withUpdateLog(context.Background(), logger.With("update_id", 42, "command", "day"))
+	setLogFamily(ctx, 5)
+	loggerFrom(ctx).Info("inner")
+	scope.Logger().Error("handle update failed")
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if !strings.Contains(line, "update_id=42 command=day family_id=5") {
+			t.Fatalf("expected update attributes in %q", line)
+		}
+	}
+	if loggerFrom(context.Background()) != slog.Default() {
+		t.Fatalf("expected default logger without update scope")
+	}
+}
@@ -3,7 +3,8 @@ package main
 import (
 	"context"
 	"database/sql"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -22,59 +23,98 @@ var (
 func main() {
 	cfg, err := LoadConfig()
 	if err != nil {
-		log.Fatalf("config error: %v", err)
+		fatal("config error", err)
 	}
+	logger, err := newLogger(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		fatal("logger init error", err)
+	}
+	slog.SetDefault(logger)
+	_ = tgbotapi.SetLogger(telegramLibLogger{})
 
-	db, err := sql.Open("sqlite", cfg.DatabasePath)
+	db, err := openDatabase(cfg.DatabasePath)
 	if err != nil {
-		log.Fatalf("db open error: %v", err)
+		fatal("db open error", err)
 	}
 	defer db.Close()
 
 	store, err := NewStore(db, cfg)
 	if err != nil {
-		log.Fatalf("store init error: %v", err)
+		fatal("store init error", err)
 	}
 
 	logChildAge(db)
 
 	botAPI, err := tgbotapi.NewBotAPI(cfg.TelegramBotToken)
 	if err != nil {
-		log.Fatalf("telegram init error: %v", err)
+		fatal("telegram init error", err)
 	}
 	registerTelegramCommands(botAPI)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	startHealthServer(ctx)
+	bot := NewSleepBot(botAPI, store, cfg)
 
-	log.Printf("sleep bot started as @%s (version=%s, build_time=%s, commit=%s)", botAPI.Self.UserName, version, buildTime, commitHash)
+	startHTTPServer(ctx, cfg.HTTPAddr, newAPIServer(store, bot.notifyFamily))
+	startMetricsServer(ctx, cfg.MetricsAddr, bot.metrics.handler(store))
 
-	bot := NewSleepBot(botAPI, store, cfg)
+	slog.Info("sleep bot started", "bot", botAPI.Self.UserName, "version", version, "build_time", buildTime, "commit", commitHash)
 
 	go bot.RunReminders(ctx)
+	go bot.RunOutbox(ctx)
+	go newWebhookSender(store).Run(ctx)
 
 	if err := bot.Run(ctx); err != nil && err != context.Canceled {
-		log.Fatalf("bot stopped with error: %v", err)
+		fatal("bot stopped with error", err)
 	}
 }
 
-func startHealthServer(ctx context.Context) {
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// Таймауты HTTP-сервера: он открыт наружу (API, календарь), поэтому медленный клиент
+// не должен держать соединение бесконечно.
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = 30 * time.Second
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+// startHTTPServer поднимает /health и HTTP API (/api/v1/...) на addr.
+func startHTTPServer(ctx context.Context, addr string, api *apiServer) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
+	api.register(mux)
+	serveHTTP(ctx, addr, mux)
+}
+
+// startMetricsServer поднимает /metrics на отдельном адресе: у метрик нет токена,
+// поэтому их нельзя отдавать с открытого наружу сервера API.
+func startMetricsServer(ctx context.Context, addr string, metrics http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics)
+	serveHTTP(ctx, addr, mux)
+}
 
+// serveHTTP слушает addr до отмены ctx.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) {
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+		IdleTimeout:       httpIdleTimeout,
 	}
 
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("health server error: %v", err)
+			slog.Error("http server error", "addr", addr, "error", err)
 		}
 	}()
 
@@ -85,31 +125,63 @@ func startHealthServer(ctx context.Context) {
 		defer cancel()
 
 		if err := server.Shutdown(shutdownCtx); err != nil {
-			log.Printf("health server shutdown error: %v", err)
+			slog.Error("http server shutdown error", "error", err)
 		}
 	}()
 }
 
-func registerTelegramCommands(botAPI *tgbotapi.BotAPI) {
-	commands := []tgbotapi.BotCommand{
-		{Command: "start", Description: "Показать приветствие и список команд"},
-		{Command: "help", Description: "Показать подсказки по использованию"},
-		{Command: "report", Description: "Общий отчет по сну"},
-		{Command: "day", Description: "Сводка сна за день"},
-		{Command: "week", Description: "Сводка сна за 7 дней"},
-		{Command: "month", Description: "Сводка сна за 30 дней"},
-		{Command: "export_csv", Description: "Экспорт завершенных записей сна в CSV"},
-		{Command: "reminders", Description: "Настройки напоминаний"},
-		{Command: "settings", Description: "Настройки профиля"},
-		{Command: "invite", Description: "Создать код приглашения"},
-		{Command: "join", Description: "Присоединиться к семье по коду"},
-		{Command: "server_status", Description: "Проверить состояние сервера"},
-		{Command: "cancel", Description: "Отменить текущее действие"},
-	}
+// telegramMenuCommands — команды в меню Telegram; все они есть в handleCommand и в metricCommands.
+var telegramMenuCommands = []tgbotapi.BotCommand{
+	{Command: "start", Description: "Показать приветствие и список команд"},
+	{Command: "help", Description: "Показать подсказки по использованию"},
+	{Command: "report", Description: "Общий отчет по сну"},
+	{Command: "day", Description: "Сводка сна за день"},
+	{Command: "week", Description: "Сводка сна за 7 дней"},
+	{Command: "month", Description: "Сводка сна за 30 дней"},
+	{Command: "compare", Description: "Сравнить неделю с предыдущей"},
+	{Command: "evaluate", Description: "Оценка сна по возрастным нормам"},
+	{Command: "tags", Description: "Теги и заметка к последнему сну"},
+	{Command: "bytag", Description: "Дневные сны по условиям (тегам)"},
+	{Command: "activities", Description: "Животик, прогулки, игры: таймеры"},
+	{Command: "tummy", Description: "Таймер времени на животе"},
+	{Command: "walk", Description: "Таймер прогулки"},
+	{Command: "play", Description: "Таймер игры"},
+	{Command: "goal", Description: "Дневные цели активностей"},
+	{Command: "pump", Description: "Сцеживание: таймер и запись"},
+	{Command: "pumplog", Description: "Сцеживания по дням"},
+	{Command: "pumpevery", Description: "Напоминание о сцеживании"},
+	{Command: "stash", Description: "Запас сцеженного молока"},
+	{Command: "bottle", Description: "Кормление из бутылочки"},
+	{Command: "apitoken", Description: "Токен HTTP API семьи"},
+	{Command: "calendar", Description: "Ссылка на календарь (.ics)"},
+	{Command: "webhooks", Description: "Вебхуки: события сна на ваш адрес"},
+	{Command: "routine", Description: "Вечерний ритуал: чек-лист"},
+	{Command: "routine_steps", Description: "Шаги вечернего ритуала"},
+	{Command: "routine_report", Description: "Ритуал и засыпание: отчет"},
+	{Command: "growth", Description: "Рост, вес и перцентили ВОЗ"},
+	{Command: "weight", Description: "Записать вес, кг"},
+	{Command: "height", Description: "Записать рост, см"},
+	{Command: "head", Description: "Записать окружность головы, см"},
+	{Command: "temp", Description: "Записать температуру"},
+	{Command: "symptom", Description: "Записать симптомы"},
+	{Command: "sick", Description: "Период болезни: температура и сон"},
+	{Command: "meds", Description: "Лекарства и витамины: отметить дозу"},
+	{Command: "addmed", Description: "Добавить лекарство с расписанием"},
+	{Command: "export_csv", Description: "Экспорт сна и измерений в CSV"},
+	{Command: "pdf_report", Description: "PDF-отчет для педиатра"},
+	{Command: "reminders", Description: "Настройки напоминаний"},
+	{Command: "digest", Description: "Утренняя и недельная сводка"},
+	{Command: "settings", Description: "Настройки профиля"},
+	{Command: "invite", Description: "Создать код приглашения"},
+	{Command: "join", Description: "Присоединиться к семье по коду"},
+	{Command: "server_status", Description: "Проверить состояние сервера"},
+	{Command: "cancel", Description: "Отменить текущее действие"},
+}
 
-	cmd := tgbotapi.NewSetMyCommands(commands...)
+func registerTelegramCommands(botAPI *tgbotapi.BotAPI) {
+	cmd := tgbotapi.NewSetMyCommands(telegramMenuCommands...)
 	if _, err := botAPI.Request(cmd); err != nil {
-		log.Printf("setMyCommands failed: %v", err)
+		slog.Warn("setMyCommands failed", "error", err)
 	}
 }
 
@@ -126,7 +198,7 @@ func logChildAge(db *sql.DB) {
 		LIMIT 1
 	`).Scan(&birthRaw)
 	if err != nil && err != sql.ErrNoRows {
-		log.Printf("failed to load child birth date: %v", err)
+		slog.Warn("failed to load child birth date", "error", err)
 		return
 	}
 	if !birthRaw.Valid {
@@ -135,7 +207,7 @@ func logChildAge(db *sql.DB) {
 
 	birthDate, ok := ParseBirthDateStored(birthRaw.String)
 	if !ok {
-		log.Printf("failed to parse child birth date %q", birthRaw.String)
+		slog.Warn("failed to parse child birth date")
 		return
 	}
 
@@ -147,5 +219,25 @@ func logChildAge(db *sql.DB) {
 	hours := int(age.Hours())
 	days := hours / 24
 
-	log.Printf("child age: %d days (~%d hours) since %s", days, hours, birthDate.Format(time.RFC3339))
+	slog.Debug("child age", "days", days, "hours", hours)
+}
+
+// localHTTPURL — адрес HTTP-сервера бота для запросов с той же машины: `:8080` → `http://127.0.0.1:8080`.
+func localHTTPURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://127.0.0.1:8080"
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// publicBaseURL — адрес HTTP-сервера для ссылок, которые бот показывает в чате.
+func publicBaseURL(cfg Config) string {
+	if cfg.PublicURL != "" {
+		return cfg.PublicURL
+	}
+	return localHTTPURL(cfg.HTTPAddr)
 }
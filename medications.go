@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Доза, данная не раньше чем за medicationEarlyWindow до времени по расписанию, закрывает этот приём:
+// напоминание по нему уже не приходит.
+const medicationEarlyWindow = 2 * time.Hour
+
+var medicationIntervalPattern = regexp.MustCompile(`^(\d+)\s*(ч|час|часа|часов|h|мин|m|min)$`)
+
+// Слова, которые можно писать в расписании для читаемости: `каждые 6 ч`, `не чаще раза в 6 ч`, `в 09:00`.
+var medicationScheduleFiller = map[string]bool{
+	"каждые": true, "каждый": true, "каждое": true, "раз": true, "раза": true, "в": true, "и": true,
+	"не": true, "чаще": true, "ежедневно": true, "every": true, "at": true, "daily": true,
+}
+
+func splitMedicationTimes(atTimes string) []string {
+	var times []string
+	for _, part := range strings.Split(atTimes, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			times = append(times, part)
+		}
+	}
+	return times
+}
+
+// parseMedicationArgs разбирает `Название; доза; расписание`. Расписание — время приёма (`09:00 21:00`)
+// и/или минимальный интервал (`6ч`, `каждые 6 ч`, `90 мин`); без расписания лекарство даётся по необходимости.
+func parseMedicationArgs(args string) (Medication, error) {
+	parts := strings.Split(args, ";")
+	if len(parts) > 3 || strings.TrimSpace(parts[0]) == "" {
+		return Medication{}, fmt.Errorf("нужно название, доза и расписание через `;`")
+	}
+	medication := Medication{Name: strings.TrimSpace(parts[0])}
+	if len(parts) > 1 {
+		medication.Dose = strings.TrimSpace(parts[1])
+	}
+	if len(parts) < 3 {
+		return medication, nil
+	}
+
+	fields := strings.Fields(strings.ToLower(parts[2]))
+	var times []string
+	for i := 0; i < len(fields); i++ {
+		field := strings.TrimSuffix(fields[i], ",")
+		if medicationScheduleFiller[field] {
+			continue
+		}
+		if parsed, err := time.Parse("15:04", field); err == nil {
+			times = append(times, parsed.Format("15:04"))
+			continue
+		}
+		// `6 ч` — число и единица отдельными словами.
+		if i+1 < len(fields) {
+			if _, err := strconv.Atoi(field); err == nil && medicationIntervalPattern.MatchString(field+fields[i+1]) {
+				field += fields[i+1]
+				i++
+			}
+		}
+		match := medicationIntervalPattern.FindStringSubmatch(field)
+		if match == nil {
+			return Medication{}, fmt.Errorf("не понял расписание %q", field)
+		}
+		value, _ := strconv.Atoi(match[1])
+		if strings.HasPrefix(match[2], "м") || strings.HasPrefix(match[2], "m") {
+			medication.MinIntervalMinutes = value
+		} else {
+			medication.MinIntervalMinutes = value * 60
+		}
+		if medication.MinIntervalMinutes <= 0 {
+			return Medication{}, fmt.Errorf("интервал должен быть больше 0")
+		}
+	}
+	sort.Strings(times)
+	medication.AtTimes = strings.Join(times, ",")
+	return medication, nil
+}
+
+func formatMedicationSchedule(medication Medication) string {
+	var parts []string
+	if times := splitMedicationTimes(medication.AtTimes); len(times) > 0 {
+		parts = append(parts, "ежедневно в "+strings.Join(times, ", "))
+	}
+	if medication.MinIntervalMinutes > 0 {
+		parts = append(parts, "не чаще раза в "+formatDurationRU(time.Duration(medication.MinIntervalMinutes)*time.Minute))
+	}
+	if len(parts) == 0 {
+		return "по необходимости"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatMedicationTitle(medication Medication) string {
+	if medication.Dose == "" {
+		return escapeTelegramMarkdown(medication.Name)
+	}
+	return fmt.Sprintf("%s (%s)", escapeTelegramMarkdown(medication.Name), escapeTelegramMarkdown(medication.Dose))
+}
+
+func formatDoseGiver(dose MedicationDose) string {
+	if dose.GivenByName == "" {
+		return ""
+	}
+	return fmt.Sprintf(", %s", escapeTelegramMarkdown(dose.GivenByName))
+}
+
+// medicationDoses отбирает дозы одного лекарства, сохраняя порядок по времени.
+func medicationDoses(doses []MedicationDose, medicationID int64) []MedicationDose {
+	var result []MedicationDose
+	for _, dose := range doses {
+		if dose.MedicationID == medicationID {
+			result = append(result, dose)
+		}
+	}
+	return result
+}
+
+// CheckMedicationDose возвращает предупреждение, если новая доза в at нарушает минимальный интервал
+// или все приёмы по расписанию на сегодня уже отмечены. previous — прежние дозы этого лекарства.
+func CheckMedicationDose(medication Medication, previous []MedicationDose, at time.Time, loc *time.Location) string {
+	if len(previous) == 0 {
+		return ""
+	}
+	last := previous[len(previous)-1]
+	if interval := time.Duration(medication.MinIntervalMinutes) * time.Minute; interval > 0 && at.Sub(last.GivenAt) < interval {
+		return fmt.Sprintf("Внимание: с прошлой дозы (%s%s) прошло %s, а минимальный интервал — %s. Следующую можно было дать не раньше %s.",
+			formatLocalDateTime(last.GivenAt, loc), formatDoseGiver(last), formatDurationRU(at.Sub(last.GivenAt)),
+			formatDurationRU(interval), formatLocalDateTime(last.GivenAt.Add(interval), loc),
+		)
+	}
+	times := splitMedicationTimes(medication.AtTimes)
+	if len(times) == 0 {
+		return ""
+	}
+	dayStart := startOfDay(at, loc)
+	given := 0
+	for _, dose := range previous {
+		if !dose.GivenAt.Before(dayStart) && !dose.GivenAt.After(at) {
+			given++
+		}
+	}
+	if given >= len(times) {
+		return fmt.Sprintf("Внимание: сегодня уже отмечено %d из %d приёмов по расписанию (последний — %s%s).",
+			given, len(times), last.GivenAt.In(loc).Format("15:04"), formatDoseGiver(last),
+		)
+	}
+	return ""
+}
+
+// NextDoseAllowedAt — когда можно дать следующую дозу лекарства «не чаще раза в N» без приёмов по расписанию
+// (например, жаропонижающее): последняя доза плюс минимальный интервал. doses — дозы этого лекарства по времени.
+// Лекарства с расписанием напоминают о приёмах по времени, поэтому для них false.
+func NextDoseAllowedAt(medication Medication, doses []MedicationDose) (time.Time, bool) {
+	if medication.MinIntervalMinutes <= 0 || len(splitMedicationTimes(medication.AtTimes)) > 0 || len(doses) == 0 {
+		return time.Time{}, false
+	}
+	return doses[len(doses)-1].GivenAt.Add(time.Duration(medication.MinIntervalMinutes) * time.Minute), true
+}
+
+// DueMedicationSlots возвращает время приёмов по расписанию, которые наступили (в пределах digestCatchUp)
+// и ещё не закрыты дозой, данной не раньше чем за medicationEarlyWindow до них.
+func DueMedicationSlots(medication Medication, doses []MedicationDose, now time.Time, loc *time.Location) []string {
+	var due []string
+	for _, atTime := range splitMedicationTimes(medication.AtTimes) {
+		if !digestDue(now, atTime, loc) {
+			continue
+		}
+		parsed, _ := time.Parse("15:04", atTime)
+		local := now.In(loc)
+		slot := time.Date(local.Year(), local.Month(), local.Day(), parsed.Hour(), parsed.Minute(), 0, 0, loc)
+		covered := false
+		for _, dose := range doses {
+			if !dose.GivenAt.Before(slot.Add(-medicationEarlyWindow)) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			due = append(due, atTime)
+		}
+	}
+	return due
+}
+
+// BuildMedicationsReport — список лекарств с расписанием и тем, кто и когда давал дозу,
+// чтобы оба родителя видели, дали ли уже лекарство.
+func BuildMedicationsReport(medications []Medication, doses []MedicationDose, now time.Time, loc *time.Location) string {
+	if len(medications) == 0 {
+		return strings.Join([]string{
+			"Лекарств пока нет.",
+			"Добавить: `/addmed Витамин D; 1 капля; 09:00` или `/addmed Нурофен; 2.5 мл; каждые 6 ч`.",
+		}, "\n")
+	}
+
+	dayStart := startOfDay(now, loc)
+	lines := []string{"Лекарства:"}
+	for _, medication := range medications {
+		lines = append(lines, "", fmt.Sprintf("*%d. %s* — %s", medication.ID, formatMedicationTitle(medication), formatMedicationSchedule(medication)))
+		own := medicationDoses(doses, medication.ID)
+
+		var today []string
+		for _, dose := range own {
+			if !dose.GivenAt.Before(dayStart) {
+				today = append(today, dose.GivenAt.In(loc).Format("15:04")+formatDoseGiver(dose))
+			}
+		}
+		switch {
+		case len(today) > 0:
+			lines = append(lines, "Сегодня: "+strings.Join(today, "; "))
+		case len(own) > 0:
+			last := own[len(own)-1]
+			lines = append(lines, fmt.Sprintf("Сегодня не давали. Последняя доза: %s%s", formatLocalDateTime(last.GivenAt, loc), formatDoseGiver(last)))
+		default:
+			lines = append(lines, "Доз пока не было.")
+		}
+
+		if len(own) > 0 && medication.MinIntervalMinutes > 0 {
+			next := own[len(own)-1].GivenAt.Add(time.Duration(medication.MinIntervalMinutes) * time.Minute)
+			if next.After(now) {
+				lines = append(lines, fmt.Sprintf("Следующая доза не раньше %s.", formatLocalDateTime(next, loc)))
+			} else {
+				lines = append(lines, "Интервал прошёл, можно давать.")
+			}
+		}
+	}
+	lines = append(lines, "", "Отметить дозу — кнопкой ниже или `/give 1`. Удалить лекарство — `/delmed 1`.")
+	return strings.Join(lines, "\n")
+}
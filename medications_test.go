@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMedicationArgs(t *testing.T) {
+	medication, err := parseMedicationArgs("Витамин D; 1 капля; в 21:00 и 09:00")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if medication.Name != "Витамин D" || medication.Dose != "1 капля" || medication.AtTimes != "09:00,21:00" || medication.MinIntervalMinutes != 0 {
+		t.Fatalf("unexpected medication: %+v", medication)
+	}
+
+	medication, err = parseMedicationArgs("Нурофен; 2.5 мл; каждые 6 ч")
+	if err != nil || medication.MinIntervalMinutes != 360 || medication.AtTimes != "" {
+		t.Fatalf("interval: %+v %v", medication, err)
+	}
+	if got := formatMedicationSchedule(medication); got != "не чаще раза в 6 ч" {
+		t.Fatalf("unexpected schedule: %q", got)
+	}
+
+	if _, err := parseMedicationArgs("Сироп; 5 мл; иногда"); err == nil {
+		t.Fatal("expected error for unknown schedule")
+	}
+	if _, err := parseMedicationArgs("; 5 мл"); err == nil {
+		t.Fatal("expected error for empty name")
+	}
+}
+
+func TestCheckMedicationDoseWarnsOnShortInterval(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	medication := Medication{ID: 1, Name: "Нурофен", MinIntervalMinutes: 360}
+	previous := []MedicationDose{{MedicationID: 1, GivenAt: time.Date(2026, 3, 16, 10, 0, 0, 0, loc).UTC(), GivenByName: "Папа"}}
+
+	warning := CheckMedicationDose(medication, previous, time.Date(2026, 3, 16, 14, 30, 0, 0, loc), loc)
+	for _, want := range []string{"16.03 10:00, Папа", "прошло 4 ч 30 мин", "не раньше 16.03 16:00"} {
+		if !strings.Contains(warning, want) {
+			t.Fatalf("expected %q in warning: %s", want, warning)
+		}
+	}
+	if warning := CheckMedicationDose(medication, previous, time.Date(2026, 3, 16, 16, 0, 0, 0, loc), loc); warning != "" {
+		t.Fatalf("no warning expected after the interval, got: %s", warning)
+	}
+
+	daily := Medication{ID: 2, Name: "Витамин D", AtTimes: "09:00"}
+	given := []MedicationDose{{MedicationID: 2, GivenAt: time.Date(2026, 3, 16, 9, 5, 0, 0, loc).UTC(), GivenByName: "Мама"}}
+	if warning := CheckMedicationDose(daily, given, time.Date(2026, 3, 16, 9, 30, 0, 0, loc), loc); !strings.Contains(warning, "1 из 1") {
+		t.Fatalf("expected already-given warning, got: %q", warning)
+	}
+	if warning := CheckMedicationDose(daily, given, time.Date(2026, 3, 17, 9, 0, 0, 0, loc), loc); warning != "" {
+		t.Fatalf("next day dose must not warn, got: %s", warning)
+	}
+}
+
+func TestDueMedicationSlotsSkipsGivenDose(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	medication := Medication{ID: 1, Name: "Витамин D", AtTimes: "09:00,21:00"}
+	now := time.Date(2026, 3, 16, 9, 10, 0, 0, loc)
+
+	if due := DueMedicationSlots(medication, nil, now, loc); strings.Join(due, ",") != "09:00" {
+		t.Fatalf("expected 09:00 due, got %v", due)
+	}
+	early := []MedicationDose{{MedicationID: 1, GivenAt: time.Date(2026, 3, 16, 8, 0, 0, 0, loc).UTC()}}
+	if due := DueMedicationSlots(medication, early, now, loc); len(due) != 0 {
+		t.Fatalf("dose at 08:00 covers the 09:00 slot, got %v", due)
+	}
+	yesterday := []MedicationDose{{MedicationID: 1, GivenAt: time.Date(2026, 3, 15, 21, 0, 0, 0, loc).UTC()}}
+	if due := DueMedicationSlots(medication, yesterday, now, loc); len(due) != 1 {
+		t.Fatalf("yesterday's dose must not cover today's slot, got %v", due)
+	}
+}
+
+func TestBuildMedicationsReportShowsWhoGave(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 16, 12, 0, 0, 0, loc)
+	medications := []Medication{
+		{ID: 1, Name: "Витамин D", Dose: "1 капля", AtTimes: "09:00"},
+		{ID: 2, Name: "Нурофен", Dose: "2.5 мл", MinIntervalMinutes: 360},
+	}
+	doses := []MedicationDose{
+		{MedicationID: 1, GivenAt: time.Date(2026, 3, 16, 9, 5, 0, 0, loc).UTC(), GivenByName: "Мама"},
+		{MedicationID: 2, GivenAt: time.Date(2026, 3, 16, 10, 0, 0, 0, loc).UTC(), GivenByName: "Папа"},
+	}
+
+	report := BuildMedicationsReport(medications, doses, now, loc)
+	for _, want := range []string{
+		"*1. Витамин D (1 капля)* — ежедневно в 09:00",
+		"Сегодня: 09:05, Мама",
+		"Сегодня: 10:00, Папа",
+		"Следующая доза не раньше 16.03 16:00.",
+	} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("expected %q in report:\n%s", want, report)
+		}
+	}
+}
+
+func TestNextDoseAllowedAt(t *testing.T) {
+	given := time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC)
+	doses := []MedicationDose{{MedicationID: 1, GivenAt: given.Add(-8 * time.Hour)}, {MedicationID: 1, GivenAt: given}}
+	antipyretic := Medication{ID: 1, Name: "Нурофен", MinIntervalMinutes: 360}
+	if at, ok := NextDoseAllowedAt(antipyretic, doses); !ok || !at.Equal(given.Add(6*time.Hour)) {
+		t.Fatalf("expected next dose at %v, got %v %v", given.Add(6*time.Hour), at, ok)
+	}
+	if _, ok := NextDoseAllowedAt(antipyretic, nil); ok {
+		t.Fatal("no doses — nothing to wait for")
+	}
+	scheduled := Medication{ID: 1, Name: "Витамин D", AtTimes: "09:00", MinIntervalMinutes: 360}
+	if _, ok := NextDoseAllowedAt(scheduled, doses); ok {
+		t.Fatal("scheduled medication is reminded by its times")
+	}
+	if _, ok := NextDoseAllowedAt(Medication{ID: 1, Name: "Крем"}, doses); ok {
+		t.Fatal("medication without an interval has no next dose time")
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// Семья считается активной, если за это время у нее начался сон (или сон идет сейчас).
+	metricsActiveWindow = 7 * 24 * time.Hour
+	// Сколько разных наборов меток хранит одна метрика; остальные попадают в "other",
+	// чтобы неизвестные команды не раздували /metrics.
+	metricsMaxSeries  = 100
+	metricsOtherLabel = "other"
+	// Метка команды, которую бот не знает: имена таких команд выбирает пользователь,
+	// и каждая заняла бы свой набор меток.
+	metricsUnknownCommand = "unknown"
+)
+
+// metricCommands — команды, которые разбирает handleCommand; только они получают свою метку.
+// TestMetricCommandsMatchHandler сверяет список с веткой switch в handleCommand.
+var metricCommands = map[string]bool{
+	"start": true, "help": true, "reset_service": true, "silent_mode": true, "invite": true, "join": true,
+	"status": true, "server_status": true, "report": true, "export_csv": true, "pdf_report": true, "day": true,
+	"week": true, "month": true, "evaluate": true, "digest": true, "compare": true, "weight": true,
+	"height": true, "head": true, "growth": true, "setsex": true, "tags": true, "bytag": true, "tummy": true,
+	"walk": true, "play": true, "activities": true, "goal": true, "pump": true, "pumplog": true,
+	"pumpevery": true, "stash": true, "bottle": true, "apitoken": true, "calendar": true, "webhooks": true,
+	"routine": true, "routine_steps": true, "routine_report": true, "temp": true, "symptom": true, "sick": true,
+	"tempalert": true, "addmed": true, "meds": true, "give": true, "delmed": true, "settings": true,
+	"reminders": true, "setchild": true, "settimezone": true, "setbirthdate": true, "setwake": true,
+	"setmaxsleep": true, "setinactive": true, "reminders_on": true, "reminders_off": true,
+	"milestone_notify": true, "milestone_report": true, "addreminder": true, "deletereminder": true,
+	"editlast": true, "cancel": true,
+}
+
+// Типы уведомлений для sleepbot_notifications_sent_total.
+const (
+	notificationWakeWindow   = "wake_window"
+	notificationMaxSleep     = "max_sleep"
+	notificationInactivity   = "inactivity"
+	notificationCustom       = "custom"
+	notificationMilestone    = "milestone"
+	notificationMedication   = "medication"
+	notificationPumping      = "pumping"
+	notificationDigestDaily  = "digest_daily"
+	notificationDigestWeekly = "digest_weekly"
+	// Изменения, о которых сообщают остальным участникам: температура, лекарство, записи через API.
+	notificationFamily = "family"
+)
+
+// Границы бакетов гистограмм, секунды.
+var (
+	updateDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	reminderTickBuckets   = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+)
+
+// botMetrics — счетчики бота для /metrics. Показатели базы считаются при каждом запросе.
+type botMetrics struct {
+	updates          *counterVec
+	updateDuration   *histogramVec
+	telegramErrors   *counterVec
+	reminderTick     *histogramVec
+	notificationSent *counterVec
+}
+
+func newBotMetrics() *botMetrics {
+	return &botMetrics{
+		updates:          newCounterVec("sleepbot_updates_total", "Обработанные обновления Telegram по командам.", "command", "result"),
+		updateDuration:   newHistogramVec("sleepbot_update_duration_seconds", "Время обработки обновления Telegram.", updateDurationBuckets, "command"),
+		telegramErrors:   newCounterVec("sleepbot_telegram_api_errors_total", "Ошибки запросов к Telegram Bot API.", "method", "code"),
+		reminderTick:     newHistogramVec("sleepbot_reminder_tick_duration_seconds", "Время одного прохода напоминаний.", reminderTickBuckets),
+		notificationSent: newCounterVec("sleepbot_notifications_sent_total", "Отправленные уведомления по типам.", "type"),
+	}
+}
+
+// updateMetricLabel — метка команды для обновления: имя известной команды, "unknown", "text" или "callback".
+func updateMetricLabel(update tgbotapi.Update) string {
+	switch {
+	case update.CallbackQuery != nil:
+		return "callback"
+	case update.Message != nil && update.Message.IsCommand():
+		if command := strings.ToLower(update.Message.Command()); metricCommands[command] {
+			return command
+		}
+		return metricsUnknownCommand
+	default:
+		return "text"
+	}
+}
+
+func (m *botMetrics) observeUpdate(command string, elapsed time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.updates.add(1, command, result)
+	m.updateDuration.observe(elapsed.Seconds(), command)
+}
+
+func (m *botMetrics) observeTelegramError(method string, err error) {
+	code := "network"
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		code = strconv.Itoa(apiErr.Code)
+	}
+	m.telegramErrors.add(1, method, code)
+}
+
+func (m *botMetrics) observeReminderTick(elapsed time.Duration) {
+	m.reminderTick.observe(elapsed.Seconds())
+}
+
+func (m *botMetrics) notificationsSent(kind string, count int) {
+	if count > 0 {
+		m.notificationSent.add(float64(count), kind)
+	}
+}
+
+// handler отдает метрики в текстовом формате Prometheus.
+func (m *botMetrics) handler(store *Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats, err := store.GetStoreStats(r.Context(), time.Now().Add(-metricsActiveWindow))
+		if err != nil {
+			slog.Error("metrics failed", "error", err)
+			http.Error(w, "внутренняя ошибка", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.write(w, stats)
+	})
+}
+
+func (m *botMetrics) write(w io.Writer, stats StoreStats) {
+	writeMetricHeader(w, "sleepbot_build_info", "Версия бота.", "gauge")
+	fmt.Fprintf(w, "sleepbot_build_info%s 1\n", formatMetricLabels([]string{"version", "commit"}, []string{version, commitHash}))
+	m.updates.write(w)
+	m.updateDuration.write(w)
+	m.telegramErrors.write(w)
+	m.reminderTick.write(w)
+	m.notificationSent.write(w)
+	writeMetricHeader(w, "sleepbot_families", "Семьи в базе.", "gauge")
+	fmt.Fprintf(w, "sleepbot_families %d\n", stats.Families)
+	writeMetricHeader(w, "sleepbot_active_families", "Семьи с записями сна за последние 7 дней.", "gauge")
+	fmt.Fprintf(w, "sleepbot_active_families %d\n", stats.ActiveFamilies)
+	writeMetricHeader(w, "sleepbot_db_size_bytes", "Размер базы SQLite.", "gauge")
+	fmt.Fprintf(w, "sleepbot_db_size_bytes %d\n", stats.SizeBytes)
+}
+
+func writeMetricHeader(w io.Writer, name string, help string, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatMetricLabels собирает `{name="value",...}`; extra — дополнительная пара вроде le у бакетов.
+func formatMetricLabels(names []string, values []string, extra ...string) string {
+	var parts []string
+	for i, name := range names {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, name, metricLabelEscaper.Replace(values[i])))
+	}
+	if len(extra) == 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extra[0], extra[1]))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// metricSeries хранит наборы значений меток одной метрики и ограничивает их число metricsMaxSeries.
+type metricSeries struct {
+	labels []string
+	keys   map[string][]string
+}
+
+// key возвращает ключ набора меток; при переполнении — набор из metricsOtherLabel.
+func (s *metricSeries) key(values []string) (string, bool) {
+	if len(values) != len(s.labels) {
+		return "", false
+	}
+	key := strings.Join(values, "\xff")
+	if _, ok := s.keys[key]; !ok {
+		if len(s.keys) >= metricsMaxSeries {
+			values = make([]string, len(s.labels))
+			for i := range values {
+				values[i] = metricsOtherLabel
+			}
+			key = strings.Join(values, "\xff")
+		}
+		s.keys[key] = values
+	}
+	return key, true
+}
+
+func (s *metricSeries) sorted() []string {
+	keys := make([]string, 0, len(s.keys))
+	for key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type counterVec struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	series metricSeries
+	values map[string]float64
+}
+
+func newCounterVec(name string, help string, labels ...string) *counterVec {
+	return &counterVec{
+		name:   name,
+		help:   help,
+		series: metricSeries{labels: labels, keys: map[string][]string{}},
+		values: map[string]float64{},
+	}
+}
+
+func (c *counterVec) add(delta float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.series.key(values); ok {
+		c.values[key] += delta
+	}
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeMetricHeader(w, c.name, c.help, "counter")
+	for _, key := range c.series.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatMetricLabels(c.series.labels, c.series.keys[key]), formatMetricValue(c.values[key]))
+	}
+}
+
+type histogramData struct {
+	counts []uint64 // по бакетам, не накопительно
+	sum    float64
+	count  uint64
+}
+
+type histogramVec struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	buckets []float64
+	series  metricSeries
+	values  map[string]*histogramData
+}
+
+func newHistogramVec(name string, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		series:  metricSeries{labels: labels, keys: map[string][]string{}},
+		values:  map[string]*histogramData{},
+	}
+}
+
+func (h *histogramVec) observe(value float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key, ok := h.series.key(values)
+	if !ok {
+		return
+	}
+	data := h.values[key]
+	if data == nil {
+		data = &histogramData{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = data
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		data.counts[i]++
+	}
+	data.sum += value
+	data.count++
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeMetricHeader(w, h.name, h.help, "histogram")
+	for _, key := range h.series.sorted() {
+		labels, data := h.series.keys[key], h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += data.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatMetricLabels(h.series.labels, labels, "le", formatMetricValue(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatMetricLabels(h.series.labels, labels, "le", "+Inf"), data.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatMetricLabels(h.series.labels, labels), formatMetricValue(data.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatMetricLabels(h.series.labels, labels), data.count)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestBotMetricsWrite(t *testing.T) {
+	m := newBotMetrics()
+	m.observeUpdate("start", 20*time.Millisecond, nil)
+	m.observeUpdate("start", 3*time.Second, errors.New("boom"))
+	m.observeTelegramError("send", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"})
+	m.observeTelegramError("send", errors.New("connection reset"))
+	m.observeReminderTick(150 * time.Millisecond)
+	m.notificationsSent(notificationWakeWindow, 2)
+	m.notificationsSent(notificationCustom, 0)
+
+	var b strings.Builder
+	m.write(&b, StoreStats{Families: 3, ActiveFamilies: 2, SizeBytes: 8192})
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE sleepbot_updates_total counter\n",
+		`sleepbot_updates_total{command="start",result="error"} 1` + "\n",
+		`sleepbot_updates_total{command="start",result="ok"} 1` + "\n",
+		`sleepbot_update_duration_seconds_bucket{command="start",le="0.025"} 1` + "\n",
+		`sleepbot_update_duration_seconds_bucket{command="start",le="5"} 2` + "\n",
+		`sleepbot_update_duration_seconds_bucket{command="start",le="+Inf"} 2` + "\n",
+		`sleepbot_update_duration_seconds_sum{command="start"} 3.02` + "\n",
+		`sleepbot_update_duration_seconds_count{command="start"} 2` + "\n",
+		`sleepbot_telegram_api_errors_total{method="send",code="403"} 1` + "\n",
+		`sleepbot_telegram_api_errors_total{method="send",code="network"} 1` + "\n",
+		`sleepbot_reminder_tick_duration_seconds_bucket{le="0.1"} 0` + "\n",
+		`sleepbot_reminder_tick_duration_seconds_bucket{le="0.25"} 1` + "\n",
+		`sleepbot_notifications_sent_total{type="wake_window"} 2` + "\n",
+		"sleepbot_families 3\n",
+		"sleepbot_active_families 2\n",
+		"sleepbot_db_size_bytes 8192\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in metrics:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `type="custom"`) {
+		t.Fatalf("zero notifications should not create a series:\n%s", out)
+	}
+}
+
+func TestCounterVecLimitsSeries(t *testing.T) {
+	c := newCounterVec("test_total", "test", "command")
+	for i := 0; i < metricsMaxSeries+5; i++ {
+		c.add(1, fmt.Sprintf("cmd%d", i))
+	}
+	c.add(1, `a"b\c`)
+
+	var b strings.Builder
+	c.write(&b)
+	lines := strings.Count(b.String(), "\ntest_total{")
+	if lines != metricsMaxSeries+1 {
+		t.Fatalf("expected %d series, got %d", metricsMaxSeries+1, lines)
+	}
+	if !strings.Contains(b.String(), `test_total{command="other"} 6`) {
+		t.Fatalf("overflow should go to other:\n%s", b.String())
+	}
+}
+
+func TestFormatMetricLabelsEscapes(t *testing.T) {
+	got := formatMetricLabels([]string{"command"}, []string{"a\"b\\c\nd"}, "le", "+Inf")
+	if want := `{command="a\"b\\c\nd",le="+Inf"}`; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	if got := formatMetricLabels(nil, nil); got != "" {
+		t.Fatalf("expected no braces without labels, got %q", got)
+	}
+}
+
+func TestUpdateMetricLabelBoundsCommands(t *testing.T) {
+	command := func(text string) tgbotapi.Update {
+		return tgbotapi.Update{Message: &tgbotapi.Message{
+			Text:     text,
+			Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(strings.Fields(text)[0])}},
+		}}
+	}
+	cases := map[string]tgbotapi.Update{
+		"week":     command("/Week"),
+		"unknown":  command("/no_such_command_42"),
+		"text":     {Message: &tgbotapi.Message{Text: "привет"}},
+		"callback": {CallbackQuery: &tgbotapi.CallbackQuery{}},
+	}
+	for want, update := range cases {
+		if got := updateMetricLabel(update); got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+}
+
+// handledCommands собирает команды из case в switch command функции handleCommand (bot.go).
+func handledCommands(t *testing.T) map[string]bool {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "bot.go", nil, 0)
+	if err != nil {
+		t.Fatalf("parse bot.go: %v", err)
+	}
+	commands := map[string]bool{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "handleCommand" {
+			continue
+		}
+		ast.Inspect(fn.Body, func(node ast.Node) bool {
+			sw, ok := node.(*ast.SwitchStmt)
+			if !ok {
+				return true
+			}
+			if tag, ok := sw.Tag.(*ast.Ident); !ok || tag.Name != "command" {
+				return true
+			}
+			for _, stmt := range sw.Body.List {
+				for _, expr := range stmt.(*ast.CaseClause).List {
+					if lit, ok := expr.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						name, _ := strconv.Unquote(lit.Value)
+						commands[name] = true
+					}
+				}
+			}
+			return false
+		})
+	}
+	if len(commands) == 0 {
+		t.Fatal("switch command not found in handleCommand")
+	}
+	return commands
+}
+
+func TestMetricCommandsMatchHandler(t *testing.T) {
+	handled := handledCommands(t)
+	var missing, extra []string
+	for command := range handled {
+		if !metricCommands[command] {
+			missing = append(missing, command)
+		}
+	}
+	for command := range metricCommands {
+		if !handled[command] {
+			extra = append(extra, command)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	if len(missing) > 0 || len(extra) > 0 {
+		t.Fatalf("metricCommands differs from handleCommand: missing %v, not handled %v", missing, extra)
+	}
+	for _, command := range telegramMenuCommands {
+		if !metricCommands[command.Command] {
+			t.Fatalf("menu command %q is not in metricCommands", command.Command)
+		}
+	}
+}
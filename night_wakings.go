@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NightSummary — ночь, закончившаяся утром дня Date: окно [накануне dayWindowEndHour, Date dayWindowStartHour).
+// Пробуждение — промежуток между двумя последовательными снами внутри этого окна.
+// FirstSleepAt/LastWakeAt — настоящие (не обрезанные окном) начало первого и конец последнего ночного сна.
+type NightSummary struct {
+	Date           time.Time
+	SleepCount     int
+	TotalSleep     time.Duration
+	Wakings        int
+	AwakeTime      time.Duration
+	LongestStretch time.Duration
+	LongestWaking  time.Duration
+	FirstSleepAt   time.Time
+	LastWakeAt     time.Time
+}
+
+// NightTrend — средние показатели ночей за период; учитываются только ночи с записями сна.
+type NightTrend struct {
+	Nights         int
+	Wakings        int
+	AverageWakings float64
+	AverageAwake   time.Duration
+	AverageLongest time.Duration
+}
+
+// nightWindow возвращает окно ночи, которая заканчивается утром календарного дня day.
+func nightWindow(day time.Time, loc *time.Location) (time.Time, time.Time) {
+	d := startOfDay(day, loc)
+	start := time.Date(d.Year(), d.Month(), d.Day()-1, dayWindowEndHour, 0, 0, 0, loc)
+	end := time.Date(d.Year(), d.Month(), d.Day(), dayWindowStartHour, 0, 0, 0, loc)
+	return start, end
+}
+
+// SummarizeNight считает пробуждения за ночь, закончившуюся утром дня day.
+// Сны обрезаются по границам ночного окна.
+func SummarizeNight(sessions []SleepSession, day time.Time, loc *time.Location) NightSummary {
+	windowStart, windowEnd := nightWindow(day, loc)
+	summary := NightSummary{Date: startOfDay(day, loc)}
+
+	type interval struct {
+		start    time.Time
+		end      time.Time
+		original SleepSession
+	}
+	var clipped []interval
+	for _, session := range sessions {
+		if session.EndAt == nil {
+			continue
+		}
+		start := maxTime(session.StartAt, windowStart)
+		end := minTime(*session.EndAt, windowEnd)
+		if !end.After(start) {
+			continue
+		}
+		clipped = append(clipped, interval{start: start, end: end, original: session})
+	}
+	if len(clipped) == 0 {
+		return summary
+	}
+	sort.Slice(clipped, func(i, j int) bool {
+		return clipped[i].start.Before(clipped[j].start)
+	})
+
+	summary.SleepCount = len(clipped)
+	summary.FirstSleepAt = clipped[0].original.StartAt.In(loc)
+	summary.LastWakeAt = clipped[len(clipped)-1].original.EndAt.In(loc)
+	for i, item := range clipped {
+		stretch := item.end.Sub(item.start)
+		summary.TotalSleep += stretch
+		if stretch > summary.LongestStretch {
+			summary.LongestStretch = stretch
+		}
+		if i == 0 {
+			continue
+		}
+		gap := item.start.Sub(clipped[i-1].end)
+		if gap <= 0 {
+			continue
+		}
+		summary.Wakings++
+		summary.AwakeTime += gap
+		if gap > summary.LongestWaking {
+			summary.LongestWaking = gap
+		}
+	}
+	return summary
+}
+
+// SummarizeNights возвращает ночи за days календарных дней, заканчивающихся днём end (по возрастанию дат).
+func SummarizeNights(sessions []SleepSession, end time.Time, days int, loc *time.Location) []NightSummary {
+	if days < 1 {
+		days = 1
+	}
+	endDay := startOfDay(end, loc)
+	nights := make([]NightSummary, 0, days)
+	for day := endDay.AddDate(0, 0, -(days - 1)); !day.After(endDay); day = day.AddDate(0, 0, 1) {
+		nights = append(nights, SummarizeNight(sessions, day, loc))
+	}
+	return nights
+}
+
+// AverageNights усредняет ночи, в которых был хотя бы один сон.
+func AverageNights(nights []NightSummary) NightTrend {
+	var (
+		trend   NightTrend
+		awake   time.Duration
+		longest time.Duration
+	)
+	for _, night := range nights {
+		if night.SleepCount == 0 {
+			continue
+		}
+		trend.Nights++
+		trend.Wakings += night.Wakings
+		awake += night.AwakeTime
+		longest += night.LongestStretch
+	}
+	if trend.Nights == 0 {
+		return trend
+	}
+	trend.AverageWakings = float64(trend.Wakings) / float64(trend.Nights)
+	trend.AverageAwake = awake / time.Duration(trend.Nights)
+	trend.AverageLongest = longest / time.Duration(trend.Nights)
+	return trend
+}
+
+func formatNightSummary(night NightSummary) string {
+	label := fmt.Sprintf("Ночь на %s", night.Date.Format("02.01"))
+	if night.SleepCount == 0 {
+		return fmt.Sprintf("%s: записей о ночном сне нет.", label)
+	}
+	if night.Wakings == 0 {
+		return fmt.Sprintf("%s: без пробуждений, сон %s (%s–%s).",
+			label, formatDurationRU(night.TotalSleep),
+			night.FirstSleepAt.Format("15:04"), night.LastWakeAt.Format("15:04"),
+		)
+	}
+	return fmt.Sprintf("%s: %d %s, бодрствование %s (самое долгое %s), самый длинный сон %s.",
+		label, night.Wakings, ruPlural(night.Wakings, "пробуждение", "пробуждения", "пробуждений"),
+		formatDurationRU(night.AwakeTime), formatDurationRU(night.LongestWaking),
+		formatDurationRU(night.LongestStretch),
+	)
+}
+
+func formatNightTrendLine(label string, trend NightTrend) string {
+	if trend.Nights == 0 {
+		return fmt.Sprintf("%s: нет данных.", label)
+	}
+	return fmt.Sprintf("%s: %.1f проб./ночь, бодрствование %s, самый длинный сон %s.",
+		label, trend.AverageWakings, formatDurationRU(trend.AverageAwake), formatDurationRU(trend.AverageLongest),
+	)
+}
+
+// BuildNightTrendSection — блок про ночные пробуждения для /week и /month:
+// среднее за период, затем по ночам (до 7 дней) или по неделям (для длинных периодов).
+func BuildNightTrendSection(nights []NightSummary) string {
+	overall := AverageNights(nights)
+	if overall.Nights == 0 {
+		return "Ночные пробуждения: записей о ночном сне за период нет."
+	}
+
+	lines := []string{
+		fmt.Sprintf("Ночные пробуждения (ночь — %02d:00–%02d:00):", dayWindowEndHour, dayWindowStartHour),
+		formatNightTrendLine(fmt.Sprintf("В среднем за %d %s", overall.Nights, ruPlural(overall.Nights, "ночь", "ночи", "ночей")), overall),
+	}
+
+	if len(nights) <= 7 {
+		for _, night := range nights {
+			if night.SleepCount == 0 {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s — %d проб., бодрствование %s, самый длинный сон %s",
+				night.Date.Format("02.01"), night.Wakings,
+				formatDurationRU(night.AwakeTime), formatDurationRU(night.LongestStretch),
+			))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	// Длинный период: группируем с конца по 7 ночей, чтобы последняя неделя всегда была полной.
+	var weeks [][]NightSummary
+	for end := len(nights); end > 0; end -= 7 {
+		start := end - 7
+		if start < 0 {
+			start = 0
+		}
+		weeks = append([][]NightSummary{nights[start:end]}, weeks...)
+	}
+	for _, week := range weeks {
+		label := fmt.Sprintf("%s–%s", week[0].Date.Format("02.01"), week[len(week)-1].Date.Format("02.01"))
+		lines = append(lines, formatNightTrendLine(label, AverageNights(week)))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizeNightCountsWakingsBetweenSessions(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	day := time.Date(2026, 3, 16, 12, 0, 0, 0, loc)
+
+	makeSession := func(startDay, startHour, startMinute, endDay, endHour, endMinute int) SleepSession {
+		start := time.Date(2026, 3, startDay, startHour, startMinute, 0, 0, loc).UTC()
+		end := time.Date(2026, 3, endDay, endHour, endMinute, 0, 0, loc).UTC()
+		return SleepSession{StartAt: start, EndAt: &end}
+	}
+
+	sessions := []SleepSession{
+		makeSession(15, 23, 30, 16, 3, 0),
+		makeSession(15, 20, 0, 15, 23, 0),
+		makeSession(16, 3, 20, 16, 6, 30),
+		// Дневной сон в ночь не попадает.
+		makeSession(16, 10, 0, 16, 11, 0),
+	}
+
+	night := SummarizeNight(sessions, day, loc)
+	if night.SleepCount != 3 {
+		t.Fatalf("expected 3 night sleeps, got %d", night.SleepCount)
+	}
+	if night.Wakings != 2 {
+		t.Fatalf("expected 2 wakings, got %d", night.Wakings)
+	}
+	if night.AwakeTime != 50*time.Minute {
+		t.Fatalf("expected 50 minutes awake, got %s", night.AwakeTime)
+	}
+	if night.LongestWaking != 30*time.Minute {
+		t.Fatalf("expected longest waking 30 minutes, got %s", night.LongestWaking)
+	}
+	if night.LongestStretch != 3*time.Hour+30*time.Minute {
+		t.Fatalf("expected longest stretch 3h30m, got %s", night.LongestStretch)
+	}
+	if got := night.FirstSleepAt.Format("15:04"); got != "20:00" {
+		t.Fatalf("expected first sleep at 20:00, got %s", got)
+	}
+	if got := night.LastWakeAt.Format("15:04"); got != "06:30" {
+		t.Fatalf("expected last wake at 06:30, got %s", got)
+	}
+}
+
+func TestSummarizeNightClipsSessionsToWindow(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	day := time.Date(2026, 3, 16, 0, 0, 0, 0, loc)
+	start := time.Date(2026, 3, 15, 18, 0, 0, 0, loc).UTC()
+	end := time.Date(2026, 3, 16, 8, 0, 0, 0, loc).UTC()
+
+	night := SummarizeNight([]SleepSession{{StartAt: start, EndAt: &end}}, day, loc)
+	if night.Wakings != 0 {
+		t.Fatalf("expected no wakings, got %d", night.Wakings)
+	}
+	if night.TotalSleep != 12*time.Hour {
+		t.Fatalf("expected sleep clipped to 12h window, got %s", night.TotalSleep)
+	}
+	if got := night.FirstSleepAt.Format("15:04"); got != "18:00" {
+		t.Fatalf("expected real bedtime 18:00, got %s", got)
+	}
+	if got := night.LastWakeAt.Format("15:04"); got != "08:00" {
+		t.Fatalf("expected real wake-up 08:00, got %s", got)
+	}
+}
+
+func TestBuildNightTrendSectionGroupsLongRangesByWeek(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	end := time.Date(2026, 3, 30, 12, 0, 0, 0, loc)
+
+	var sessions []SleepSession
+	for offset := 0; offset < 30; offset++ {
+		d := end.AddDate(0, 0, -offset)
+		firstStart := time.Date(d.Year(), d.Month(), d.Day()-1, 21, 0, 0, 0, loc).UTC()
+		firstEnd := firstStart.Add(4 * time.Hour)
+		secondStart := firstEnd.Add(20 * time.Minute)
+		secondEnd := secondStart.Add(4 * time.Hour)
+		sessions = append(sessions,
+			SleepSession{StartAt: firstStart, EndAt: &firstEnd},
+			SleepSession{StartAt: secondStart, EndAt: &secondEnd},
+		)
+	}
+
+	section := BuildNightTrendSection(SummarizeNights(sessions, end, 30, loc))
+	if !strings.Contains(section, "В среднем за 30 ночей: 1.0 проб./ночь, бодрствование 20 мин") {
+		t.Fatalf("unexpected average line: %s", section)
+	}
+	if !strings.Contains(section, "24.03–30.03") {
+		t.Fatalf("expected the last full week to be grouped, got %s", section)
+	}
+	if !strings.Contains(section, "01.03–02.03") {
+		t.Fatalf("expected leftover nights at the start, got %s", section)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+)
+
+// Таблицы норм сна лежат в sleep_norms.json и встраиваются в бинарник: чтобы поправить
+// диапазоны или добавить систему, достаточно отредактировать JSON.
+//
+//go:embed sleep_norms.json
+var sleepNormsJSON []byte
+
+// SleepNorm — норма для возрастной группы [MinMonths, MaxMonths): часы сна и число дневных снов.
+type SleepNorm struct {
+	Label     string  `json:"label"`
+	MinMonths float64 `json:"min_months"`
+	MaxMonths float64 `json:"max_months"`
+	TotalMin  float64 `json:"total_min"`
+	TotalMax  float64 `json:"total_max"`
+	DayMin    float64 `json:"day_min"`
+	DayMax    float64 `json:"day_max"`
+	NightMin  float64 `json:"night_min"`
+	NightMax  float64 `json:"night_max"`
+	NapsMin   int     `json:"naps_min"`
+	NapsMax   int     `json:"naps_max"`
+}
+
+// NormSystem — одна система норм; группы идут подряд от 0 до максимального возраста.
+type NormSystem struct {
+	ID    string      `json:"id"`
+	Title string      `json:"title"`
+	Bands []SleepNorm `json:"bands"`
+}
+
+type normTables struct {
+	MaxAgeMonths float64      `json:"max_age_months"`
+	Systems      []NormSystem `json:"systems"`
+}
+
+var sleepNorms = mustParseNormTables(sleepNormsJSON)
+
+func mustParseNormTables(raw []byte) normTables {
+	tables, err := parseNormTables(raw)
+	if err != nil {
+		panic(err)
+	}
+	return tables
+}
+
+// parseNormTables разбирает и проверяет таблицы: у каждой системы группы без пропусков
+// и перекрытий покрывают возраст от 0 до max_age_months.
+func parseNormTables(raw []byte) (normTables, error) {
+	var tables normTables
+	if err := json.Unmarshal(raw, &tables); err != nil {
+		return normTables{}, fmt.Errorf("parse sleep norms: %w", err)
+	}
+	if tables.MaxAgeMonths <= 0 || len(tables.Systems) == 0 {
+		return normTables{}, fmt.Errorf("sleep norms: empty tables")
+	}
+	for _, system := range tables.Systems {
+		if system.ID == "" || len(system.Bands) == 0 {
+			return normTables{}, fmt.Errorf("sleep norms: system %q has no bands", system.ID)
+		}
+		covered := 0.0
+		for _, band := range system.Bands {
+			if band.MinMonths != covered || band.MaxMonths <= band.MinMonths {
+				return normTables{}, fmt.Errorf("sleep norms: system %s band %s must start at %.0f months", system.ID, band.Label, covered)
+			}
+			if band.TotalMin > band.TotalMax || band.DayMin > band.DayMax || band.NightMin > band.NightMax || band.NapsMin > band.NapsMax {
+				return normTables{}, fmt.Errorf("sleep norms: system %s band %s has min above max", system.ID, band.Label)
+			}
+			covered = band.MaxMonths
+		}
+		if covered != tables.MaxAgeMonths {
+			return normTables{}, fmt.Errorf("sleep norms: system %s ends at %.0f months, want %.0f", system.ID, covered, tables.MaxAgeMonths)
+		}
+	}
+	return tables, nil
+}
+
+// BandFor возвращает возрастную группу; последняя группа включает верхнюю границу.
+func (s NormSystem) BandFor(ageMonths float64) (SleepNorm, bool) {
+	for i, band := range s.Bands {
+		last := i == len(s.Bands)-1
+		if ageMonths >= band.MinMonths && (ageMonths < band.MaxMonths || (last && ageMonths == band.MaxMonths)) {
+			return band, true
+		}
+	}
+	return SleepNorm{}, false
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmbeddedSleepNormsCoverThreeYears(t *testing.T) {
+	if sleepNorms.MaxAgeMonths != 36 {
+		t.Fatalf("expected norms through 36 months, got %.0f", sleepNorms.MaxAgeMonths)
+	}
+	ids := make([]string, 0, len(sleepNorms.Systems))
+	for _, system := range sleepNorms.Systems {
+		ids = append(ids, system.ID)
+	}
+	if strings.Join(ids, ",") != "A,B,C" {
+		t.Fatalf("unexpected systems: %v", ids)
+	}
+}
+
+func TestNormBandBoundaries(t *testing.T) {
+	for _, system := range sleepNorms.Systems {
+		for i, band := range system.Bands {
+			if got, ok := system.BandFor(band.MinMonths); !ok || got.Label != band.Label {
+				t.Fatalf("system %s: age %.0f should start band %s, got %q", system.ID, band.MinMonths, band.Label, got.Label)
+			}
+			if got, ok := system.BandFor(band.MaxMonths - 0.01); !ok || got.Label != band.Label {
+				t.Fatalf("system %s: age just below %.0f should stay in band %s, got %q", system.ID, band.MaxMonths, band.Label, got.Label)
+			}
+			if i == len(system.Bands)-1 {
+				if got, ok := system.BandFor(band.MaxMonths); !ok || got.Label != band.Label {
+					t.Fatalf("system %s: last band must include %.0f months, got %q", system.ID, band.MaxMonths, got.Label)
+				}
+				if _, ok := system.BandFor(band.MaxMonths + 0.01); ok {
+					t.Fatalf("system %s: age above %.0f months must not match", system.ID, band.MaxMonths)
+				}
+				continue
+			}
+			next := system.Bands[i+1]
+			if got, _ := system.BandFor(band.MaxMonths); got.Label != next.Label {
+				t.Fatalf("system %s: age %.0f should move to band %s, got %q", system.ID, band.MaxMonths, next.Label, got.Label)
+			}
+		}
+	}
+}
+
+func TestParseNormTablesRejectsGaps(t *testing.T) {
+	raw := []byte(`{"max_age_months": 12, "systems": [{"id": "X", "title": "X", "bands": [
+		{"label": "0-3", "min_months": 0, "max_months": 3},
+		{"label": "6-12", "min_months": 6, "max_months": 12}
+	]}]}`)
+	if _, err := parseNormTables(raw); err == nil {
+		t.Fatal("expected error for a gap between bands")
+	}
+}
+
+func TestBuildNormsReportForToddler(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 16, 20, 0, 0, 0, loc)
+	birth := now.AddDate(-2, -1, 0)
+	child := Child{Name: "Малыш", BirthDate: &birth}
+
+	napStart := time.Date(2026, 3, 16, 13, 0, 0, 0, loc).UTC()
+	napEnd := napStart.Add(2 * time.Hour)
+	nightStart := time.Date(2026, 3, 15, 20, 30, 0, 0, loc).UTC()
+	nightEnd := time.Date(2026, 3, 16, 7, 0, 0, 0, loc).UTC()
+	sessions := []SleepSession{
+		{StartAt: nightStart, EndAt: &nightEnd},
+		{StartAt: napStart, EndAt: &napEnd},
+	}
+
+	report := BuildNormsReport(child, sessions, loc, now)
+	for _, want := range []string{
+		"в среднем по 3 системам",
+		"(возрастная группа 24-36 мес.)",
+		"дневных снов 0–1.",
+		"дневных снов 1.",
+	} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("expected %q in report:\n%s", want, report)
+		}
+	}
+
+	older := now.AddDate(-4, 0, 0)
+	child.BirthDate = &older
+	if report := BuildNormsReport(child, sessions, loc, now); !strings.Contains(report, "до 3 лет") {
+		t.Fatalf("expected age limit message, got: %s", report)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Окна оценки по нормам: 1 — последние 24 часа, остальные — средние за полные календарные дни до вчера.
+const normsDefaultWindowDays = 3
+
+var normsWindowDays = []int{1, 3, 7, 14}
+
+// NormsDayEvaluation — оценка одного дня окна; Results пуст, если за день нет записей.
+type NormsDayEvaluation struct {
+	Summary DayNightSummary
+	Results []NormSystemResult
+}
+
+// NormTrend — отклонение одного показателя в одну сторону, повторившееся в большинстве дней окна.
+type NormTrend struct {
+	Metric string
+	Above  bool
+	Days   int
+	Of     int
+}
+
+func isNormsWindow(days int) bool {
+	for _, allowed := range normsWindowDays {
+		if days == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// EvaluateNormsByDay оценивает каждый из days полных дней, заканчивающихся вчера (по таймзоне loc).
+// Сутки дня — ночь перед ним и дневное окно, как в SummarizeDayNight.
+func EvaluateNormsByDay(child Child, sessions []SleepSession, now time.Time, days int, loc *time.Location) []NormsDayEvaluation {
+	end := startOfDay(now, loc).AddDate(0, 0, -1)
+	evaluations := make([]NormsDayEvaluation, 0, days)
+	for day := end.AddDate(0, 0, -(days - 1)); !day.After(end); day = day.AddDate(0, 0, 1) {
+		evaluation := NormsDayEvaluation{Summary: SummarizeDayNight(sessions, day, loc)}
+		ageMonths, ok := childAgeMonths(child, day.Add(12*time.Hour))
+		if ok && evaluation.Summary.Total() > 0 {
+			evaluation.Results = evaluateAllSystems(ageMonths,
+				evaluation.Summary.DaySleep.Hours(), evaluation.Summary.Night.TotalSleep.Hours(), evaluation.Summary.NapCount,
+			)
+		}
+		evaluations = append(evaluations, evaluation)
+	}
+	return evaluations
+}
+
+// DetectNormTrends ищет устойчивые отклонения: показатель вне нормы в одну сторону
+// хотя бы в двух днях и не меньше чем в двух третях дней с записями.
+// За направление дня берётся среднее отклонение по системам (для дневных снов — большинство систем).
+func DetectNormTrends(evaluations []NormsDayEvaluation) []NormTrend {
+	metrics := []string{"total", "day", "night", "naps"}
+	below := map[string]int{}
+	above := map[string]int{}
+	withData := 0
+	for _, evaluation := range evaluations {
+		if len(evaluation.Results) == 0 {
+			continue
+		}
+		withData++
+		var total, day, night float64
+		napsBelow, napsAbove := 0, 0
+		for _, res := range evaluation.Results {
+			total += res.Delta.TotalPercent
+			day += res.Delta.DayPercent
+			night += res.Delta.NightPercent
+			if res.Actual.Naps < res.Norm.NapsMin {
+				napsBelow++
+			}
+			if res.Actual.Naps > res.Norm.NapsMax {
+				napsAbove++
+			}
+		}
+		count := func(metric string, value float64) {
+			if value < 0 {
+				below[metric]++
+			} else if value > 0 {
+				above[metric]++
+			}
+		}
+		count("total", total)
+		count("day", day)
+		count("night", night)
+		if systems := len(evaluation.Results); napsBelow*2 > systems {
+			below["naps"]++
+		} else if napsAbove*2 > systems {
+			above["naps"]++
+		}
+	}
+
+	persistent := func(days int) bool {
+		return days >= 2 && days*3 >= withData*2
+	}
+	var trends []NormTrend
+	for _, metric := range metrics {
+		if persistent(below[metric]) {
+			trends = append(trends, NormTrend{Metric: metric, Days: below[metric], Of: withData})
+		}
+		if persistent(above[metric]) {
+			trends = append(trends, NormTrend{Metric: metric, Above: true, Days: above[metric], Of: withData})
+		}
+	}
+	return trends
+}
+
+// BuildNormsWindowReport — оценка по нормам за days дней: средние значения по системам,
+// разбивка по дням и устойчивые тенденции. Для days <= 1 — прежняя оценка за 24 часа.
+func BuildNormsWindowReport(child Child, sessions []SleepSession, loc *time.Location, now time.Time, days int) string {
+	if days <= 1 {
+		return BuildNormsReport(child, sessions, loc, now)
+	}
+	ageMonths, problem := normsChildAge(child, now, loc)
+	if problem != "" {
+		return problem
+	}
+
+	evaluations := EvaluateNormsByDay(child, sessions, now, days, loc)
+	first := evaluations[0].Summary.Date
+	last := evaluations[len(evaluations)-1].Summary.Date
+	period := fmt.Sprintf("%d дн. (%s–%s)", days, first.Format("02.01"), last.Format("02.01"))
+
+	var (
+		withData   int
+		dayHours   float64
+		nightHours float64
+		naps       int
+	)
+	for _, evaluation := range evaluations {
+		if len(evaluation.Results) == 0 {
+			continue
+		}
+		withData++
+		dayHours += evaluation.Summary.DaySleep.Hours()
+		nightHours += evaluation.Summary.Night.TotalSleep.Hours()
+		naps += evaluation.Summary.NapCount
+	}
+	if withData == 0 {
+		return fmt.Sprintf("За %s нет сохраненных снов, поэтому оценка относительно норм пока недоступна.", period)
+	}
+
+	averageNaps := int(math.Round(float64(naps) / float64(withData)))
+	results := evaluateAllSystems(ageMonths, dayHours/float64(withData), nightHours/float64(withData), averageNaps)
+	if len(results) == 0 {
+		return "Для этого возраста нет подходящих норм сна."
+	}
+	avgScore := averageScore(results)
+
+	lines := []string{
+		fmt.Sprintf("Оценка сна %s за %s, в среднем за сутки:", escapeTelegramMarkdown(child.Name), period),
+		fmt.Sprintf("*Сводка:* в среднем по %d системам — _%s_ (среднее отклонение %.1f%%). Дней с записями: %d из %d.",
+			len(results), categoryByScore(avgScore), avgScore, withData, days,
+		),
+		"",
+		"*Тенденции:*",
+	}
+	trends := DetectNormTrends(evaluations)
+	if len(trends) == 0 {
+		lines = append(lines, "Устойчивых отклонений нет.")
+	}
+	for _, trend := range trends {
+		lines = append(lines, formatNormTrend(trend))
+	}
+
+	lines = append(lines, "", "*По дням* (отклонение по системам):")
+	for _, evaluation := range evaluations {
+		lines = append(lines, formatNormsDayLine(evaluation))
+	}
+
+	for _, res := range results {
+		lines = append(lines, "", formatSystemBlock(res))
+	}
+	lines = append(lines, "", normsDisclaimer)
+	return strings.Join(lines, "\n")
+}
+
+func formatNormTrend(trend NormTrend) string {
+	labels := map[string]string{
+		"total": "Общий сон",
+		"day":   "Дневной сон",
+		"night": "Ночной сон",
+	}
+	direction := "ниже нормы"
+	if trend.Above {
+		direction = "выше нормы"
+	}
+	label, ok := labels[trend.Metric]
+	if !ok {
+		label = "Дневных снов"
+		direction = "меньше нормы"
+		if trend.Above {
+			direction = "больше нормы"
+		}
+	}
+	return fmt.Sprintf("%s %s %d из %d дн.", label, direction, trend.Days, trend.Of)
+}
+
+func formatNormsDayLine(evaluation NormsDayEvaluation) string {
+	summary := evaluation.Summary
+	date := summary.Date.Format("02.01")
+	if len(evaluation.Results) == 0 {
+		return fmt.Sprintf("%s — нет записей", date)
+	}
+	scores := make([]string, 0, len(evaluation.Results))
+	for _, res := range evaluation.Results {
+		scores = append(scores, fmt.Sprintf("%s %.1f%%", res.SystemID, res.Delta.Score))
+	}
+	return fmt.Sprintf("%s — всего %.1f ч (день %.1f, ночь %.1f), снов днём %d: %s — %s",
+		date, summary.Total().Hours(), summary.DaySleep.Hours(), summary.Night.TotalSleep.Hours(), summary.NapCount,
+		strings.Join(scores, ", "), categoryByScore(averageScore(evaluation.Results)),
+	)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildNormsWindowReportFlagsPersistentTrends(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 16, 12, 0, 0, 0, loc)
+	birth := now.AddDate(0, -8, 0)
+	child := Child{Name: "Малыш", BirthDate: &birth}
+
+	// 6 из 7 дней: короткая ночь (22:00–05:00) и два дневных сна по 1.5 ч; 12.03 без записей.
+	var sessions []SleepSession
+	add := func(start time.Time, duration time.Duration) {
+		end := start.Add(duration)
+		sessions = append(sessions, SleepSession{StartAt: start.UTC(), EndAt: &end})
+	}
+	for day := 9; day <= 15; day++ {
+		if day == 12 {
+			continue
+		}
+		add(time.Date(2026, 3, day-1, 22, 0, 0, 0, loc), 7*time.Hour)
+		add(time.Date(2026, 3, day, 10, 0, 0, 0, loc), 90*time.Minute)
+		add(time.Date(2026, 3, day, 14, 0, 0, 0, loc), 90*time.Minute)
+	}
+
+	report := BuildNormsWindowReport(child, sessions, loc, now, 7)
+	for _, want := range []string{
+		"за 7 дн. (09.03–15.03)",
+		"Дней с записями: 6 из 7.",
+		"Ночной сон ниже нормы 6 из 6 дн.",
+		"12.03 — нет записей",
+		"15.03 — всего 10.0 ч (день 3.0, ночь 7.0), снов днём 2: A ",
+	} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("expected %q in report:\n%s", want, report)
+		}
+	}
+	if strings.Contains(report, "Дневных снов меньше нормы") {
+		t.Fatalf("two naps are normal at 8 months:\n%s", report)
+	}
+}
+
+func TestDetectNormTrendsIgnoresSingleBadDay(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 16, 12, 0, 0, 0, loc)
+	birth := now.AddDate(0, -8, 0)
+	child := Child{Name: "Малыш", BirthDate: &birth}
+
+	var sessions []SleepSession
+	add := func(start time.Time, duration time.Duration) {
+		end := start.Add(duration)
+		sessions = append(sessions, SleepSession{StartAt: start.UTC(), EndAt: &end})
+	}
+	for day := 13; day <= 15; day++ {
+		night := 11 * time.Hour
+		if day == 14 {
+			night = 6 * time.Hour
+		}
+		add(time.Date(2026, 3, day-1, 20, 0, 0, 0, loc), night)
+		add(time.Date(2026, 3, day, 10, 0, 0, 0, loc), 90*time.Minute)
+		add(time.Date(2026, 3, day, 14, 0, 0, 0, loc), 90*time.Minute)
+	}
+
+	if trends := DetectNormTrends(EvaluateNormsByDay(child, sessions, now, 3, loc)); len(trends) != 0 {
+		t.Fatalf("expected no persistent trends, got %+v", trends)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Статусы outbox.status.
+const (
+	outboxStatusPending = "pending"
+	outboxStatusSent    = "sent"
+	outboxStatusFailed  = "failed"
+)
+
+const (
+	// Лимиты Telegram: около 30 сообщений в секунду на бота и около одного в секунду в чат;
+	// в чат допускаем короткую пачку (отчет с графиками).
+	sendGlobalRate  = 25.0
+	sendGlobalBurst = 25
+	sendChatRate    = 1.0
+	sendChatBurst   = 3
+	// Ответ в чате ждет retry_after из ответа 429 не дольше этого и не больше sendMaxRetries
+	// попыток; уведомления из очереди откладываются на весь retry_after.
+	sendMaxInlineRetryAfter = 5 * time.Second
+	sendMaxRetries          = 3
+	// Сколько корзин чатов держит ограничитель, прежде чем выбросить заполненные.
+	sendLimiterMaxChats = 1000
+
+	outboxTick      = time.Second
+	outboxBatchSize = 50
+	// Попыток на уведомление при ошибках, кроме 429 и 403.
+	outboxMaxAttempts     = 6
+	outboxFirstRetryDelay = 10 * time.Second
+	outboxMaxRetryDelay   = 10 * time.Minute
+	// Отправленные и неотправленные уведомления старше этого срока удаляются.
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+// tokenBucket — корзина токенов; take берет токен в долг и возвращает, сколько ждать его появления.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) take(now time.Time, rate float64, burst int) time.Duration {
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(float64(burst), b.tokens+elapsed.Seconds()*rate)
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+func (b *tokenBucket) full(now time.Time, rate float64, burst int) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst)
+}
+
+// sendLimiter ограничивает отправки в Telegram: общий лимит бота, лимит на чат и пауза
+// после ответа 429.
+type sendLimiter struct {
+	mu          sync.Mutex
+	now         func() time.Time
+	sleep       func(time.Duration)
+	global      tokenBucket
+	chats       map[int64]*tokenBucket
+	pausedUntil time.Time
+}
+
+func newSendLimiter(now func() time.Time) *sendLimiter {
+	return &sendLimiter{now: now, sleep: time.Sleep, chats: map[int64]*tokenBucket{}}
+}
+
+// reserve занимает место для отправки в чат chatID (0 — чат неизвестен) и возвращает паузу до нее.
+func (l *sendLimiter) reserve(chatID int64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	wait := l.global.take(now, sendGlobalRate, sendGlobalBurst)
+	if chatID != 0 {
+		if len(l.chats) >= sendLimiterMaxChats {
+			for id, bucket := range l.chats {
+				if bucket.full(now, sendChatRate, sendChatBurst) {
+					delete(l.chats, id)
+				}
+			}
+		}
+		bucket := l.chats[chatID]
+		if bucket == nil {
+			bucket = &tokenBucket{}
+			l.chats[chatID] = bucket
+		}
+		wait = max(wait, bucket.take(now, sendChatRate, sendChatBurst))
+	}
+	if l.pausedUntil.After(now) {
+		wait = max(wait, l.pausedUntil.Sub(now))
+	}
+	return wait
+}
+
+func (l *sendLimiter) wait(chatID int64) {
+	if d := l.reserve(chatID); d > 0 {
+		l.sleep(d)
+	}
+}
+
+// pause останавливает все отправки на d: Telegram ограничивает бота целиком.
+func (l *sendLimiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := l.now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+func (l *sendLimiter) paused() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pausedUntil.After(l.now())
+}
+
+// telegramRetryAfter возвращает паузу из ответа 429 Too Many Requests.
+func telegramRetryAfter(err error) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != 429 {
+		return 0, false
+	}
+	return time.Duration(max(apiErr.RetryAfter, 1)) * time.Second, true
+}
+
+// telegramBlocked — ответ 403: пользователь заблокировал бота или удалил аккаунт.
+func telegramBlocked(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == 403
+}
+
+func chattableChatID(c tgbotapi.Chattable) int64 {
+	switch v := c.(type) {
+	case tgbotapi.MessageConfig:
+		return v.ChatID
+	case tgbotapi.DocumentConfig:
+		return v.ChatID
+	case tgbotapi.PhotoConfig:
+		return v.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return v.ChatID
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return v.ChatID
+	default:
+		return 0
+	}
+}
+
+// callTelegram выполняет вызов API с учетом лимитов: ждет очереди, на 429 ставит общую паузу
+// и повторяет, если пауза короткая, на 403 отмечает чат как заблокировавший бота.
+func (b *SleepBot) callTelegram(method string, chatID int64, call func() error) error {
+	for attempt := 1; ; attempt++ {
+		b.limiter.wait(chatID)
+		err := call()
+		if err == nil {
+			return nil
+		}
+		b.metrics.observeTelegramError(method, err)
+		if retryAfter, ok := telegramRetryAfter(err); ok {
+			b.limiter.pause(retryAfter)
+			if attempt < sendMaxRetries && retryAfter <= sendMaxInlineRetryAfter {
+				continue
+			}
+		}
+		if telegramBlocked(err) && chatID != 0 {
+			b.markChatBlocked(chatID, err)
+		}
+		return err
+	}
+}
+
+func (b *SleepBot) markChatBlocked(chatID int64, cause error) {
+	marked, err := b.store.MarkChatBlocked(context.Background(), chatID, cause.Error())
+	if err != nil {
+		slog.Error("mark chat blocked failed", "error", err)
+		return
+	}
+	if marked > 0 {
+		slog.Info("members blocked the bot, notifications paused", "members", marked)
+	}
+}
+
+// enqueueNotification ставит уведомление в outbox для участников, которые не заблокировали бота;
+// markup — inline-клавиатура или nil.
+func (b *SleepBot) enqueueNotification(ctx context.Context, kind string, members []Member, text string, markup *tgbotapi.InlineKeyboardMarkup) {
+	var encodedMarkup string
+	if markup != nil {
+		raw, err := json.Marshal(markup)
+		if err != nil {
+			loggerFrom(ctx).Error("notification not queued", "kind", kind, "error", err)
+			return
+		}
+		encodedMarkup = string(raw)
+	}
+	var messages []OutboxMessage
+	for _, member := range members {
+		if member.TelegramChatID == 0 || member.BlockedAt != nil {
+			continue
+		}
+		messages = append(messages, OutboxMessage{
+			FamilyID: member.FamilyID,
+			MemberID: member.ID,
+			ChatID:   member.TelegramChatID,
+			Kind:     kind,
+			Text:     text,
+			Markup:   encodedMarkup,
+		})
+	}
+	if len(messages) == 0 {
+		return
+	}
+	if err := b.store.EnqueueOutbox(ctx, messages); err != nil {
+		loggerFrom(ctx).Error("notification not queued", "kind", kind, "error", err)
+		return
+	}
+	select {
+	case b.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunOutbox доставляет уведомления из outbox: сразу после постановки в очередь и раз в outboxTick.
+// Уведомления хранятся в базе, поэтому переживают перезапуск.
+func (b *SleepBot) RunOutbox(ctx context.Context) {
+	ticker := time.NewTicker(outboxTick)
+	defer ticker.Stop()
+
+	for {
+		if err := b.deliverOutbox(ctx); err != nil {
+			slog.Error("outbox delivery failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.outboxWake:
+		}
+	}
+}
+
+func (b *SleepBot) deliverOutbox(ctx context.Context) error {
+	messages, err := b.store.ListDueOutbox(ctx, b.now(), outboxBatchSize)
+	if err != nil {
+		return err
+	}
+	blocked := map[int64]bool{}
+	for _, msg := range messages {
+		// После 429 ждем следующего прохода, а не держим очередь в sleep.
+		if ctx.Err() != nil || b.limiter.paused() {
+			return nil
+		}
+		// Остальные уведомления в заблокированный чат MarkChatBlocked уже снял.
+		if blocked[msg.ChatID] {
+			continue
+		}
+		sendErr := b.sendOutboxMessage(&msg)
+		msg = applyOutboxAttempt(msg, sendErr, b.now())
+		if err := b.store.RecordOutboxAttempt(ctx, msg); err != nil {
+			return err
+		}
+		switch {
+		case msg.Status == outboxStatusSent:
+			b.metrics.notificationsSent(msg.Kind, 1)
+		case telegramBlocked(sendErr):
+			blocked[msg.ChatID] = true
+		case msg.Status == outboxStatusFailed:
+			slog.Warn("notification not delivered", "kind", msg.Kind, "family_id", msg.FamilyID, "member_id", msg.MemberID, "attempts", msg.Attempts, "error", sendErr)
+		}
+	}
+	return b.store.PruneOutbox(ctx, b.now().Add(-outboxRetention))
+}
+
+// sendOutboxMessage отправляет части текста, начиная с msg.PartsSent, и отмечает каждую доставленную:
+// после ошибки на части N повтор не присылает части до N еще раз. Клавиатура — у последней части.
+func (b *SleepBot) sendOutboxMessage(msg *OutboxMessage) error {
+	var keyboard *tgbotapi.InlineKeyboardMarkup
+	if msg.Markup != "" {
+		keyboard = &tgbotapi.InlineKeyboardMarkup{}
+		if err := json.Unmarshal([]byte(msg.Markup), keyboard); err != nil {
+			return err
+		}
+	}
+	parts := splitTelegramMessage(msg.Text, telegramMaxMessageRunes)
+	for i := msg.PartsSent; i < len(parts); i++ {
+		var err error
+		if keyboard != nil && i == len(parts)-1 {
+			err = b.sendTextWithInlineKeyboard(msg.ChatID, parts[i], *keyboard)
+		} else {
+			err = b.sendText(msg.ChatID, parts[i])
+		}
+		if err != nil {
+			return err
+		}
+		msg.PartsSent = i + 1
+	}
+	return nil
+}
+
+// applyOutboxAttempt учитывает результат попытки: успех — sent; 403 — failed сразу; 429 —
+// повтор через retry_after без траты попытки; прочие ошибки — повтор с экспоненциальной паузой,
+// пока не кончатся попытки.
+func applyOutboxAttempt(msg OutboxMessage, err error, now time.Time) OutboxMessage {
+	if err == nil {
+		msg.Attempts++
+		msg.Status = outboxStatusSent
+		msg.LastError = ""
+		msg.SentAt = &now
+		return msg
+	}
+	msg.LastError = err.Error()
+	if retryAfter, ok := telegramRetryAfter(err); ok {
+		msg.NextAttemptAt = now.Add(retryAfter)
+		return msg
+	}
+	msg.Attempts++
+	if telegramBlocked(err) || msg.Attempts >= outboxMaxAttempts {
+		msg.Status = outboxStatusFailed
+		return msg
+	}
+	msg.NextAttemptAt = now.Add(exponentialDelay(outboxFirstRetryDelay, outboxMaxRetryDelay, msg.Attempts))
+	return msg
+}
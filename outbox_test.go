@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestSendLimiterPerChat(t *testing.T) {
+	clock := &testClock{now: time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC)}
+	limiter := newSendLimiter(clock.Now)
+
+	for i := 0; i < sendChatBurst; i++ {
+		if wait := limiter.reserve(100); wait != 0 {
+			t.Fatalf("burst message %d should go at once, wait %v", i+1, wait)
+		}
+	}
+	if wait := limiter.reserve(100); wait != time.Second {
+		t.Fatalf("expected 1s wait after burst, got %v", wait)
+	}
+	if wait := limiter.reserve(200); wait != 0 {
+		t.Fatalf("other chat should not wait, got %v", wait)
+	}
+	clock.Advance(5 * time.Second)
+	if wait := limiter.reserve(100); wait != 0 {
+		t.Fatalf("bucket should refill, wait %v", wait)
+	}
+}
+
+func TestSendLimiterGlobalAndPause(t *testing.T) {
+	clock := &testClock{now: time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC)}
+	limiter := newSendLimiter(clock.Now)
+
+	for i := int64(0); i < sendGlobalBurst; i++ {
+		if wait := limiter.reserve(1000 + i); wait != 0 {
+			t.Fatalf("message %d within global burst should go at once, wait %v", i+1, wait)
+		}
+	}
+	if wait := limiter.reserve(5000); wait != time.Second/sendGlobalRate {
+		t.Fatalf("expected global wait %v, got %v", time.Second/sendGlobalRate, wait)
+	}
+
+	clock.Advance(time.Minute)
+	limiter.pause(30 * time.Second)
+	if !limiter.paused() {
+		t.Fatalf("limiter should be paused after 429")
+	}
+	if wait := limiter.reserve(100); wait != 30*time.Second {
+		t.Fatalf("expected 30s pause, got %v", wait)
+	}
+	limiter.pause(time.Second)
+	clock.Advance(31 * time.Second)
+	if limiter.paused() {
+		t.Fatalf("shorter pause should not extend and pause should expire")
+	}
+}
+
+func TestApplyOutboxAttempt(t *testing.T) {
+	now := time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC)
+	pending := OutboxMessage{ID: 1, Status: outboxStatusPending, NextAttemptAt: now}
+
+	sent := applyOutboxAttempt(pending, nil, now)
+	if sent.Status != outboxStatusSent || sent.Attempts != 1 || sent.SentAt == nil {
+		t.Fatalf("unexpected sent message %+v", sent)
+	}
+
+	limited := applyOutboxAttempt(pending, &tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 42}}, now)
+	if limited.Status != outboxStatusPending || limited.Attempts != 0 || !limited.NextAttemptAt.Equal(now.Add(42*time.Second)) {
+		t.Fatalf("429 should reschedule without spending an attempt, got %+v", limited)
+	}
+
+	blocked := applyOutboxAttempt(pending, &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, now)
+	if blocked.Status != outboxStatusFailed || blocked.LastError == "" {
+		t.Fatalf("403 should fail at once, got %+v", blocked)
+	}
+
+	failing := pending
+	for i := 1; i < outboxMaxAttempts; i++ {
+		failing = applyOutboxAttempt(failing, errors.New("connection reset"), now)
+		if failing.Status != outboxStatusPending {
+			t.Fatalf("attempt %d should be retried, got %+v", i, failing)
+		}
+	}
+	if want := now.Add(exponentialDelay(outboxFirstRetryDelay, outboxMaxRetryDelay, outboxMaxAttempts-1)); !failing.NextAttemptAt.Equal(want) {
+		t.Fatalf("expected next attempt at %v, got %v", want, failing.NextAttemptAt)
+	}
+	if failing = applyOutboxAttempt(failing, errors.New("connection reset"), now); failing.Status != outboxStatusFailed {
+		t.Fatalf("message should fail after %d attempts, got %+v", outboxMaxAttempts, failing)
+	}
+}
+
+func TestChattableChatID(t *testing.T) {
+	if got := chattableChatID(tgbotapi.NewMessage(42, "hi")); got != 42 {
+		t.Fatalf("expected chat 42, got %d", got)
+	}
+	if got := chattableChatID(tgbotapi.NewCallback("id", "ok")); got != 0 {
+		t.Fatalf("callback answer has no chat, got %d", got)
+	}
+}
+
+func TestOutboxResumesLongMessageFromFailedPart(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(100)
+	member := h.member(100, 100)
+
+	paragraph := strings.Repeat("а", 3000)
+	text := "первая " + paragraph + "\nвторая " + paragraph + "\nтретья " + paragraph
+	if parts := splitTelegramMessage(text, telegramMaxMessageRunes); len(parts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(parts))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("ok", "ok")))
+	h.bot.enqueueNotification(context.Background(), notificationDigestDaily, []Member{member}, text, &keyboard)
+
+	h.tg.failAfter(100, 1, errors.New("network"))
+	if sent := messagesTo(h.deliverOutbox(), 100); len(sent) != 1 || !strings.HasPrefix(sent[0].Text, "первая") {
+		t.Fatalf("expected only the first part before the failure, got %d", len(sent))
+	}
+	h.clock.Advance(outboxFirstRetryDelay)
+	sent := messagesTo(h.deliverOutbox(), 100)
+	if len(sent) != 2 || !strings.HasPrefix(sent[0].Text, "вторая") || !strings.HasPrefix(sent[1].Text, "третья") {
+		t.Fatalf("retry should resume from the failed part, got %d messages", len(sent))
+	}
+	if sent[0].Markup != nil || sent[1].Markup == nil {
+		t.Fatalf("keyboard should be attached to the last part only")
+	}
+	h.clock.Advance(outboxMaxRetryDelay)
+	if again := h.deliverOutbox(); len(again) != 0 {
+		t.Fatalf("delivered message should not be sent again, got %d", len(again))
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// Ограничения периода для /pdf_report.
+const (
+	pdfReportDefaultDays = 30
+	pdfReportMaxDays     = 90
+	// Оценка по нормам в PDF — средние за последние две недели, а не снимок одних суток.
+	pdfNormsWindowDays = 14
+)
+
+// Шрифты Go (golang.org/x/image/font/gofont) встроены в бинарник и покрывают кириллицу.
+const pdfFontFamily = "Go"
+
+// BuildPDFReport формирует PDF для визита к педиатру: данные ребенка и возраст, сутки сна по дням
+// (дневной сон, ночь, число дневных снов, ночные пробуждения), оценку по нормам и ленту сна.
+func BuildPDFReport(child Child, sessions []SleepSession, active *SleepSession, now time.Time, days int, loc *time.Location) ([]byte, error) {
+	if days < 1 {
+		days = 1
+	}
+	merged := sessionsWithActive(sessions, active, now)
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes(pdfFontFamily, "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes(pdfFontFamily, "B", gobold.TTF)
+	pdf.SetTitle(fmt.Sprintf("Отчёт о сне: %s", child.Name), true)
+	pdf.SetCreator("sleepbot", true)
+	pdf.SetCreationDate(now)
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont(pdfFontFamily, "", 8)
+		pdf.CellFormat(0, 5, fmt.Sprintf("Стр. %d", pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+	pdf.AddPage()
+
+	endDay := startOfDay(now, loc)
+	startDay := endDay.AddDate(0, 0, -(days - 1))
+
+	pdf.SetFont(pdfFontFamily, "B", 16)
+	pdf.CellFormat(0, 9, fmt.Sprintf("Отчёт о сне: %s", child.Name), "", 1, "L", false, 0, "")
+	pdf.SetFont(pdfFontFamily, "", 10)
+	infoLines := []string{
+		fmt.Sprintf("Период: %s – %s (%d дн.)", startDay.Format("02.01.2006"), endDay.Format("02.01.2006"), days),
+		fmt.Sprintf("Сформирован: %s (%s)", now.In(loc).Format("02.01.2006 15:04"), loc.String()),
+	}
+	if child.BirthDate != nil {
+		infoLines = append(infoLines,
+			fmt.Sprintf("Дата рождения: %s", formatChildBirthForSettings(*child.BirthDate, loc)),
+			fmt.Sprintf("Возраст: %s", formatChildAgeRU(*child.BirthDate, now, loc)),
+		)
+	} else {
+		infoLines = append(infoLines, "Дата рождения не указана.")
+	}
+	for _, line := range infoLines {
+		pdf.CellFormat(0, 5.5, line, "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(3)
+
+	rows := make([]DayNightSummary, 0, days)
+	for day := startDay; !day.After(endDay); day = day.AddDate(0, 0, 1) {
+		rows = append(rows, SummarizeDayNight(merged, day, loc))
+	}
+	writePDFSummary(pdf, rows)
+	writePDFDailyTable(pdf, rows)
+
+	pdfSectionTitle(pdf, "Оценка относительно возрастных норм")
+	pdf.SetFont(pdfFontFamily, "", 9.5)
+	norms := stripTelegramMarkdown(BuildNormsWindowReport(child, merged, loc, now, min(days, pdfNormsWindowDays)))
+	pdf.MultiCell(0, 4.8, norms, "", "L", false)
+	pdf.Ln(3)
+
+	timeline, err := RenderSleepTimelinePNG(merged, now, days, loc)
+	if err != nil {
+		return nil, err
+	}
+	writePDFImage(pdf, "timeline", "Лента сна (синий — сон, серый фон — ночь 19:00–07:00)", timeline)
+
+	if err := pdf.Error(); err != nil {
+		return nil, fmt.Errorf("build pdf report: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("write pdf report: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func pdfSectionTitle(pdf *fpdf.Fpdf, title string) {
+	pdf.SetFont(pdfFontFamily, "B", 12)
+	pdf.CellFormat(0, 7, title, "", 1, "L", false, 0, "")
+}
+
+func writePDFSummary(pdf *fpdf.Fpdf, rows []DayNightSummary) {
+	var (
+		withData int
+		total    time.Duration
+		daySleep time.Duration
+		naps     int
+	)
+	nights := make([]NightSummary, 0, len(rows))
+	for _, row := range rows {
+		nights = append(nights, row.Night)
+		if row.Total() == 0 {
+			continue
+		}
+		withData++
+		total += row.Total()
+		daySleep += row.DaySleep
+		naps += row.NapCount
+	}
+
+	pdfSectionTitle(pdf, "Сводка")
+	pdf.SetFont(pdfFontFamily, "", 10)
+	if withData == 0 {
+		pdf.CellFormat(0, 5.5, "За период нет записей о сне.", "", 1, "L", false, 0, "")
+		pdf.Ln(3)
+		return
+	}
+	trend := AverageNights(nights)
+	lines := []string{
+		fmt.Sprintf("Дней с записями: %d из %d.", withData, len(rows)),
+		fmt.Sprintf("Сон за сутки в среднем: %s (днём %s, ночью %s).",
+			formatDurationRU(total/time.Duration(withData)),
+			formatDurationRU(daySleep/time.Duration(withData)),
+			formatDurationRU((total-daySleep)/time.Duration(withData)),
+		),
+		fmt.Sprintf("Дневных снов в среднем: %.1f в день.", float64(naps)/float64(withData)),
+	}
+	if trend.Nights > 0 {
+		lines = append(lines, fmt.Sprintf("Ночные пробуждения: %.1f за ночь, бодрствование ночью %s, самый длинный ночной сон в среднем %s.",
+			trend.AverageWakings, formatDurationRU(trend.AverageAwake), formatDurationRU(trend.AverageLongest),
+		))
+	}
+	for _, line := range lines {
+		pdf.MultiCell(0, 5.5, line, "", "L", false)
+	}
+	pdf.Ln(3)
+}
+
+func writePDFDailyTable(pdf *fpdf.Fpdf, rows []DayNightSummary) {
+	pdfSectionTitle(pdf, "По дням (ночь — перед утром указанной даты)")
+
+	headers := []string{"Дата", "Всего", "Днём", "Ночью", "Дневных снов", "Пробуждений", "Бодрств. ночью"}
+	widths := []float64{22, 24, 24, 24, 28, 28, 30}
+
+	pdf.SetFont(pdfFontFamily, "B", 9)
+	pdf.SetFillColor(236, 238, 244)
+	for i, header := range headers {
+		pdf.CellFormat(widths[i], 6.5, header, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont(pdfFontFamily, "", 9)
+	for _, row := range rows {
+		cells := []string{row.Date.Format("02.01"), "—", "—", "—", "—", "—", "—"}
+		if row.Total() > 0 {
+			cells = []string{
+				row.Date.Format("02.01"),
+				formatDurationRU(row.Total()),
+				formatDurationRU(row.DaySleep),
+				formatDurationRU(row.Night.TotalSleep),
+				fmt.Sprintf("%d", row.NapCount),
+				fmt.Sprintf("%d", row.Night.Wakings),
+				formatDurationRU(row.Night.AwakeTime),
+			}
+		}
+		for i, cell := range cells {
+			pdf.CellFormat(widths[i], 5.5, cell, "1", 0, "C", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.Ln(4)
+}
+
+// writePDFImage вставляет PNG во всю ширину страницы; если не помещается по высоте — уменьшает
+// или переносит на новую страницу.
+func writePDFImage(pdf *fpdf.Fpdf, name string, title string, payload []byte) {
+	options := fpdf.ImageOptions{ImageType: "PNG"}
+	info := pdf.RegisterImageOptionsReader(name, options, bytes.NewReader(payload))
+	if info == nil || pdf.Error() != nil {
+		return
+	}
+
+	pageWidth, pageHeight := pdf.GetPageSize()
+	left, top, right, bottom := pdf.GetMargins()
+	width := pageWidth - left - right
+	height := width * info.Height() / info.Width()
+	maxHeight := pageHeight - top - bottom - 10
+	if height > maxHeight {
+		width = width * maxHeight / height
+		height = maxHeight
+	}
+	if pdf.GetY()+height+10 > pageHeight-bottom {
+		pdf.AddPage()
+	}
+
+	pdfSectionTitle(pdf, strings.TrimSpace(title))
+	pdf.ImageOptions(name, left, pdf.GetY(), width, height, true, options, 0, "")
+}
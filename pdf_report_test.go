@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSummarizeDayNightSplitsNapsAndNight(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	day := time.Date(2026, 3, 16, 0, 0, 0, 0, loc)
+
+	makeSession := func(startDay, startHour, endDay, endHour int) SleepSession {
+		start := time.Date(2026, 3, startDay, startHour, 0, 0, 0, loc).UTC()
+		end := time.Date(2026, 3, endDay, endHour, 0, 0, 0, loc).UTC()
+		return SleepSession{StartAt: start, EndAt: &end}
+	}
+
+	summary := SummarizeDayNight([]SleepSession{
+		makeSession(15, 20, 16, 8),
+		makeSession(16, 11, 16, 12),
+		makeSession(16, 15, 16, 17),
+	}, day, loc)
+
+	if summary.NapCount != 2 {
+		t.Fatalf("expected 2 naps, the morning tail of the night is not a nap, got %d", summary.NapCount)
+	}
+	if summary.DaySleep != 4*time.Hour {
+		t.Fatalf("expected 4h of day sleep, got %s", summary.DaySleep)
+	}
+	if summary.Night.TotalSleep != 11*time.Hour {
+		t.Fatalf("expected 11h of night sleep, got %s", summary.Night.TotalSleep)
+	}
+	if summary.Total() != 15*time.Hour {
+		t.Fatalf("expected 15h total, got %s", summary.Total())
+	}
+}
+
+func TestBuildPDFReportProducesDocument(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 16, 20, 0, 0, 0, loc)
+	birth := time.Date(2026, 1, 2, 10, 0, 0, 0, loc)
+	child := Child{Name: "Малыш_1", BirthDate: &birth}
+
+	var sessions []SleepSession
+	for offset := 0; offset < 7; offset++ {
+		start := time.Date(2026, 3, 16-offset, 13, 0, 0, 0, loc).UTC()
+		end := start.Add(90 * time.Minute)
+		sessions = append(sessions, SleepSession{ID: int64(offset + 1), StartAt: start, EndAt: &end})
+	}
+
+	payload, err := BuildPDFReport(child, sessions, nil, now, 14, loc)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if !bytes.HasPrefix(payload, []byte("%PDF-")) {
+		t.Fatalf("expected PDF header, got %q", payload[:min(len(payload), 8)])
+	}
+	if !bytes.Contains(payload, []byte("%%EOF")) {
+		t.Fatal("expected PDF trailer")
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Стороны сцеживания: значение хранится в pumping_sessions.side.
+const (
+	pumpSideLeft  = "left"
+	pumpSideRight = "right"
+	pumpSideBoth  = "both"
+)
+
+var pumpSideLabels = map[string]string{
+	pumpSideLeft:  "левая",
+	pumpSideRight: "правая",
+	pumpSideBoth:  "обе",
+}
+
+// Места хранения молока и срок годности в каждом из них.
+const (
+	milkStorageFridge  = "fridge"
+	milkStorageFreezer = "freezer"
+)
+
+var milkShelfLife = map[string]time.Duration{
+	milkStorageFridge:  4 * 24 * time.Hour,
+	milkStorageFreezer: 180 * 24 * time.Hour,
+}
+
+var milkStorageLabels = map[string]string{
+	milkStorageFridge:  "холодильник",
+	milkStorageFreezer: "морозилка",
+}
+
+const (
+	pumpMaxVolumeML        = 1000
+	pumpMaxMinutes         = 180
+	pumpIntervalMaxMinutes = 12 * 60
+	// Пакет, срок которого истекает раньше, помечается в /stash.
+	milkExpiringSoon = 24 * time.Hour
+	// Период сводки /pumplog, дней.
+	pumpingReportDays = 7
+)
+
+// parsePumpSide понимает `л`, `левая`, `left`, `п`, `правая`, `right`, `обе`, `both`.
+func parsePumpSide(raw string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "л", "лев", "левая", "left", "l":
+		return pumpSideLeft, true
+	case "п", "прав", "правая", "right", "r":
+		return pumpSideRight, true
+	case "обе", "о", "both", "b":
+		return pumpSideBoth, true
+	}
+	return "", false
+}
+
+// parseMilkStorage понимает `холодильник`, `х`, `fridge`, `морозилка`, `м`, `freezer`.
+func parseMilkStorage(raw string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "х", "холодильник", "fridge":
+		return milkStorageFridge, true
+	case "м", "морозилка", "морозильник", "freezer":
+		return milkStorageFreezer, true
+	}
+	return "", false
+}
+
+// parsePumpArgs разбирает `120 л 15`: объем в мл, сторона (по умолчанию обе) и, при желании, длительность в минутах.
+// Вместо одного объема можно указать оба: `70+50` — левая и правая, тогда сторона — обе.
+func parsePumpArgs(args string) (int, string, int, error) {
+	fields := strings.Fields(strings.ToLower(args))
+	if len(fields) == 0 {
+		return 0, "", 0, fmt.Errorf("нужен объем в мл")
+	}
+	volume := 0
+	side := pumpSideBoth
+	for _, part := range strings.Split(strings.TrimSuffix(fields[0], "мл"), "+") {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return 0, "", 0, fmt.Errorf("не понял объем")
+		}
+		volume += value
+	}
+	if volume > pumpMaxVolumeML {
+		return 0, "", 0, fmt.Errorf("объем больше %d мл", pumpMaxVolumeML)
+	}
+
+	minutes := 0
+	for _, field := range fields[1:] {
+		if parsed, ok := parsePumpSide(field); ok {
+			side = parsed
+			continue
+		}
+		field = strings.TrimSuffix(field, "мин")
+		value, err := strconv.Atoi(field)
+		if err != nil || value < 1 || value > pumpMaxMinutes || minutes != 0 {
+			return 0, "", 0, fmt.Errorf("не понял %q", field)
+		}
+		minutes = value
+	}
+	return volume, side, minutes, nil
+}
+
+// parseStashAddArgs разбирает `120 морозилка [дата или дата и время сцеживания]`; без даты — now.
+func parseStashAddArgs(args string, now time.Time, loc *time.Location) (MilkBag, error) {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return MilkBag{}, fmt.Errorf("нужны объем и место хранения")
+	}
+	volume, err := strconv.Atoi(strings.TrimSuffix(fields[0], "мл"))
+	if err != nil || volume < 1 || volume > pumpMaxVolumeML {
+		return MilkBag{}, fmt.Errorf("объем должен быть от 1 до %d мл", pumpMaxVolumeML)
+	}
+	storage, ok := parseMilkStorage(fields[1])
+	if !ok {
+		return MilkBag{}, fmt.Errorf("место хранения — холодильник или морозилка")
+	}
+	pumpedAt := now
+	if len(fields) > 2 {
+		raw := strings.Join(fields[2:], " ")
+		parsed, hasDate, err := parseFlexibleDateTime(raw, now, loc)
+		if err != nil {
+			// Только дата: срок годности считаем от начала дня, с запасом.
+			if parsed, err = parseReportDate(raw, now, loc); err != nil {
+				return MilkBag{}, fmt.Errorf("не понял дату сцеживания")
+			}
+		} else if !hasDate && parsed.After(now) {
+			parsed = parsed.AddDate(0, 0, -1)
+		}
+		pumpedAt = parsed
+	}
+	return MilkBag{VolumeML: volume, Storage: storage, PumpedAt: pumpedAt}, nil
+}
+
+// AllocateMilk выбирает молоко для кормления из годных на момент at пакетов: сначала те, чей срок
+// истекает раньше. bags должны быть упорядочены по ExpiresAt. Возвращает списания и нехватку в мл.
+func AllocateMilk(bags []MilkBag, volumeML int, at time.Time) ([]MilkBagUse, int) {
+	var uses []MilkBagUse
+	need := volumeML
+	for _, bag := range bags {
+		if need == 0 {
+			break
+		}
+		if bag.RemainingML <= 0 || !bag.ExpiresAt.After(at) {
+			continue
+		}
+		take := min(bag.RemainingML, need)
+		uses = append(uses, MilkBagUse{BagID: bag.ID, VolumeML: take})
+		need -= take
+	}
+	return uses, need
+}
+
+func formatPumping(session PumpingSession, loc *time.Location) string {
+	text := fmt.Sprintf("%s — %d мл, %s", formatLocalDateTime(session.StartAt, loc), session.VolumeML, pumpSideLabels[session.Side])
+	if session.EndAt != nil && session.EndAt.After(session.StartAt) {
+		text += ", " + formatDurationRU(session.EndAt.Sub(session.StartAt))
+	}
+	return text
+}
+
+// BuildPumpingReport — сцеживания за days дней: по дням объем и число сцеживаний, затем последние записи.
+func BuildPumpingReport(sessions []PumpingSession, now time.Time, days int, loc *time.Location) string {
+	today := startOfDay(now, loc)
+	first := today.AddDate(0, 0, -(days - 1))
+	lines := []string{fmt.Sprintf("Сцеживания за %s–%s:", first.Format("02.01"), today.Format("02.01"))}
+	if len(sessions) == 0 {
+		lines = append(lines, "Записей нет. Таймер: `/pump`, запись задним числом: `/pump 120 л 15`.")
+		return strings.Join(lines, "\n")
+	}
+
+	total := 0
+	for day := first; !day.After(today); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		volume, count := 0, 0
+		for _, session := range sessions {
+			if session.StartAt.Before(day) || !session.StartAt.Before(next) {
+				continue
+			}
+			volume += session.VolumeML
+			count++
+		}
+		total += volume
+		if count == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d мл, %d %s", day.Format("02.01"), volume, count, ruPlural(count, "раз", "раза", "раз")))
+	}
+	lines = append(lines, fmt.Sprintf("В среднем %d мл в день.", total/days), "", "Последние:")
+	start := max(len(sessions)-5, 0)
+	for _, session := range sessions[start:] {
+		lines = append(lines, fmt.Sprintf("%s (%s)", formatPumping(session, loc), escapeTelegramMarkdown(session.MemberName)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// BuildStashReport — пакеты в запасе по сроку годности с пометками об истекающих и просроченных.
+func BuildStashReport(bags []MilkBag, now time.Time, loc *time.Location) string {
+	if len(bags) == 0 {
+		return "Запас пуст. Добавить: кнопками после сцеживания или `/stash add 120 морозилка`."
+	}
+	lines := []string{"Запас молока:"}
+	usable, expired := 0, 0
+	for _, bag := range bags {
+		line := fmt.Sprintf("№%d — %d мл", bag.ID, bag.RemainingML)
+		if bag.RemainingML != bag.VolumeML {
+			line += fmt.Sprintf(" из %d", bag.VolumeML)
+		}
+		line += fmt.Sprintf(", сцежено %s, %s, годно до %s", bag.PumpedAt.In(loc).Format("02.01"), milkStorageLabels[bag.Storage], formatLocalDateTime(bag.ExpiresAt, loc))
+		switch {
+		case !bag.ExpiresAt.After(now):
+			line += " — просрочено"
+			expired += bag.RemainingML
+		case bag.ExpiresAt.Sub(now) < milkExpiringSoon:
+			line += " — истекает через " + formatDurationRU(bag.ExpiresAt.Sub(now))
+			usable += bag.RemainingML
+		default:
+			usable += bag.RemainingML
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", fmt.Sprintf("Годного молока: %d мл.", usable))
+	if expired > 0 {
+		lines = append(lines, fmt.Sprintf("Просрочено %d мл — уберите пакеты командой `/stash del N`.", expired))
+	}
+	lines = append(lines, "Кормление из запаса: `/bottle 90` (берется молоко с ближайшим сроком).")
+	return strings.Join(lines, "\n")
+}
+
+// PumpReminderDue сообщает, пора ли напомнить о сцеживании: прошло intervalMinutes с конца последнего.
+func PumpReminderDue(intervalMinutes int, lastEnd *time.Time, active bool, now time.Time) bool {
+	if intervalMinutes <= 0 || lastEnd == nil || active {
+		return false
+	}
+	return !now.Before(lastEnd.Add(time.Duration(intervalMinutes) * time.Minute))
+}
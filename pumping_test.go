@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePumpArgs(t *testing.T) {
+	volume, side, minutes, err := parsePumpArgs("70+50 обе 20мин")
+	if err != nil || volume != 120 || side != pumpSideBoth || minutes != 20 {
+		t.Fatalf("unexpected: %d %s %d %v", volume, side, minutes, err)
+	}
+	volume, side, minutes, err = parsePumpArgs("90мл Л")
+	if err != nil || volume != 90 || side != pumpSideLeft || minutes != 0 {
+		t.Fatalf("unexpected: %d %s %d %v", volume, side, minutes, err)
+	}
+	if _, _, _, err := parsePumpArgs("90 л 10 15"); err == nil {
+		t.Fatal("expected error for two durations")
+	}
+}
+
+func TestAllocateMilkSkipsExpiredAndTakesSoonestFirst(t *testing.T) {
+	now := time.Date(2026, 3, 16, 12, 0, 0, 0, time.UTC)
+	bags := []MilkBag{
+		{ID: 1, RemainingML: 50, ExpiresAt: now.Add(-time.Hour)},
+		{ID: 2, RemainingML: 60, ExpiresAt: now.Add(24 * time.Hour)},
+		{ID: 3, RemainingML: 100, ExpiresAt: now.Add(90 * 24 * time.Hour)},
+	}
+	uses, shortfall := AllocateMilk(bags, 90, now)
+	if shortfall != 0 || len(uses) != 2 || uses[0] != (MilkBagUse{BagID: 2, VolumeML: 60}) || uses[1] != (MilkBagUse{BagID: 3, VolumeML: 30}) {
+		t.Fatalf("unexpected allocation: %+v shortfall %d", uses, shortfall)
+	}
+	if _, shortfall := AllocateMilk(bags, 200, now); shortfall != 40 {
+		t.Fatalf("expected 40 ml shortfall, got %d", shortfall)
+	}
+}
+
+func TestBuildStashReportMarksExpiry(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2026, 3, 16, 12, 0, 0, 0, loc)
+	pumped := time.Date(2026, 3, 12, 20, 0, 0, 0, loc)
+	bags := []MilkBag{
+		{ID: 1, VolumeML: 100, RemainingML: 100, Storage: milkStorageFridge, PumpedAt: pumped, ExpiresAt: pumped.Add(milkShelfLife[milkStorageFridge])},
+		{ID: 2, VolumeML: 120, RemainingML: 40, Storage: milkStorageFreezer, PumpedAt: now, ExpiresAt: now.Add(milkShelfLife[milkStorageFreezer])},
+	}
+	report := BuildStashReport(bags, now, loc)
+	for _, want := range []string{
+		"№1 — 100 мл, сцежено 12.03, холодильник, годно до 16.03 20:00 — истекает через 8 ч",
+		"№2 — 40 мл из 120, сцежено 16.03, морозилка",
+		"Годного молока: 140 мл.",
+	} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("expected %q in report:\n%s", want, report)
+		}
+	}
+
+	last := now.Add(-3 * time.Hour)
+	if !PumpReminderDue(180, &last, false, now) || PumpReminderDue(180, &last, true, now) || PumpReminderDue(0, &last, false, now) {
+		t.Fatal("reminder is due only after the interval, without an active timer")
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Если обработка семьи упала, она повторяется через столько.
+	reminderRetryDelay = time.Minute
+	// Срок повтора после ошибки хранится в очереди под этим типом.
+	reminderKindRetry = "retry"
+	// Пользовательское напоминание досылается, если проход опоздал не больше чем на столько.
+	customReminderCatchUp = 5 * time.Minute
+	everyWeekday          = "0,1,2,3,4,5,6"
+)
+
+// reminderEntry — ближайший срок напоминания kind семьи familyID.
+type reminderEntry struct {
+	familyID int64
+	kind     string
+	due      time.Time
+	index    int
+}
+
+// reminderQueue — куча сроков: в корне ближайший (container/heap).
+type reminderQueue []*reminderEntry
+
+func (q reminderQueue) Len() int { return len(q) }
+
+func (q reminderQueue) Less(i, j int) bool {
+	if q[i].due.Equal(q[j].due) {
+		return q[i].familyID < q[j].familyID
+	}
+	return q[i].due.Before(q[j].due)
+}
+
+func (q reminderQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *reminderQueue) Push(x any) {
+	entry := x.(*reminderEntry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *reminderQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	entry.index = -1
+	return entry
+}
+
+// reminderScheduler хранит ближайшие сроки напоминаний по семьям и типам. RunReminders спит до
+// ближайшего срока или до touch, когда данные семьи изменились, и обрабатывает только эти семьи.
+type reminderScheduler struct {
+	mu       sync.Mutex
+	queue    reminderQueue
+	families map[int64][]*reminderEntry
+	dirty    map[int64]bool
+	wake     chan struct{}
+}
+
+func newReminderScheduler() *reminderScheduler {
+	return &reminderScheduler{
+		families: map[int64][]*reminderEntry{},
+		dirty:    map[int64]bool{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// schedule заменяет сроки семьи familyID; пустой due — будущих напоминаний у семьи нет.
+func (s *reminderScheduler) schedule(familyID int64, due map[string]time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(familyID)
+	entries := make([]*reminderEntry, 0, len(due))
+	for kind, at := range due {
+		entry := &reminderEntry{familyID: familyID, kind: kind, due: at}
+		heap.Push(&s.queue, entry)
+		entries = append(entries, entry)
+	}
+	if len(entries) > 0 {
+		s.families[familyID] = entries
+	}
+}
+
+func (s *reminderScheduler) removeLocked(familyID int64) {
+	for _, entry := range s.families[familyID] {
+		if entry.index >= 0 {
+			heap.Remove(&s.queue, entry.index)
+		}
+	}
+	delete(s.families, familyID)
+}
+
+// touch отмечает, что данные семьи изменились и ее сроки надо пересчитать, и будит RunReminders.
+func (s *reminderScheduler) touch(familyID int64) {
+	s.mu.Lock()
+	s.dirty[familyID] = true
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// takeDue забирает из очереди семьи, у которых наступил хотя бы один срок, и семьи после touch.
+func (s *reminderScheduler) takeDue(now time.Time) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.queue) > 0 && !s.queue[0].due.After(now) {
+		s.dirty[s.queue[0].familyID] = true
+		s.removeLocked(s.queue[0].familyID)
+	}
+	families := make([]int64, 0, len(s.dirty))
+	for familyID := range s.dirty {
+		families = append(families, familyID)
+	}
+	clear(s.dirty)
+	sort.Slice(families, func(i, j int) bool { return families[i] < families[j] })
+	return families
+}
+
+// next возвращает ближайший срок в очереди.
+func (s *reminderScheduler) next() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == 0 {
+		return time.Time{}, false
+	}
+	return s.queue[0].due, true
+}
+
+func (s *reminderScheduler) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// RunReminders при старте проходит все семьи, а дальше просыпается только к ближайшему сроку
+// в очереди или когда данные семьи изменились.
+func (b *SleepBot) RunReminders(ctx context.Context) {
+	for {
+		err := b.processReminders(ctx)
+		if err == nil {
+			break
+		}
+		slog.Error("reminders failed", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reminderRetryDelay):
+		}
+	}
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		b.runDueReminders(ctx)
+		var timerC <-chan time.Time
+		if due, ok := b.reminders.next(); ok {
+			timer.Reset(max(due.Sub(b.now()), 0))
+			timerC = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-timerC:
+		case <-b.reminders.wake:
+		}
+	}
+}
+
+// processReminders обрабатывает все семьи и заполняет очередь их сроками.
+func (b *SleepBot) processReminders(ctx context.Context) error {
+	started := time.Now()
+	targets, err := b.store.GetReminderTargets(ctx)
+	if err != nil {
+		return err
+	}
+	now := b.now().UTC()
+	for _, target := range targets {
+		b.refreshFamilyReminders(ctx, target, now)
+	}
+	b.metrics.observeReminderTick(time.Since(started))
+	slog.Info("reminders scheduled", "families", len(targets), "queue", b.reminders.size(), "duration", time.Since(started))
+	return nil
+}
+
+// runDueReminders обрабатывает семьи с наступившими сроками и измененные с прошлого прохода.
+func (b *SleepBot) runDueReminders(ctx context.Context) {
+	now := b.now().UTC()
+	families := b.reminders.takeDue(now)
+	if len(families) == 0 {
+		return
+	}
+	started := time.Now()
+	for _, familyID := range families {
+		targets, err := b.store.GetFamilyReminderTargets(ctx, familyID)
+		if err != nil {
+			slog.Error("reminders failed", "family_id", familyID, "error", err)
+			b.reminders.schedule(familyID, map[string]time.Time{reminderKindRetry: now.Add(reminderRetryDelay)})
+			continue
+		}
+		// Семья без ребенка или удаленная семья просто выпадает из очереди.
+		for _, target := range targets {
+			b.refreshFamilyReminders(ctx, target, now)
+		}
+	}
+	b.metrics.observeReminderTick(time.Since(started))
+}
+
+// refreshFamilyReminders отправляет наступившие напоминания семьи и ставит в очередь следующие сроки.
+func (b *SleepBot) refreshFamilyReminders(ctx context.Context, target ReminderTarget, now time.Time) {
+	// Ошибки шагов processFamilyReminders уже записаны в лог; здесь они только назначают повтор,
+	// а остальные сроки семьи считаются как обычно.
+	processErr := b.processFamilyReminders(ctx, target, now)
+	due, err := b.familyReminderDue(ctx, target, now)
+	if err != nil {
+		slog.Error("reminders failed", "family_id", target.Family.ID, "error", err)
+		due = map[string]time.Time{}
+	}
+	if err != nil || processErr != nil {
+		due[reminderKindRetry] = now.Add(reminderRetryDelay)
+	}
+	b.reminders.schedule(target.Family.ID, due)
+}
+
+// familyReminderDue вычисляет ближайшие после now сроки напоминаний семьи по типам. Срок нужен
+// только чтобы вовремя проснуться: что отправить, решает processFamilyReminders, поэтому срок
+// может быть и у напоминания, которое в итоге не уйдет (доза уже дана, веха отфильтрована).
+func (b *SleepBot) familyReminderDue(ctx context.Context, target ReminderTarget, now time.Time) (map[string]time.Time, error) {
+	due := map[string]time.Time{}
+	add := func(kind string, at time.Time) {
+		if at.After(now) && (due[kind].IsZero() || at.Before(due[kind])) {
+			due[kind] = at
+		}
+	}
+	loc := b.mustLocation(target.Family.Timezone)
+
+	pumping, err := b.familyPumpingStates(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range target.Members {
+		if at, ok := nextLocalTime(now, member.DailyDigestAt, everyWeekday, loc); ok {
+			add(notificationDigestDaily, at)
+		}
+		if at, ok := nextLocalTime(now, member.WeeklyDigestAt, strconv.Itoa(int(time.Sunday)), loc); ok {
+			add(notificationDigestWeekly, at)
+		}
+		if state := pumping[member.ID]; member.PumpIntervalMinutes > 0 && state.LastEnd != nil && !state.Active {
+			add(notificationPumping, state.LastEnd.Add(time.Duration(member.PumpIntervalMinutes)*time.Minute))
+		}
+	}
+
+	chatReminders := target.Settings.RemindersEnabled && len(target.Members) > 0
+	if anchor, ok := BirthAnchorLocal(target.Child.BirthDate, loc); ok {
+		milestones := chatReminders && target.Settings.MilestoneNotifyEach
+		if !milestones {
+			webhooks, err := b.store.ListWebhooks(ctx, target.Family.ID)
+			if err != nil {
+				return nil, err
+			}
+			milestones = len(webhooks) > 0
+		}
+		if milestones {
+			if _, at, ok := NextMilestoneAtOrAfter(anchor, now.Add(time.Nanosecond)); ok {
+				add(notificationMilestone, at)
+			}
+		}
+	}
+	if !chatReminders {
+		return due, nil
+	}
+
+	active, err := b.store.GetActiveSleep(ctx, target.Child.ID)
+	if err != nil {
+		return nil, err
+	}
+	lastCompleted, err := b.store.GetLastCompletedSleep(ctx, target.Child.ID)
+	if err != nil {
+		return nil, err
+	}
+	lastEvent, err := b.store.GetLatestEventTime(ctx, target.Child.ID)
+	if err != nil {
+		return nil, err
+	}
+	if active == nil && lastCompleted != nil && target.Settings.WakeWindowEnabled {
+		add(notificationWakeWindow, lastCompleted.EndAt.Add(time.Duration(target.Settings.WakeWindowMinutes)*time.Minute))
+	}
+	if active != nil && target.Settings.MaxSleepEnabled {
+		add(notificationMaxSleep, active.StartAt.Add(time.Duration(target.Settings.MaxSleepMinutes)*time.Minute))
+	}
+	if lastEvent != nil && target.Settings.InactivityEnabled {
+		add(notificationInactivity, lastEvent.Add(time.Duration(target.Settings.InactivityMinutes)*time.Minute))
+	}
+
+	reminders, err := b.store.ListCustomReminders(ctx, target.Family.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, reminder := range reminders {
+		if !reminder.Enabled {
+			continue
+		}
+		if at, ok := nextLocalTime(now, reminder.AtTime, reminder.Weekdays, loc); ok {
+			add(notificationCustom, at)
+		}
+	}
+
+	medications, err := b.store.ListMedications(ctx, target.Child.ID)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		doses       []MedicationDose
+		dosesLoaded bool
+	)
+	for _, medication := range medications {
+		for _, atTime := range splitMedicationTimes(medication.AtTimes) {
+			if at, ok := nextLocalTime(now, atTime, everyWeekday, loc); ok {
+				add(notificationMedication, at)
+			}
+		}
+		if medication.MinIntervalMinutes <= 0 || len(splitMedicationTimes(medication.AtTimes)) > 0 {
+			continue
+		}
+		if !dosesLoaded {
+			if doses, err = b.store.ListMedicationDosesSince(ctx, target.Child.ID, now.Add(-medicationDosesLookback)); err != nil {
+				return nil, err
+			}
+			dosesLoaded = true
+		}
+		if at, ok := NextDoseAllowedAt(medication, medicationDoses(doses, medication.ID)); ok {
+			add(notificationMedication, at)
+		}
+	}
+	return due, nil
+}
+
+// nextLocalTime — ближайший после now момент atTime (`15:04`) в таймзоне loc в один из дней
+// недели weekdays (`0,1,…`, 0 — воскресенье).
+func nextLocalTime(now time.Time, atTime string, weekdays string, loc *time.Location) (time.Time, bool) {
+	if atTime == "" {
+		return time.Time{}, false
+	}
+	parsed, err := time.Parse("15:04", atTime)
+	if err != nil {
+		return time.Time{}, false
+	}
+	local := now.In(loc)
+	for day := 0; day <= 7; day++ {
+		at := time.Date(local.Year(), local.Month(), local.Day()+day, parsed.Hour(), parsed.Minute(), 0, 0, loc)
+		if at.After(now) && weekdayIncluded(weekdays, strconv.Itoa(int(at.Weekday()))) {
+			return at, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReminderSchedulerQueue(t *testing.T) {
+	base := time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC)
+	s := newReminderScheduler()
+	s.schedule(1, map[string]time.Time{notificationWakeWindow: base.Add(10 * time.Minute), notificationInactivity: base.Add(5 * time.Minute)})
+	s.schedule(2, map[string]time.Time{notificationMaxSleep: base.Add(7 * time.Minute)})
+
+	if due, ok := s.next(); !ok || !due.Equal(base.Add(5*time.Minute)) {
+		t.Fatalf("expected earliest due in 5m, got %v %v", due, ok)
+	}
+	if got := s.takeDue(base); len(got) != 0 {
+		t.Fatalf("nothing is due yet, got %v", got)
+	}
+	// Наступивший срок забирает из очереди все сроки семьи: их пересчитают после обработки.
+	if got := s.takeDue(base.Add(6 * time.Minute)); !reflect.DeepEqual(got, []int64{1}) {
+		t.Fatalf("expected family 1, got %v", got)
+	}
+	if s.size() != 1 {
+		t.Fatalf("expected only family 2 in queue, got %d entries", s.size())
+	}
+
+	s.schedule(2, map[string]time.Time{notificationMaxSleep: base.Add(time.Hour)})
+	if due, _ := s.next(); !due.Equal(base.Add(time.Hour)) {
+		t.Fatalf("schedule should replace family entries, next %v", due)
+	}
+	s.schedule(2, nil)
+	if _, ok := s.next(); ok {
+		t.Fatalf("queue should be empty")
+	}
+
+	s.touch(3)
+	select {
+	case <-s.wake:
+	default:
+		t.Fatalf("touch should wake the scheduler")
+	}
+	if got := s.takeDue(base); !reflect.DeepEqual(got, []int64{3}) {
+		t.Fatalf("expected touched family 3, got %v", got)
+	}
+	if got := s.takeDue(base); len(got) != 0 {
+		t.Fatalf("touch should be consumed, got %v", got)
+	}
+}
+
+func TestNextLocalTime(t *testing.T) {
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	// Понедельник, 12:00 по Москве.
+	now := time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC)
+	cases := []struct {
+		atTime   string
+		weekdays string
+		want     time.Time
+		ok       bool
+	}{
+		{"12:30", everyWeekday, time.Date(2026, 3, 16, 9, 30, 0, 0, time.UTC), true},
+		{"12:00", everyWeekday, time.Date(2026, 3, 17, 9, 0, 0, 0, time.UTC), true},
+		{"08:00", "0", time.Date(2026, 3, 22, 5, 0, 0, 0, time.UTC), true},
+		{"11:00", "1", time.Date(2026, 3, 23, 8, 0, 0, 0, time.UTC), true},
+		{"", everyWeekday, time.Time{}, false},
+		{"25:00", everyWeekday, time.Time{}, false},
+		{"09:00", "", time.Time{}, false},
+	}
+	for _, tc := range cases {
+		got, ok := nextLocalTime(now, tc.atTime, tc.weekdays, loc)
+		if ok != tc.ok || !got.Equal(tc.want) {
+			t.Fatalf("nextLocalTime(%q, %q) = %v %v, want %v %v", tc.atTime, tc.weekdays, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestReminderTargetsMembers(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(1)
+	h.onboard(2)
+	h.join(1, 3)
+	ctx := context.Background()
+
+	if members, err := h.store.GetFamilyMembers(ctx, 0); err != nil || len(members) != 0 {
+		t.Fatalf("family 0 must have no members, got %v (%v)", members, err)
+	}
+	targets, err := h.store.GetReminderTargets(ctx)
+	if err != nil || len(targets) != 2 {
+		t.Fatalf("expected 2 families, got %d (%v)", len(targets), err)
+	}
+	if len(targets[0].Members) != 2 || len(targets[1].Members) != 1 {
+		t.Fatalf("expected 2 and 1 members, got %d and %d", len(targets[0].Members), len(targets[1].Members))
+	}
+	family, err := h.store.GetFamilyReminderTargets(ctx, targets[1].Family.ID)
+	if err != nil || len(family) != 1 || len(family[0].Members) != 1 || family[0].Members[0].TelegramUserID != 2 {
+		t.Fatalf("unexpected family targets %+v (%v)", family, err)
+	}
+}
+
+// newBenchmarkBot создает бота над базой с families семьями: напоминания включены, сон закончился
+// 10 минут назад, у каждого родителя утренняя сводка — до ближайшего срока больше часа.
+func newBenchmarkBot(b *testing.B, families int) *SleepBot {
+	b.Helper()
+	db, err := openDatabase(filepath.Join(b.TempDir(), "sleepbot.db"))
+	if err != nil {
+		b.Fatalf("open db: %v", err)
+	}
+	b.Cleanup(func() { _ = db.Close() })
+	cfg := Config{DefaultTimezone: "Europe/Moscow", InviteTTL: 24 * time.Hour, MaxBackdate: 48 * time.Hour}
+	store, err := NewStore(db, cfg)
+	if err != nil {
+		b.Fatalf("init store: %v", err)
+	}
+	now := time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC)
+	store.clock = func() time.Time { return now }
+
+	tx, err := db.Begin()
+	if err != nil {
+		b.Fatalf("begin: %v", err)
+	}
+	created := toStoredTime(now)
+	for i := 1; i <= families; i++ {
+		statements := []struct {
+			query string
+			args  []any
+		}{
+			{`INSERT INTO families(id, name, timezone, created_at, updated_at) VALUES (?, 'Семья', 'Europe/Moscow', ?, ?)`, []any{i, created, created}},
+			{`INSERT INTO children(id, family_id, name, birth_date, created_at, updated_at) VALUES (?, ?, 'Маша', '2026-01-10T09:00:00Z', ?, ?)`, []any{i, i, created, created}},
+			{`INSERT INTO reminder_settings(family_id, reminders_enabled, wake_window_enabled, max_sleep_enabled, inactivity_enabled,
+				wake_window_minutes, max_sleep_minutes, inactivity_minutes, milestone_notify_each, milestone_report_today, created_at, updated_at)
+				VALUES (?, 1, 1, 1, 1, 90, 120, 240, 0, 0, ?, ?)`, []any{i, created, created}},
+			{`INSERT INTO family_members(id, family_id, telegram_user_id, telegram_chat_id, display_name, role, digest_daily_at, created_at, updated_at)
+				VALUES (?, ?, ?, ?, 'Родитель', 'owner', '08:00', ?, ?)`, []any{i, i, i, i, created, created}},
+			{`INSERT INTO sleep_sessions(child_id, start_at, end_at, start_source, created_by, updated_by, created_at, updated_at)
+				VALUES (?, ?, ?, 'manual', ?, ?, ?, ?)`, []any{i, toStoredTime(now.Add(-time.Hour)), toStoredTime(now.Add(-10 * time.Minute)), i, i, created, created}},
+		}
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+				b.Fatalf("seed family %d: %v", i, err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatalf("commit: %v", err)
+	}
+	bot := NewSleepBot(newFakeTelegram(), store, cfg)
+	if err := bot.processReminders(context.Background()); err != nil {
+		b.Fatalf("process reminders: %v", err)
+	}
+	return bot
+}
+
+// Полный проход при старте: обработка и расчет сроков для каждой семьи.
+func BenchmarkReminderStartup10k(b *testing.B) {
+	bot := newBenchmarkBot(b, 10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := bot.processReminders(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(bot.reminders.size()), "queued")
+}
+
+// Пробуждение, когда ничего не наступило: ни одного запроса к базе.
+func BenchmarkReminderIdleWake10k(b *testing.B) {
+	bot := newBenchmarkBot(b, 10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bot.runDueReminders(context.Background())
+	}
+}
+
+// Пересчет одной семьи после изменения ее данных — столько стоит каждое обновление от участника.
+func BenchmarkReminderTouch10k(b *testing.B) {
+	bot := newBenchmarkBot(b, 10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bot.reminders.touch(int64(i%10000 + 1))
+		bot.runDueReminders(context.Background())
+	}
+}
+
+// Срок наступил у одной из 10k семей: обрабатывается только она.
+func BenchmarkReminderDueFamily10k(b *testing.B) {
+	bot := newBenchmarkBot(b, 10000)
+	due := bot.now().Add(-time.Second)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		familyID := int64(i%10000 + 1)
+		bot.reminders.schedule(familyID, map[string]time.Time{notificationWakeWindow: due})
+		bot.runDueReminders(context.Background())
+	}
+	if got := bot.reminders.size(); got < 10000 {
+		b.Fatalf("expected every family to stay queued, got %d entries", got)
+	}
+}
+
+func TestFamilyPumpingStates(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(1)
+	h.join(1, 2)
+	h.onboard(3)
+	ctx := context.Background()
+	owner, err := h.store.GetUserContext(ctx, 1)
+	if err != nil {
+		t.Fatalf("owner context: %v", err)
+	}
+	partner, err := h.store.GetUserContext(ctx, 2)
+	if err != nil {
+		t.Fatalf("partner context: %v", err)
+	}
+	other, err := h.store.GetUserContext(ctx, 3)
+	if err != nil {
+		t.Fatalf("other context: %v", err)
+	}
+
+	now := h.clock.Now()
+	for _, end := range []time.Time{now.Add(-5 * time.Hour), now.Add(-2 * time.Hour)} {
+		if _, err := h.store.AddPumping(ctx, owner.Child.ID, owner.Member.ID, pumpSideLeft, 80, end.Add(-20*time.Minute), end); err != nil {
+			t.Fatalf("add pumping: %v", err)
+		}
+	}
+	if _, err := h.store.StartPumping(ctx, partner.Child.ID, partner.Member.ID, now.Add(-time.Minute)); err != nil {
+		t.Fatalf("start pumping: %v", err)
+	}
+	if _, err := h.store.AddPumping(ctx, other.Child.ID, other.Member.ID, pumpSideLeft, 80, now.Add(-time.Hour), now.Add(-30*time.Minute)); err != nil {
+		t.Fatalf("add pumping: %v", err)
+	}
+
+	states, err := h.store.GetFamilyPumpingStates(ctx, owner.Family.ID)
+	if err != nil {
+		t.Fatalf("pumping states: %v", err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("expected states of 2 family members, got %v", states)
+	}
+	if state := states[owner.Member.ID]; state.Active || state.LastEnd == nil || !state.LastEnd.Equal(now.Add(-2*time.Hour)) {
+		t.Fatalf("owner should have the latest end and no timer, got %+v", state)
+	}
+	if state := states[partner.Member.ID]; !state.Active || state.LastEnd != nil {
+		t.Fatalf("partner should have only a running timer, got %+v", state)
+	}
+}
+
+func TestScenarioPumpingReminderScheduled(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(100)
+	h.join(100, 200)
+	ctx := context.Background()
+	userCtx, err := h.store.GetUserContext(ctx, 100)
+	if err != nil {
+		t.Fatalf("user context: %v", err)
+	}
+	if err := h.store.SetPumpInterval(ctx, userCtx.Member.ID, 180); err != nil {
+		t.Fatalf("set pump interval: %v", err)
+	}
+	end := h.clock.Now()
+	if _, err := h.store.AddPumping(ctx, userCtx.Child.ID, userCtx.Member.ID, pumpSideBoth, 120, end.Add(-20*time.Minute), end); err != nil {
+		t.Fatalf("add pumping: %v", err)
+	}
+	h.bot.reminders.touch(userCtx.Family.ID)
+	if sent := h.processReminders(); len(sent) != 0 {
+		t.Fatalf("no reminders expected yet, got:\n%s", joinTexts(sent))
+	}
+	if due, ok := h.bot.reminders.next(); !ok || !due.Equal(end.Add(180*time.Minute)) {
+		t.Fatalf("expected pumping due at %v, got %v %v", end.Add(180*time.Minute), due, ok)
+	}
+
+	h.clock.Advance(180 * time.Minute)
+	sent := h.processReminders()
+	if got := joinTexts(messagesTo(sent, 100)); !strings.Contains(got, "Пора сцеживаться") {
+		t.Fatalf("expected pumping reminder, got:\n%s", joinTexts(sent))
+	}
+	if other := messagesTo(sent, 200); len(other) != 0 {
+		t.Fatalf("pumping reminder is personal, partner got:\n%s", joinTexts(other))
+	}
+}
+
+func TestScenarioMedicationIntervalReminder(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(100)
+	h.expect(100, "/reminders_on", "напоминания включены")
+	h.send(100, "/addmed Нурофен; 2.5 мл; каждые 6 ч")
+	ctx := context.Background()
+	userCtx, err := h.store.GetUserContext(ctx, 100)
+	if err != nil {
+		t.Fatalf("user context: %v", err)
+	}
+	medications, err := h.store.ListMedications(ctx, userCtx.Child.ID)
+	if err != nil || len(medications) != 1 || medications[0].MinIntervalMinutes != 360 {
+		t.Fatalf("expected one medication with a 6 h interval, got %+v (%v)", medications, err)
+	}
+	h.send(100, "/give "+strconv.FormatInt(medications[0].ID, 10))
+	given := h.clock.Now()
+	if sent := h.processReminders(); len(sent) != 0 {
+		t.Fatalf("no reminders expected right after the dose, got:\n%s", joinTexts(sent))
+	}
+
+	h.clock.Advance(6*time.Hour - time.Minute)
+	if sent := h.processReminders(); strings.Contains(joinTexts(sent), "можно дать") {
+		t.Fatalf("interval notice fired too early:\n%s", joinTexts(sent))
+	}
+	h.clock.Advance(time.Minute)
+	if got := joinTexts(h.processReminders()); !strings.Contains(got, "следующую можно дать") || !strings.Contains(got, formatLocalDateTime(given, h.bot.mustLocation(userCtx.Family.Timezone))) {
+		t.Fatalf("expected next dose notice after 6 h, got:\n%s", got)
+	}
+	h.bot.reminders.touch(userCtx.Family.ID)
+	if sent := h.processReminders(); strings.Contains(joinTexts(sent), "можно дать") {
+		t.Fatalf("notice should be sent once per dose:\n%s", joinTexts(sent))
+	}
+}
+
+func TestScenarioCustomReminderFiresOnceInCatchUpWindow(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(100)
+	h.join(100, 200)
+	h.expect(100, "/reminders_on", "напоминания включены")
+	ctx := context.Background()
+	userCtx, err := h.store.GetUserContext(ctx, 100)
+	if err != nil {
+		t.Fatalf("user context: %v", err)
+	}
+	// Часы харнесса показывают 12:00 по Москве.
+	if err := h.store.AddCustomReminder(ctx, userCtx.Family.ID, "12:30", "Витамин D", everyWeekday); err != nil {
+		t.Fatalf("add custom reminder: %v", err)
+	}
+	h.bot.reminders.touch(userCtx.Family.ID)
+
+	fired := 0
+	count := func(sent []fakeMessage) {
+		fired += strings.Count(joinTexts(messagesTo(sent, 100)), "Напоминание: Витамин D")
+	}
+	h.clock.Advance(29 * time.Minute)
+	count(h.processReminders())
+	if fired != 0 {
+		t.Fatalf("custom reminder fired before 12:30")
+	}
+	// Проход опоздал на две минуты, но еще попадает в окно customReminderCatchUp.
+	h.clock.Advance(3 * time.Minute)
+	sent := h.processReminders()
+	count(sent)
+	if fired != 1 || len(messagesTo(sent, 200)) != 1 {
+		t.Fatalf("expected the reminder once for every member, got:\n%s", joinTexts(sent))
+	}
+	// Лишние проходы внутри окна и сразу после него ничего не повторяют.
+	for range 4 {
+		h.clock.Advance(time.Minute)
+		h.bot.reminders.touch(userCtx.Family.ID)
+		count(h.processReminders())
+	}
+	if fired != 1 {
+		t.Fatalf("custom reminder fired %d times within the catch-up window", fired)
+	}
+}
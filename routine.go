@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Шаги ритуала укладывания, пока семья не задала свои через /routine_steps.
+var defaultRoutineSteps = []string{"Купание", "Массаж", "Кормление", "Книжка", "Выключить свет"}
+
+const (
+	routineMaxSteps      = 10
+	routineMaxStepLength = 40
+	// Ритуал, начатый до этого часа, относится к предыдущему вечеру.
+	routineEveningCutoffHour = 5
+	// Сон, начавшийся позже этого срока после старта ритуала, с ним не связывается.
+	routineSleepLinkWindow = 4 * time.Hour
+	// Период /routine_report по умолчанию, дней.
+	routineReportDays = 14
+)
+
+// parseRoutineSteps разбирает шаги через запятую: `купание, массаж, книжка`.
+func parseRoutineSteps(args string) ([]string, error) {
+	var steps []string
+	for _, step := range strings.Split(args, ",") {
+		step = strings.TrimSpace(step)
+		if step == "" {
+			continue
+		}
+		if len([]rune(step)) > routineMaxStepLength {
+			return nil, fmt.Errorf("шаг длиннее %d символов", routineMaxStepLength)
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("нужен хотя бы один шаг")
+	}
+	if len(steps) > routineMaxSteps {
+		return nil, fmt.Errorf("не больше %d шагов", routineMaxSteps)
+	}
+	return steps, nil
+}
+
+// routineEvening — локальная дата вечера (`2006-01-02`), к которому относится момент now.
+func routineEvening(now time.Time, loc *time.Location) string {
+	local := now.In(loc)
+	if local.Hour() < routineEveningCutoffHour {
+		local = local.AddDate(0, 0, -1)
+	}
+	return local.Format("2006-01-02")
+}
+
+func routineEveningDate(run RoutineRun, loc *time.Location) time.Time {
+	date, err := time.ParseInLocation("2006-01-02", run.Evening, loc)
+	if err != nil {
+		return startOfDay(run.StartedAt, loc)
+	}
+	return date
+}
+
+// lastRoutineMark — время последнего отмеченного шага; без отметок — время старта.
+func lastRoutineMark(run RoutineRun) time.Time {
+	last := run.StartedAt
+	for _, doneAt := range run.Marks {
+		if doneAt.After(last) {
+			last = doneAt
+		}
+	}
+	return last
+}
+
+// BuildRoutineChecklist — текст сообщения с кнопками шагов ритуала.
+func BuildRoutineChecklist(run RoutineRun, loc *time.Location) string {
+	text := fmt.Sprintf("Ритуал на вечер %s: выполнено %d из %d, начат в %s.",
+		routineEveningDate(run, loc).Format("02.01"), len(run.Marks), len(run.Steps), run.StartedAt.In(loc).Format("15:04"),
+	)
+	if len(run.Marks) == len(run.Steps) {
+		return text + " Все шаги выполнены — отметьте начало сна, и ритуал попадет в `/routine_report`."
+	}
+	return text + " Отмечайте шаги кнопками по мере выполнения."
+}
+
+// RoutineOutcome — ритуал вечера и то, чем он закончился: через сколько после последнего шага
+// ребенок уснул и сколько раз просыпался ночью.
+type RoutineOutcome struct {
+	Run         RoutineRun
+	Complete    bool
+	Sleep       *SleepSession
+	TimeToSleep time.Duration
+	HasNight    bool
+	Wakings     int
+}
+
+// AnalyzeRoutine связывает ритуал с первым сном, начавшимся в течение routineSleepLinkWindow после старта,
+// и с ночью, закончившейся утром следующего дня.
+func AnalyzeRoutine(run RoutineRun, sessions []SleepSession, loc *time.Location) RoutineOutcome {
+	outcome := RoutineOutcome{Run: run, Complete: len(run.Marks) == len(run.Steps)}
+	for i := range sessions {
+		session := sessions[i]
+		if session.StartAt.Before(run.StartedAt) || session.StartAt.After(run.StartedAt.Add(routineSleepLinkWindow)) {
+			continue
+		}
+		if outcome.Sleep == nil || session.StartAt.Before(outcome.Sleep.StartAt) {
+			outcome.Sleep = &session
+		}
+	}
+	if outcome.Sleep != nil {
+		outcome.TimeToSleep = max(outcome.Sleep.StartAt.Sub(lastRoutineMark(run)), 0)
+	}
+	night := SummarizeNight(sessions, routineEveningDate(run, loc).AddDate(0, 0, 1), loc)
+	outcome.HasNight = night.SleepCount > 0
+	outcome.Wakings = night.Wakings
+	return outcome
+}
+
+// routineStartMinutes — время старта в минутах от полуночи вечера; старт после полуночи дает больше 24 ч.
+func routineStartMinutes(run RoutineRun, loc *time.Location) int {
+	return int(run.StartedAt.In(loc).Sub(routineEveningDate(run, loc)) / time.Minute)
+}
+
+func formatRoutineMinutes(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60%24, minutes%60)
+}
+
+// BuildRoutineReport — ритуалы за период: по каждому вечеру старт, полнота, засыпание и ночные
+// пробуждения; затем сравнение ранних и поздних стартов (относительно медианы) и полных и неполных ритуалов.
+func BuildRoutineReport(runs []RoutineRun, sessions []SleepSession, days int, loc *time.Location) string {
+	if len(runs) == 0 {
+		return fmt.Sprintf("За %d %s ритуалов нет. Начните сегодняшний: /routine", days, ruPlural(days, "день", "дня", "дней"))
+	}
+	lines := []string{fmt.Sprintf("Вечерний ритуал за %d %s:", days, ruPlural(days, "день", "дня", "дней"))}
+	outcomes := make([]RoutineOutcome, 0, len(runs))
+	starts := make([]int, 0, len(runs))
+	for _, run := range runs {
+		outcome := AnalyzeRoutine(run, sessions, loc)
+		outcomes = append(outcomes, outcome)
+		starts = append(starts, routineStartMinutes(run, loc))
+
+		line := fmt.Sprintf("%s: начало %s, %d/%d", routineEveningDate(run, loc).Format("02.01"), run.StartedAt.In(loc).Format("15:04"), len(run.Marks), len(run.Steps))
+		if outcome.Sleep != nil {
+			line += fmt.Sprintf(" — уснул в %s (через %s)", outcome.Sleep.StartAt.In(loc).Format("15:04"), formatDurationRU(outcome.TimeToSleep))
+		} else {
+			line += " — сон не записан"
+		}
+		if outcome.HasNight {
+			line += fmt.Sprintf(", пробуждений %d", outcome.Wakings)
+		}
+		lines = append(lines, line)
+	}
+
+	sort.Ints(starts)
+	median := starts[len(starts)/2]
+	var early, late, complete, partial []RoutineOutcome
+	for _, outcome := range outcomes {
+		if routineStartMinutes(outcome.Run, loc) < median {
+			early = append(early, outcome)
+		} else {
+			late = append(late, outcome)
+		}
+		if outcome.Complete {
+			complete = append(complete, outcome)
+		} else {
+			partial = append(partial, outcome)
+		}
+	}
+
+	lines = append(lines, "", "*Время начала:*")
+	lines = append(lines,
+		formatRoutineGroup("до "+formatRoutineMinutes(median), early),
+		formatRoutineGroup(formatRoutineMinutes(median)+" и позже", late),
+	)
+	lines = append(lines, "", "*Полнота:*")
+	lines = append(lines,
+		formatRoutineGroup("все шаги", complete),
+		formatRoutineGroup("не все шаги", partial),
+	)
+	lines = append(lines, "", "Засыпание считается от последнего отмеченного шага до начала сна.")
+	return strings.Join(lines, "\n")
+}
+
+func formatRoutineGroup(title string, outcomes []RoutineOutcome) string {
+	if len(outcomes) == 0 {
+		return title + " — нет вечеров"
+	}
+	var toSleep time.Duration
+	linked, nights, wakings := 0, 0, 0
+	for _, outcome := range outcomes {
+		if outcome.Sleep != nil {
+			linked++
+			toSleep += outcome.TimeToSleep
+		}
+		if outcome.HasNight {
+			nights++
+			wakings += outcome.Wakings
+		}
+	}
+	parts := []string{fmt.Sprintf("%s — %d %s", title, len(outcomes), ruPlural(len(outcomes), "вечер", "вечера", "вечеров"))}
+	if linked > 0 {
+		parts = append(parts, "засыпание в среднем "+formatDurationRU(toSleep/time.Duration(linked)))
+	}
+	if nights > 0 {
+		parts = append(parts, fmt.Sprintf("пробуждений в среднем %.1f", math.Round(float64(wakings)/float64(nights)*10)/10))
+	}
+	return strings.Join(parts, ", ")
+}
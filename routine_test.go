@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRoutineStepsAndEvening(t *testing.T) {
+	steps, err := parseRoutineSteps(" Купание, массаж,, книжка ")
+	if err != nil || strings.Join(steps, "|") != "Купание|массаж|книжка" {
+		t.Fatalf("unexpected steps: %v %v", steps, err)
+	}
+	if _, err := parseRoutineSteps(" , "); err == nil {
+		t.Fatal("expected error for empty steps")
+	}
+
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	if got := routineEvening(time.Date(2026, 3, 17, 0, 30, 0, 0, loc), loc); got != "2026-03-16" {
+		t.Fatalf("after midnight belongs to the previous evening, got %s", got)
+	}
+	if got := routineEvening(time.Date(2026, 3, 16, 19, 30, 0, 0, loc), loc); got != "2026-03-16" {
+		t.Fatalf("unexpected evening %s", got)
+	}
+}
+
+func TestBuildRoutineReportComparesGroups(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, loc).UTC()
+	}
+	sleep := func(start time.Time, end time.Time) SleepSession {
+		return SleepSession{StartAt: start, EndAt: &end}
+	}
+	steps := []string{"Купание", "Книжка"}
+	runs := []RoutineRun{
+		{Evening: "2026-03-14", Steps: steps, StartedAt: at(14, 19, 0), Marks: map[int]time.Time{0: at(14, 19, 10), 1: at(14, 19, 40)}},
+		{Evening: "2026-03-15", Steps: steps, StartedAt: at(15, 20, 30), Marks: map[int]time.Time{0: at(15, 20, 40)}},
+		{Evening: "2026-03-16", Steps: steps, StartedAt: at(16, 21, 0), Marks: map[int]time.Time{}},
+	}
+	sessions := []SleepSession{
+		sleep(at(14, 19, 50), at(15, 2, 0)),
+		sleep(at(15, 2, 30), at(15, 7, 0)),
+		sleep(at(15, 21, 40), at(16, 1, 0)),
+		sleep(at(16, 1, 20), at(16, 4, 0)),
+		sleep(at(16, 4, 30), at(16, 7, 0)),
+	}
+
+	outcome := AnalyzeRoutine(runs[0], sessions, loc)
+	if !outcome.Complete || outcome.TimeToSleep != 10*time.Minute || outcome.Wakings != 1 {
+		t.Fatalf("unexpected outcome: %+v", outcome)
+	}
+
+	report := BuildRoutineReport(runs, sessions, 3, loc)
+	for _, want := range []string{
+		"14.03: начало 19:00, 2/2 — уснул в 19:50 (через 10 мин), пробуждений 1",
+		"15.03: начало 20:30, 1/2 — уснул в 21:40 (через 1 ч), пробуждений 2",
+		"16.03: начало 21:00, 0/2 — сон не записан",
+		"до 20:30 — 1 вечер, засыпание в среднем 10 мин, пробуждений в среднем 1.0",
+		"20:30 и позже — 2 вечера, засыпание в среднем 1 ч, пробуждений в среднем 2.0",
+		"не все шаги — 2 вечера",
+	} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("expected %q in report:\n%s", want, report)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sleepTagOption — условие сна: ID хранится в sleep_sessions.tags и в CSV, Label показывается в боте.
+type sleepTagOption struct {
+	ID    string
+	Label string
+}
+
+// Теги сгруппированы: в каждой группе у сна может быть отмечен только один вариант.
+var sleepTagGroups = [][]sleepTagOption{
+	{
+		{ID: "crib", Label: "кроватка"},
+		{ID: "stroller", Label: "коляска"},
+		{ID: "car", Label: "автокресло"},
+		{ID: "arms", Label: "на руках"},
+	},
+	{
+		{ID: "fed", Label: "с кормлением"},
+		{ID: "rocked", Label: "укачали"},
+		{ID: "self", Label: "сам"},
+	},
+}
+
+// Период /bytag по умолчанию, дней.
+const sleepTagReportDays = 30
+
+func sleepTagLabel(id string) (string, bool) {
+	for _, group := range sleepTagGroups {
+		for _, option := range group {
+			if option.ID == id {
+				return option.Label, true
+			}
+		}
+	}
+	return "", false
+}
+
+// resolveSleepTag находит тег по ID или подписи: `stroller`, `коляска`, `#коляска`.
+func resolveSleepTag(raw string) (string, bool) {
+	raw = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(raw), "#"))
+	for _, group := range sleepTagGroups {
+		for _, option := range group {
+			if raw == option.ID || raw == option.Label {
+				return option.ID, true
+			}
+		}
+	}
+	return "", false
+}
+
+// toggleSleepTag снимает тег, если он уже отмечен, иначе отмечает его вместо другого варианта той же группы.
+// Результат упорядочен как sleepTagGroups.
+func toggleSleepTag(tags []string, tag string) []string {
+	selected := map[string]bool{}
+	for _, existing := range tags {
+		selected[existing] = true
+	}
+	wasSelected := selected[tag]
+	for _, group := range sleepTagGroups {
+		inGroup := false
+		for _, option := range group {
+			if option.ID == tag {
+				inGroup = true
+			}
+		}
+		if inGroup {
+			for _, option := range group {
+				delete(selected, option.ID)
+			}
+		}
+	}
+	if !wasSelected {
+		selected[tag] = true
+	}
+
+	var result []string
+	for _, group := range sleepTagGroups {
+		for _, option := range group {
+			if selected[option.ID] {
+				result = append(result, option.ID)
+			}
+		}
+	}
+	return result
+}
+
+func allSleepTagIDs() []string {
+	var ids []string
+	for _, group := range sleepTagGroups {
+		for _, option := range group {
+			ids = append(ids, option.ID)
+		}
+	}
+	return ids
+}
+
+func formatSleepTags(tags []string) string {
+	labels := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if label, ok := sleepTagLabel(tag); ok {
+			labels = append(labels, label)
+		}
+	}
+	return strings.Join(labels, ", ")
+}
+
+func hasSleepTag(session SleepSession, tag string) bool {
+	for _, existing := range session.Tags {
+		if existing == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// isNap — сон, начавшийся в дневном окне (как дневные сны в SummarizeDayNight).
+func isNap(session SleepSession, loc *time.Location) bool {
+	hour := session.StartAt.In(loc).Hour()
+	return hour >= dayWindowStartHour && hour < dayWindowEndHour
+}
+
+func formatSleepInterval(session SleepSession, loc *time.Location) string {
+	return fmt.Sprintf("%s–%s", formatLocalDateTime(session.StartAt, loc), session.EndAt.In(loc).Format("15:04"))
+}
+
+// BuildSleepTagsPrompt — текст сообщения с кнопками тегов для сна.
+func BuildSleepTagsPrompt(session SleepSession, loc *time.Location) string {
+	lines := []string{fmt.Sprintf("Сон %s: где и как уснул? Отметьте — так будет видно, при каких условиях сон длиннее (`/bytag`).", formatSleepInterval(session, loc))}
+	if session.Note != "" {
+		lines = append(lines, "Заметка: "+escapeTelegramMarkdown(session.Note))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// BuildSleepTagReport — дневные сны за период по тегам. Без tag — средняя длительность по каждому тегу
+// относительно всех дневных снов; с tag — список снов с этим тегом.
+func BuildSleepTagReport(sessions []SleepSession, tag string, start time.Time, end time.Time, loc *time.Location) string {
+	var naps []SleepSession
+	var total time.Duration
+	for _, session := range sessions {
+		if session.EndAt == nil || session.StartAt.Before(start) || !session.StartAt.Before(end) || !isNap(session, loc) {
+			continue
+		}
+		naps = append(naps, session)
+		total += session.EndAt.Sub(session.StartAt)
+	}
+	period := fmt.Sprintf("%s–%s", start.In(loc).Format("02.01"), end.In(loc).Add(-time.Nanosecond).Format("02.01"))
+	if len(naps) == 0 {
+		return fmt.Sprintf("За %s дневных снов нет.", period)
+	}
+	average := total / time.Duration(len(naps))
+
+	if tag != "" {
+		label, _ := sleepTagLabel(tag)
+		lines := []string{fmt.Sprintf("Дневные сны «%s» за %s:", label, period)}
+		var tagged time.Duration
+		count := 0
+		for _, nap := range naps {
+			if !hasSleepTag(nap, tag) {
+				continue
+			}
+			count++
+			tagged += nap.EndAt.Sub(nap.StartAt)
+			line := fmt.Sprintf("%s — %s (%s)", formatSleepInterval(nap, loc), formatDurationRU(nap.EndAt.Sub(nap.StartAt)), formatSleepTags(nap.Tags))
+			if nap.Note != "" {
+				line += ": " + escapeTelegramMarkdown(nap.Note)
+			}
+			lines = append(lines, line)
+		}
+		if count == 0 {
+			return fmt.Sprintf("За %s нет дневных снов с тегом «%s».", period, label)
+		}
+		lines = append(lines, "", fmt.Sprintf("В среднем %s против %s по всем %d дневным снам.", formatDurationRU(tagged/time.Duration(count)), formatDurationRU(average), len(naps)))
+		return strings.Join(lines, "\n")
+	}
+
+	lines := []string{
+		fmt.Sprintf("Дневные сны по условиям за %s: %d %s, в среднем %s.", period, len(naps), ruPlural(len(naps), "сон", "сна", "снов"), formatDurationRU(average)),
+	}
+	untagged := 0
+	for _, nap := range naps {
+		if len(nap.Tags) == 0 {
+			untagged++
+		}
+	}
+	for _, group := range sleepTagGroups {
+		lines = append(lines, "")
+		for _, option := range group {
+			var sum time.Duration
+			count := 0
+			for _, nap := range naps {
+				if hasSleepTag(nap, option.ID) {
+					count++
+					sum += nap.EndAt.Sub(nap.StartAt)
+				}
+			}
+			if count == 0 {
+				lines = append(lines, fmt.Sprintf("%s — нет снов", option.Label))
+				continue
+			}
+			tagAverage := sum / time.Duration(count)
+			lines = append(lines, fmt.Sprintf("%s — %d, в среднем %s (%s)", option.Label, count, formatDurationRU(tagAverage), formatAverageDelta(tagAverage-average)))
+		}
+	}
+	lines = append(lines, "", fmt.Sprintf("Без тегов: %d. Отметить условия — кнопками после сна или `/tags`; подробнее по тегу — `/bytag коляска`.", untagged))
+	return strings.Join(lines, "\n")
+}
+
+func formatAverageDelta(delta time.Duration) string {
+	if delta.Abs() < time.Minute {
+		return "как в среднем"
+	}
+	if delta > 0 {
+		return "+" + formatDurationRU(delta)
+	}
+	return "−" + formatDurationRU(delta)
+}
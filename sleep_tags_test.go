@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToggleSleepTagKeepsOneOptionPerGroup(t *testing.T) {
+	tags := toggleSleepTag(nil, "stroller")
+	tags = toggleSleepTag(tags, "self")
+	tags = toggleSleepTag(tags, "crib")
+	if strings.Join(tags, ",") != "crib,self" {
+		t.Fatalf("crib should replace stroller, got %v", tags)
+	}
+	if tags = toggleSleepTag(tags, "self"); strings.Join(tags, ",") != "crib" {
+		t.Fatalf("second tap should clear the tag, got %v", tags)
+	}
+	if id, ok := resolveSleepTag("#Коляска"); !ok || id != "stroller" {
+		t.Fatalf("expected stroller, got %q %t", id, ok)
+	}
+}
+
+func TestBuildSleepTagReportComparesNaps(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	start := time.Date(2026, 3, 10, 0, 0, 0, 0, loc)
+	end := time.Date(2026, 3, 17, 0, 0, 0, 0, loc)
+	add := func(day int, hour int, duration time.Duration, tags ...string) SleepSession {
+		startAt := time.Date(2026, 3, day, hour, 0, 0, 0, loc).UTC()
+		endAt := startAt.Add(duration)
+		return SleepSession{StartAt: startAt, EndAt: &endAt, Tags: tags}
+	}
+	sessions := []SleepSession{
+		add(14, 10, 2*time.Hour, "stroller"),
+		add(15, 10, 2*time.Hour, "stroller", "self"),
+		add(16, 10, time.Hour, "crib"),
+		add(16, 14, time.Hour),
+		add(15, 21, 9*time.Hour, "crib"),
+	}
+
+	report := BuildSleepTagReport(sessions, "", start, end, loc)
+	for _, want := range []string{
+		"за 10.03–16.03: 4 сна, в среднем 1 ч 30 мин.",
+		"коляска — 2, в среднем 2 ч (+30 мин)",
+		"кроватка — 1, в среднем 1 ч (−30 мин)",
+		"автокресло — нет снов",
+		"Без тегов: 1.",
+	} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("expected %q in report:\n%s", want, report)
+		}
+	}
+
+	filtered := BuildSleepTagReport(sessions, "stroller", start, end, loc)
+	for _, want := range []string{
+		"Дневные сны «коляска» за 10.03–16.03:",
+		"15.03 10:00–12:00 — 2 ч (коляска, сам)",
+		"В среднем 2 ч против 1 ч 30 мин по всем 4 дневным снам.",
+	} {
+		if !strings.Contains(filtered, want) {
+			t.Fatalf("expected %q in report:\n%s", want, filtered)
+		}
+	}
+}
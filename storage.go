@@ -18,8 +18,23 @@ const (
 	sourceRealTime      = "real_time"
 	sourceQuickBackdate = "quick_backdated"
 	sourceManual        = "manual"
+	sourceAPI           = "api"
 )
 
+// validationError — отказ Store из-за входных данных (время в будущем, пересечение снов…),
+// а не из-за базы: его текст можно показать пользователю.
+type validationError struct {
+	message string
+}
+
+func (e *validationError) Error() string {
+	return e.message
+}
+
+func invalidInput(format string, args ...any) error {
+	return &validationError{message: fmt.Sprintf(format, args...)}
+}
+
 type Store struct {
 	db     *sql.DB
 	cfg    Config
@@ -35,6 +50,14 @@ type Member struct {
 	TelegramChatID int64
 	DisplayName    string
 	Role           string
+	// Время сводок `15:04` в таймзоне семьи; пустая строка — сводка выключена.
+	DailyDigestAt  string
+	WeeklyDigestAt string
+	// Напоминать о сцеживании, если с конца последнего прошло столько минут; 0 — выключено.
+	PumpIntervalMinutes int
+	// Когда Telegram ответил 403 (участник заблокировал бота); такие участники не получают
+	// уведомлений, пока снова не напишут боту.
+	BlockedAt *time.Time
 }
 
 type Family struct {
@@ -48,6 +71,128 @@ type Child struct {
 	FamilyID  int64
 	Name      string
 	BirthDate *time.Time
+	// Sex — childSexBoy, childSexGirl или пустая строка, если не указан (нужен для перцентилей ВОЗ).
+	Sex string
+}
+
+const (
+	childSexBoy  = "boy"
+	childSexGirl = "girl"
+)
+
+// Виды измерений в таблице measurements.
+const (
+	measurementWeight = "weight"
+	measurementHeight = "height"
+	measurementHead   = "head"
+)
+
+// Measurement — одно измерение: вес в кг, рост и окружность головы в см.
+type Measurement struct {
+	ID         int64
+	ChildID    int64
+	Kind       string
+	Value      float64
+	MeasuredAt time.Time
+	CreatedBy  int64
+}
+
+// Medication — лекарство или витамин ребенка. AtTimes — время приёма по расписанию `09:00,21:00`
+// (пусто — по необходимости), MinIntervalMinutes — минимальный интервал между дозами (0 — без ограничения).
+type Medication struct {
+	ID                 int64
+	ChildID            int64
+	Name               string
+	Dose               string
+	AtTimes            string
+	MinIntervalMinutes int
+	CreatedBy          int64
+}
+
+// MedicationDose — отметка о том, что дозу дали; GivenByName — имя родителя для показа второму.
+type MedicationDose struct {
+	ID           int64
+	MedicationID int64
+	GivenAt      time.Time
+	GivenBy      int64
+	GivenByName  string
+}
+
+// Записи журнала здоровья.
+const (
+	healthTemperature = "temperature"
+	healthSymptom     = "symptom"
+)
+
+// HealthEntry — измерение температуры (Temperature, °C) или симптомы с тегами и заметкой.
+type HealthEntry struct {
+	ID          int64
+	ChildID     int64
+	Kind        string
+	Temperature float64
+	Tags        []string
+	Note        string
+	RecordedAt  time.Time
+	CreatedBy   int64
+}
+
+// ActivitySession — активность вида Kind (`tummy`, `walk`, `play`); EndAt == nil, пока она идет.
+// Сон хранится отдельно в SleepSession: на активности его аналитика не распространяется.
+type ActivitySession struct {
+	ID        int64
+	ChildID   int64
+	Kind      string
+	StartAt   time.Time
+	EndAt     *time.Time
+	CreatedBy int64
+	UpdatedBy int64
+}
+
+// PumpingSession — сцеживание участника семьи MemberID; EndAt == nil, пока идет таймер.
+type PumpingSession struct {
+	ID         int64
+	ChildID    int64
+	MemberID   int64
+	MemberName string
+	Side       string
+	VolumeML   int
+	StartAt    time.Time
+	EndAt      *time.Time
+}
+
+// PumpingState — сцеживания участника для напоминаний: конец последнего и идет ли сейчас таймер.
+type PumpingState struct {
+	LastEnd *time.Time
+	Active  bool
+}
+
+// MilkBag — пакет сцеженного молока в запасе; RemainingML уменьшается при кормлении из бутылочки.
+type MilkBag struct {
+	ID          int64
+	ChildID     int64
+	PumpingID   int64
+	VolumeML    int
+	RemainingML int
+	Storage     string
+	PumpedAt    time.Time
+	ExpiresAt   time.Time
+}
+
+// MilkBagUse — сколько молока взято из пакета BagID при кормлении.
+type MilkBagUse struct {
+	BagID    int64
+	VolumeML int
+}
+
+// RoutineRun — ритуал укладывания за вечер Evening (`2006-01-02`, локальная дата): снимок шагов
+// на момент старта и время отметки каждого выполненного шага (индекс в Steps).
+type RoutineRun struct {
+	ID        int64
+	ChildID   int64
+	Evening   string
+	Steps     []string
+	StartedAt time.Time
+	Marks     map[int]time.Time
 }
 
 type SleepSession struct {
@@ -58,8 +203,10 @@ type SleepSession struct {
 	StartSource string
 	EndSource   string
 	Note        string
-	CreatedBy   int64
-	UpdatedBy   int64
+	// Tags — условия сна из sleepTagOptions (место, как уснул).
+	Tags      []string
+	CreatedBy int64
+	UpdatedBy int64
 }
 
 type ReminderSettings struct {
@@ -73,6 +220,8 @@ type ReminderSettings struct {
 	InactivityMinutes    int
 	MilestoneNotifyEach  bool
 	MilestoneReportToday bool
+	// Порог температуры для оповещения всей семьи, °C; 0 — оповещение выключено.
+	TemperatureAlert float64
 }
 
 type CustomReminder struct {
@@ -85,6 +234,54 @@ type CustomReminder struct {
 	LastFiredOn string
 }
 
+// Webhook — адрес, на который уходят события семьи; Secret подписывает тело запроса.
+type Webhook struct {
+	ID        int64
+	FamilyID  int64
+	URL       string
+	Secret    string
+	CreatedAt time.Time
+}
+
+// WebhookDelivery — отправка события на вебхук: Status `pending`, пока есть попытки, затем
+// `delivered` или `failed`. URL и Secret берутся из вебхука.
+type WebhookDelivery struct {
+	ID            int64
+	WebhookID     int64
+	URL           string
+	Secret        string
+	Event         string
+	Payload       []byte
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	ResponseCode  int
+	LastError     string
+	CreatedAt     time.Time
+	DeliveredAt   *time.Time
+}
+
+// OutboxMessage — уведомление в очереди отправки outbox.
+type OutboxMessage struct {
+	ID       int64
+	FamilyID int64
+	MemberID int64
+	ChatID   int64
+	// Тип уведомления для метрик (notificationWakeWindow и т.п.).
+	Kind string
+	Text string
+	// Inline-клавиатура в JSON; пусто — без клавиатуры.
+	Markup   string
+	Status   string
+	Attempts int
+	// Сколько частей длинного текста уже доставлено: повтор продолжает со следующей.
+	PartsSent     int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
+
 type UserState struct {
 	State   string
 	Payload json.RawMessage
@@ -104,6 +301,18 @@ type ReminderTarget struct {
 	Members  []Member
 }
 
+// Сколько запрос ждет, пока другое соединение держит блокировку записи, прежде чем вернуть "database is locked".
+const sqliteBusyTimeoutMS = 5000
+
+// openDatabase открывает SQLite для параллельной обработки обновлений: WAL, чтобы чтение не ждало
+// записи; busy_timeout, чтобы запись ждала соседнюю, а не падала; внешние ключи на каждом соединении
+// пула; BEGIN IMMEDIATE, чтобы транзакция брала блокировку записи сразу и не ловила взаимную
+// блокировку при переходе от чтения к записи. Многошаговые изменения дополнительно сериализует Store.mu.
+func openDatabase(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_txlock=immediate", path, sqliteBusyTimeoutMS)
+	return sql.Open("sqlite", dsn)
+}
+
 func NewStore(db *sql.DB, cfg Config) (*Store, error) {
 	store := &Store{
 		db:     db,
@@ -139,6 +348,7 @@ func (s *Store) initSchema() error {
 			updated_at TEXT NOT NULL,
 			FOREIGN KEY(family_id) REFERENCES families(id) ON DELETE CASCADE
 		);`,
+		`CREATE INDEX IF NOT EXISTS idx_family_members_family ON family_members(family_id);`,
 		`CREATE TABLE IF NOT EXISTS children (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			family_id INTEGER NOT NULL UNIQUE,
@@ -197,6 +407,7 @@ func (s *Store) initSchema() error {
 			updated_at TEXT NOT NULL,
 			FOREIGN KEY(family_id) REFERENCES families(id) ON DELETE CASCADE
 		);`,
+		`CREATE INDEX IF NOT EXISTS idx_custom_reminders_family ON custom_reminders(family_id);`,
 		`CREATE TABLE IF NOT EXISTS user_states (
 			telegram_user_id INTEGER PRIMARY KEY,
 			family_id INTEGER NOT NULL,
@@ -205,6 +416,202 @@ func (s *Store) initSchema() error {
 			updated_at TEXT NOT NULL,
 			FOREIGN KEY(family_id) REFERENCES families(id) ON DELETE CASCADE
 		);`,
+		`CREATE TABLE IF NOT EXISTS measurements (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			child_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			value REAL NOT NULL,
+			measured_at TEXT NOT NULL,
+			created_by INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			FOREIGN KEY(child_id) REFERENCES children(id) ON DELETE CASCADE,
+			FOREIGN KEY(created_by) REFERENCES family_members(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_measurements_child_kind ON measurements(child_id, kind, measured_at);`,
+		`CREATE TABLE IF NOT EXISTS medications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			child_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			dose TEXT NOT NULL DEFAULT '',
+			at_times TEXT NOT NULL DEFAULT '',
+			min_interval_minutes INTEGER NOT NULL DEFAULT 0,
+			active INTEGER NOT NULL DEFAULT 1,
+			created_by INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			FOREIGN KEY(child_id) REFERENCES children(id) ON DELETE CASCADE,
+			FOREIGN KEY(created_by) REFERENCES family_members(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_medications_child ON medications(child_id);`,
+		`CREATE TABLE IF NOT EXISTS medication_doses (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			medication_id INTEGER NOT NULL,
+			given_at TEXT NOT NULL,
+			given_by INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			FOREIGN KEY(medication_id) REFERENCES medications(id) ON DELETE CASCADE,
+			FOREIGN KEY(given_by) REFERENCES family_members(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_medication_doses_med_given ON medication_doses(medication_id, given_at);`,
+		`CREATE TABLE IF NOT EXISTS health_entries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			child_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			temperature REAL NOT NULL DEFAULT 0,
+			tags TEXT NOT NULL DEFAULT '',
+			note TEXT NOT NULL DEFAULT '',
+			recorded_at TEXT NOT NULL,
+			created_by INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			FOREIGN KEY(child_id) REFERENCES children(id) ON DELETE CASCADE,
+			FOREIGN KEY(created_by) REFERENCES family_members(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_health_entries_child_recorded ON health_entries(child_id, recorded_at);`,
+		`CREATE TABLE IF NOT EXISTS activity_sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			child_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			start_at TEXT NOT NULL,
+			end_at TEXT,
+			created_by INTEGER NOT NULL,
+			updated_by INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			FOREIGN KEY(child_id) REFERENCES children(id) ON DELETE CASCADE,
+			FOREIGN KEY(created_by) REFERENCES family_members(id) ON DELETE CASCADE,
+			FOREIGN KEY(updated_by) REFERENCES family_members(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_activity_sessions_child_start ON activity_sessions(child_id, start_at);`,
+		`CREATE TABLE IF NOT EXISTS activity_goals (
+			child_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			minutes INTEGER NOT NULL,
+			updated_at TEXT NOT NULL,
+			PRIMARY KEY(child_id, kind),
+			FOREIGN KEY(child_id) REFERENCES children(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS pumping_sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			child_id INTEGER NOT NULL,
+			member_id INTEGER NOT NULL,
+			side TEXT NOT NULL DEFAULT '',
+			volume_ml INTEGER NOT NULL DEFAULT 0,
+			start_at TEXT NOT NULL,
+			end_at TEXT,
+			created_at TEXT NOT NULL,
+			FOREIGN KEY(child_id) REFERENCES children(id) ON DELETE CASCADE,
+			FOREIGN KEY(member_id) REFERENCES family_members(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_pumping_sessions_child_start ON pumping_sessions(child_id, start_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_pumping_sessions_member_end ON pumping_sessions(member_id, end_at);`,
+		`CREATE TABLE IF NOT EXISTS milk_bags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			child_id INTEGER NOT NULL,
+			pumping_id INTEGER,
+			volume_ml INTEGER NOT NULL,
+			remaining_ml INTEGER NOT NULL,
+			storage TEXT NOT NULL,
+			pumped_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL,
+			discarded INTEGER NOT NULL DEFAULT 0,
+			created_by INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			UNIQUE(pumping_id),
+			FOREIGN KEY(child_id) REFERENCES children(id) ON DELETE CASCADE,
+			FOREIGN KEY(pumping_id) REFERENCES pumping_sessions(id) ON DELETE SET NULL,
+			FOREIGN KEY(created_by) REFERENCES family_members(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS bottle_feeds (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			child_id INTEGER NOT NULL,
+			volume_ml INTEGER NOT NULL,
+			from_stash_ml INTEGER NOT NULL,
+			fed_at TEXT NOT NULL,
+			created_by INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			FOREIGN KEY(child_id) REFERENCES children(id) ON DELETE CASCADE,
+			FOREIGN KEY(created_by) REFERENCES family_members(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			token_hash TEXT PRIMARY KEY,
+			family_id INTEGER NOT NULL UNIQUE,
+			member_id INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			last_used_at TEXT,
+			FOREIGN KEY(family_id) REFERENCES families(id) ON DELETE CASCADE,
+			FOREIGN KEY(member_id) REFERENCES family_members(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			family_id INTEGER NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			FOREIGN KEY(family_id) REFERENCES families(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_webhooks_family ON webhooks(family_id);`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			webhook_id INTEGER NOT NULL,
+			event TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TEXT NOT NULL,
+			response_code INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			delivered_at TEXT,
+			FOREIGN KEY(webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);`,
+		`CREATE TABLE IF NOT EXISTS calendar_feeds (
+			family_id INTEGER PRIMARY KEY,
+			token TEXT NOT NULL UNIQUE,
+			created_at TEXT NOT NULL,
+			FOREIGN KEY(family_id) REFERENCES families(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS routine_runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			child_id INTEGER NOT NULL,
+			evening TEXT NOT NULL,
+			steps TEXT NOT NULL,
+			started_at TEXT NOT NULL,
+			created_by INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			UNIQUE(child_id, evening),
+			FOREIGN KEY(child_id) REFERENCES children(id) ON DELETE CASCADE,
+			FOREIGN KEY(created_by) REFERENCES family_members(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS routine_marks (
+			run_id INTEGER NOT NULL,
+			step INTEGER NOT NULL,
+			done_at TEXT NOT NULL,
+			done_by INTEGER NOT NULL,
+			PRIMARY KEY(run_id, step),
+			FOREIGN KEY(run_id) REFERENCES routine_runs(id) ON DELETE CASCADE,
+			FOREIGN KEY(done_by) REFERENCES family_members(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			family_id INTEGER NOT NULL,
+			member_id INTEGER NOT NULL,
+			chat_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			text TEXT NOT NULL,
+			markup TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			parts_sent INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TEXT NOT NULL,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			sent_at TEXT,
+			FOREIGN KEY(family_id) REFERENCES families(id) ON DELETE CASCADE,
+			FOREIGN KEY(member_id) REFERENCES family_members(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_outbox_due ON outbox(status, next_attempt_at);`,
 		`CREATE TABLE IF NOT EXISTS notification_log (
 			family_id INTEGER NOT NULL,
 			reminder_key TEXT NOT NULL,
@@ -220,7 +627,28 @@ func (s *Store) initSchema() error {
 		}
 	}
 
-	return s.migrateMilestoneSettingsColumns()
+	if err := s.migrateMilestoneSettingsColumns(); err != nil {
+		return err
+	}
+	if err := s.migrateMemberDigestColumns(); err != nil {
+		return err
+	}
+	if err := s.migrateChildSexColumn(); err != nil {
+		return err
+	}
+	if err := s.migrateTemperatureAlertColumn(); err != nil {
+		return err
+	}
+	if err := s.migrateSleepTagsColumn(); err != nil {
+		return err
+	}
+	if err := s.migrateRoutineStepsColumn(); err != nil {
+		return err
+	}
+	if err := s.migrateMemberBlockedColumn(); err != nil {
+		return err
+	}
+	return s.migrateOutboxPartsColumn()
 }
 
 func (s *Store) migrateMilestoneSettingsColumns() error {
@@ -390,15 +818,93 @@ func (s *Store) CreateInviteCode(ctx context.Context, familyID int64) (string, t
 	return code, expiresAt, nil
 }
 
+func (s *Store) migrateMemberDigestColumns() error {
+	stmts := []string{
+		`ALTER TABLE family_members ADD COLUMN digest_daily_at TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE family_members ADD COLUMN digest_weekly_at TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE family_members ADD COLUMN pump_interval_minutes INTEGER NOT NULL DEFAULT 0`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.Exec(stmt); err != nil {
+			if !strings.Contains(strings.ToLower(err.Error()), "duplicate column") {
+				return fmt.Errorf("migrate family_members: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) migrateChildSexColumn() error {
+	if _, err := s.db.Exec(`ALTER TABLE children ADD COLUMN sex TEXT NOT NULL DEFAULT ''`); err != nil {
+		if !strings.Contains(strings.ToLower(err.Error()), "duplicate column") {
+			return fmt.Errorf("migrate children: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) migrateTemperatureAlertColumn() error {
+	if _, err := s.db.Exec(`ALTER TABLE reminder_settings ADD COLUMN temperature_alert REAL NOT NULL DEFAULT 38`); err != nil {
+		if !strings.Contains(strings.ToLower(err.Error()), "duplicate column") {
+			return fmt.Errorf("migrate reminder_settings: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) migrateSleepTagsColumn() error {
+	if _, err := s.db.Exec(`ALTER TABLE sleep_sessions ADD COLUMN tags TEXT NOT NULL DEFAULT ''`); err != nil {
+		if !strings.Contains(strings.ToLower(err.Error()), "duplicate column") {
+			return fmt.Errorf("migrate sleep_sessions: %w", err)
+		}
+		return nil
+	}
+	// Раньше ручные записи получали служебную заметку "manual"; теперь заметки пишут родители,
+	// а ручной ввод виден по start_source/end_source.
+	if _, err := s.db.Exec(`UPDATE sleep_sessions SET note = '' WHERE note = 'manual' AND start_source = ?`, sourceManual); err != nil {
+		return fmt.Errorf("migrate sleep_sessions: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) migrateRoutineStepsColumn() error {
+	if _, err := s.db.Exec(`ALTER TABLE children ADD COLUMN routine_steps TEXT NOT NULL DEFAULT ''`); err != nil {
+		if !strings.Contains(strings.ToLower(err.Error()), "duplicate column") {
+			return fmt.Errorf("migrate children: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) migrateMemberBlockedColumn() error {
+	if _, err := s.db.Exec(`ALTER TABLE family_members ADD COLUMN blocked_at TEXT`); err != nil {
+		if !strings.Contains(strings.ToLower(err.Error()), "duplicate column") {
+			return fmt.Errorf("migrate family_members: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) migrateOutboxPartsColumn() error {
+	if _, err := s.db.Exec(`ALTER TABLE outbox ADD COLUMN parts_sent INTEGER NOT NULL DEFAULT 0`); err != nil {
+		if !strings.Contains(strings.ToLower(err.Error()), "duplicate column") {
+			return fmt.Errorf("migrate outbox: %w", err)
+		}
+	}
+	return nil
+}
+
 func (s *Store) GetUserContext(ctx context.Context, telegramUserID int64) (UserContext, error) {
 	query := `
 		SELECT
 			m.id, m.family_id, m.telegram_user_id, m.telegram_chat_id, m.display_name, m.role,
+			m.digest_daily_at, m.digest_weekly_at, m.pump_interval_minutes,
 			f.id, f.name, f.timezone,
-			c.id, c.family_id, c.name, c.birth_date,
+			c.id, c.family_id, c.name, c.birth_date, c.sex,
 			rs.family_id, rs.reminders_enabled, rs.wake_window_enabled, rs.max_sleep_enabled, rs.inactivity_enabled,
 			rs.wake_window_minutes, rs.max_sleep_minutes, rs.inactivity_minutes,
-			COALESCE(rs.milestone_notify_each, 0), COALESCE(rs.milestone_report_today, 0)
+			COALESCE(rs.milestone_notify_each, 0), COALESCE(rs.milestone_report_today, 0),
+			rs.temperature_alert
 		FROM family_members m
 		JOIN families f ON f.id = m.family_id
 		JOIN children c ON c.family_id = f.id
@@ -422,11 +928,13 @@ func (s *Store) GetUserContext(ctx context.Context, telegramUserID int64) (UserC
 
 	err := s.db.QueryRowContext(ctx, query, telegramUserID).Scan(
 		&member.ID, &member.FamilyID, &member.TelegramUserID, &member.TelegramChatID, &member.DisplayName, &member.Role,
+		&member.DailyDigestAt, &member.WeeklyDigestAt, &member.PumpIntervalMinutes,
 		&family.ID, &family.Name, &family.Timezone,
-		&child.ID, &child.FamilyID, &child.Name, &birthDateString,
+		&child.ID, &child.FamilyID, &child.Name, &birthDateString, &child.Sex,
 		&settings.FamilyID, &remindersOn, &wakeOn, &maxSleepOn, &inactivityOn,
 		&settings.WakeWindowMinutes, &settings.MaxSleepMinutes, &settings.InactivityMinutes,
 		&milestonePush, &milestoneReport,
+		&settings.TemperatureAlert,
 	)
 	if err != nil {
 		return UserContext{}, err
@@ -453,17 +961,58 @@ func (s *Store) GetUserContext(ctx context.Context, telegramUserID int64) (UserC
 	}, nil
 }
 
+// GetReminderTargets возвращает все семьи с настройками напоминаний и участниками;
+// участники загружаются одним запросом на все семьи.
 func (s *Store) GetReminderTargets(ctx context.Context) ([]ReminderTarget, error) {
+	targets, err := s.listReminderTargets(ctx, ``)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.listAllMembers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return attachReminderMembers(targets, members), nil
+}
+
+// GetFamilyReminderTargets — то же для одной семьи.
+func (s *Store) GetFamilyReminderTargets(ctx context.Context, familyID int64) ([]ReminderTarget, error) {
+	targets, err := s.listReminderTargets(ctx, `WHERE f.id = ?`, familyID)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.GetFamilyMembers(ctx, familyID)
+	if err != nil {
+		return nil, err
+	}
+	return attachReminderMembers(targets, members), nil
+}
+
+// attachReminderMembers раскладывает участников по семьям напоминаний.
+func attachReminderMembers(targets []ReminderTarget, members []Member) []ReminderTarget {
+	byFamily := map[int64][]Member{}
+	for _, member := range members {
+		byFamily[member.FamilyID] = append(byFamily[member.FamilyID], member)
+	}
+	for i := range targets {
+		targets[i].Members = byFamily[targets[i].Family.ID]
+	}
+	return targets
+}
+
+// listReminderTargets загружает семьи с ребенком и настройками напоминаний без участников.
+func (s *Store) listReminderTargets(ctx context.Context, where string, args ...any) ([]ReminderTarget, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT f.id, f.name, f.timezone, c.id, c.name, c.birth_date,
+		SELECT f.id, f.name, f.timezone, c.id, c.name, c.birth_date, c.sex,
 			rs.reminders_enabled, rs.wake_window_enabled, rs.max_sleep_enabled, rs.inactivity_enabled,
 			rs.wake_window_minutes, rs.max_sleep_minutes, rs.inactivity_minutes,
 			COALESCE(rs.milestone_notify_each, 0), COALESCE(rs.milestone_report_today, 0)
 		FROM families f
 		JOIN children c ON c.family_id = f.id
 		JOIN reminder_settings rs ON rs.family_id = f.id
+		`+where+`
 		ORDER BY f.id
-	`)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -483,7 +1032,7 @@ func (s *Store) GetReminderTargets(ctx context.Context) ([]ReminderTarget, error
 		)
 		if err := rows.Scan(
 			&target.Family.ID, &target.Family.Name, &target.Family.Timezone,
-			&target.Child.ID, &target.Child.Name, &birthDateString,
+			&target.Child.ID, &target.Child.Name, &birthDateString, &target.Child.Sex,
 			&remindersOn, &wakeOn, &maxSleepOn, &inactivityOn,
 			&target.Settings.WakeWindowMinutes, &target.Settings.MaxSleepMinutes, &target.Settings.InactivityMinutes,
 			&milestonePush, &milestoneReport,
@@ -504,24 +1053,38 @@ func (s *Store) GetReminderTargets(ctx context.Context) ([]ReminderTarget, error
 			}
 		}
 
-		members, err := s.GetFamilyMembers(ctx, target.Family.ID)
-		if err != nil {
-			return nil, err
-		}
-		target.Members = members
 		targets = append(targets, target)
 	}
-
 	return targets, rows.Err()
 }
 
+// GetFamilyIDByTelegramUser возвращает семью пользователя; 0 — пользователь еще ни в какой семье.
+func (s *Store) GetFamilyIDByTelegramUser(ctx context.Context, telegramUserID int64) (int64, error) {
+	var familyID int64
+	err := s.db.QueryRowContext(ctx, `SELECT family_id FROM family_members WHERE telegram_user_id = ?`, telegramUserID).Scan(&familyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return familyID, err
+}
+
 func (s *Store) GetFamilyMembers(ctx context.Context, familyID int64) ([]Member, error) {
+	return s.listMembers(ctx, `WHERE family_id = ?`, familyID)
+}
+
+// listAllMembers возвращает участников всех семей одним запросом — для прохода напоминаний.
+func (s *Store) listAllMembers(ctx context.Context) ([]Member, error) {
+	return s.listMembers(ctx, ``)
+}
+
+func (s *Store) listMembers(ctx context.Context, where string, args ...any) ([]Member, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, family_id, telegram_user_id, telegram_chat_id, display_name, role
+		SELECT id, family_id, telegram_user_id, telegram_chat_id, display_name, role,
+			digest_daily_at, digest_weekly_at, pump_interval_minutes, blocked_at
 		FROM family_members
-		WHERE family_id = ?
-		ORDER BY id
-	`, familyID)
+		`+where+`
+		ORDER BY family_id, id
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -529,10 +1092,23 @@ func (s *Store) GetFamilyMembers(ctx context.Context, familyID int64) ([]Member,
 
 	var members []Member
 	for rows.Next() {
-		var member Member
-		if err := rows.Scan(&member.ID, &member.FamilyID, &member.TelegramUserID, &member.TelegramChatID, &member.DisplayName, &member.Role); err != nil {
+		var (
+			member       Member
+			blockedAtRaw sql.NullString
+		)
+		if err := rows.Scan(
+			&member.ID, &member.FamilyID, &member.TelegramUserID, &member.TelegramChatID, &member.DisplayName, &member.Role,
+			&member.DailyDigestAt, &member.WeeklyDigestAt, &member.PumpIntervalMinutes, &blockedAtRaw,
+		); err != nil {
 			return nil, err
 		}
+		if blockedAtRaw.Valid {
+			blockedAt, err := parseStoredTime(blockedAtRaw.String)
+			if err != nil {
+				return nil, err
+			}
+			member.BlockedAt = &blockedAt
+		}
 		members = append(members, member)
 	}
 	return members, rows.Err()
@@ -540,7 +1116,7 @@ func (s *Store) GetFamilyMembers(ctx context.Context, familyID int64) ([]Member,
 
 func (s *Store) GetActiveSleep(ctx context.Context, childID int64) (*SleepSession, error) {
 	row := s.db.QueryRowContext(ctx, `
-		SELECT id, child_id, start_at, end_at, start_source, end_source, note, created_by, updated_by
+		SELECT id, child_id, start_at, end_at, start_source, end_source, note, tags, created_by, updated_by
 		FROM sleep_sessions
 		WHERE child_id = ? AND end_at IS NULL
 		ORDER BY start_at DESC
@@ -567,27 +1143,21 @@ func (s *Store) StartSleep(ctx context.Context, childID int64, memberID int64, s
 	}
 	defer tx.Rollback()
 
-	if existing, err := s.getActiveSleepTx(ctx, tx, childID); err != nil {
+	if activeID, activeStart, err := s.activeSessionTx(ctx, tx, sleepSessionTable, childID); err != nil {
 		return nil, err
-	} else if existing != nil {
-		return nil, fmt.Errorf("сон уже идет с %s", existing.StartAt.Format("15:04"))
+	} else if activeID != 0 {
+		return nil, invalidInput("сон уже идет с %s", activeStart.Format("15:04"))
 	}
 
 	if err := s.ensureNoOverlapTx(ctx, tx, childID, startAt, nil, 0); err != nil {
 		return nil, err
 	}
 
-	now := s.nowUTCString()
-	result, err := tx.ExecContext(ctx, `
-		INSERT INTO sleep_sessions(
-			child_id, start_at, end_at, start_source, end_source, note, created_by, updated_by, created_at, updated_at
-		) VALUES (?, ?, NULL, ?, '', '', ?, ?, ?, ?)
-	`, childID, toStoredTime(startAt), source, memberID, memberID, now, now)
+	id, err := s.insertSessionTx(ctx, tx, sleepSessionTable, childID, memberID, startAt, nil,
+		sessionColumn{"start_source", source}, sessionColumn{"end_source", ""}, sessionColumn{"note", ""})
 	if err != nil {
 		return nil, err
 	}
-
-	id, _ := result.LastInsertId()
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
@@ -609,30 +1179,25 @@ func (s *Store) EndSleep(ctx context.Context, childID int64, memberID int64, end
 	}
 	defer tx.Rollback()
 
-	active, err := s.getActiveSleepTx(ctx, tx, childID)
+	activeID, activeStart, err := s.activeSessionTx(ctx, tx, sleepSessionTable, childID)
 	if err != nil {
 		return nil, err
 	}
-	if active == nil {
-		return nil, fmt.Errorf("сейчас нет активного сна")
+	if activeID == 0 {
+		return nil, invalidInput("сейчас нет активного сна")
 	}
-	if !endAt.After(active.StartAt) {
-		return nil, fmt.Errorf("время окончания должно быть позже начала сна")
+	if !endAt.After(activeStart) {
+		return nil, invalidInput("время окончания должно быть позже начала сна")
 	}
 
-	now := s.nowUTCString()
-	if _, err := tx.ExecContext(ctx, `
-		UPDATE sleep_sessions
-		SET end_at = ?, end_source = ?, updated_by = ?, updated_at = ?
-		WHERE id = ?
-	`, toStoredTime(endAt), source, memberID, now, active.ID); err != nil {
+	if err := s.closeSessionTx(ctx, tx, sleepSessionTable, activeID, memberID, endAt, sessionColumn{"end_source", source}); err != nil {
 		return nil, err
 	}
 
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
-	return s.GetSleepByID(ctx, active.ID)
+	return s.GetSleepByID(ctx, activeID)
 }
 
 func (s *Store) AddManualSleep(ctx context.Context, childID int64, memberID int64, startAt time.Time, endAt time.Time, note string) (*SleepSession, error) {
@@ -643,7 +1208,7 @@ func (s *Store) AddManualSleep(ctx context.Context, childID int64, memberID int6
 		return nil, err
 	}
 	if !endAt.After(startAt) {
-		return nil, fmt.Errorf("окончание должно быть позже начала")
+		return nil, invalidInput("окончание должно быть позже начала")
 	}
 
 	s.mu.Lock()
@@ -655,27 +1220,21 @@ func (s *Store) AddManualSleep(ctx context.Context, childID int64, memberID int6
 	}
 	defer tx.Rollback()
 
-	if active, err := s.getActiveSleepTx(ctx, tx, childID); err != nil {
+	if activeID, _, err := s.activeSessionTx(ctx, tx, sleepSessionTable, childID); err != nil {
 		return nil, err
-	} else if active != nil {
-		return nil, fmt.Errorf("сначала завершите текущий активный сон")
+	} else if activeID != 0 {
+		return nil, invalidInput("сначала завершите текущий активный сон")
 	}
 
 	if err := s.ensureNoOverlapTx(ctx, tx, childID, startAt, &endAt, 0); err != nil {
 		return nil, err
 	}
 
-	now := s.nowUTCString()
-	result, err := tx.ExecContext(ctx, `
-		INSERT INTO sleep_sessions(
-			child_id, start_at, end_at, start_source, end_source, note, created_by, updated_by, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, childID, toStoredTime(startAt), toStoredTime(endAt), sourceManual, sourceManual, strings.TrimSpace(note), memberID, memberID, now, now)
+	id, err := s.insertSessionTx(ctx, tx, sleepSessionTable, childID, memberID, startAt, &endAt,
+		sessionColumn{"start_source", sourceManual}, sessionColumn{"end_source", sourceManual}, sessionColumn{"note", strings.TrimSpace(note)})
 	if err != nil {
 		return nil, err
 	}
-
-	id, _ := result.LastInsertId()
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
@@ -685,7 +1244,7 @@ func (s *Store) AddManualSleep(ctx context.Context, childID int64, memberID int6
 
 func (s *Store) UpdateLastCompletedSleep(ctx context.Context, childID int64, memberID int64, startAt time.Time, endAt time.Time) (*SleepSession, error) {
 	if !endAt.After(startAt) {
-		return nil, fmt.Errorf("окончание должно быть позже начала")
+		return nil, invalidInput("окончание должно быть позже начала")
 	}
 	if err := s.validateTimestamp(startAt); err != nil {
 		return nil, err
@@ -694,152 +1253,1681 @@ func (s *Store) UpdateLastCompletedSleep(ctx context.Context, childID int64, mem
 		return nil, err
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	last, err := s.getLastCompletedSleepTx(ctx, tx, childID)
+	if err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, fmt.Errorf("нет завершенных снов для редактирования")
+	}
+
+	if err := s.ensureNoOverlapTx(ctx, tx, childID, startAt, &endAt, last.ID); err != nil {
+		return nil, err
+	}
+
+	now := s.nowUTCString()
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE sleep_sessions
+		SET start_at = ?, end_at = ?, start_source = ?, end_source = ?, updated_by = ?, updated_at = ?
+		WHERE id = ?
+	`, toStoredTime(startAt), toStoredTime(endAt), sourceManual, sourceManual, memberID, now, last.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetSleepByID(ctx, last.ID)
+}
+
+func (s *Store) GetSleepByID(ctx context.Context, id int64) (*SleepSession, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT id, child_id, start_at, end_at, start_source, end_source, note, tags, created_by, updated_by
+		FROM sleep_sessions
+		WHERE id = ?
+	`, id)
+	return scanSleepSession(row)
+}
+
+// GetChildSleep возвращает сон ребенка по id; чужие сны не видны.
+func (s *Store) GetChildSleep(ctx context.Context, childID int64, id int64) (*SleepSession, error) {
+	session, err := s.GetSleepByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && session.ChildID != childID) {
+		return nil, fmt.Errorf("сон не найден")
+	}
+	return session, err
+}
+
+func (s *Store) SetSleepTags(ctx context.Context, childID int64, sessionID int64, memberID int64, tags []string) error {
+	for _, tag := range tags {
+		if _, ok := sleepTagLabel(tag); !ok {
+			return fmt.Errorf("неизвестный тег %q", tag)
+		}
+	}
+	return s.updateSleepAnnotation(ctx, childID, sessionID, memberID, "tags", strings.Join(tags, ","))
+}
+
+func (s *Store) SetSleepNote(ctx context.Context, childID int64, sessionID int64, memberID int64, note string) error {
+	return s.updateSleepAnnotation(ctx, childID, sessionID, memberID, "note", strings.TrimSpace(note))
+}
+
+func (s *Store) updateSleepAnnotation(ctx context.Context, childID int64, sessionID int64, memberID int64, column string, value string) error {
+	allowed := map[string]bool{
+		"tags": true,
+		"note": true,
+	}
+	if !allowed[column] {
+		return fmt.Errorf("неподдерживаемое поле сна")
+	}
+	query := fmt.Sprintf("UPDATE sleep_sessions SET %s = ?, updated_by = ?, updated_at = ? WHERE id = ? AND child_id = ?", column)
+	result, err := s.db.ExecContext(ctx, query, value, memberID, s.nowUTCString(), sessionID, childID)
+	if err != nil {
+		return err
+	}
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return fmt.Errorf("сон не найден")
+	}
+	return nil
+}
+
+func (s *Store) ListCompletedSleepsSince(ctx context.Context, childID int64, since time.Time) ([]SleepSession, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, child_id, start_at, end_at, start_source, end_source, note, tags, created_by, updated_by
+		FROM sleep_sessions
+		WHERE child_id = ? AND end_at IS NOT NULL AND start_at >= ?
+		ORDER BY start_at ASC
+	`, childID, toStoredTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return collectSleepSessions(rows)
+}
+
+// ListCompletedSleepsBetween возвращает завершенные сны, начавшиеся в [from, to).
+func (s *Store) ListCompletedSleepsBetween(ctx context.Context, childID int64, from time.Time, to time.Time) ([]SleepSession, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, child_id, start_at, end_at, start_source, end_source, note, tags, created_by, updated_by
+		FROM sleep_sessions
+		WHERE child_id = ? AND end_at IS NOT NULL AND start_at >= ? AND start_at < ?
+		ORDER BY start_at ASC
+	`, childID, toStoredTime(from), toStoredTime(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return collectSleepSessions(rows)
+}
+
+func (s *Store) ListAllCompletedSleeps(ctx context.Context, childID int64) ([]SleepSession, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, child_id, start_at, end_at, start_source, end_source, note, tags, created_by, updated_by
+		FROM sleep_sessions
+		WHERE child_id = ? AND end_at IS NOT NULL
+		ORDER BY start_at ASC
+	`, childID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return collectSleepSessions(rows)
+}
+
+func (s *Store) GetLastCompletedSleep(ctx context.Context, childID int64) (*SleepSession, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT id, child_id, start_at, end_at, start_source, end_source, note, tags, created_by, updated_by
+		FROM sleep_sessions
+		WHERE child_id = ? AND end_at IS NOT NULL
+		ORDER BY start_at DESC
+		LIMIT 1
+	`, childID)
+	session, err := scanSleepSession(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return session, err
+}
+
+func (s *Store) GetLatestEventTime(ctx context.Context, childID int64) (*time.Time, error) {
+	var startAt sql.NullString
+	var endAt sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT start_at, end_at
+		FROM sleep_sessions
+		WHERE child_id = ?
+		ORDER BY COALESCE(end_at, start_at) DESC
+		LIMIT 1
+	`, childID).Scan(&startAt, &endAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	raw := startAt.String
+	if endAt.Valid && endAt.String != "" {
+		raw = endAt.String
+	}
+	parsed, err := parseStoredTime(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func (s *Store) SetFamilyTimezone(ctx context.Context, familyID int64, timezone string) error {
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("не удалось загрузить таймзону: %w", err)
+	}
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE families SET timezone = ?, updated_at = ? WHERE id = ?`,
+		timezone, s.nowUTCString(), familyID,
+	)
+	return err
+}
+
+func (s *Store) SetChildName(ctx context.Context, familyID int64, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("имя ребенка не может быть пустым")
+	}
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE children SET name = ?, updated_at = ? WHERE family_id = ?`,
+		name, s.nowUTCString(), familyID,
+	)
+	return err
+}
+
+func (s *Store) SetChildBirthDate(ctx context.Context, familyID int64, birthDate time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE children SET birth_date = ?, updated_at = ? WHERE family_id = ?`,
+		FormatBirthDateStored(birthDate), s.nowUTCString(), familyID,
+	)
+	return err
+}
+
+func (s *Store) SetChildSex(ctx context.Context, familyID int64, sex string) error {
+	if sex != childSexBoy && sex != childSexGirl {
+		return fmt.Errorf("пол ребенка: мальчик или девочка")
+	}
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE children SET sex = ?, updated_at = ? WHERE family_id = ?`,
+		sex, s.nowUTCString(), familyID,
+	)
+	return err
+}
+
+func (s *Store) AddMeasurement(ctx context.Context, childID int64, memberID int64, kind string, value float64, measuredAt time.Time) (*Measurement, error) {
+	if _, ok := measurementUnits[kind]; !ok {
+		return nil, fmt.Errorf("неизвестный вид измерения")
+	}
+	if value <= 0 {
+		return nil, fmt.Errorf("значение должно быть больше 0")
+	}
+	if measuredAt.After(s.clock().Add(1 * time.Minute)) {
+		return nil, fmt.Errorf("дата измерения не может быть в будущем")
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO measurements(child_id, kind, value, measured_at, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, childID, kind, value, toStoredTime(measuredAt), memberID, s.nowUTCString())
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	return &Measurement{ID: id, ChildID: childID, Kind: kind, Value: value, MeasuredAt: measuredAt.UTC(), CreatedBy: memberID}, nil
+}
+
+// ListMeasurements возвращает все измерения ребенка по возрастанию даты.
+func (s *Store) ListMeasurements(ctx context.Context, childID int64) ([]Measurement, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, child_id, kind, value, measured_at, created_by
+		FROM measurements
+		WHERE child_id = ?
+		ORDER BY measured_at ASC, id ASC
+	`, childID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var measurements []Measurement
+	for rows.Next() {
+		var (
+			measurement   Measurement
+			measuredAtRaw string
+		)
+		if err := rows.Scan(&measurement.ID, &measurement.ChildID, &measurement.Kind, &measurement.Value, &measuredAtRaw, &measurement.CreatedBy); err != nil {
+			return nil, err
+		}
+		measuredAt, err := parseStoredTime(measuredAtRaw)
+		if err != nil {
+			return nil, err
+		}
+		measurement.MeasuredAt = measuredAt
+		measurements = append(measurements, measurement)
+	}
+	return measurements, rows.Err()
+}
+
+func (s *Store) AddMedication(ctx context.Context, childID int64, memberID int64, medication Medication) (*Medication, error) {
+	medication.Name = strings.TrimSpace(medication.Name)
+	medication.Dose = strings.TrimSpace(medication.Dose)
+	if medication.Name == "" {
+		return nil, fmt.Errorf("название лекарства пустое")
+	}
+	if medication.MinIntervalMinutes < 0 {
+		return nil, fmt.Errorf("интервал не может быть отрицательным")
+	}
+	for _, atTime := range splitMedicationTimes(medication.AtTimes) {
+		if _, err := time.Parse("15:04", atTime); err != nil {
+			return nil, fmt.Errorf("время приёма должно быть в формате HH:MM")
+		}
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO medications(child_id, name, dose, at_times, min_interval_minutes, active, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 1, ?, ?, ?)
+	`, childID, medication.Name, medication.Dose, medication.AtTimes, medication.MinIntervalMinutes, memberID, s.nowUTCString(), s.nowUTCString())
+	if err != nil {
+		return nil, err
+	}
+	medication.ID, _ = result.LastInsertId()
+	medication.ChildID = childID
+	medication.CreatedBy = memberID
+	return &medication, nil
+}
+
+// ListMedications возвращает активные лекарства ребенка в порядке добавления.
+func (s *Store) ListMedications(ctx context.Context, childID int64) ([]Medication, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, child_id, name, dose, at_times, min_interval_minutes, created_by
+		FROM medications
+		WHERE child_id = ? AND active = 1
+		ORDER BY id ASC
+	`, childID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var medications []Medication
+	for rows.Next() {
+		var medication Medication
+		if err := rows.Scan(&medication.ID, &medication.ChildID, &medication.Name, &medication.Dose, &medication.AtTimes, &medication.MinIntervalMinutes, &medication.CreatedBy); err != nil {
+			return nil, err
+		}
+		medications = append(medications, medication)
+	}
+	return medications, rows.Err()
+}
+
+func (s *Store) GetMedication(ctx context.Context, childID int64, medicationID int64) (*Medication, error) {
+	var medication Medication
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, child_id, name, dose, at_times, min_interval_minutes, created_by
+		FROM medications
+		WHERE id = ? AND child_id = ? AND active = 1
+	`, medicationID, childID).Scan(&medication.ID, &medication.ChildID, &medication.Name, &medication.Dose, &medication.AtTimes, &medication.MinIntervalMinutes, &medication.CreatedBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("лекарство не найдено")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &medication, nil
+}
+
+// DeactivateMedication скрывает лекарство из списка и напоминаний; журнал доз сохраняется.
+func (s *Store) DeactivateMedication(ctx context.Context, childID int64, medicationID int64) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE medications SET active = 0, updated_at = ? WHERE id = ? AND child_id = ? AND active = 1`,
+		s.nowUTCString(), medicationID, childID,
+	)
+	if err != nil {
+		return err
+	}
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return fmt.Errorf("лекарство не найдено")
+	}
+	return nil
+}
+
+func (s *Store) AddMedicationDose(ctx context.Context, medicationID int64, memberID int64, givenAt time.Time) (*MedicationDose, error) {
+	if givenAt.After(s.clock().Add(1 * time.Minute)) {
+		return nil, fmt.Errorf("время приёма не может быть в будущем")
+	}
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO medication_doses(medication_id, given_at, given_by, created_at)
+		VALUES (?, ?, ?, ?)
+	`, medicationID, toStoredTime(givenAt), memberID, s.nowUTCString())
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	return &MedicationDose{ID: id, MedicationID: medicationID, GivenAt: givenAt.UTC(), GivenBy: memberID}, nil
+}
+
+// ListMedicationDosesSince возвращает дозы всех лекарств ребенка начиная с since, по возрастанию времени.
+func (s *Store) ListMedicationDosesSince(ctx context.Context, childID int64, since time.Time) ([]MedicationDose, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT d.id, d.medication_id, d.given_at, d.given_by, COALESCE(m.display_name, '')
+		FROM medication_doses d
+		JOIN medications med ON med.id = d.medication_id
+		LEFT JOIN family_members m ON m.id = d.given_by
+		WHERE med.child_id = ? AND d.given_at >= ?
+		ORDER BY d.given_at ASC, d.id ASC
+	`, childID, toStoredTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var doses []MedicationDose
+	for rows.Next() {
+		var (
+			dose       MedicationDose
+			givenAtRaw string
+		)
+		if err := rows.Scan(&dose.ID, &dose.MedicationID, &givenAtRaw, &dose.GivenBy, &dose.GivenByName); err != nil {
+			return nil, err
+		}
+		givenAt, err := parseStoredTime(givenAtRaw)
+		if err != nil {
+			return nil, err
+		}
+		dose.GivenAt = givenAt
+		doses = append(doses, dose)
+	}
+	return doses, rows.Err()
+}
+
+// SetTemperatureAlert задает порог оповещения о температуре; 0 выключает оповещение.
+func (s *Store) SetTemperatureAlert(ctx context.Context, familyID int64, threshold float64) error {
+	if threshold != 0 && (threshold < 37 || threshold > 41) {
+		return fmt.Errorf("порог температуры должен быть от 37 до 41 °C")
+	}
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE reminder_settings SET temperature_alert = ?, updated_at = ? WHERE family_id = ?`,
+		threshold, s.nowUTCString(), familyID,
+	)
+	return err
+}
+
+func (s *Store) AddHealthEntry(ctx context.Context, childID int64, memberID int64, entry HealthEntry) (*HealthEntry, error) {
+	switch entry.Kind {
+	case healthTemperature:
+		if entry.Temperature < temperatureMin || entry.Temperature > temperatureMax {
+			return nil, invalidInput("температура должна быть от %g до %g °C", temperatureMin, temperatureMax)
+		}
+	case healthSymptom:
+		if len(entry.Tags) == 0 {
+			return nil, invalidInput("укажите хотя бы один симптом")
+		}
+	default:
+		return nil, invalidInput("неизвестный вид записи")
+	}
+	if entry.RecordedAt.After(s.clock().Add(1 * time.Minute)) {
+		return nil, invalidInput("время записи не может быть в будущем")
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO health_entries(child_id, kind, temperature, tags, note, recorded_at, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, childID, entry.Kind, entry.Temperature, strings.Join(entry.Tags, ","), entry.Note, toStoredTime(entry.RecordedAt), memberID, s.nowUTCString())
+	if err != nil {
+		return nil, err
+	}
+	entry.ID, _ = result.LastInsertId()
+	entry.ChildID = childID
+	entry.CreatedBy = memberID
+	entry.RecordedAt = entry.RecordedAt.UTC()
+	return &entry, nil
+}
+
+// ListHealthEntriesBetween возвращает записи журнала здоровья в [from, to) по возрастанию времени.
+func (s *Store) ListHealthEntriesBetween(ctx context.Context, childID int64, from time.Time, to time.Time) ([]HealthEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, child_id, kind, temperature, tags, note, recorded_at, created_by
+		FROM health_entries
+		WHERE child_id = ? AND recorded_at >= ? AND recorded_at < ?
+		ORDER BY recorded_at ASC, id ASC
+	`, childID, toStoredTime(from), toStoredTime(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []HealthEntry
+	for rows.Next() {
+		var (
+			entry         HealthEntry
+			tags          string
+			recordedAtRaw string
+		)
+		if err := rows.Scan(&entry.ID, &entry.ChildID, &entry.Kind, &entry.Temperature, &tags, &entry.Note, &recordedAtRaw, &entry.CreatedBy); err != nil {
+			return nil, err
+		}
+		recordedAt, err := parseStoredTime(recordedAtRaw)
+		if err != nil {
+			return nil, err
+		}
+		entry.RecordedAt = recordedAt
+		if tags != "" {
+			entry.Tags = strings.Split(tags, ",")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// StartActivity начинает активность kind; одновременно может идти только одна активность каждого вида.
+func (s *Store) StartActivity(ctx context.Context, childID int64, memberID int64, kind string, startAt time.Time) (*ActivitySession, error) {
+	if _, ok := lookupActivityKind(kind); !ok {
+		return nil, invalidInput("неизвестная активность")
+	}
+	if err := s.validateTimestamp(startAt); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	table := activitySessionTable(kind)
+	if activeID, activeStart, err := s.activeSessionTx(ctx, tx, table, childID); err != nil {
+		return nil, err
+	} else if activeID != 0 {
+		return nil, invalidInput("уже идет с %s", activeStart.Format("15:04"))
+	}
+	if err := s.ensureNoActivityOverlapTx(ctx, tx, table, childID, startAt, nil); err != nil {
+		return nil, err
+	}
+
+	id, err := s.insertSessionTx(ctx, tx, table, childID, memberID, startAt, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.getActivityByID(ctx, id)
+}
+
+// EndActivity завершает идущую активность kind.
+func (s *Store) EndActivity(ctx context.Context, childID int64, memberID int64, kind string, endAt time.Time) (*ActivitySession, error) {
+	if err := s.validateTimestamp(endAt); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	table := activitySessionTable(kind)
+	activeID, activeStart, err := s.activeSessionTx(ctx, tx, table, childID)
+	if err != nil {
+		return nil, err
+	}
+	if activeID == 0 {
+		return nil, invalidInput("сейчас эта активность не идет")
+	}
+	if !endAt.After(activeStart) {
+		return nil, invalidInput("время окончания должно быть позже начала")
+	}
+
+	if err := s.closeSessionTx(ctx, tx, table, activeID, memberID, endAt); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.getActivityByID(ctx, activeID)
+}
+
+// AddActivity записывает уже завершенную активность задним числом.
+func (s *Store) AddActivity(ctx context.Context, childID int64, memberID int64, kind string, startAt time.Time, endAt time.Time) (*ActivitySession, error) {
+	if _, ok := lookupActivityKind(kind); !ok {
+		return nil, invalidInput("неизвестная активность")
+	}
+	if err := s.validateTimestamp(startAt); err != nil {
+		return nil, err
+	}
+	if err := s.validateTimestamp(endAt); err != nil {
+		return nil, err
+	}
+	if !endAt.After(startAt) {
+		return nil, invalidInput("окончание должно быть позже начала")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	table := activitySessionTable(kind)
+	if err := s.ensureNoActivityOverlapTx(ctx, tx, table, childID, startAt, &endAt); err != nil {
+		return nil, err
+	}
+	id, err := s.insertSessionTx(ctx, tx, table, childID, memberID, startAt, &endAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.getActivityByID(ctx, id)
+}
+
+// ListActiveActivities возвращает идущие сейчас активности.
+func (s *Store) ListActiveActivities(ctx context.Context, childID int64) ([]ActivitySession, error) {
+	return s.listActivities(ctx, `WHERE child_id = ? AND end_at IS NULL`, childID)
+}
+
+// ListActivitiesBetween возвращает активности, пересекающие [from, to), включая идущие, по возрастанию начала.
+func (s *Store) ListActivitiesBetween(ctx context.Context, childID int64, from time.Time, to time.Time) ([]ActivitySession, error) {
+	return s.listActivities(ctx, `WHERE child_id = ? AND start_at < ? AND (end_at IS NULL OR end_at > ?)`, childID, toStoredTime(to), toStoredTime(from))
+}
+
+func (s *Store) getActivityByID(ctx context.Context, id int64) (*ActivitySession, error) {
+	activities, err := s.listActivities(ctx, `WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(activities) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &activities[0], nil
+}
+
+// ensureNoActivityOverlapTx проверяет, что интервал не пересекает сохраненную активность того же вида.
+func (s *Store) ensureNoActivityOverlapTx(ctx context.Context, tx *sql.Tx, table sessionTable, childID int64, startAt time.Time, endAt *time.Time) error {
+	overlaps, err := s.sessionOverlapsTx(ctx, tx, table, childID, startAt, endAt, 0)
+	if err != nil {
+		return err
+	}
+	if overlaps {
+		return invalidInput("интервал пересекается с уже сохраненной активностью этого вида")
+	}
+	return nil
+}
+
+func (s *Store) listActivities(ctx context.Context, where string, args ...any) ([]ActivitySession, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, child_id, kind, start_at, end_at, created_by, updated_by
+		FROM activity_sessions
+		`+where+`
+		ORDER BY start_at ASC, id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []ActivitySession
+	for rows.Next() {
+		var (
+			activity   ActivitySession
+			startAtRaw string
+			endAtRaw   sql.NullString
+		)
+		if err := rows.Scan(&activity.ID, &activity.ChildID, &activity.Kind, &startAtRaw, &endAtRaw, &activity.CreatedBy, &activity.UpdatedBy); err != nil {
+			return nil, err
+		}
+		startAt, err := parseStoredTime(startAtRaw)
+		if err != nil {
+			return nil, err
+		}
+		activity.StartAt = startAt
+		if endAtRaw.Valid {
+			endAt, err := parseStoredTime(endAtRaw.String)
+			if err != nil {
+				return nil, err
+			}
+			activity.EndAt = &endAt
+		}
+		activities = append(activities, activity)
+	}
+	return activities, rows.Err()
+}
+
+// GetActivityGoals возвращает заданные семьей дневные цели в минутах по видам активности
+// (0 — цель выключена); для видов без записи действует цель по умолчанию.
+func (s *Store) GetActivityGoals(ctx context.Context, childID int64) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT kind, minutes FROM activity_goals WHERE child_id = ?`, childID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := map[string]int{}
+	for rows.Next() {
+		var (
+			kind    string
+			minutes int
+		)
+		if err := rows.Scan(&kind, &minutes); err != nil {
+			return nil, err
+		}
+		goals[kind] = minutes
+	}
+	return goals, rows.Err()
+}
+
+func (s *Store) SetActivityGoal(ctx context.Context, childID int64, kind string, minutes int) error {
+	if _, ok := lookupActivityKind(kind); !ok {
+		return invalidInput("неизвестная активность")
+	}
+	if minutes < 0 || minutes > activityGoalMaxMinutes {
+		return fmt.Errorf("цель должна быть от 1 до %d минут", activityGoalMaxMinutes)
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO activity_goals(child_id, kind, minutes, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(child_id, kind) DO UPDATE SET minutes = excluded.minutes, updated_at = excluded.updated_at
+	`, childID, kind, minutes, s.nowUTCString())
+	return err
+}
+
+func (s *Store) SetPumpInterval(ctx context.Context, memberID int64, minutes int) error {
+	if minutes < 0 || minutes > pumpIntervalMaxMinutes {
+		return fmt.Errorf("интервал должен быть от 1 до %d минут", pumpIntervalMaxMinutes)
+	}
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE family_members SET pump_interval_minutes = ?, updated_at = ? WHERE id = ?`,
+		minutes, s.nowUTCString(), memberID,
+	)
+	return err
+}
+
+// StartPumping запускает таймер сцеживания; у каждого участника может идти только один.
+func (s *Store) StartPumping(ctx context.Context, childID int64, memberID int64, startAt time.Time) (*PumpingSession, error) {
+	if err := s.validateTimestamp(startAt); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if active, err := s.GetActivePumping(ctx, memberID); err != nil {
+		return nil, err
+	} else if active != nil {
+		return nil, fmt.Errorf("сцеживание уже идет с %s", active.StartAt.Format("15:04"))
+	}
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO pumping_sessions(child_id, member_id, start_at, end_at, created_at)
+		VALUES (?, ?, ?, NULL, ?)
+	`, childID, memberID, toStoredTime(startAt), s.nowUTCString())
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	return s.getPumping(ctx, id)
+}
+
+// GetActivePumping возвращает идущее сцеживание участника или nil.
+func (s *Store) GetActivePumping(ctx context.Context, memberID int64) (*PumpingSession, error) {
+	sessions, err := s.listPumpings(ctx, `WHERE p.member_id = ? AND p.end_at IS NULL`, memberID)
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	return &sessions[len(sessions)-1], nil
+}
+
+// FinishPumping останавливает таймер участника и записывает сторону и объем.
+func (s *Store) FinishPumping(ctx context.Context, memberID int64, side string, volumeML int, endAt time.Time) (*PumpingSession, error) {
+	if err := s.validateTimestamp(endAt); err != nil {
+		return nil, err
+	}
+	if err := validatePumping(side, volumeML); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active, err := s.GetActivePumping(ctx, memberID)
+	if err != nil {
+		return nil, err
+	}
+	if active == nil {
+		return nil, fmt.Errorf("сейчас нет идущего сцеживания")
+	}
+	if !endAt.After(active.StartAt) {
+		return nil, invalidInput("время окончания должно быть позже начала")
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE pumping_sessions SET side = ?, volume_ml = ?, end_at = ? WHERE id = ?
+	`, side, volumeML, toStoredTime(endAt), active.ID); err != nil {
+		return nil, err
+	}
+	return s.getPumping(ctx, active.ID)
+}
+
+// AddPumping записывает уже завершенное сцеживание.
+func (s *Store) AddPumping(ctx context.Context, childID int64, memberID int64, side string, volumeML int, startAt time.Time, endAt time.Time) (*PumpingSession, error) {
+	if err := s.validateTimestamp(startAt); err != nil {
+		return nil, err
+	}
+	if err := s.validateTimestamp(endAt); err != nil {
+		return nil, err
+	}
+	if endAt.Before(startAt) {
+		return nil, fmt.Errorf("окончание должно быть не раньше начала")
+	}
+	if err := validatePumping(side, volumeML); err != nil {
+		return nil, err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO pumping_sessions(child_id, member_id, side, volume_ml, start_at, end_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, childID, memberID, side, volumeML, toStoredTime(startAt), toStoredTime(endAt), s.nowUTCString())
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	return s.getPumping(ctx, id)
+}
+
+func validatePumping(side string, volumeML int) error {
+	if _, ok := pumpSideLabels[side]; !ok {
+		return fmt.Errorf("неизвестная сторона")
+	}
+	if volumeML < 0 || volumeML > pumpMaxVolumeML {
+		return fmt.Errorf("объем должен быть от 0 до %d мл", pumpMaxVolumeML)
+	}
+	return nil
+}
+
+// ListPumpingsSince возвращает завершенные сцеживания с since по возрастанию начала.
+func (s *Store) ListPumpingsSince(ctx context.Context, childID int64, since time.Time) ([]PumpingSession, error) {
+	return s.listPumpings(ctx, `WHERE p.child_id = ? AND p.end_at IS NOT NULL AND p.start_at >= ?`, childID, toStoredTime(since))
+}
+
+// GetFamilyPumpingStates возвращает состояние сцеживаний всех участников семьи одним запросом;
+// участников без сцеживаний в карте нет.
+func (s *Store) GetFamilyPumpingStates(ctx context.Context, familyID int64) (map[int64]PumpingState, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.member_id, MAX(p.end_at), SUM(CASE WHEN p.end_at IS NULL THEN 1 ELSE 0 END)
+		FROM pumping_sessions p
+		JOIN family_members m ON m.id = p.member_id
+		WHERE m.family_id = ?
+		GROUP BY p.member_id
+	`, familyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := map[int64]PumpingState{}
+	for rows.Next() {
+		var (
+			memberID  int64
+			lastEnd   sql.NullString
+			activeCnt int
+		)
+		if err := rows.Scan(&memberID, &lastEnd, &activeCnt); err != nil {
+			return nil, err
+		}
+		state := PumpingState{Active: activeCnt > 0}
+		if lastEnd.Valid {
+			endAt, err := parseStoredTime(lastEnd.String)
+			if err != nil {
+				return nil, err
+			}
+			state.LastEnd = &endAt
+		}
+		states[memberID] = state
+	}
+	return states, rows.Err()
+}
+
+func (s *Store) GetPumping(ctx context.Context, childID int64, id int64) (*PumpingSession, error) {
+	sessions, err := s.listPumpings(ctx, `WHERE p.child_id = ? AND p.id = ?`, childID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, fmt.Errorf("сцеживание не найдено")
+	}
+	return &sessions[0], nil
+}
+
+func (s *Store) getPumping(ctx context.Context, id int64) (*PumpingSession, error) {
+	sessions, err := s.listPumpings(ctx, `WHERE p.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &sessions[0], nil
+}
+
+func (s *Store) listPumpings(ctx context.Context, where string, args ...any) ([]PumpingSession, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id, p.child_id, p.member_id, m.display_name, p.side, p.volume_ml, p.start_at, p.end_at
+		FROM pumping_sessions p
+		JOIN family_members m ON m.id = p.member_id
+		`+where+`
+		ORDER BY p.start_at ASC, p.id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []PumpingSession
+	for rows.Next() {
+		var (
+			session    PumpingSession
+			startAtRaw string
+			endAtRaw   sql.NullString
+		)
+		if err := rows.Scan(&session.ID, &session.ChildID, &session.MemberID, &session.MemberName, &session.Side, &session.VolumeML, &startAtRaw, &endAtRaw); err != nil {
+			return nil, err
+		}
+		startAt, err := parseStoredTime(startAtRaw)
+		if err != nil {
+			return nil, err
+		}
+		session.StartAt = startAt
+		if endAtRaw.Valid {
+			endAt, err := parseStoredTime(endAtRaw.String)
+			if err != nil {
+				return nil, err
+			}
+			session.EndAt = &endAt
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// AddMilkBag кладет пакет в запас; срок годности считается от даты сцеживания и места хранения.
+// Пакет из сцеживания (PumpingID != 0) можно добавить только один раз.
+func (s *Store) AddMilkBag(ctx context.Context, childID int64, memberID int64, bag MilkBag) (*MilkBag, error) {
+	shelfLife, ok := milkShelfLife[bag.Storage]
+	if !ok {
+		return nil, fmt.Errorf("неизвестное место хранения")
+	}
+	if bag.VolumeML < 1 || bag.VolumeML > pumpMaxVolumeML {
+		return nil, fmt.Errorf("объем должен быть от 1 до %d мл", pumpMaxVolumeML)
+	}
+	if bag.PumpedAt.After(s.clock().Add(1 * time.Minute)) {
+		return nil, fmt.Errorf("дата сцеживания не может быть в будущем")
+	}
+	bag.ChildID = childID
+	bag.RemainingML = bag.VolumeML
+	bag.PumpedAt = bag.PumpedAt.UTC()
+	bag.ExpiresAt = bag.PumpedAt.Add(shelfLife)
+
+	var pumpingID any
+	if bag.PumpingID != 0 {
+		pumpingID = bag.PumpingID
+	}
+	now := s.nowUTCString()
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO milk_bags(child_id, pumping_id, volume_ml, remaining_ml, storage, pumped_at, expires_at, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, childID, pumpingID, bag.VolumeML, bag.RemainingML, bag.Storage, toStoredTime(bag.PumpedAt), toStoredTime(bag.ExpiresAt), memberID, now, now)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return nil, fmt.Errorf("это сцеживание уже в запасе")
+		}
+		return nil, err
+	}
+	bag.ID, _ = result.LastInsertId()
+	return &bag, nil
+}
+
+// ListMilkBags возвращает пакеты с остатком (включая просроченные) по возрастанию срока годности.
+func (s *Store) ListMilkBags(ctx context.Context, childID int64) ([]MilkBag, error) {
+	return s.listMilkBags(ctx, s.db, childID)
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func (s *Store) listMilkBags(ctx context.Context, q queryer, childID int64) ([]MilkBag, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, child_id, COALESCE(pumping_id, 0), volume_ml, remaining_ml, storage, pumped_at, expires_at
+		FROM milk_bags
+		WHERE child_id = ? AND remaining_ml > 0 AND discarded = 0
+		ORDER BY expires_at ASC, id ASC
+	`, childID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bags []MilkBag
+	for rows.Next() {
+		var (
+			bag          MilkBag
+			pumpedAtRaw  string
+			expiresAtRaw string
+		)
+		if err := rows.Scan(&bag.ID, &bag.ChildID, &bag.PumpingID, &bag.VolumeML, &bag.RemainingML, &bag.Storage, &pumpedAtRaw, &expiresAtRaw); err != nil {
+			return nil, err
+		}
+		if bag.PumpedAt, err = parseStoredTime(pumpedAtRaw); err != nil {
+			return nil, err
+		}
+		if bag.ExpiresAt, err = parseStoredTime(expiresAtRaw); err != nil {
+			return nil, err
+		}
+		bags = append(bags, bag)
+	}
+	return bags, rows.Err()
+}
+
+// DiscardMilkBag убирает пакет из запаса (вылили или испортился).
+func (s *Store) DiscardMilkBag(ctx context.Context, childID int64, bagID int64) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE milk_bags SET discarded = 1, updated_at = ?
+		WHERE id = ? AND child_id = ? AND discarded = 0 AND remaining_ml > 0
+	`, s.nowUTCString(), bagID, childID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("пакет не найден")
+	}
+	return nil
+}
+
+// AddBottleFeed записывает кормление из бутылочки; при fromStash молоко списывается из запаса
+// (см. AllocateMilk). Возвращает, из каких пакетов оно взято.
+func (s *Store) AddBottleFeed(ctx context.Context, childID int64, memberID int64, volumeML int, fromStash bool, fedAt time.Time) ([]MilkBagUse, error) {
+	if err := s.validateTimestamp(fedAt); err != nil {
+		return nil, err
+	}
+	if volumeML < 1 || volumeML > pumpMaxVolumeML {
+		return nil, fmt.Errorf("объем должен быть от 1 до %d мл", pumpMaxVolumeML)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var uses []MilkBagUse
+	if fromStash {
+		bags, err := s.listMilkBags(ctx, tx, childID)
+		if err != nil {
+			return nil, err
+		}
+		var shortfall int
+		uses, shortfall = AllocateMilk(bags, volumeML, fedAt)
+		if shortfall > 0 {
+			return nil, fmt.Errorf("в запасе не хватает %d мл годного молока", shortfall)
+		}
+		now := s.nowUTCString()
+		for _, use := range uses {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE milk_bags SET remaining_ml = remaining_ml - ?, updated_at = ? WHERE id = ?
+			`, use.VolumeML, now, use.BagID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	fromStashML := 0
+	for _, use := range uses {
+		fromStashML += use.VolumeML
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO bottle_feeds(child_id, volume_ml, from_stash_ml, fed_at, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, childID, volumeML, fromStashML, toStoredTime(fedAt), memberID, s.nowUTCString()); err != nil {
+		return nil, err
+	}
+	return uses, tx.Commit()
+}
+
+// SetAPIToken сохраняет хеш нового токена API семьи; прежний токен семьи перестает действовать.
+// memberID — участник, от имени которого выпущен токен.
+func (s *Store) SetAPIToken(ctx context.Context, familyID int64, memberID int64, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO api_tokens(token_hash, family_id, member_id, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(family_id) DO UPDATE SET
+			token_hash = excluded.token_hash,
+			member_id = excluded.member_id,
+			created_at = excluded.created_at,
+			last_used_at = NULL
+	`, tokenHash, familyID, memberID, s.nowUTCString())
+	return err
+}
+
+func (s *Store) RevokeAPIToken(ctx context.Context, familyID int64) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE family_id = ?`, familyID)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// GetAPITokenInfo возвращает время выпуска и последнего использования токена семьи (nil, если токена нет).
+func (s *Store) GetAPITokenInfo(ctx context.Context, familyID int64) (*time.Time, *time.Time, error) {
+	var (
+		createdAtRaw  string
+		lastUsedAtRaw sql.NullString
+	)
+	err := s.db.QueryRowContext(ctx, `SELECT created_at, last_used_at FROM api_tokens WHERE family_id = ?`, familyID).Scan(&createdAtRaw, &lastUsedAtRaw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	createdAt, err := parseStoredTime(createdAtRaw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !lastUsedAtRaw.Valid {
+		return &createdAt, nil, nil
+	}
+	lastUsedAt, err := parseStoredTime(lastUsedAtRaw.String)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &createdAt, &lastUsedAt, nil
+}
+
+// apiTokenTouchInterval — как часто обновляется last_used_at токена: чтение через API
+// не должно каждый раз брать транзакцию записи.
+const apiTokenTouchInterval = time.Minute
+
+// GetUserContextByAPIToken находит контекст участника, выпустившего токен, и отмечает использование токена
+// не чаще раза в apiTokenTouchInterval. Неизвестный токен — sql.ErrNoRows.
+func (s *Store) GetUserContextByAPIToken(ctx context.Context, tokenHash string) (UserContext, error) {
+	var (
+		telegramUserID int64
+		lastUsedAtRaw  sql.NullString
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT m.telegram_user_id, t.last_used_at
+		FROM api_tokens t
+		JOIN family_members m ON m.id = t.member_id AND m.family_id = t.family_id
+		WHERE t.token_hash = ?
+	`, tokenHash).Scan(&telegramUserID, &lastUsedAtRaw)
+	if err != nil {
+		return UserContext{}, err
+	}
+	now := s.clock()
+	touch := true
+	if lastUsedAtRaw.Valid {
+		if lastUsedAt, err := parseStoredTime(lastUsedAtRaw.String); err == nil && now.Sub(lastUsedAt) < apiTokenTouchInterval {
+			touch = false
+		}
+	}
+	if touch {
+		if _, err := s.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = ? WHERE token_hash = ?`, toStoredTime(now), tokenHash); err != nil {
+			return UserContext{}, err
+		}
+	}
+	return s.GetUserContext(ctx, telegramUserID)
+}
+
+// AddWebhook регистрирует адрес для событий семьи; не больше webhookMaxPerFamily адресов.
+func (s *Store) AddWebhook(ctx context.Context, familyID int64, url string, secret string) (*Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM webhooks WHERE family_id = ?`, familyID).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= webhookMaxPerFamily {
+		return nil, fmt.Errorf("не больше %d вебхуков на семью", webhookMaxPerFamily)
+	}
+	now := s.clock().UTC()
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhooks(family_id, url, secret, created_at)
+		VALUES (?, ?, ?, ?)
+	`, familyID, url, secret, toStoredTime(now))
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	return &Webhook{ID: id, FamilyID: familyID, URL: url, Secret: secret, CreatedAt: now}, nil
+}
+
+func (s *Store) ListWebhooks(ctx context.Context, familyID int64) ([]Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, family_id, url, secret, created_at
+		FROM webhooks
+		WHERE family_id = ?
+		ORDER BY id
+	`, familyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var (
+			webhook      Webhook
+			createdAtRaw string
+		)
+		if err := rows.Scan(&webhook.ID, &webhook.FamilyID, &webhook.URL, &webhook.Secret, &createdAtRaw); err != nil {
+			return nil, err
+		}
+		if webhook.CreatedAt, err = parseStoredTime(createdAtRaw); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook удаляет вебхук семьи вместе с журналом его отправок.
+func (s *Store) DeleteWebhook(ctx context.Context, familyID int64, webhookID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ? AND family_id = ?`, webhookID, familyID)
+	if err != nil {
+		return false, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = ?`, webhookID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// EnqueueWebhookEvent ставит событие в очередь отправки на все вебхуки семьи.
+func (s *Store) EnqueueWebhookEvent(ctx context.Context, familyID int64, event string, payload []byte) error {
+	now := s.nowUTCString()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries(webhook_id, event, payload, status, next_attempt_at, created_at)
+		SELECT id, ?, ?, ?, ?, ?
+		FROM webhooks
+		WHERE family_id = ?
+	`, event, string(payload), webhookStatusPending, now, now, familyID)
+	return err
+}
+
+// EnqueueWebhookDelivery создает отправку на один вебхук семьи для немедленной попытки (`/webhooks test`).
+// Очередь подхватит ее только через webhookFirstRetryDelay, если немедленная попытка не запишет результат.
+func (s *Store) EnqueueWebhookDelivery(ctx context.Context, familyID int64, webhookID int64, event string, payload []byte) (*WebhookDelivery, error) {
+	now := s.clock()
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries(webhook_id, event, payload, status, next_attempt_at, created_at)
+		SELECT id, ?, ?, ?, ?, ?
+		FROM webhooks
+		WHERE id = ? AND family_id = ?
+	`, event, string(payload), webhookStatusPending, toStoredTime(now.Add(webhookFirstRetryDelay)), toStoredTime(now), webhookID, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, fmt.Errorf("вебхук %d не найден", webhookID)
+	}
+	id, _ := result.LastInsertId()
+	deliveries, err := s.listWebhookDeliveries(ctx, `WHERE d.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &deliveries[0], nil
+}
+
+// ListDueWebhookDeliveries возвращает до limit отправок, чья очередная попытка наступила к now.
+func (s *Store) ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	return s.listWebhookDeliveries(ctx, `
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT ?
+	`, webhookStatusPending, toStoredTime(now), limit)
+}
+
+// ListWebhookDeliveries — журнал последних limit отправок семьи, новые сверху.
+func (s *Store) ListWebhookDeliveries(ctx context.Context, familyID int64, limit int) ([]WebhookDelivery, error) {
+	return s.listWebhookDeliveries(ctx, `
+		WHERE w.family_id = ?
+		ORDER BY d.id DESC
+		LIMIT ?
+	`, familyID, limit)
+}
+
+func (s *Store) listWebhookDeliveries(ctx context.Context, where string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			d.id, d.webhook_id, w.url, w.secret, d.event, d.payload, d.status, d.attempts,
+			d.next_attempt_at, d.response_code, d.last_error, d.created_at, d.delivered_at
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+	`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var (
+			delivery                       WebhookDelivery
+			payload                        string
+			nextAttemptAtRaw, createdAtRaw string
+			deliveredAtRaw                 sql.NullString
+		)
+		if err := rows.Scan(
+			&delivery.ID, &delivery.WebhookID, &delivery.URL, &delivery.Secret, &delivery.Event, &payload, &delivery.Status, &delivery.Attempts,
+			&nextAttemptAtRaw, &delivery.ResponseCode, &delivery.LastError, &createdAtRaw, &deliveredAtRaw,
+		); err != nil {
+			return nil, err
+		}
+		delivery.Payload = []byte(payload)
+		if delivery.NextAttemptAt, err = parseStoredTime(nextAttemptAtRaw); err != nil {
+			return nil, err
+		}
+		if delivery.CreatedAt, err = parseStoredTime(createdAtRaw); err != nil {
+			return nil, err
+		}
+		if deliveredAtRaw.Valid {
+			deliveredAt, err := parseStoredTime(deliveredAtRaw.String)
+			if err != nil {
+				return nil, err
+			}
+			delivery.DeliveredAt = &deliveredAt
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordWebhookAttempt сохраняет результат попытки отправки: новый статус, число попыток,
+// время следующей попытки, код ответа и текст ошибки.
+func (s *Store) RecordWebhookAttempt(ctx context.Context, delivery WebhookDelivery) error {
+	var deliveredAt any
+	if delivery.DeliveredAt != nil {
+		deliveredAt = toStoredTime(*delivery.DeliveredAt)
+	}
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, response_code = ?, last_error = ?, delivered_at = ?
+		WHERE id = ?
+	`, delivery.Status, delivery.Attempts, toStoredTime(delivery.NextAttemptAt), delivery.ResponseCode, delivery.LastError, deliveredAt, delivery.ID)
+	return err
+}
+
+// PruneWebhookDeliveries удаляет завершенные отправки старше before.
+func (s *Store) PruneWebhookDeliveries(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM webhook_deliveries
+		WHERE status != ? AND created_at < ?
+	`, webhookStatusPending, toStoredTime(before))
+	return err
+}
+
+// MarkChatBlocked отмечает участников с чатом chatID как заблокировавших бота и снимает их
+// ожидающие уведомления; возвращает число отмеченных участников.
+func (s *Store) MarkChatBlocked(ctx context.Context, chatID int64, lastError string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := s.nowUTCString()
+	result, err := tx.ExecContext(ctx, `
+		UPDATE family_members SET blocked_at = ?, updated_at = ?
+		WHERE telegram_chat_id = ? AND blocked_at IS NULL
+	`, now, now, chatID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE outbox SET status = ?, last_error = ?
+		WHERE chat_id = ? AND status = ?
+	`, outboxStatusFailed, lastError, chatID, outboxStatusPending); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// EnqueueOutbox ставит уведомления в очередь отправки; первая попытка — сразу.
+func (s *Store) EnqueueOutbox(ctx context.Context, messages []OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer tx.Rollback()
 
-	last, err := s.getLastCompletedSleepTx(ctx, tx, childID)
-	if err != nil {
-		return nil, err
-	}
-	if last == nil {
-		return nil, fmt.Errorf("нет завершенных снов для редактирования")
+	now := s.nowUTCString()
+	for _, msg := range messages {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO outbox(family_id, member_id, chat_id, kind, text, markup, status, next_attempt_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, msg.FamilyID, msg.MemberID, msg.ChatID, msg.Kind, msg.Text, msg.Markup, outboxStatusPending, now, now); err != nil {
+			return err
+		}
 	}
+	return tx.Commit()
+}
 
-	if err := s.ensureNoOverlapTx(ctx, tx, childID, startAt, &endAt, last.ID); err != nil {
+// ListDueOutbox возвращает до limit уведомлений, которым пора отправляться, в порядке очереди.
+func (s *Store) ListDueOutbox(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, family_id, member_id, chat_id, kind, text, markup, status, attempts, parts_sent,
+			next_attempt_at, last_error, created_at, sent_at
+		FROM outbox
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id
+		LIMIT ?
+	`, outboxStatusPending, toStoredTime(now), limit)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	now := s.nowUTCString()
-	if _, err := tx.ExecContext(ctx, `
-		UPDATE sleep_sessions
-		SET start_at = ?, end_at = ?, start_source = ?, end_source = ?, updated_by = ?, updated_at = ?
-		WHERE id = ?
-	`, toStoredTime(startAt), toStoredTime(endAt), sourceManual, sourceManual, memberID, now, last.ID); err != nil {
-		return nil, err
+	var messages []OutboxMessage
+	for rows.Next() {
+		var (
+			msg                            OutboxMessage
+			nextAttemptAtRaw, createdAtRaw string
+			sentAtRaw                      sql.NullString
+		)
+		if err := rows.Scan(
+			&msg.ID, &msg.FamilyID, &msg.MemberID, &msg.ChatID, &msg.Kind, &msg.Text, &msg.Markup, &msg.Status, &msg.Attempts, &msg.PartsSent,
+			&nextAttemptAtRaw, &msg.LastError, &createdAtRaw, &sentAtRaw,
+		); err != nil {
+			return nil, err
+		}
+		if msg.NextAttemptAt, err = parseStoredTime(nextAttemptAtRaw); err != nil {
+			return nil, err
+		}
+		if msg.CreatedAt, err = parseStoredTime(createdAtRaw); err != nil {
+			return nil, err
+		}
+		if sentAtRaw.Valid {
+			sentAt, err := parseStoredTime(sentAtRaw.String)
+			if err != nil {
+				return nil, err
+			}
+			msg.SentAt = &sentAt
+		}
+		messages = append(messages, msg)
 	}
+	return messages, rows.Err()
+}
 
-	if err := tx.Commit(); err != nil {
-		return nil, err
+// RecordOutboxAttempt сохраняет результат попытки отправки уведомления.
+func (s *Store) RecordOutboxAttempt(ctx context.Context, msg OutboxMessage) error {
+	var sentAt any
+	if msg.SentAt != nil {
+		sentAt = toStoredTime(*msg.SentAt)
 	}
-	return s.GetSleepByID(ctx, last.ID)
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE outbox
+		SET status = ?, attempts = ?, parts_sent = ?, next_attempt_at = ?, last_error = ?, sent_at = ?
+		WHERE id = ?
+	`, msg.Status, msg.Attempts, msg.PartsSent, toStoredTime(msg.NextAttemptAt), msg.LastError, sentAt, msg.ID)
+	return err
 }
 
-func (s *Store) GetSleepByID(ctx context.Context, id int64) (*SleepSession, error) {
-	row := s.db.QueryRowContext(ctx, `
-		SELECT id, child_id, start_at, end_at, start_source, end_source, note, created_by, updated_by
-		FROM sleep_sessions
-		WHERE id = ?
-	`, id)
-	return scanSleepSession(row)
+// PruneOutbox удаляет отправленные и неотправленные уведомления, созданные раньше before.
+func (s *Store) PruneOutbox(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM outbox
+		WHERE status != ? AND created_at < ?
+	`, outboxStatusPending, toStoredTime(before))
+	return err
 }
 
-func (s *Store) ListCompletedSleepsSince(ctx context.Context, childID int64, since time.Time) ([]SleepSession, error) {
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, child_id, start_at, end_at, start_source, end_source, note, created_by, updated_by
-		FROM sleep_sessions
-		WHERE child_id = ? AND end_at IS NOT NULL AND start_at >= ?
-		ORDER BY start_at ASC
-	`, childID, toStoredTime(since))
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+// StoreStats — показатели базы для /metrics.
+type StoreStats struct {
+	Families       int
+	ActiveFamilies int
+	SizeBytes      int64
+}
 
-	return collectSleepSessions(rows)
+// GetStoreStats считает семьи, семьи с записями сна с момента since и размер файла базы.
+func (s *Store) GetStoreStats(ctx context.Context, since time.Time) (StoreStats, error) {
+	var stats StoreStats
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM families`).Scan(&stats.Families); err != nil {
+		return stats, err
+	}
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT c.family_id)
+		FROM sleep_sessions ss
+		JOIN children c ON c.id = ss.child_id
+		WHERE ss.start_at >= ? OR ss.end_at IS NULL
+	`, toStoredTime(since)).Scan(&stats.ActiveFamilies); err != nil {
+		return stats, err
+	}
+	var pageCount, pageSize int64
+	if err := s.db.QueryRowContext(ctx, `PRAGMA page_count`).Scan(&pageCount); err != nil {
+		return stats, err
+	}
+	if err := s.db.QueryRowContext(ctx, `PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return stats, err
+	}
+	stats.SizeBytes = pageCount * pageSize
+	return stats, nil
 }
 
-func (s *Store) ListAllCompletedSleeps(ctx context.Context, childID int64) ([]SleepSession, error) {
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, child_id, start_at, end_at, start_source, end_source, note, created_by, updated_by
-		FROM sleep_sessions
-		WHERE child_id = ? AND end_at IS NOT NULL
-		ORDER BY start_at ASC
-	`, childID)
-	if err != nil {
-		return nil, err
+// GetCalendarToken возвращает секрет ссылки на календарь семьи; пустая строка — календарь выключен.
+func (s *Store) GetCalendarToken(ctx context.Context, familyID int64) (string, error) {
+	var token string
+	err := s.db.QueryRowContext(ctx, `SELECT token FROM calendar_feeds WHERE family_id = ?`, familyID).Scan(&token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
 	}
-	defer rows.Close()
+	return token, err
+}
 
-	return collectSleepSessions(rows)
+// SetCalendarToken задает новый секрет ссылки на календарь; прежняя ссылка перестает работать.
+func (s *Store) SetCalendarToken(ctx context.Context, familyID int64, token string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO calendar_feeds(family_id, token, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(family_id) DO UPDATE SET
+			token = excluded.token,
+			created_at = excluded.created_at
+	`, familyID, token, s.nowUTCString())
+	return err
 }
 
-func (s *Store) GetLastCompletedSleep(ctx context.Context, childID int64) (*SleepSession, error) {
-	row := s.db.QueryRowContext(ctx, `
-		SELECT id, child_id, start_at, end_at, start_source, end_source, note, created_by, updated_by
-		FROM sleep_sessions
-		WHERE child_id = ? AND end_at IS NOT NULL
-		ORDER BY start_at DESC
-		LIMIT 1
-	`, childID)
-	session, err := scanSleepSession(row)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, nil
+func (s *Store) DeleteCalendarToken(ctx context.Context, familyID int64) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM calendar_feeds WHERE family_id = ?`, familyID)
+	if err != nil {
+		return false, err
 	}
-	return session, err
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
 }
 
-func (s *Store) GetLatestEventTime(ctx context.Context, childID int64) (*time.Time, error) {
-	var startAt sql.NullString
-	var endAt sql.NullString
+// GetUserContextByCalendarToken возвращает контекст владельца семьи по секрету календаря.
+// Неизвестный секрет — sql.ErrNoRows.
+func (s *Store) GetUserContextByCalendarToken(ctx context.Context, token string) (UserContext, error) {
+	var telegramUserID int64
 	err := s.db.QueryRowContext(ctx, `
-		SELECT start_at, end_at
-		FROM sleep_sessions
-		WHERE child_id = ?
-		ORDER BY COALESCE(end_at, start_at) DESC
+		SELECT m.telegram_user_id
+		FROM calendar_feeds c
+		JOIN family_members m ON m.family_id = c.family_id
+		WHERE c.token = ?
+		ORDER BY m.id
 		LIMIT 1
-	`, childID).Scan(&startAt, &endAt)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, nil
-	}
+	`, token).Scan(&telegramUserID)
 	if err != nil {
-		return nil, err
+		return UserContext{}, err
 	}
+	return s.GetUserContext(ctx, telegramUserID)
+}
 
-	raw := startAt.String
-	if endAt.Valid && endAt.String != "" {
-		raw = endAt.String
-	}
-	parsed, err := parseStoredTime(raw)
-	if err != nil {
+// GetRoutineSteps возвращает настроенные шаги ритуала; пустой список — используются шаги по умолчанию.
+func (s *Store) GetRoutineSteps(ctx context.Context, childID int64) ([]string, error) {
+	var raw string
+	if err := s.db.QueryRowContext(ctx, `SELECT routine_steps FROM children WHERE id = ?`, childID).Scan(&raw); err != nil {
 		return nil, err
 	}
-	return &parsed, nil
+	if raw == "" {
+		return nil, nil
+	}
+	return strings.Split(raw, "\n"), nil
 }
 
-func (s *Store) SetFamilyTimezone(ctx context.Context, familyID int64, timezone string) error {
-	if _, err := time.LoadLocation(timezone); err != nil {
-		return fmt.Errorf("не удалось загрузить таймзону: %w", err)
+func (s *Store) SetRoutineSteps(ctx context.Context, childID int64, steps []string) error {
+	if len(steps) > routineMaxSteps {
+		return fmt.Errorf("не больше %d шагов", routineMaxSteps)
 	}
 	_, err := s.db.ExecContext(ctx,
-		`UPDATE families SET timezone = ?, updated_at = ? WHERE id = ?`,
-		timezone, s.nowUTCString(), familyID,
+		`UPDATE children SET routine_steps = ?, updated_at = ? WHERE id = ?`,
+		strings.Join(steps, "\n"), s.nowUTCString(), childID,
 	)
 	return err
 }
 
-func (s *Store) SetChildName(ctx context.Context, familyID int64, name string) error {
-	name = strings.TrimSpace(name)
-	if name == "" {
-		return fmt.Errorf("имя ребенка не может быть пустым")
+// StartRoutine возвращает ритуал за вечер evening, создавая его со снимком steps, если его еще нет.
+func (s *Store) StartRoutine(ctx context.Context, childID int64, memberID int64, evening string, steps []string, startedAt time.Time) (*RoutineRun, error) {
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO routine_runs(child_id, evening, steps, started_at, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, childID, evening, strings.Join(steps, "\n"), toStoredTime(startedAt), memberID, s.nowUTCString()); err != nil {
+		return nil, err
 	}
-	_, err := s.db.ExecContext(ctx,
-		`UPDATE children SET name = ?, updated_at = ? WHERE family_id = ?`,
-		name, s.nowUTCString(), familyID,
-	)
-	return err
+	var runID int64
+	if err := s.db.QueryRowContext(ctx, `SELECT id FROM routine_runs WHERE child_id = ? AND evening = ?`, childID, evening).Scan(&runID); err != nil {
+		return nil, err
+	}
+	return s.GetRoutineRun(ctx, childID, runID)
 }
 
-func (s *Store) SetChildBirthDate(ctx context.Context, familyID int64, birthDate time.Time) error {
-	_, err := s.db.ExecContext(ctx,
-		`UPDATE children SET birth_date = ?, updated_at = ? WHERE family_id = ?`,
-		FormatBirthDateStored(birthDate), s.nowUTCString(), familyID,
-	)
+func (s *Store) GetRoutineRun(ctx context.Context, childID int64, runID int64) (*RoutineRun, error) {
+	runs, err := s.listRoutineRuns(ctx, `WHERE r.child_id = ? AND r.id = ?`, childID, runID)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("ритуал не найден")
+	}
+	return &runs[0], nil
+}
+
+// ListRoutineRunsSince возвращает ритуалы с вечера sinceEvening (`2006-01-02`) включительно, по возрастанию.
+func (s *Store) ListRoutineRunsSince(ctx context.Context, childID int64, sinceEvening string) ([]RoutineRun, error) {
+	return s.listRoutineRuns(ctx, `WHERE r.child_id = ? AND r.evening >= ?`, childID, sinceEvening)
+}
+
+func (s *Store) listRoutineRuns(ctx context.Context, where string, args ...any) ([]RoutineRun, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.id, r.child_id, r.evening, r.steps, r.started_at, m.step, m.done_at
+		FROM routine_runs r
+		LEFT JOIN routine_marks m ON m.run_id = r.id
+		`+where+`
+		ORDER BY r.evening ASC, m.step ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []RoutineRun
+	for rows.Next() {
+		var (
+			run          RoutineRun
+			steps        string
+			startedAtRaw string
+			step         sql.NullInt64
+			doneAtRaw    sql.NullString
+		)
+		if err := rows.Scan(&run.ID, &run.ChildID, &run.Evening, &steps, &startedAtRaw, &step, &doneAtRaw); err != nil {
+			return nil, err
+		}
+		if len(runs) == 0 || runs[len(runs)-1].ID != run.ID {
+			startedAt, err := parseStoredTime(startedAtRaw)
+			if err != nil {
+				return nil, err
+			}
+			run.StartedAt = startedAt
+			run.Steps = strings.Split(steps, "\n")
+			run.Marks = map[int]time.Time{}
+			runs = append(runs, run)
+		}
+		if step.Valid && doneAtRaw.Valid {
+			doneAt, err := parseStoredTime(doneAtRaw.String)
+			if err != nil {
+				return nil, err
+			}
+			runs[len(runs)-1].Marks[int(step.Int64)] = doneAt
+		}
+	}
+	return runs, rows.Err()
+}
+
+// ToggleRoutineMark отмечает шаг выполненным в doneAt или снимает отметку, если она уже есть.
+func (s *Store) ToggleRoutineMark(ctx context.Context, runID int64, step int, memberID int64, doneAt time.Time) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM routine_marks WHERE run_id = ? AND step = ?`, runID, step)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return nil
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO routine_marks(run_id, step, done_at, done_by)
+		VALUES (?, ?, ?, ?)
+	`, runID, step, toStoredTime(doneAt), memberID)
 	return err
 }
 
@@ -885,6 +2973,27 @@ func (s *Store) UpdateReminderThreshold(ctx context.Context, familyID int64, fie
 	return err
 }
 
+// SetMemberDigest задаёт время ежедневной или еженедельной сводки участника; пустое atTime выключает сводку.
+func (s *Store) SetMemberDigest(ctx context.Context, memberID int64, field string, atTime string) error {
+	allowed := map[string]bool{
+		"digest_daily_at":  true,
+		"digest_weekly_at": true,
+	}
+	if !allowed[field] {
+		return fmt.Errorf("неподдерживаемое поле сводки")
+	}
+	atTime = strings.TrimSpace(atTime)
+	if atTime != "" {
+		if _, err := time.Parse("15:04", atTime); err != nil {
+			return fmt.Errorf("время должно быть в формате HH:MM")
+		}
+	}
+
+	query := fmt.Sprintf("UPDATE family_members SET %s = ?, updated_at = ? WHERE id = ?", field)
+	_, err := s.db.ExecContext(ctx, query, atTime, s.nowUTCString(), memberID)
+	return err
+}
+
 func (s *Store) AddCustomReminder(ctx context.Context, familyID int64, atTime string, title string, weekdays string) error {
 	atTime = strings.TrimSpace(atTime)
 	title = strings.TrimSpace(title)
@@ -1031,8 +3140,17 @@ func (s *Store) SetSilentMode(ctx context.Context, silent bool) error {
 			inactivity_enabled = 0,
 			milestone_notify_each = 0,
 			milestone_report_today = 0,
+			temperature_alert = 0,
 			updated_at = ?
 	`, s.nowUTCString())
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE family_members
+		SET digest_daily_at = '', digest_weekly_at = '', pump_interval_minutes = 0, updated_at = ?
+	`, s.nowUTCString())
 	return err
 }
 
@@ -1056,24 +3174,121 @@ func (s *Store) MarkCustomReminderFired(ctx context.Context, reminderID int64, l
 	return err
 }
 
-func (s *Store) getActiveSleepTx(ctx context.Context, tx *sql.Tx, childID int64) (*SleepSession, error) {
-	row := tx.QueryRowContext(ctx, `
-		SELECT id, child_id, start_at, end_at, start_source, end_source, note, created_by, updated_by
-		FROM sleep_sessions
-		WHERE child_id = ? AND end_at IS NULL
+// sessionTable — таблица интервалов ребенка: сон или активности одного вида. Поиск идущего
+// интервала, проверка пересечений, вставка и завершение у них общие; у сна вида нет.
+type sessionTable struct {
+	name string
+	kind string
+}
+
+// sessionColumn — значение колонки, которая есть только в одной из таблиц интервалов.
+type sessionColumn struct {
+	name  string
+	value any
+}
+
+var sleepSessionTable = sessionTable{name: "sleep_sessions"}
+
+func activitySessionTable(kind string) sessionTable {
+	return sessionTable{name: "activity_sessions", kind: kind}
+}
+
+// filter возвращает условие по ребенку и виду интервала.
+func (t sessionTable) filter(childID int64) (string, []any) {
+	if t.kind == "" {
+		return `child_id = ?`, []any{childID}
+	}
+	return `child_id = ? AND kind = ?`, []any{childID, t.kind}
+}
+
+// activeSessionTx возвращает id и начало идущего интервала; id == 0 — сейчас ничего не идет.
+func (s *Store) activeSessionTx(ctx context.Context, tx *sql.Tx, table sessionTable, childID int64) (int64, time.Time, error) {
+	where, args := table.filter(childID)
+	var (
+		id         int64
+		startAtRaw string
+	)
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, start_at FROM `+table.name+`
+		WHERE `+where+` AND end_at IS NULL
 		ORDER BY start_at DESC
 		LIMIT 1
-	`, childID)
-	session, err := scanSleepSession(row)
+	`, args...).Scan(&id, &startAtRaw)
 	if errors.Is(err, sql.ErrNoRows) {
-		return nil, nil
+		return 0, time.Time{}, nil
 	}
-	return session, err
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	startAt, err := parseStoredTime(startAtRaw)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return id, startAt, nil
+}
+
+// sessionOverlapsTx сообщает, пересекается ли [startAt, endAt) с сохраненным интервалом, кроме excludeID;
+// endAt == nil — интервал еще идет.
+func (s *Store) sessionOverlapsTx(ctx context.Context, tx *sql.Tx, table sessionTable, childID int64, startAt time.Time, endAt *time.Time, excludeID int64) (bool, error) {
+	proposedEnd := time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	if endAt != nil {
+		proposedEnd = endAt.UTC()
+	}
+	where, args := table.filter(childID)
+	args = append(args, excludeID, toStoredTime(proposedEnd), toStoredTime(proposedEnd), toStoredTime(startAt))
+	var id int64
+	err := tx.QueryRowContext(ctx, `
+		SELECT id FROM `+table.name+`
+		WHERE `+where+` AND id <> ? AND start_at < ? AND COALESCE(end_at, ?) > ?
+		LIMIT 1
+	`, args...).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// insertSessionTx добавляет интервал и возвращает его id; endAt == nil — интервал только начался.
+func (s *Store) insertSessionTx(ctx context.Context, tx *sql.Tx, table sessionTable, childID int64, memberID int64, startAt time.Time, endAt *time.Time, extra ...sessionColumn) (int64, error) {
+	var storedEnd any
+	if endAt != nil {
+		storedEnd = toStoredTime(*endAt)
+	}
+	now := s.nowUTCString()
+	columns := []string{"child_id", "start_at", "end_at", "created_by", "updated_by", "created_at", "updated_at"}
+	values := []any{childID, toStoredTime(startAt), storedEnd, memberID, memberID, now, now}
+	if table.kind != "" {
+		extra = append(extra, sessionColumn{"kind", table.kind})
+	}
+	for _, column := range extra {
+		columns = append(columns, column.name)
+		values = append(values, column.value)
+	}
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO `+table.name+`(`+strings.Join(columns, ", ")+`)
+		VALUES (?`+strings.Repeat(", ?", len(columns)-1)+`)
+	`, values...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// closeSessionTx завершает идущий интервал id в момент endAt.
+func (s *Store) closeSessionTx(ctx context.Context, tx *sql.Tx, table sessionTable, id int64, memberID int64, endAt time.Time, extra ...sessionColumn) error {
+	set := `end_at = ?, updated_by = ?, updated_at = ?`
+	values := []any{toStoredTime(endAt), memberID, s.nowUTCString()}
+	for _, column := range extra {
+		set += `, ` + column.name + ` = ?`
+		values = append(values, column.value)
+	}
+	_, err := tx.ExecContext(ctx, `UPDATE `+table.name+` SET `+set+` WHERE id = ?`, append(values, id)...)
+	return err
 }
 
 func (s *Store) getLastCompletedSleepTx(ctx context.Context, tx *sql.Tx, childID int64) (*SleepSession, error) {
 	row := tx.QueryRowContext(ctx, `
-		SELECT id, child_id, start_at, end_at, start_source, end_source, note, created_by, updated_by
+		SELECT id, child_id, start_at, end_at, start_source, end_source, note, tags, created_by, updated_by
 		FROM sleep_sessions
 		WHERE child_id = ? AND end_at IS NOT NULL
 		ORDER BY start_at DESC
@@ -1087,27 +3302,12 @@ func (s *Store) getLastCompletedSleepTx(ctx context.Context, tx *sql.Tx, childID
 }
 
 func (s *Store) ensureNoOverlapTx(ctx context.Context, tx *sql.Tx, childID int64, startAt time.Time, endAt *time.Time, excludeID int64) error {
-	proposedEnd := time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
-	if endAt != nil {
-		proposedEnd = endAt.UTC()
-	}
-
-	row := tx.QueryRowContext(ctx, `
-		SELECT id, child_id, start_at, end_at, start_source, end_source, note, created_by, updated_by
-		FROM sleep_sessions
-		WHERE child_id = ? AND id <> ? AND start_at < ? AND COALESCE(end_at, ?) > ?
-		LIMIT 1
-	`, childID, excludeID, toStoredTime(proposedEnd), toStoredTime(proposedEnd), toStoredTime(startAt))
-
-	session, err := scanSleepSession(row)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil
-	}
+	overlaps, err := s.sessionOverlapsTx(ctx, tx, sleepSessionTable, childID, startAt, endAt, excludeID)
 	if err != nil {
 		return err
 	}
-	if session != nil {
-		return fmt.Errorf("новый интервал пересекается с уже сохраненным сном")
+	if overlaps {
+		return invalidInput("новый интервал пересекается с уже сохраненным сном")
 	}
 	return nil
 }
@@ -1115,7 +3315,7 @@ func (s *Store) ensureNoOverlapTx(ctx context.Context, tx *sql.Tx, childID int64
 func (s *Store) updateMemberPresence(ctx context.Context, telegramUserID int64, telegramChatID int64, displayName string) error {
 	_, err := s.db.ExecContext(ctx, `
 		UPDATE family_members
-		SET telegram_chat_id = ?, display_name = ?, updated_at = ?
+		SET telegram_chat_id = ?, display_name = ?, blocked_at = NULL, updated_at = ?
 		WHERE telegram_user_id = ?
 	`, telegramChatID, sanitizeDisplayName(displayName), s.nowUTCString(), telegramUserID)
 	return err
@@ -1124,10 +3324,10 @@ func (s *Store) updateMemberPresence(ctx context.Context, telegramUserID int64,
 func (s *Store) validateTimestamp(ts time.Time) error {
 	now := s.clock().UTC()
 	if ts.After(now.Add(1 * time.Minute)) {
-		return fmt.Errorf("время не может быть в будущем")
+		return invalidInput("время не может быть в будущем")
 	}
 	if ts.Before(now.Add(-s.cfg.MaxBackdate)) {
-		return fmt.Errorf("время слишком старое: доступно не более %s назад", s.cfg.MaxBackdate)
+		return invalidInput("время слишком старое: доступно не более %s назад", s.cfg.MaxBackdate)
 	}
 	return nil
 }
@@ -1150,13 +3350,17 @@ func scanSleepSession(scanner interface{ Scan(dest ...any) error }) (*SleepSessi
 		session    SleepSession
 		startAtRaw string
 		endAtRaw   sql.NullString
+		tags       string
 	)
 	if err := scanner.Scan(
 		&session.ID, &session.ChildID, &startAtRaw, &endAtRaw, &session.StartSource, &session.EndSource,
-		&session.Note, &session.CreatedBy, &session.UpdatedBy,
+		&session.Note, &tags, &session.CreatedBy, &session.UpdatedBy,
 	); err != nil {
 		return nil, err
 	}
+	if tags != "" {
+		session.Tags = strings.Split(tags, ",")
+	}
 
 	startAt, err := parseStoredTime(startAtRaw)
 	if err != nil {
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeMessage — исходящий вызов Telegram API, записанный fakeTelegram.
+type fakeMessage struct {
+	Kind   string // message, document, photo, edit, callback
+	ChatID int64
+	Text   string
+	Markup any
+}
+
+// fakeTelegram реализует telegramAPI в памяти: записывает исходящие сообщения и может
+// возвращать ошибку для выбранных чатов.
+type fakeTelegram struct {
+	mu      sync.Mutex
+	sent    []fakeMessage
+	failFor map[int64]error
+	// Разовая ошибка: пропустить skip отправок в чат, следующую провалить.
+	failOnce map[int64]fakeFailure
+	nextID   int
+	updates  chan tgbotapi.Update
+}
+
+func newFakeTelegram() *fakeTelegram {
+	return &fakeTelegram{failFor: map[int64]error{}, failOnce: map[int64]fakeFailure{}, updates: make(chan tgbotapi.Update, 16)}
+}
+
+func (f *fakeTelegram) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg, err := f.record(c)
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+	f.nextID++
+	return tgbotapi.Message{MessageID: f.nextID, Chat: &tgbotapi.Chat{ID: msg.ChatID}, Text: msg.Text}, nil
+}
+
+func (f *fakeTelegram) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.record(c); err != nil {
+		return nil, err
+	}
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (f *fakeTelegram) GetUpdatesChan(tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel {
+	return f.updates
+}
+
+func (f *fakeTelegram) record(c tgbotapi.Chattable) (fakeMessage, error) {
+	var msg fakeMessage
+	switch v := c.(type) {
+	case tgbotapi.MessageConfig:
+		msg = fakeMessage{Kind: "message", ChatID: v.ChatID, Text: v.Text, Markup: v.ReplyMarkup}
+	case tgbotapi.DocumentConfig:
+		msg = fakeMessage{Kind: "document", ChatID: v.ChatID, Text: v.Caption}
+	case tgbotapi.PhotoConfig:
+		msg = fakeMessage{Kind: "photo", ChatID: v.ChatID, Text: v.Caption}
+	case tgbotapi.EditMessageTextConfig:
+		msg = fakeMessage{Kind: "edit", ChatID: v.ChatID, Text: v.Text, Markup: v.ReplyMarkup}
+	case tgbotapi.CallbackConfig:
+		msg = fakeMessage{Kind: "callback", Text: v.Text}
+	default:
+		return msg, fmt.Errorf("fakeTelegram: unsupported %T", c)
+	}
+	if err := f.failFor[msg.ChatID]; err != nil && msg.ChatID != 0 {
+		return msg, err
+	}
+	if failure, ok := f.failOnce[msg.ChatID]; ok {
+		if failure.skip == 0 {
+			delete(f.failOnce, msg.ChatID)
+			return msg, failure.err
+		}
+		failure.skip--
+		f.failOnce[msg.ChatID] = failure
+	}
+	f.sent = append(f.sent, msg)
+	return msg, nil
+}
+
+// take возвращает записанные с прошлого вызова сообщения и очищает журнал.
+func (f *fakeTelegram) take() []fakeMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sent := f.sent
+	f.sent = nil
+	return sent
+}
+
+func (f *fakeTelegram) fail(chatID int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failFor[chatID] = err
+}
+
+type fakeFailure struct {
+	skip int
+	err  error
+}
+
+// failAfter проваливает с err одну отправку в чат chatID — следующую после skip успешных.
+func (f *fakeTelegram) failAfter(chatID int64, skip int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failOnce[chatID] = fakeFailure{skip: skip, err: err}
+}
+
+// testClock — управляемые часы для Store.clock.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// messagesTo оставляет сообщения в чат chatID.
+func messagesTo(sent []fakeMessage, chatID int64) []fakeMessage {
+	var out []fakeMessage
+	for _, msg := range sent {
+		if msg.ChatID == chatID && msg.Kind != "callback" {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+func joinTexts(sent []fakeMessage) string {
+	texts := make([]string, 0, len(sent))
+	for _, msg := range sent {
+		texts = append(texts, msg.Text)
+	}
+	return strings.Join(texts, "\n---\n")
+}
@@ -13,6 +13,27 @@ func escapeTelegramMarkdown(s string) string {
 	return tgbotapi.EscapeText(tgbotapi.ModeMarkdown, s)
 }
 
+// stripTelegramMarkdown превращает текст в legacy Markdown в обычный: убирает разметку *, _ и `
+// и снимает экранирование (\_ → _), чтобы отчёт можно было вывести вне Telegram (PDF и т.п.).
+func stripTelegramMarkdown(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*' || r == '_' || r == '`':
+			// Символы разметки пропускаем.
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
 // splitTelegramMessage режет текст на части не длиннее maxRunes, по возможности по переводу строки.
 func splitTelegramMessage(text string, maxRunes int) []string {
 	if maxRunes <= 0 {
@@ -31,3 +31,9 @@ func TestSplitTelegramMessageRespectsMaxRunes(t *testing.T) {
 	}
 }
 
+func TestStripTelegramMarkdown(t *testing.T) {
+	in := "*Сводка:* " + escapeTelegramMarkdown("Малыш_2") + " — _норма_ `code`"
+	if got := stripTelegramMarkdown(in); got != "Сводка: Малыш_2 — норма code" {
+		t.Fatalf("unexpected strip: %q", got)
+	}
+}
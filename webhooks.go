@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// События вебхуков: значение уходит в поле event и заголовок X-Sleepbot-Event.
+const (
+	webhookEventSleepStarted = "sleep.started"
+	webhookEventSleepEnded   = "sleep.ended"
+	webhookEventSleepAdded   = "sleep.added"
+	webhookEventReminder     = "reminder.fired"
+	webhookEventMilestone    = "milestone.reached"
+	webhookEventTest         = "webhook.test"
+)
+
+// Статусы webhook_deliveries.status.
+const (
+	webhookStatusPending   = "pending"
+	webhookStatusDelivered = "delivered"
+	webhookStatusFailed    = "failed"
+)
+
+const (
+	webhookMaxPerFamily = 5
+	// Попыток на одну отправку; после последней отправка помечается failed.
+	webhookMaxAttempts = 8
+	// Пауза перед второй попыткой; дальше удваивается, но не больше webhookMaxRetryDelay.
+	webhookFirstRetryDelay = 30 * time.Second
+	webhookMaxRetryDelay   = time.Hour
+	webhookTimeout         = 10 * time.Second
+	// Как часто отправитель проверяет очередь и сколько отправок берет за раз.
+	webhookTick      = 5 * time.Second
+	webhookBatchSize = 20
+	// Сколько отправок из пачки идут одновременно: медленный приемник одной семьи
+	// не задерживает вебхуки остальных дольше webhookTimeout.
+	webhookParallel = 5
+	// Завершенные отправки старше этого срока удаляются из журнала.
+	webhookLogRetention = 30 * 24 * time.Hour
+	// Сколько отправок показывает `/webhooks log`.
+	webhookLogLimit = 10
+)
+
+// webhookPayload — тело запроса вебхука. Data зависит от события: сон — как в HTTP API,
+// напоминание — вид и текст, веха — название и момент.
+type webhookPayload struct {
+	Event      string     `json:"event"`
+	FamilyID   int64      `json:"family_id"`
+	ChildID    int64      `json:"child_id"`
+	Member     *apiMember `json:"member,omitempty"`
+	OccurredAt time.Time  `json:"occurred_at"`
+	Data       any        `json:"data"`
+}
+
+type webhookReminder struct {
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+type webhookMilestone struct {
+	ID    string    `json:"id"`
+	Title string    `json:"title"`
+	At    time.Time `json:"at"`
+}
+
+func marshalWebhookPayload(family Family, child Child, member *Member, event string, data any, at time.Time) ([]byte, error) {
+	payload := webhookPayload{
+		Event:      event,
+		FamilyID:   family.ID,
+		ChildID:    child.ID,
+		OccurredAt: at.UTC(),
+		Data:       data,
+	}
+	if member != nil {
+		payload.Member = &apiMember{ID: member.ID, Name: member.DisplayName}
+	}
+	return json.Marshal(payload)
+}
+
+// emitWebhookEvent ставит событие в очередь на вебхуки семьи. Ошибка только пишется в лог:
+// сбой вебхуков не должен мешать записи сна.
+func emitWebhookEvent(ctx context.Context, store *Store, family Family, child Child, member *Member, event string, data any) {
+	body, err := marshalWebhookPayload(family, child, member, event, data, store.clock())
+	if err == nil {
+		err = store.EnqueueWebhookEvent(ctx, family.ID, event, body)
+	}
+	if err != nil {
+		slog.Error("webhook not queued", "event", event, "family_id", family.ID, "error", err)
+	}
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// webhookResolver находит IP-адреса хоста вебхука; в боте это net.DefaultResolver.
+type webhookResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// validateWebhookURL принимает только абсолютные https-адреса (http — если allowHTTP), которые
+// не ведут в локальную или внутреннюю сеть: иначе через вебхук можно достучаться до сервисов
+// рядом с ботом. Адреса проверяются еще раз при каждом подключении, см. webhookDialControl.
+func validateWebhookURL(ctx context.Context, resolver webhookResolver, raw string, allowHTTP bool) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || parsed.Hostname() == "" || (parsed.Scheme != "https" && (parsed.Scheme != "http" || !allowHTTP)) {
+		return "", fmt.Errorf("нужен адрес вида https://example.com/hook")
+	}
+	host := parsed.Hostname()
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return "", fmt.Errorf("не удалось найти адрес %s", host)
+	}
+	for _, addr := range addrs {
+		if !webhookIPAllowed(addr.IP) {
+			return "", fmt.Errorf("адрес %s ведет в локальную сеть, вебхук на него не отправить", host)
+		}
+	}
+	return parsed.String(), nil
+}
+
+// webhookDeniedPrefixes — адреса специального назначения из реестров IANA (IPv4 и IPv6 Special-Purpose
+// Address Registry) и multicast: loopback, частные сети, CGNAT, link-local, документация, бенчмарки,
+// зарезервированные. Вебхуки на них не отправляются.
+var webhookDeniedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.88.99.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("3fff::/20"),
+	netip.MustParsePrefix("5f00::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("fec0::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// webhookNAT64Prefix — общеизвестный префикс NAT64: такой адрес ведет на IPv4 из последних четырех байт.
+var webhookNAT64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// webhookIPAllowed отсекает адреса из webhookDeniedPrefixes; IPv4 внутри IPv6 (::ffff:a.b.c.d, NAT64)
+// проверяется как IPv4.
+func webhookIPAllowed(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	if webhookNAT64Prefix.Contains(addr) {
+		raw := addr.As16()
+		addr = netip.AddrFrom4([4]byte(raw[12:]))
+	}
+	for _, prefix := range webhookDeniedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookDialControl проверяет адрес перед каждым подключением: DNS мог смениться после
+// /webhooks add, а имя — начать указывать во внутреннюю сеть.
+func webhookDialControl(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !webhookIPAllowed(ip) {
+		return fmt.Errorf("адрес %s в локальной сети, отправка запрещена", host)
+	}
+	return nil
+}
+
+// newWebhookClient — HTTP-клиент вебхуков: без прокси из окружения (иначе проверка адреса
+// досталась бы прокси), без перехода по редиректам и с проверкой адреса при подключении.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: webhookDialControl}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// signWebhookPayload — подпись тела для заголовка X-Sleepbot-Signature: `sha256=<hex HMAC-SHA256>`.
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryDelay — пауза перед следующей попыткой после attempts неудачных.
+func webhookRetryDelay(attempts int) time.Duration {
+	return exponentialDelay(webhookFirstRetryDelay, webhookMaxRetryDelay, attempts)
+}
+
+// exponentialDelay удваивает first после каждой неудачной попытки, но не больше limit.
+func exponentialDelay(first time.Duration, limit time.Duration, attempts int) time.Duration {
+	delay := first
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+// postWebhook отправляет одну попытку и возвращает код ответа; не-2xx ответ — ошибка.
+func postWebhook(ctx context.Context, client *http.Client, delivery WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sleepbot-webhooks")
+	req.Header.Set("X-Sleepbot-Event", delivery.Event)
+	req.Header.Set("X-Sleepbot-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Sleepbot-Signature", signWebhookPayload(delivery.Secret, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("ответ %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookSender доставляет отправки из очереди webhook_deliveries с повторами.
+type webhookSender struct {
+	store  *Store
+	client *http.Client
+	now    func() time.Time
+}
+
+func newWebhookSender(store *Store) *webhookSender {
+	return &webhookSender{store: store, client: newWebhookClient(), now: time.Now}
+}
+
+func (s *webhookSender) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookTick)
+	defer ticker.Stop()
+
+	for {
+		if err := s.deliverDue(ctx); err != nil {
+			slog.Error("webhook delivery failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *webhookSender) deliverDue(ctx context.Context) error {
+	deliveries, err := s.store.ListDueWebhookDeliveries(ctx, s.now(), webhookBatchSize)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, webhookParallel)
+	for _, delivery := range deliveries {
+		slots <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-slots }()
+			if _, err := s.attempt(ctx, delivery); err != nil {
+				slog.Error("webhook attempt not saved", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID, "error", err)
+			}
+		})
+	}
+	wg.Wait()
+	return s.store.PruneWebhookDeliveries(ctx, s.now().Add(-webhookLogRetention))
+}
+
+// attempt делает одну попытку и сохраняет ее результат; возвращает обновленную отправку.
+func (s *webhookSender) attempt(ctx context.Context, delivery WebhookDelivery) (WebhookDelivery, error) {
+	code, err := postWebhook(ctx, s.client, delivery)
+	delivery = applyWebhookAttempt(delivery, code, err, s.now())
+	return delivery, s.store.RecordWebhookAttempt(ctx, delivery)
+}
+
+// applyWebhookAttempt учитывает результат попытки: успех — delivered, иначе следующая попытка
+// с экспоненциальной паузой или failed, если попытки кончились.
+func applyWebhookAttempt(delivery WebhookDelivery, code int, err error, now time.Time) WebhookDelivery {
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	if err == nil {
+		delivery.Status = webhookStatusDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return delivery
+	}
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= webhookMaxAttempts {
+		delivery.Status = webhookStatusFailed
+		return delivery
+	}
+	delivery.NextAttemptAt = now.Add(webhookRetryDelay(delivery.Attempts))
+	return delivery
+}
+
+func formatWebhookDelivery(delivery WebhookDelivery, now time.Time, loc *time.Location) string {
+	line := fmt.Sprintf("%s №%d `%s` → вебхук %d: ", formatLocalDateTime(delivery.CreatedAt, loc), delivery.ID, delivery.Event, delivery.WebhookID)
+	switch delivery.Status {
+	case webhookStatusDelivered:
+		line += fmt.Sprintf("доставлено (%d)", delivery.ResponseCode)
+	case webhookStatusFailed:
+		line += fmt.Sprintf("не доставлено за %d %s: %s", delivery.Attempts, ruPlural(delivery.Attempts, "попытку", "попытки", "попыток"), escapeTelegramMarkdown(delivery.LastError))
+	default:
+		if delivery.Attempts == 0 {
+			return line + "в очереди"
+		}
+		line += fmt.Sprintf("ошибка (%s), повтор через %s", escapeTelegramMarkdown(delivery.LastError), formatDurationRU(max(delivery.NextAttemptAt.Sub(now), time.Minute)))
+	}
+	return line
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPostWebhookSignsPayload(t *testing.T) {
+	delivery := WebhookDelivery{ID: 42, Event: webhookEventSleepStarted, Secret: "s3cret", Payload: []byte(`{"event":"sleep.started"}`)}
+	var gotSignature, gotEvent, gotDelivery string
+	var gotBody []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get("X-Sleepbot-Signature")
+		gotEvent = r.Header.Get("X-Sleepbot-Event")
+		gotDelivery = r.Header.Get("X-Sleepbot-Delivery")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	delivery.URL = receiver.URL
+
+	code, err := postWebhook(context.Background(), receiver.Client(), delivery)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("unexpected result %d %v", code, err)
+	}
+	if string(gotBody) != string(delivery.Payload) || gotEvent != webhookEventSleepStarted || gotDelivery != "42" {
+		t.Fatalf("unexpected request: body %s, event %q, delivery %q", gotBody, gotEvent, gotDelivery)
+	}
+	// printf '%s' '{"event":"sleep.started"}' | openssl dgst -sha256 -hmac s3cret
+	if want := "sha256=505023625b8df34fca843a47d7c1efc31eaf5645a92879ad4805ed11e3c6a01c"; gotSignature != want {
+		t.Fatalf("expected signature %q, got %q", want, gotSignature)
+	}
+}
+
+func TestPostWebhookFailsOnErrorStatus(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	code, err := postWebhook(context.Background(), receiver.Client(), WebhookDelivery{URL: receiver.URL, Payload: []byte(`{}`)})
+	if err == nil || code != http.StatusBadGateway {
+		t.Fatalf("expected error for 502, got %d %v", code, err)
+	}
+}
+
+func TestApplyWebhookAttemptBacksOff(t *testing.T) {
+	now := time.Date(2026, 3, 16, 10, 0, 0, 0, time.UTC)
+	delivery := WebhookDelivery{Status: webhookStatusPending}
+
+	delivery = applyWebhookAttempt(delivery, 500, errors.New("ответ 500"), now)
+	if delivery.Status != webhookStatusPending || !delivery.NextAttemptAt.Equal(now.Add(30*time.Second)) {
+		t.Fatalf("first failure should retry in 30s, got %+v", delivery)
+	}
+	delivery = applyWebhookAttempt(delivery, 0, errors.New("timeout"), now)
+	if !delivery.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("second failure should retry in 1m, got %v", delivery.NextAttemptAt)
+	}
+	if webhookRetryDelay(20) != webhookMaxRetryDelay {
+		t.Fatalf("delay should be capped, got %v", webhookRetryDelay(20))
+	}
+
+	delivered := applyWebhookAttempt(delivery, 200, nil, now)
+	if delivered.Status != webhookStatusDelivered || delivered.DeliveredAt == nil || delivered.LastError != "" {
+		t.Fatalf("unexpected delivered state %+v", delivered)
+	}
+
+	delivery.Attempts = webhookMaxAttempts - 1
+	if failed := applyWebhookAttempt(delivery, 500, errors.New("ответ 500"), now); failed.Status != webhookStatusFailed {
+		t.Fatalf("last attempt should fail the delivery, got %+v", failed)
+	}
+}
+
+// fakeResolver отдает заранее заданные адреса хостов вместо запроса к DNS.
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	var addrs []net.IPAddr
+	for _, ip := range r[host] {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	resolver := fakeResolver{
+		"example.com":    {"93.184.215.14", "2606:2800:21f:cb07:6820:80da:af6b:8b2c"},
+		"router.example": {"93.184.215.14", "192.168.1.1"},
+		"localhost":      {"127.0.0.1"},
+		"metadata":       {"169.254.169.254"},
+		"v6.local":       {"fe80::1"},
+		"mapped.example": {"::ffff:10.0.0.1"},
+	}
+	ctx := context.Background()
+	if got, err := validateWebhookURL(ctx, resolver, " https://example.com/hook?x=1 ", false); err != nil || got != "https://example.com/hook?x=1" {
+		t.Fatalf("unexpected result %q %v", got, err)
+	}
+	for _, raw := range []string{
+		"", "example.com/hook", "ftp://example.com", "https://", "http://example.com/hook",
+		"https://localhost/hook", "https://127.0.0.1:8080/hook", "https://[::1]/hook", "https://0.0.0.0/hook",
+		"https://10.1.2.3/hook", "https://router.example/hook", "https://metadata/latest", "https://v6.local/hook",
+		"https://mapped.example/hook", "https://unknown.example/hook",
+	} {
+		if _, err := validateWebhookURL(ctx, resolver, raw, false); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+	if _, err := validateWebhookURL(ctx, resolver, "http://example.com/hook", true); err != nil {
+		t.Fatalf("http should be allowed by the flag: %v", err)
+	}
+	if _, err := validateWebhookURL(ctx, resolver, "http://localhost/hook", true); err == nil {
+		t.Fatal("the http flag must not allow local addresses")
+	}
+}
+
+func TestWebhookIPAllowed(t *testing.T) {
+	denied := map[string][]string{
+		"0.0.0.0/8":       {"0.0.0.0", "0.1.2.3", "0.255.255.255"},
+		"10.0.0.0/8":      {"10.0.0.1", "10.255.255.255"},
+		"100.64.0.0/10":   {"100.64.0.0", "100.100.100.100", "100.127.255.255"},
+		"127.0.0.0/8":     {"127.0.0.1", "127.255.255.254"},
+		"169.254.0.0/16":  {"169.254.169.254"},
+		"172.16.0.0/12":   {"172.16.0.1", "172.31.255.255"},
+		"192.0.0.0/24":    {"192.0.0.8"},
+		"192.0.2.0/24":    {"192.0.2.1"},
+		"192.88.99.0/24":  {"192.88.99.1"},
+		"192.168.0.0/16":  {"192.168.1.1"},
+		"198.18.0.0/15":   {"198.18.0.1", "198.19.255.255"},
+		"198.51.100.0/24": {"198.51.100.7"},
+		"203.0.113.0/24":  {"203.0.113.9"},
+		"224.0.0.0/4":     {"224.0.0.1", "239.255.255.250"},
+		"240.0.0.0/4":     {"240.0.0.1", "255.255.255.255"},
+		"::/128":          {"::"},
+		"::1/128":         {"::1"},
+		"::ffff:0:0/96":   {"::ffff:10.0.0.1", "::ffff:127.0.0.1"},
+		"64:ff9b::/96":    {"64:ff9b::a00:1", "64:ff9b::7f00:1"},
+		"64:ff9b:1::/48":  {"64:ff9b:1::1"},
+		"100::/64":        {"100::1"},
+		"2001::/23":       {"2001::1", "2001:2::1", "2001:1ff::1"},
+		"2001:db8::/32":   {"2001:db8::1"},
+		"2002::/16":       {"2002:a00:1::1"},
+		"3fff::/20":       {"3fff::1"},
+		"5f00::/16":       {"5f00::1"},
+		"fc00::/7":        {"fc00::1", "fd12:3456::1"},
+		"fe80::/10":       {"fe80::1"},
+		"fec0::/10":       {"fec0::1"},
+		"ff00::/8":        {"ff02::1", "ff0e::1"},
+	}
+	for prefix, addrs := range denied {
+		for _, raw := range addrs {
+			if webhookIPAllowed(net.ParseIP(raw)) {
+				t.Fatalf("%s (%s) should be denied", raw, prefix)
+			}
+		}
+	}
+	for _, raw := range []string{
+		"1.1.1.1", "8.8.8.8", "93.184.215.14", "100.63.255.255", "100.128.0.0", "172.32.0.1", "192.0.3.1",
+		"198.17.255.255", "198.20.0.0", "223.255.255.255", "::ffff:8.8.8.8", "64:ff9b::808:808",
+		"2001:200::1", "2606:2800:21f:cb07:6820:80da:af6b:8b2c", "2a00:1450:4001::1",
+	} {
+		if !webhookIPAllowed(net.ParseIP(raw)) {
+			t.Fatalf("%s should be allowed", raw)
+		}
+	}
+	if webhookIPAllowed(nil) {
+		t.Fatal("an empty address should be denied")
+	}
+}
+
+func TestWebhookClientRefusesLocalAddresses(t *testing.T) {
+	hit := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer receiver.Close()
+
+	// Адрес мог пройти проверку при добавлении, а потом начать указывать на localhost.
+	_, err := postWebhook(context.Background(), newWebhookClient(), WebhookDelivery{URL: receiver.URL, Payload: []byte(`{}`)})
+	if err == nil || !strings.Contains(err.Error(), "локальной сети") || hit {
+		t.Fatalf("expected refused connection, got %v (request reached: %v)", err, hit)
+	}
+}
+
+func TestWebhookSenderRetriesFromQueue(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(100)
+	userCtx, err := h.store.GetUserContext(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("user context: %v", err)
+	}
+
+	type received struct {
+		body       string
+		signature  string
+		deliveryID string
+	}
+	var (
+		mu       sync.Mutex
+		requests []received
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, received{string(body), r.Header.Get("X-Sleepbot-Signature"), r.Header.Get("X-Sleepbot-Delivery")})
+		if len(requests) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	ctx := context.Background()
+	// Адрес в тесте локальный, поэтому вебхук добавляется в обход validateWebhookURL, а клиент — клиентом приемника.
+	if _, err := h.store.AddWebhook(ctx, userCtx.Family.ID, receiver.URL, "s3cret"); err != nil {
+		t.Fatalf("add webhook: %v", err)
+	}
+	sender := newWebhookSender(h.store)
+	sender.client = receiver.Client()
+	sender.now = h.clock.Now
+	emitWebhookEvent(ctx, h.store, userCtx.Family, userCtx.Child, &userCtx.Member, webhookEventSleepStarted, map[string]int{"id": 1})
+
+	stored := func() WebhookDelivery {
+		t.Helper()
+		deliveries, err := h.store.ListWebhookDeliveries(ctx, userCtx.Family.ID, webhookLogLimit)
+		if err != nil || len(deliveries) != 1 {
+			t.Fatalf("expected one delivery, got %d (%v)", len(deliveries), err)
+		}
+		return deliveries[0]
+	}
+
+	if err := sender.deliverDue(ctx); err != nil {
+		t.Fatalf("first delivery: %v", err)
+	}
+	failed := stored()
+	if failed.Status != webhookStatusPending || failed.Attempts != 1 || failed.ResponseCode != http.StatusInternalServerError ||
+		!failed.NextAttemptAt.Equal(h.clock.Now().Add(webhookFirstRetryDelay)) {
+		t.Fatalf("500 should be retried later, got %+v", failed)
+	}
+	// До срока повтора очередь не трогает отправку.
+	if err := sender.deliverDue(ctx); err != nil {
+		t.Fatalf("early delivery: %v", err)
+	}
+	mu.Lock()
+	early := len(requests)
+	mu.Unlock()
+	if early != 1 {
+		t.Fatalf("retry should wait, got %d requests", early)
+	}
+
+	h.clock.Advance(webhookFirstRetryDelay)
+	if err := sender.deliverDue(ctx); err != nil {
+		t.Fatalf("second delivery: %v", err)
+	}
+	delivered := stored()
+	if delivered.Status != webhookStatusDelivered || delivered.Attempts != 2 || delivered.ResponseCode != http.StatusOK ||
+		delivered.LastError != "" || delivered.DeliveredAt == nil || !delivered.DeliveredAt.Equal(h.clock.Now()) {
+		t.Fatalf("second attempt should be delivered, got %+v", delivered)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	first, second := requests[0], requests[1]
+	if first != second || first.body != string(delivered.Payload) || first.deliveryID != strconv.FormatInt(delivered.ID, 10) {
+		t.Fatalf("retry should repeat the same delivery: %+v vs %+v", first, second)
+	}
+	if first.signature != signWebhookPayload("s3cret", []byte(first.body)) || !strings.Contains(first.body, `"event":"sleep.started"`) {
+		t.Fatalf("unexpected signed body %+v", first)
+	}
+}
+
+func TestWebhookSenderSlowReceiverDoesNotBlockOthers(t *testing.T) {
+	h := newBotHarness(t)
+	h.onboard(100)
+	userCtx, err := h.store.GetUserContext(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("user context: %v", err)
+	}
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+
+	ctx := context.Background()
+	if _, err := h.store.AddWebhook(ctx, userCtx.Family.ID, slow.URL, "s"); err != nil {
+		t.Fatalf("add slow webhook: %v", err)
+	}
+	fastHook, err := h.store.AddWebhook(ctx, userCtx.Family.ID, fast.URL, "s")
+	if err != nil {
+		t.Fatalf("add fast webhook: %v", err)
+	}
+	sender := newWebhookSender(h.store)
+	sender.client = fast.Client()
+	sender.now = h.clock.Now
+	emitWebhookEvent(ctx, h.store, userCtx.Family, userCtx.Child, &userCtx.Member, webhookEventSleepStarted, map[string]int{"id": 1})
+
+	done := make(chan error, 1)
+	go func() { done <- sender.deliverDue(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := h.store.ListWebhookDeliveries(ctx, userCtx.Family.ID, webhookLogLimit)
+		if err != nil {
+			t.Fatalf("list deliveries: %v", err)
+		}
+		delivered := false
+		for _, delivery := range deliveries {
+			delivered = delivered || (delivery.WebhookID == fastHook.ID && delivery.Status == webhookStatusDelivered)
+		}
+		if delivered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("fast receiver should be delivered while the slow one is still answering")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("batch should still wait for the slow receiver, finished with %v", err)
+	default:
+	}
+
+	release <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+}